@@ -238,6 +238,8 @@ const (
 
 	REQUEST_RATE  = "request_rate"
 	REQUEST_TIMER = "request_timer"
+	SERVICE_TIMER = "service_timer"
+	PHASE_TIMER   = "phase_timer"
 )
 
 // please keep in sync with the mnemonics
@@ -308,6 +310,7 @@ var slowMetricsMap = map[time.Duration][]CounterId{
 var acctstore AccountingStore
 var counters []Counter = make([]Counter, len(metricNames))
 var requestTimer Timer
+var serviceTimer Timer
 
 // Use the give AccountingStore to create counters for all the metrics we are interested in:
 func RegisterMetrics(acctStore AccountingStore) {
@@ -318,6 +321,7 @@ func RegisterMetrics(acctStore AccountingStore) {
 	}
 
 	requestTimer = ms.Timer(REQUEST_TIMER)
+	serviceTimer = ms.Timer(SERVICE_TIMER)
 }
 
 // Record request metrics
@@ -354,6 +358,9 @@ func RecordMetrics(request_time, service_time, transaction_time time.Duration,
 	counters[WARNINGS].Inc(int64(warn_count))
 
 	requestTimer.Update(request_time)
+	serviceTimer.Update(service_time)
+	latency(REQUEST_LATENCY, statementLabel(stmt)).Update(request_time)
+	latency(SERVICE_LATENCY, statementLabel(stmt)).Update(service_time)
 
 	if prepared {
 		counters[PREPARED].Inc(1)
@@ -409,3 +416,81 @@ func UpdateCounter(id CounterId) {
 	}
 	counters[id].Inc(1)
 }
+
+// Help text for the metrics, by name
+var metricHelp = map[string]string{
+	_REQUESTS:  "Total number of requests",
+	_CANCELLED: "Total number of cancelled requests",
+
+	_UNBOUNDED: "Total number of requests with not_bounded scan consistency",
+	_AT_PLUS:   "Total number of requests with at_plus scan consistency",
+	_SCAN_PLUS: "Total number of requests with request_plus scan consistency",
+
+	_SELECTS: "Total number of successful SELECT requests",
+	_UPDATES: "Total number of successful UPDATE requests",
+	_INSERTS: "Total number of successful INSERT requests",
+	_DELETES: "Total number of successful DELETE requests",
+
+	_TRANSACTIONS: "Total number of transactions started",
+
+	_INDEX_SCANS:   "Total number of index scans",
+	_PRIMARY_SCANS: "Total number of primary index scans",
+
+	_ACTIVE_REQUESTS:  "Number of active requests",
+	_QUEUED_REQUESTS:  "Number of queued requests",
+	_INVALID_REQUESTS: "Total number of requests for unsupported endpoints",
+
+	_REQUEST_TIME:     "Total end to end time of requests, in nanoseconds",
+	_SERVICE_TIME:     "Total execution time of requests, in nanoseconds",
+	_TRANSACTION_TIME: "Total elapsed time of transactions, in nanoseconds",
+
+	_RESULT_COUNT: "Total number of results returned",
+	_RESULT_SIZE:  "Total size of results returned, in bytes",
+	_ERRORS:       "Total number of errors returned",
+	_WARNINGS:     "Total number of warnings returned",
+	_MUTATIONS:    "Total number of documents mutated",
+
+	_REQUESTS_250MS:  "Total number of requests taking longer than 250ms",
+	_REQUESTS_500MS:  "Total number of requests taking longer than 500ms",
+	_REQUESTS_1000MS: "Total number of requests taking longer than 1000ms",
+	_REQUESTS_5000MS: "Total number of requests taking longer than 5000ms",
+
+	PREPAREDS: "Total number of prepared statements executed",
+
+	_AUDIT_REQUESTS_TOTAL:    "Total number of audit requests",
+	_AUDIT_REQUESTS_FILTERED: "Total number of audit requests filtered out",
+	_AUDIT_ACTIONS:           "Total number of audit records sent",
+	_AUDIT_ACTIONS_FAILED:    "Total number of audit records that could not be sent",
+
+	REQUEST_RATE:  "Rate of requests",
+	REQUEST_TIMER: "End to end time of recent requests, in seconds",
+	SERVICE_TIMER: "Execution time of recent requests, in seconds",
+	PHASE_TIMER:   "Time spent by recent requests in each execution phase, in seconds",
+
+	REQUEST_LATENCY: "End to end time of requests by statement type, in seconds",
+	SERVICE_LATENCY: "Execution time of requests by statement type, in seconds",
+	PHASE_LATENCY:   "Time spent by requests in each execution phase, in seconds",
+}
+
+// The help text of a metric, or of the family of a labelled metric
+func MetricHelp(name string) string {
+	family, _, _ := MetricLabel(name)
+	return metricHelp[family]
+}
+
+// Labelled metrics are registered as <family>.<label value>:
+// returns the family, label name and label value of a metric name
+func MetricLabel(name string) (family, labelName, label string) {
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		return name, "", ""
+	}
+	family = name[:i]
+	switch family {
+	case PHASE_TIMER:
+		labelName = "phase"
+	default:
+		labelName = "label"
+	}
+	return family, labelName, name[i+1:]
+}
@@ -0,0 +1,203 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package accounting
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	atomic "github.com/couchbase/go-couchbase/platform"
+)
+
+// Latency distributions.
+//
+// Timers only keep a sample of recent values, which is good enough for
+// quantiles, but cannot produce the cumulative bucket counts of a Prometheus
+// histogram. Request and service times (labelled by statement type) and phase
+// times (labelled by phase) are therefore also counted in fixed buckets.
+
+const (
+	REQUEST_LATENCY = "request_time_seconds"
+	SERVICE_LATENCY = "service_time_seconds"
+	PHASE_LATENCY   = "phase_time_seconds"
+)
+
+// upper bounds of the buckets, the last bucket being +Inf
+var latencyBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	60 * time.Second,
+}
+
+// LatencyHistogram counts durations in fixed buckets
+type LatencyHistogram struct {
+	counts []atomic.AlignedUint64 // one per bound, plus +Inf
+	sum    atomic.AlignedUint64   // in nanoseconds
+}
+
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{counts: make([]atomic.AlignedUint64, len(latencyBounds)+1)}
+}
+
+// Count a duration
+func (this *LatencyHistogram) Update(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := sort.Search(len(latencyBounds), func(i int) bool { return d <= latencyBounds[i] })
+	atomic.AddUint64(&this.counts[i], 1)
+	atomic.AddUint64(&this.sum, uint64(d))
+}
+
+// The upper bounds of the buckets, in seconds, excluding +Inf
+func (this *LatencyHistogram) Bounds() []float64 {
+	rv := make([]float64, len(latencyBounds))
+	for i, b := range latencyBounds {
+		rv[i] = b.Seconds()
+	}
+	return rv
+}
+
+// The cumulative counts of the buckets, the last one being the +Inf bucket
+func (this *LatencyHistogram) Buckets() []uint64 {
+	rv := make([]uint64, len(this.counts))
+	var total uint64
+	for i := range this.counts {
+		total += atomic.LoadUint64(&this.counts[i])
+		rv[i] = total
+	}
+	return rv
+}
+
+// The number of durations counted
+func (this *LatencyHistogram) Count() uint64 {
+	var total uint64
+	for i := range this.counts {
+		total += atomic.LoadUint64(&this.counts[i])
+	}
+	return total
+}
+
+// The sum of all durations counted
+func (this *LatencyHistogram) Sum() time.Duration {
+	return time.Duration(atomic.LoadUint64(&this.sum))
+}
+
+// the histograms by latency name and label value
+var latencies = map[string]map[string]*LatencyHistogram{
+	REQUEST_LATENCY: {},
+	SERVICE_LATENCY: {},
+	PHASE_LATENCY:   {},
+}
+var latencyLabels = map[string]string{
+	REQUEST_LATENCY: "statement",
+	SERVICE_LATENCY: "statement",
+	PHASE_LATENCY:   "phase",
+}
+var latenciesLock sync.RWMutex
+
+// phase timers are registered as phase_timer.<phase>
+var phaseTimers = map[string]Timer{}
+
+func phaseTimer(phase string) Timer {
+	latenciesLock.RLock()
+	t := phaseTimers[phase]
+	latenciesLock.RUnlock()
+	if t != nil {
+		return t
+	}
+
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	t = phaseTimers[phase]
+	if t == nil {
+		t = acctstore.MetricRegistry().Timer(PHASE_TIMER + "." + phase)
+		phaseTimers[phase] = t
+	}
+	return t
+}
+
+func latency(name, label string) *LatencyHistogram {
+	latenciesLock.RLock()
+	h := latencies[name][label]
+	latenciesLock.RUnlock()
+	if h != nil {
+		return h
+	}
+
+	latenciesLock.Lock()
+	defer latenciesLock.Unlock()
+	h = latencies[name][label]
+	if h == nil {
+		h = NewLatencyHistogram()
+		latencies[name][label] = h
+	}
+	return h
+}
+
+// statement types are a small, fixed set, so they make for a safe label
+func statementLabel(stmt string) string {
+	if stmt == "" {
+		return "other"
+	}
+	return strings.ToLower(stmt)
+}
+
+// Record the time spent in an execution phase by a request
+func RecordPhaseTime(phase string, phaseTime time.Duration) {
+	if acctstore == nil {
+		return
+	}
+	latency(PHASE_LATENCY, phase).Update(phaseTime)
+	phaseTimer(phase).Update(phaseTime)
+}
+
+// Call f for every latency histogram, in name and label order
+func LatenciesForeach(f func(name, labelName, label string, h *LatencyHistogram)) {
+	latenciesLock.RLock()
+	names := make([]string, 0, len(latencies))
+	for name := range latencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	type entry struct {
+		name  string
+		label string
+		h     *LatencyHistogram
+	}
+	var entries []entry
+	for _, name := range names {
+		labels := make([]string, 0, len(latencies[name]))
+		for label := range latencies[name] {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			entries = append(entries, entry{name, label, latencies[name][label]})
+		}
+	}
+	latenciesLock.RUnlock()
+
+	for _, e := range entries {
+		f(e.name, latencyLabels[e.name], e.label, e.h)
+	}
+}
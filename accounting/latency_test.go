@@ -0,0 +1,60 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package accounting
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := NewLatencyHistogram()
+	h.Update(500 * time.Microsecond)
+	h.Update(time.Millisecond)
+	h.Update(3 * time.Millisecond)
+	h.Update(2 * time.Minute)
+
+	if h.Count() != 4 {
+		t.Fatalf("Expected 4 durations, got %v", h.Count())
+	}
+	if h.Sum() != 2*time.Minute+4500*time.Microsecond {
+		t.Fatalf("Unexpected sum %v", h.Sum())
+	}
+
+	bounds := h.Bounds()
+	buckets := h.Buckets()
+	if len(buckets) != len(bounds)+1 {
+		t.Fatalf("Expected %v buckets, got %v", len(bounds)+1, len(buckets))
+	}
+
+	// bounds are inclusive, and counts cumulative
+	if bounds[0] != 0.001 || buckets[0] != 2 {
+		t.Fatalf("Expected 2 durations up to %v, got %v", bounds[0], buckets[0])
+	}
+	if bounds[1] != 0.005 || buckets[1] != 3 {
+		t.Fatalf("Expected 3 durations up to %v, got %v", bounds[1], buckets[1])
+	}
+	if buckets[len(bounds)-1] != 3 || buckets[len(bounds)] != 4 {
+		t.Fatalf("Expected only the +Inf bucket to count all durations, got %v", buckets)
+	}
+}
+
+func TestMetricLabel(t *testing.T) {
+	family, labelName, label := MetricLabel(PHASE_TIMER + ".fetch")
+	if family != PHASE_TIMER || labelName != "phase" || label != "fetch" {
+		t.Fatalf("Unexpected family %v, label %v=%v", family, labelName, label)
+	}
+	family, labelName, _ = MetricLabel(REQUEST_TIMER)
+	if family != REQUEST_TIMER || labelName != "" {
+		t.Fatalf("Unexpected family %v, label name %v", family, labelName)
+	}
+	if MetricHelp(PHASE_TIMER+".fetch") == "" {
+		t.Fatalf("Expected help text for phase timers")
+	}
+}
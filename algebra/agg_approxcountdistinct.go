@@ -0,0 +1,159 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+/*
+This represents the Aggregate function APPROX_COUNT_DISTINCT(expr).
+It returns an estimate of the number of distinct non-NULL,
+non-MISSING values in the group, computed with a HyperLogLog
+sketch in fixed memory rather than by collecting the values.
+Type ApproxCountDistinct is a struct that inherits from AggregateBase.
+*/
+type ApproxCountDistinct struct {
+	AggregateBase
+}
+
+/*
+The function NewApproxCountDistinct calls NewAggregateBase to
+create an aggregate function named approx_count_distinct with
+one expression as input.
+*/
+func NewApproxCountDistinct(operands expression.Expressions, flags uint32, filter expression.Expression, wTerm *WindowTerm) Aggregate {
+	rv := &ApproxCountDistinct{
+		*NewAggregateBase("approx_count_distinct", operands, flags, filter, wTerm),
+	}
+
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+It calls the VisitFunction method by passing in the receiver to
+and returns the interface. It is a visitor pattern.
+*/
+func (this *ApproxCountDistinct) Accept(visitor expression.Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+/*
+It returns a value of type NUMBER.
+*/
+func (this *ApproxCountDistinct) Type() value.Type { return value.NUMBER }
+
+/*
+Calls the evaluate method for aggregate functions and passes in the
+receiver, current item and current context.
+*/
+func (this *ApproxCountDistinct) Evaluate(item value.Value, context expression.Context) (value.Value, error) {
+	return this.evaluate(this, item, context)
+}
+
+/*
+The constructor returns a NewApproxCountDistinct with the input operand
+cast to a Function as the FunctionConstructor.
+*/
+func (this *ApproxCountDistinct) Constructor() expression.FunctionConstructor {
+	return func(operands ...expression.Expression) expression.Function {
+		return NewApproxCountDistinct(operands, uint32(0), nil, nil)
+	}
+}
+
+/*
+Copy of the aggregate function
+*/
+
+func (this *ApproxCountDistinct) Copy() expression.Expression {
+	rv := &ApproxCountDistinct{
+		*NewAggregateBase(this.Name(), expression.CopyExpressions(this.Operands()),
+			this.Flags(), expression.Copy(this.Filter()), CopyWindowTerm(this.WindowTerm())),
+	}
+
+	rv.BaseCopy(this)
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+If no input to the ApproxCountDistinct function, then the default value
+returned is a zero value.
+*/
+func (this *ApproxCountDistinct) Default(item value.Value, context Context) (value.Value, error) {
+	return value.ZERO_VALUE, nil
+}
+
+/*
+Aggregates input data by evaluating operands. For missing and
+null values return the input value itself. Otherwise add the
+hash of the value to the sketch.
+*/
+func (this *ApproxCountDistinct) CumulateInitial(item, cumulative value.Value, context Context) (value.Value, error) {
+	// apply filter if any
+	if ok, e := this.evaluateFilter(item, context); e != nil || !ok {
+		return cumulative, e
+	}
+
+	item, e := this.Operands()[0].Evaluate(item, context)
+	if e != nil {
+		return nil, e
+	}
+
+	if item.Type() <= value.NULL {
+		return cumulative, nil
+	}
+
+	bytes, e := item.MarshalJSON()
+	if e != nil {
+		return nil, e
+	}
+
+	hll := getHyperLogLog(cumulative)
+	if hll == nil {
+		hll = util.NewHyperLogLog(util.HLL_PRECISION)
+	}
+	hll.Add(bytes)
+	return setSketch(cumulative, "hll", hll), nil
+}
+
+/*
+Aggregates intermediate results by merging the sketches.
+*/
+func (this *ApproxCountDistinct) CumulateIntermediate(part, cumulative value.Value, context Context) (value.Value, error) {
+	pHll := getHyperLogLog(part)
+	if pHll == nil {
+		return cumulative, nil
+	}
+	cHll := getHyperLogLog(cumulative)
+	if cHll == nil {
+		return part, nil
+	}
+
+	e := cHll.Merge(pHll)
+	if e != nil {
+		return nil, e
+	}
+	return cumulative, nil
+}
+
+/*
+Compute the Final. Return the estimate from the sketch, or zero
+if there were no values.
+*/
+func (this *ApproxCountDistinct) ComputeFinal(cumulative value.Value, context Context) (value.Value, error) {
+	hll := getHyperLogLog(cumulative)
+	if hll == nil {
+		return value.ZERO_VALUE, nil
+	}
+	return value.NewValue(int64(hll.Count())), nil
+}
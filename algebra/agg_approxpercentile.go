@@ -0,0 +1,166 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+/*
+This represents the Aggregate function APPROX_PERCENTILE(expr, fraction).
+It returns an estimate of the value that would fall at the given fraction
+of the ordered number values in the group, as PERCENTILE_CONT() does,
+computed with a t-digest sketch in bounded memory rather than by
+collecting and sorting the values.
+Type ApproxPercentile is a struct that inherits from AggregateBase.
+*/
+type ApproxPercentile struct {
+	AggregateBase
+}
+
+/*
+The function NewApproxPercentile calls NewAggregateBase to
+create an aggregate function named approx_percentile with
+the expression and the fraction as input.
+*/
+func NewApproxPercentile(operands expression.Expressions, flags uint32, filter expression.Expression, wTerm *WindowTerm) Aggregate {
+	rv := &ApproxPercentile{
+		*NewAggregateBase("approx_percentile", operands, flags, filter, wTerm),
+	}
+
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+It calls the VisitFunction method by passing in the receiver to
+and returns the interface. It is a visitor pattern.
+*/
+func (this *ApproxPercentile) Accept(visitor expression.Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+/*
+It returns a value of type NUMBER.
+*/
+func (this *ApproxPercentile) Type() value.Type { return value.NUMBER }
+
+/*
+Calls the evaluate method for aggregate functions and passes in the
+receiver, current item and current context.
+*/
+func (this *ApproxPercentile) Evaluate(item value.Value, context expression.Context) (value.Value, error) {
+	return this.evaluate(this, item, context)
+}
+
+/*
+The constructor returns a NewApproxPercentile with the input operands
+cast to a Function as the FunctionConstructor.
+*/
+func (this *ApproxPercentile) Constructor() expression.FunctionConstructor {
+	return func(operands ...expression.Expression) expression.Function {
+		return NewApproxPercentile(operands, uint32(0), nil, nil)
+	}
+}
+
+/*
+Copy of the aggregate function
+*/
+
+func (this *ApproxPercentile) Copy() expression.Expression {
+	rv := &ApproxPercentile{
+		*NewAggregateBase(this.Name(), expression.CopyExpressions(this.Operands()),
+			this.Flags(), expression.Copy(this.Filter()), CopyWindowTerm(this.WindowTerm())),
+	}
+
+	rv.BaseCopy(this)
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+Minimum input arguments required is 2.
+*/
+func (this *ApproxPercentile) MinArgs() int { return 2 }
+
+/*
+Maximum number of input arguments allowed is 2.
+*/
+func (this *ApproxPercentile) MaxArgs() int { return 2 }
+
+/*
+If no input to the ApproxPercentile function, then the default value
+returned is a null.
+*/
+func (this *ApproxPercentile) Default(item value.Value, context Context) (value.Value, error) {
+	return value.NULL_VALUE, nil
+}
+
+/*
+Aggregates input data by evaluating the first operand.
+For all values other than Number, return the input value itself.
+Otherwise add the value to the sketch.
+*/
+func (this *ApproxPercentile) CumulateInitial(item, cumulative value.Value, context Context) (value.Value, error) {
+	// apply filter if any
+	if ok, e := this.evaluateFilter(item, context); e != nil || !ok {
+		return cumulative, e
+	}
+
+	item, e := this.Operands()[0].Evaluate(item, context)
+	if e != nil {
+		return nil, e
+	}
+
+	if item.Type() != value.NUMBER {
+		return cumulative, nil
+	}
+
+	digest := getTDigest(cumulative)
+	if digest == nil {
+		digest = util.NewTDigest(util.TDIGEST_COMPRESSION)
+	}
+	digest.Add(item.(value.NumberValue).Float64())
+	return setSketch(cumulative, "tdigest", digest), nil
+}
+
+/*
+Aggregates intermediate results by merging the sketches.
+*/
+func (this *ApproxPercentile) CumulateIntermediate(part, cumulative value.Value, context Context) (value.Value, error) {
+	pDigest := getTDigest(part)
+	if pDigest == nil {
+		return cumulative, nil
+	}
+	cDigest := getTDigest(cumulative)
+	if cDigest == nil {
+		return part, nil
+	}
+
+	cDigest.Merge(pDigest)
+	return cumulative, nil
+}
+
+/*
+Compute the Final. Return NULL if no values of type NUMBER exist.
+*/
+func (this *ApproxPercentile) ComputeFinal(cumulative value.Value, context Context) (value.Value, error) {
+	fraction, e := percentileFraction(this, context)
+	if e != nil {
+		return nil, e
+	}
+
+	digest := getTDigest(cumulative)
+	if digest == nil || digest.Count() == 0 {
+		return value.NULL_VALUE, nil
+	}
+	return value.NewValue(digest.Quantile(fraction)), nil
+}
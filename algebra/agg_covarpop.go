@@ -0,0 +1,129 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+/*
+This represents the Aggregate function COVAR_POP(y, x). It returns
+the population covariance of the pairs of number values in the group.
+Type CovarPop is a struct that inherits from AggregateBase.
+*/
+type CovarPop struct {
+	AggregateBase
+}
+
+/*
+The function NewCovarPop calls NewAggregateBase to
+create an aggregate function named covar_pop with
+two expressions as input.
+*/
+func NewCovarPop(operands expression.Expressions, flags uint32, filter expression.Expression, wTerm *WindowTerm) Aggregate {
+	rv := &CovarPop{
+		*NewAggregateBase("covar_pop", operands, flags, filter, wTerm),
+	}
+
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+It calls the VisitFunction method by passing in the receiver to
+and returns the interface. It is a visitor pattern.
+*/
+func (this *CovarPop) Accept(visitor expression.Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+/*
+It returns a value of type NUMBER.
+*/
+func (this *CovarPop) Type() value.Type { return value.NUMBER }
+
+/*
+Calls the evaluate method for aggregate functions and passes in the
+receiver, current item and current context.
+*/
+func (this *CovarPop) Evaluate(item value.Value, context expression.Context) (value.Value, error) {
+	return this.evaluate(this, item, context)
+}
+
+/*
+The constructor returns a NewCovarPop with the input operands
+cast to a Function as the FunctionConstructor.
+*/
+func (this *CovarPop) Constructor() expression.FunctionConstructor {
+	return func(operands ...expression.Expression) expression.Function {
+		return NewCovarPop(operands, uint32(0), nil, nil)
+	}
+}
+
+/*
+Copy of the aggregate function
+*/
+
+func (this *CovarPop) Copy() expression.Expression {
+	rv := &CovarPop{
+		*NewAggregateBase(this.Name(), expression.CopyExpressions(this.Operands()),
+			this.Flags(), expression.Copy(this.Filter()), CopyWindowTerm(this.WindowTerm())),
+	}
+
+	rv.BaseCopy(this)
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+Minimum input arguments required is 2.
+*/
+func (this *CovarPop) MinArgs() int { return 2 }
+
+/*
+Maximum number of input arguments allowed is 2.
+*/
+func (this *CovarPop) MaxArgs() int { return 2 }
+
+/*
+If no input to the CovarPop function, then the default value
+returned is a null.
+*/
+func (this *CovarPop) Default(item value.Value, context Context) (value.Value, error) {
+	return value.NULL_VALUE, nil
+}
+
+/*
+Aggregates input data by evaluating operands. Pairs where
+either value is not a NUMBER are ignored.
+Call addBivariate to compute the intermediate aggregate value and return it.
+*/
+func (this *CovarPop) CumulateInitial(item, cumulative value.Value, context Context) (value.Value, error) {
+	// apply filter if any
+	if ok, e := this.evaluateFilter(item, context); e != nil || !ok {
+		return cumulative, e
+	}
+
+	return addBivariate(this.Operands(), item, cumulative, context)
+}
+
+/*
+Aggregates intermediate results and return them.
+*/
+func (this *CovarPop) CumulateIntermediate(part, cumulative value.Value, context Context) (value.Value, error) {
+	return cumulateBivariate(part, cumulative)
+}
+
+/*
+Compute the final result from the bivariate statistics of the pairs.
+*/
+func (this *CovarPop) ComputeFinal(cumulative value.Value, context Context) (value.Value, error) {
+	return computeBivariate(this.Name(), cumulative), nil
+}
@@ -0,0 +1,167 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"math"
+
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+/*
+This represents the Aggregate function
+PERCENTILE_CONT(fraction) WITHIN GROUP (ORDER BY expr [ASC|DESC]).
+It returns the value that would fall at the given fraction of the
+ordered number values in the group, interpolating linearly between
+the two closest values.
+The ORDER BY expression is the first operand, the fraction the second.
+Type PercentileCont is a struct that inherits from AggregateBase.
+*/
+type PercentileCont struct {
+	AggregateBase
+}
+
+/*
+The function NewPercentileCont calls NewAggregateBase to
+create an aggregate function named percentile_cont with
+the ORDER BY expression and the fraction as input.
+*/
+func NewPercentileCont(operands expression.Expressions, flags uint32, filter expression.Expression, wTerm *WindowTerm) Aggregate {
+	rv := &PercentileCont{
+		*NewAggregateBase("percentile_cont", operands, flags, filter, wTerm),
+	}
+
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+It calls the VisitFunction method by passing in the receiver to
+and returns the interface. It is a visitor pattern.
+*/
+func (this *PercentileCont) Accept(visitor expression.Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+/*
+It returns a value of type NUMBER.
+*/
+func (this *PercentileCont) Type() value.Type { return value.NUMBER }
+
+/*
+Calls the evaluate method for aggregate functions and passes in the
+receiver, current item and current context.
+*/
+func (this *PercentileCont) Evaluate(item value.Value, context expression.Context) (value.Value, error) {
+	return this.evaluate(this, item, context)
+}
+
+/*
+The constructor returns a NewPercentileCont with the input operand
+cast to a Function as the FunctionConstructor.
+*/
+func (this *PercentileCont) Constructor() expression.FunctionConstructor {
+	return func(operands ...expression.Expression) expression.Function {
+		return NewPercentileCont(operands, uint32(0), nil, nil)
+	}
+}
+
+/*
+Copy of the aggregate function
+*/
+
+func (this *PercentileCont) Copy() expression.Expression {
+	rv := &PercentileCont{
+		*NewAggregateBase(this.Name(), expression.CopyExpressions(this.Operands()),
+			this.Flags(), expression.Copy(this.Filter()), CopyWindowTerm(this.WindowTerm())),
+	}
+
+	rv.BaseCopy(this)
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+Minimum input arguments required is 2.
+*/
+func (this *PercentileCont) MinArgs() int { return 2 }
+
+/*
+Maximum number of input arguments allowed is 2.
+*/
+func (this *PercentileCont) MaxArgs() int { return 2 }
+
+/*
+If no input to the PercentileCont function, then the default value
+returned is a null.
+*/
+func (this *PercentileCont) Default(item value.Value, context Context) (value.Value, error) {
+	return value.NULL_VALUE, nil
+}
+
+/*
+Aggregates input data by evaluating the ORDER BY expression.
+For all values other than Number, return the input value itself.
+Call listAdd to collect the values as the intermediate aggregate value
+and return it.
+*/
+func (this *PercentileCont) CumulateInitial(item, cumulative value.Value, context Context) (value.Value, error) {
+	// apply filter if any
+	if ok, e := this.evaluateFilter(item, context); e != nil || !ok {
+		return cumulative, e
+	}
+
+	item, e := this.Operands()[0].Evaluate(item, context)
+	if e != nil {
+		return nil, e
+	}
+
+	if item.Type() != value.NUMBER {
+		return cumulative, nil
+	}
+
+	return listAdd(item, cumulative), nil
+}
+
+/*
+Aggregates intermediate results and return them.
+*/
+func (this *PercentileCont) CumulateIntermediate(part, cumulative value.Value, context Context) (value.Value, error) {
+	return cumulateOptionalLists(part, cumulative)
+}
+
+/*
+Compute the Final. Return NULL if no values of type NUMBER exist.
+The fraction f falls at position f * (n - 1) of the n ordered values:
+interpolate between the values on either side.
+*/
+func (this *PercentileCont) ComputeFinal(cumulative value.Value, context Context) (value.Value, error) {
+	fraction, e := percentileFraction(this, context)
+	if e != nil {
+		return nil, e
+	}
+
+	vals := listValues(cumulative)
+	if len(vals) == 0 {
+		return value.NULL_VALUE, nil
+	}
+
+	vals = sortValues(vals, this.HasFlags(AGGREGATE_DESCENDING))
+	pos := fraction * float64(len(vals)-1)
+	lower := math.Floor(pos)
+	upper := math.Ceil(pos)
+	if lower == upper {
+		return vals[int(lower)], nil
+	}
+
+	lowerVal := vals[int(lower)].(value.NumberValue).Float64()
+	upperVal := vals[int(upper)].(value.NumberValue).Float64()
+	return value.NewValue(lowerVal + (pos-lower)*(upperVal-lowerVal)), nil
+}
@@ -0,0 +1,160 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"math"
+
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+/*
+This represents the Aggregate function
+PERCENTILE_DISC(fraction) WITHIN GROUP (ORDER BY expr [ASC|DESC]).
+It returns the first of the ordered non-NULL values in the group
+whose cumulative distribution is at least the given fraction.
+The ORDER BY expression is the first operand, the fraction the second.
+Type PercentileDisc is a struct that inherits from AggregateBase.
+*/
+type PercentileDisc struct {
+	AggregateBase
+}
+
+/*
+The function NewPercentileDisc calls NewAggregateBase to
+create an aggregate function named percentile_disc with
+the ORDER BY expression and the fraction as input.
+*/
+func NewPercentileDisc(operands expression.Expressions, flags uint32, filter expression.Expression, wTerm *WindowTerm) Aggregate {
+	rv := &PercentileDisc{
+		*NewAggregateBase("percentile_disc", operands, flags, filter, wTerm),
+	}
+
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+It calls the VisitFunction method by passing in the receiver to
+and returns the interface. It is a visitor pattern.
+*/
+func (this *PercentileDisc) Accept(visitor expression.Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+/*
+It returns a value of type JSON.
+*/
+func (this *PercentileDisc) Type() value.Type { return value.JSON }
+
+/*
+Calls the evaluate method for aggregate functions and passes in the
+receiver, current item and current context.
+*/
+func (this *PercentileDisc) Evaluate(item value.Value, context expression.Context) (value.Value, error) {
+	return this.evaluate(this, item, context)
+}
+
+/*
+The constructor returns a NewPercentileDisc with the input operand
+cast to a Function as the FunctionConstructor.
+*/
+func (this *PercentileDisc) Constructor() expression.FunctionConstructor {
+	return func(operands ...expression.Expression) expression.Function {
+		return NewPercentileDisc(operands, uint32(0), nil, nil)
+	}
+}
+
+/*
+Copy of the aggregate function
+*/
+
+func (this *PercentileDisc) Copy() expression.Expression {
+	rv := &PercentileDisc{
+		*NewAggregateBase(this.Name(), expression.CopyExpressions(this.Operands()),
+			this.Flags(), expression.Copy(this.Filter()), CopyWindowTerm(this.WindowTerm())),
+	}
+
+	rv.BaseCopy(this)
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+Minimum input arguments required is 2.
+*/
+func (this *PercentileDisc) MinArgs() int { return 2 }
+
+/*
+Maximum number of input arguments allowed is 2.
+*/
+func (this *PercentileDisc) MaxArgs() int { return 2 }
+
+/*
+If no input to the PercentileDisc function, then the default value
+returned is a null.
+*/
+func (this *PercentileDisc) Default(item value.Value, context Context) (value.Value, error) {
+	return value.NULL_VALUE, nil
+}
+
+/*
+Aggregates input data by evaluating the ORDER BY expression.
+NULL and MISSING values are ignored.
+Call listAdd to collect the values as the intermediate aggregate value
+and return it.
+*/
+func (this *PercentileDisc) CumulateInitial(item, cumulative value.Value, context Context) (value.Value, error) {
+	// apply filter if any
+	if ok, e := this.evaluateFilter(item, context); e != nil || !ok {
+		return cumulative, e
+	}
+
+	item, e := this.Operands()[0].Evaluate(item, context)
+	if e != nil {
+		return nil, e
+	}
+
+	if item.Type() <= value.NULL {
+		return cumulative, nil
+	}
+
+	return listAdd(item, cumulative), nil
+}
+
+/*
+Aggregates intermediate results and return them.
+*/
+func (this *PercentileDisc) CumulateIntermediate(part, cumulative value.Value, context Context) (value.Value, error) {
+	return cumulateOptionalLists(part, cumulative)
+}
+
+/*
+Compute the Final. Return NULL if no values exist, otherwise
+return the value at position ceil(f * n) of the n ordered values.
+*/
+func (this *PercentileDisc) ComputeFinal(cumulative value.Value, context Context) (value.Value, error) {
+	fraction, e := percentileFraction(this, context)
+	if e != nil {
+		return nil, e
+	}
+
+	vals := listValues(cumulative)
+	if len(vals) == 0 {
+		return value.NULL_VALUE, nil
+	}
+
+	vals = sortValues(vals, this.HasFlags(AGGREGATE_DESCENDING))
+	pos := int(math.Ceil(fraction * float64(len(vals))))
+	if pos > 0 {
+		pos--
+	}
+	return vals[pos], nil
+}
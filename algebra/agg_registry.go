@@ -44,6 +44,9 @@ const (
 	AGGREGATE_IGNORENULLS
 	AGGREGATE_FROMFIRST
 	AGGREGATE_FROMLAST
+	AGGREGATE_DESCENDING
+	AGGREGATE_OVERFLOW_TRUNCATE
+	AGGREGATE_OVERFLOW_NOCOUNT
 )
 
 /*
@@ -66,14 +69,22 @@ const (
 	AGGREGATE_WINDOW_FROMLAST
 	AGGREGATE_WINDOW_2ND_POSINT
 	AGGREGATE_WINDOW_2ND_DYNAMIC
+	AGGREGATE_WITHIN_GROUP
+	AGGREGATE_FRACTION
+	AGGREGATE_ORDER_BY
+	AGGREGATE_OVERFLOW
 )
 
 /*
- Grouped Aggregate properties.
+Grouped Aggregate properties.
 */
 const (
 	AGGREGATE_ALLOWS_ALL             = AGGREGATE_ALLOWS_REGULAR | AGGREGATE_ALLOWS_DISTINCT | AGGREGATE_ALLOWS_WINDOW | AGGREGATE_ALLOWS_WINDOW_FRAME | AGGREGATE_ALLOWS_FILTER
 	AGGREGATE_ALLOWS_ALL_INCREMENTAL = AGGREGATE_ALLOWS_ALL | AGGREGATE_ALLOWS_INCREMENTAL
+	AGGREGATE_ALLOWS_ALL_NODISTINCT  = AGGREGATE_ALLOWS_ALL &^ AGGREGATE_ALLOWS_DISTINCT
+	AGGREGATE_ALLOWS_FRACTION        = AGGREGATE_ALLOWS_ALL_NODISTINCT | AGGREGATE_FRACTION
+	AGGREGATE_ALLOWS_PERCENTILE      = AGGREGATE_ALLOWS_FRACTION | AGGREGATE_WITHIN_GROUP
+	AGGREGATE_ALLOWS_STRING_AGG      = AGGREGATE_ALLOWS_ALL | AGGREGATE_ORDER_BY | AGGREGATE_OVERFLOW
 	AGGREGATE_WINDOW_RANK            = AGGREGATE_ALLOWS_WINDOW | AGGREGATE_ALLOWS_INCREMENTAL | AGGREGATE_WINDOW_ORDER
 	AGGREGATE_ROW_NUMBER             = AGGREGATE_ALLOWS_WINDOW | AGGREGATE_ALLOWS_INCREMENTAL | AGGREGATE_WINDOW_RELEASE_CURRENTROW
 	AGGREGATE_ALLOWS_FL              = AGGREGATE_ALLOWS_WINDOW | AGGREGATE_ALLOWS_WINDOW_FRAME | AGGREGATE_WINDOW_RESPECTNULLS | AGGREGATE_WINDOW_IGNORENULLS
@@ -116,33 +127,52 @@ Aggregate functions. The variable represents a map from string to Aggregate Func
 */
 
 var _AGGREGATES = map[string]*AggregateRegistry{
-	"array_agg":       &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &ArrayAgg{}},
-	"avg":             &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Avg{}},
-	"count":           &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Count{}},
-	"countn":          &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Countn{}},
-	"max":             &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Max{}},
-	"mean":            &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Avg{}},
-	"median":          &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Median{}},
-	"min":             &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Min{}},
-	"stddev":          &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Stddev{}},
-	"stddev_pop":      &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &StddevPop{}},
-	"stddev_samp":     &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &StddevSamp{}},
-	"sum":             &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Sum{}},
-	"variance":        &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Variance{}},
-	"var_pop":         &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &VarPop{}},
-	"variance_pop":    &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &VarPop{}},
-	"var_samp":        &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &VarSamp{}},
-	"variance_samp":   &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &VarSamp{}},
-	"row_number":      &AggregateRegistry{property: AGGREGATE_ROW_NUMBER, agg: &RowNumber{}},
-	"rank":            &AggregateRegistry{property: AGGREGATE_WINDOW_RANK | AGGREGATE_WINDOW_RELEASE_CURRENTROW, agg: &Rank{}},
-	"dense_rank":      &AggregateRegistry{property: AGGREGATE_WINDOW_RANK | AGGREGATE_WINDOW_RELEASE_CURRENTROW, agg: &DenseRank{}},
-	"percent_rank":    &AggregateRegistry{property: AGGREGATE_WINDOW_RANK, agg: &PercentRank{}},
-	"cume_dist":       &AggregateRegistry{property: AGGREGATE_WINDOW_RANK, agg: &CumeDist{}},
-	"ratio_to_report": &AggregateRegistry{property: AGGREGATE_ALLOWS_WINDOW | AGGREGATE_ALLOWS_WINDOW_FRAME, agg: &RatioToReport{}},
-	"ntile":           &AggregateRegistry{property: AGGREGATE_ALLOWS_WINDOW | AGGREGATE_WINDOW_ORDER, agg: &Ntile{}},
-	"first_value":     &AggregateRegistry{property: AGGREGATE_ALLOWS_FL, agg: &FirstValue{}},
-	"last_value":      &AggregateRegistry{property: AGGREGATE_ALLOWS_FL, agg: &LastValue{}},
-	"nth_value":       &AggregateRegistry{property: AGGREGATE_ALLOWS_NTH, agg: &NthValue{}},
-	"lag":             &AggregateRegistry{property: AGGREGATE_ALLOWS_LAGLEAD, agg: &Lag{}},
-	"lead":            &AggregateRegistry{property: AGGREGATE_ALLOWS_LAGLEAD, agg: &Lead{}},
+	"approx_count_distinct": &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &ApproxCountDistinct{}},
+	"approx_percentile":     &AggregateRegistry{property: AGGREGATE_ALLOWS_FRACTION, agg: &ApproxPercentile{}},
+	"array_agg":             &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &ArrayAgg{}},
+	"avg":                   &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Avg{}},
+	"corr":                  &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &Corr{}},
+	"count":                 &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Count{}},
+	"countn":                &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Countn{}},
+	"covar_pop":             &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &CovarPop{}},
+	"covar_samp":            &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &CovarSamp{}},
+	"listagg":               &AggregateRegistry{property: AGGREGATE_ALLOWS_STRING_AGG, agg: &StringAgg{}},
+	"max":                   &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Max{}},
+	"mean":                  &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Avg{}},
+	"median":                &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Median{}},
+	"min":                   &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Min{}},
+	"mode":                  &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &Mode{}},
+	"percentile_cont":       &AggregateRegistry{property: AGGREGATE_ALLOWS_PERCENTILE, agg: &PercentileCont{}},
+	"percentile_disc":       &AggregateRegistry{property: AGGREGATE_ALLOWS_PERCENTILE, agg: &PercentileDisc{}},
+	"regr_avgx":             &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrAvgx{}},
+	"regr_avgy":             &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrAvgy{}},
+	"regr_count":            &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrCount{}},
+	"regr_intercept":        &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrIntercept{}},
+	"regr_r2":               &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrR2{}},
+	"regr_slope":            &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrSlope{}},
+	"regr_sxx":              &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrSxx{}},
+	"regr_sxy":              &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrSxy{}},
+	"regr_syy":              &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_NODISTINCT, agg: &RegrSyy{}},
+	"stddev":                &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Stddev{}},
+	"stddev_pop":            &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &StddevPop{}},
+	"stddev_samp":           &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &StddevSamp{}},
+	"string_agg":            &AggregateRegistry{property: AGGREGATE_ALLOWS_STRING_AGG, agg: &StringAgg{}},
+	"sum":                   &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL_INCREMENTAL, agg: &Sum{}},
+	"variance":              &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &Variance{}},
+	"var_pop":               &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &VarPop{}},
+	"variance_pop":          &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &VarPop{}},
+	"var_samp":              &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &VarSamp{}},
+	"variance_samp":         &AggregateRegistry{property: AGGREGATE_ALLOWS_ALL, agg: &VarSamp{}},
+	"row_number":            &AggregateRegistry{property: AGGREGATE_ROW_NUMBER, agg: &RowNumber{}},
+	"rank":                  &AggregateRegistry{property: AGGREGATE_WINDOW_RANK | AGGREGATE_WINDOW_RELEASE_CURRENTROW, agg: &Rank{}},
+	"dense_rank":            &AggregateRegistry{property: AGGREGATE_WINDOW_RANK | AGGREGATE_WINDOW_RELEASE_CURRENTROW, agg: &DenseRank{}},
+	"percent_rank":          &AggregateRegistry{property: AGGREGATE_WINDOW_RANK, agg: &PercentRank{}},
+	"cume_dist":             &AggregateRegistry{property: AGGREGATE_WINDOW_RANK, agg: &CumeDist{}},
+	"ratio_to_report":       &AggregateRegistry{property: AGGREGATE_ALLOWS_WINDOW | AGGREGATE_ALLOWS_WINDOW_FRAME, agg: &RatioToReport{}},
+	"ntile":                 &AggregateRegistry{property: AGGREGATE_ALLOWS_WINDOW | AGGREGATE_WINDOW_ORDER, agg: &Ntile{}},
+	"first_value":           &AggregateRegistry{property: AGGREGATE_ALLOWS_FL, agg: &FirstValue{}},
+	"last_value":            &AggregateRegistry{property: AGGREGATE_ALLOWS_FL, agg: &LastValue{}},
+	"nth_value":             &AggregateRegistry{property: AGGREGATE_ALLOWS_NTH, agg: &NthValue{}},
+	"lag":                   &AggregateRegistry{property: AGGREGATE_ALLOWS_LAGLEAD, agg: &Lag{}},
+	"lead":                  &AggregateRegistry{property: AGGREGATE_ALLOWS_LAGLEAD, agg: &Lead{}},
 }
@@ -0,0 +1,473 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+/*
+Default truncation indicator for ON OVERFLOW TRUNCATE.
+*/
+const STRING_AGG_FILLER = "..."
+
+/*
+This represents the Aggregate function
+STRING_AGG([DISTINCT] expr, separator [, max_length] [ORDER BY sort_terms]
+[ON OVERFLOW ERROR | ON OVERFLOW TRUNCATE [filler] [WITH | WITHOUT COUNT]]),
+and its synonym LISTAGG.
+It returns the string values in the group, in the order of the sort terms,
+concatenated with the separator. If the result would be longer than
+max_length bytes, it raises an error or, if truncation is requested, drops
+the trailing values and appends the filler and the number of values dropped.
+Type StringAgg is a struct that inherits from AggregateBase, and holds the
+ORDER BY clause and the filler.
+*/
+type StringAgg struct {
+	AggregateBase
+	order  *Order
+	filler string
+}
+
+/*
+The function NewStringAgg calls NewAggregateBase to
+create an aggregate function named string_agg with
+the expression, the separator and the optional maximum
+length as input.
+*/
+func NewStringAgg(operands expression.Expressions, flags uint32, filter expression.Expression, wTerm *WindowTerm) Aggregate {
+	rv := &StringAgg{
+		AggregateBase: *NewAggregateBase("string_agg", operands, flags, filter, wTerm),
+		filler:        STRING_AGG_FILLER,
+	}
+
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+It calls the VisitFunction method by passing in the receiver to
+and returns the interface. It is a visitor pattern.
+*/
+func (this *StringAgg) Accept(visitor expression.Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+/*
+It returns a value of type STRING.
+*/
+func (this *StringAgg) Type() value.Type { return value.STRING }
+
+/*
+Calls the evaluate method for aggregate functions and passes in the
+receiver, current item and current context.
+*/
+func (this *StringAgg) Evaluate(item value.Value, context expression.Context) (value.Value, error) {
+	return this.evaluate(this, item, context)
+}
+
+/*
+The constructor returns a NewStringAgg with the input operands
+cast to a Function as the FunctionConstructor.
+*/
+func (this *StringAgg) Constructor() expression.FunctionConstructor {
+	return func(operands ...expression.Expression) expression.Function {
+		return NewStringAgg(operands, uint32(0), nil, nil)
+	}
+}
+
+/*
+Copy of the aggregate function
+*/
+
+func (this *StringAgg) Copy() expression.Expression {
+	rv := &StringAgg{
+		AggregateBase: *NewAggregateBase(this.Name(), expression.CopyExpressions(this.Operands()),
+			this.Flags(), expression.Copy(this.Filter()), CopyWindowTerm(this.WindowTerm())),
+		filler: this.filler,
+	}
+
+	if this.order != nil {
+		rv.order = this.order.Copy()
+	}
+
+	rv.BaseCopy(this)
+	rv.SetExpr(rv)
+	return rv
+}
+
+/*
+Minimum input arguments required is 2.
+*/
+func (this *StringAgg) MinArgs() int { return 2 }
+
+/*
+Maximum number of input arguments allowed is 3.
+*/
+func (this *StringAgg) MaxArgs() int { return 3 }
+
+/*
+Return the ORDER BY clause, if any.
+*/
+func (this *StringAgg) Order() *Order { return this.order }
+
+/*
+Set the ORDER BY clause.
+*/
+func (this *StringAgg) SetOrder(order *Order) { this.order = order }
+
+/*
+Return the truncation indicator.
+*/
+func (this *StringAgg) Filler() string { return this.filler }
+
+/*
+Set the truncation indicator.
+*/
+func (this *StringAgg) SetFiller(filler string) { this.filler = filler }
+
+/*
+Representation as a N1QL string, with the ORDER BY and
+ON OVERFLOW clauses in the argument list.
+*/
+func (this *StringAgg) String() string {
+	var buf bytes.Buffer
+	if this.order != nil {
+		buf.WriteString(this.order.String())
+	}
+
+	if this.HasFlags(AGGREGATE_OVERFLOW_TRUNCATE) {
+		buf.WriteString(" ON OVERFLOW TRUNCATE ")
+		buf.WriteString(value.NewValue(this.filler).String())
+		if this.HasFlags(AGGREGATE_OVERFLOW_NOCOUNT) {
+			buf.WriteString(" WITHOUT COUNT")
+		} else {
+			buf.WriteString(" WITH COUNT")
+		}
+	}
+
+	return this.toString(buf.String())
+}
+
+/*
+Aggregates are same Return true otherwise Return false.
+*/
+func (this *StringAgg) EquivalentTo(other expression.Expression) bool {
+	otherAggregate, ok := other.(Aggregate)
+	return ok && this.String() == otherAggregate.String()
+}
+
+/*
+Return the operands, including those of the ORDER BY clause.
+*/
+func (this *StringAgg) Children() expression.Expressions {
+	rv := this.AggregateBase.Children()
+	if this.order != nil {
+		rv = append(rv, this.order.Expressions()...)
+	}
+
+	return rv
+}
+
+/*
+Map the operands, including those of the ORDER BY clause.
+*/
+func (this *StringAgg) MapChildren(mapper expression.Mapper) error {
+	err := this.AggregateBase.MapChildren(mapper)
+	if err == nil && this.order != nil {
+		err = this.order.MapExpressions(mapper)
+	}
+
+	return err
+}
+
+/*
+For window aggregates, the ORDER BY clause must also survive grouping.
+*/
+func (this *StringAgg) SurvivesGrouping(groupKeys expression.Expressions,
+	allowed *value.ScopeValue) (bool, expression.Expression) {
+	if this.WindowTerm() != nil {
+		for _, child := range this.Children() {
+			ok, _ := child.SurvivesGrouping(groupKeys, allowed)
+			if !ok {
+				return ok, child
+			}
+		}
+	}
+	return true, nil
+}
+
+/*
+If no input to the StringAgg function, then the default value
+returned is a null.
+*/
+func (this *StringAgg) Default(item value.Value, context Context) (value.Value, error) {
+	return value.NULL_VALUE, nil
+}
+
+/*
+Aggregates input data by evaluating operands. Values other than
+strings are ignored. Without DISTINCT, the value is collected together
+with the values of the ORDER BY terms, if any.
+*/
+func (this *StringAgg) CumulateInitial(item, cumulative value.Value, context Context) (value.Value, error) {
+	// apply filter if any
+	if ok, e := this.evaluateFilter(item, context); e != nil || !ok {
+		return cumulative, e
+	}
+
+	val, e := this.Operands()[0].Evaluate(item, context)
+	if e != nil {
+		return nil, e
+	}
+
+	if val.Type() != value.STRING {
+		return cumulative, nil
+	}
+
+	if this.Distinct() {
+		return setAdd(val, cumulative, false), nil
+	}
+
+	// an entry is the value followed by the sort keys
+	entry := val
+	if this.order != nil {
+		terms := this.order.Terms()
+		keys := make([]interface{}, 1, len(terms)+1)
+		keys[0] = val
+		for _, term := range terms {
+			key, e := term.Expression().Evaluate(item, context)
+			if e != nil {
+				return nil, e
+			}
+			keys = append(keys, key)
+		}
+		entry = value.NewValue(keys)
+	}
+
+	return this.cumulatePart(value.NewValue([]interface{}{entry}), cumulative, context)
+}
+
+/*
+Aggregates intermediate results and return them.
+*/
+func (this *StringAgg) CumulateIntermediate(part, cumulative value.Value, context Context) (value.Value, error) {
+	if this.Distinct() {
+		if _, e := getSet(part); e != nil {
+			return cumulative, nil
+		} else if _, e := getSet(cumulative); e != nil {
+			return part, nil
+		}
+		return cumulateSets(part, cumulative)
+	}
+
+	return this.cumulatePart(part, cumulative, context)
+}
+
+/*
+Compute the Final. Sort the collected values, concatenate them with the
+separator, and apply the maximum length. Return NULL if there are no
+string values.
+*/
+func (this *StringAgg) ComputeFinal(cumulative value.Value, context Context) (value.Value, error) {
+	ops := this.Operands()
+	sep, e := ops[1].Evaluate(value.NULL_VALUE, context)
+	if e != nil {
+		return nil, e
+	}
+
+	if sep.Type() != value.STRING {
+		return nil, fmt.Errorf("%s() separator%s must evaluate to a string.", this.Name(), ops[1].ErrorContext())
+	}
+
+	maxLen := -1
+	if len(ops) > 2 {
+		max, e := ops[2].Evaluate(value.NULL_VALUE, context)
+		if e != nil {
+			return nil, e
+		}
+
+		if max.Type() != value.NUMBER || !value.IsInt(max.(value.NumberValue).Float64()) ||
+			max.(value.NumberValue).Int64() <= 0 {
+			return nil, fmt.Errorf("%s() maximum length%s must evaluate to a positive integer.",
+				this.Name(), ops[2].ErrorContext())
+		}
+
+		maxLen = int(max.(value.NumberValue).Int64())
+	}
+
+	vals := this.sortedValues(cumulative)
+	if len(vals) == 0 {
+		return value.NULL_VALUE, nil
+	}
+
+	return this.concat(vals, sep.ToString(), maxLen)
+}
+
+/*
+Return the collected strings in the order of the ORDER BY clause.
+Without an ORDER BY clause, distinct values are sorted, and others are
+returned in the order they were collected.
+*/
+func (this *StringAgg) sortedValues(cumulative value.Value) []string {
+	var entries value.Values
+	if this.Distinct() {
+		set, e := getSet(cumulative)
+		if e != nil {
+			return nil
+		}
+
+		// ORDER BY can only refer to the argument
+		entries = sortValues(set.Values(), this.order != nil && this.order.Terms()[0].Descending())
+	} else if actuals, ok := cumulative.Actual().([]interface{}); ok {
+		entries = make(value.Values, len(actuals))
+		for i, a := range actuals {
+			entries[i] = value.NewValue(a)
+		}
+	}
+
+	if this.order != nil && !this.Distinct() {
+		terms := this.order.Terms()
+		sort.SliceStable(entries, func(i, j int) bool {
+			for t, term := range terms {
+				ki, _ := entries[i].Index(t + 1)
+				kj, _ := entries[j].Index(t + 1)
+				c := ki.Collate(kj)
+				if term.NullsPos() {
+					ni := ki.Type() <= value.NULL
+					nj := kj.Type() <= value.NULL
+					if ni && !nj {
+						c = 1
+					} else if !ni && nj {
+						c = -1
+					}
+				}
+				if term.Descending() {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	rv := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if this.order != nil && !this.Distinct() {
+			entry, _ = entry.Index(0)
+		}
+		if entry.Type() == value.STRING {
+			rv = append(rv, entry.ToString())
+		}
+	}
+
+	return rv
+}
+
+/*
+Concatenate the strings with the separator. If the result exceeds the
+maximum length, raise an error or truncate it, keeping as many leading
+values as fit with the truncation indicator.
+*/
+func (this *StringAgg) concat(vals []string, sep string, maxLen int) (value.Value, error) {
+	length := len(sep) * (len(vals) - 1)
+	for _, v := range vals {
+		length += len(v)
+	}
+
+	n := len(vals)
+	if maxLen >= 0 && length > maxLen {
+		if !this.HasFlags(AGGREGATE_OVERFLOW_TRUNCATE) {
+			return nil, fmt.Errorf("%s() result exceeds the maximum length of %d.", this.Name(), maxLen)
+		}
+
+		// the indicator is the separator, the filler and the number of values dropped
+		indicator := func(kept int) int {
+			l := len(this.filler)
+			if kept > 0 {
+				l += len(sep)
+			}
+			if !this.HasFlags(AGGREGATE_OVERFLOW_NOCOUNT) {
+				l += len(strconv.Itoa(len(vals)-kept)) + 2
+			}
+			return l
+		}
+
+		n = 0
+		length = 0
+		for k := 1; k < len(vals); k++ {
+			l := length + len(vals[k-1])
+			if k > 1 {
+				l += len(sep)
+			}
+			if l+indicator(k) > maxLen {
+				break
+			}
+			length = l
+			n = k
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(length)
+	for i, v := range vals[:n] {
+		if i > 0 {
+			buf.WriteString(sep)
+		}
+		buf.WriteString(v)
+	}
+
+	if n < len(vals) {
+		if n > 0 {
+			buf.WriteString(sep)
+		}
+		buf.WriteString(this.filler)
+		if !this.HasFlags(AGGREGATE_OVERFLOW_NOCOUNT) {
+			buf.WriteString("(")
+			buf.WriteString(strconv.Itoa(len(vals) - n))
+			buf.WriteString(")")
+		}
+	}
+
+	return value.NewValue(buf.String()), nil
+}
+
+/*
+Aggregate input partial values into cumulative result slice of entries
+and return. If either is null, return the other.
+*/
+func (this *StringAgg) cumulatePart(part, cumulative value.Value, context Context) (value.Value, error) {
+	if part == value.NULL_VALUE {
+		return cumulative, nil
+	} else if cumulative == value.NULL_VALUE {
+		return part, nil
+	}
+
+	actual := part.Actual()
+	switch actual := actual.(type) {
+	case []interface{}:
+		array := cumulative.Actual()
+		switch array := array.(type) {
+		case []interface{}:
+			return value.NewValue(append(array, actual...)), nil
+		default:
+			return nil, fmt.Errorf("Invalid STRING_AGG %v of type %T.", array, array)
+		}
+	default:
+		return nil, fmt.Errorf("Invalid partial STRING_AGG %v of type %T.", actual, actual)
+	}
+}
@@ -9,10 +9,14 @@
 package algebra
 
 import (
+	"encoding"
+	"encoding/base64"
 	"fmt"
+	"math"
 	"sort"
 
 	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/util"
 	"github.com/couchbase/query/value"
 )
 
@@ -479,3 +483,285 @@ func compute_nth_value(item, cumpart value.Value, expr expression.Expression, ni
 	}
 	return nil
 }
+
+/*
+Return the fraction of PERCENTILE_CONT() and PERCENTILE_DISC(), which is the
+second operand, and must evaluate to a number between 0 and 1.
+*/
+func percentileFraction(agg Aggregate, context Context) (float64, error) {
+	op := agg.Operands()[1]
+	fraction, e := op.Evaluate(value.NULL_VALUE, context)
+	if e != nil {
+		return 0.0, e
+	}
+
+	if fraction.Type() == value.NUMBER {
+		f := fraction.(value.NumberValue).Float64()
+		if f >= 0.0 && f <= 1.0 {
+			return f, nil
+		}
+	}
+	return 0.0, fmt.Errorf("%s() fraction%s must evaluate to a number between 0 and 1.", agg.Name(), op.ErrorContext())
+}
+
+/*
+Return a sorted copy of the values, for the WITHIN GROUP (ORDER BY ...) clause.
+*/
+func sortValues(vals value.Values, descending bool) value.Values {
+	rv := make(value.Values, len(vals))
+	copy(rv, vals)
+	sort.SliceStable(rv, func(i, j int) bool {
+		if descending {
+			return rv[i].Collate(rv[j]) > 0
+		}
+		return rv[i].Collate(rv[j]) < 0
+	})
+	return rv
+}
+
+/*
+Return the values collected in the list attachment, nil if there are none.
+*/
+func listValues(cumulative value.Value) value.Values {
+	list, e := getList(cumulative)
+	if e != nil || list.Len() == 0 {
+		return nil
+	}
+	return list.Values()
+}
+
+/*
+Aggregate intermediate lists, either of which may be missing if the group had
+no qualifying values.
+*/
+func cumulateOptionalLists(part, cumulative value.Value) (value.Value, error) {
+	if _, e := getList(part); e != nil {
+		return cumulative, nil
+	} else if _, e := getList(cumulative); e != nil {
+		return part, nil
+	}
+	return cumulateLists(part, cumulative)
+}
+
+/*
+Bivariate aggregates, CORR(), COVAR_POP(), COVAR_SAMP() and REGR_*(), take
+the dependent expression y and the independent expression x, and only
+consider the pairs where both are numbers.
+Their state is the number of pairs, the means of x and y, the sums of squared
+deviations of x and y and the sum of the products of the deviations, which can
+be updated and merged without the loss of precision of plain sums of squares.
+It is kept as an array in the "bivariate" attachment.
+*/
+const (
+	_BIVARIATE_COUNT = iota
+	_BIVARIATE_MEANX
+	_BIVARIATE_MEANY
+	_BIVARIATE_SXX
+	_BIVARIATE_SYY
+	_BIVARIATE_SXY
+	_BIVARIATE_SIZE
+)
+
+func getBivariate(cumulative value.Value) []float64 {
+	av, ok := cumulative.(value.AnnotatedValue)
+	if !ok {
+		return nil
+	}
+
+	// the attachment may have been spilled to disk and read back
+	state, ok := av.GetAttachment("bivariate").(value.Value)
+	if !ok || state.Type() != value.ARRAY {
+		return nil
+	}
+	rv := make([]float64, _BIVARIATE_SIZE)
+	for i := range rv {
+		v, _ := state.Index(i)
+		if n, ok := v.(value.NumberValue); ok {
+			rv[i] = n.Float64()
+		}
+	}
+	return rv
+}
+
+func setBivariate(cumulative value.Value, state []float64) value.Value {
+	av, ok := cumulative.(value.AnnotatedValue)
+	if !ok {
+		av = value.NewAnnotatedValue(cumulative)
+	}
+
+	vals := make([]interface{}, len(state))
+	for i, f := range state {
+		vals[i] = f
+	}
+	av.SetAttachment("bivariate", value.NewValue(vals))
+	return av
+}
+
+/*
+Aggregate initial results for bivariate aggregates.
+*/
+func addBivariate(operands expression.Expressions, item, cumulative value.Value, context Context) (value.Value, error) {
+	y, e := operands[0].Evaluate(item, context)
+	if e != nil {
+		return nil, e
+	}
+	x, e := operands[1].Evaluate(item, context)
+	if e != nil {
+		return nil, e
+	}
+	if y.Type() != value.NUMBER || x.Type() != value.NUMBER {
+		return cumulative, nil
+	}
+
+	fx := x.(value.NumberValue).Float64()
+	fy := y.(value.NumberValue).Float64()
+	state := getBivariate(cumulative)
+	if state == nil {
+		state = make([]float64, _BIVARIATE_SIZE)
+	}
+
+	state[_BIVARIATE_COUNT]++
+	dx := fx - state[_BIVARIATE_MEANX]
+	dy := fy - state[_BIVARIATE_MEANY]
+	state[_BIVARIATE_MEANX] += dx / state[_BIVARIATE_COUNT]
+	state[_BIVARIATE_MEANY] += dy / state[_BIVARIATE_COUNT]
+	state[_BIVARIATE_SXX] += dx * (fx - state[_BIVARIATE_MEANX])
+	state[_BIVARIATE_SYY] += dy * (fy - state[_BIVARIATE_MEANY])
+	state[_BIVARIATE_SXY] += dx * (fy - state[_BIVARIATE_MEANY])
+	return setBivariate(cumulative, state), nil
+}
+
+/*
+Aggregate intermediate results for bivariate aggregates.
+*/
+func cumulateBivariate(part, cumulative value.Value) (value.Value, error) {
+	pState := getBivariate(part)
+	if pState == nil {
+		return cumulative, nil
+	}
+	cState := getBivariate(cumulative)
+	if cState == nil {
+		return part, nil
+	}
+
+	pCount := pState[_BIVARIATE_COUNT]
+	cCount := cState[_BIVARIATE_COUNT]
+	count := pCount + cCount
+	dx := pState[_BIVARIATE_MEANX] - cState[_BIVARIATE_MEANX]
+	dy := pState[_BIVARIATE_MEANY] - cState[_BIVARIATE_MEANY]
+	weight := pCount * cCount / count
+
+	cState[_BIVARIATE_COUNT] = count
+	cState[_BIVARIATE_MEANX] += dx * pCount / count
+	cState[_BIVARIATE_MEANY] += dy * pCount / count
+	cState[_BIVARIATE_SXX] += pState[_BIVARIATE_SXX] + dx*dx*weight
+	cState[_BIVARIATE_SYY] += pState[_BIVARIATE_SYY] + dy*dy*weight
+	cState[_BIVARIATE_SXY] += pState[_BIVARIATE_SXY] + dx*dy*weight
+	return setBivariate(cumulative, cState), nil
+}
+
+/*
+Compute the final value of the named bivariate aggregate.
+REGR_COUNT() returns zero if there are no pairs, all others return NULL
+whenever the result is undefined.
+*/
+func computeBivariate(name string, cumulative value.Value) value.Value {
+	state := getBivariate(cumulative)
+	if state == nil {
+		if name == "regr_count" {
+			return value.ZERO_NUMBER
+		}
+		return value.NULL_VALUE
+	}
+
+	count := state[_BIVARIATE_COUNT]
+	sxx := state[_BIVARIATE_SXX]
+	syy := state[_BIVARIATE_SYY]
+	sxy := state[_BIVARIATE_SXY]
+
+	switch name {
+	case "regr_count":
+		return value.NewValue(int64(count))
+	case "regr_avgx":
+		return value.NewValue(state[_BIVARIATE_MEANX])
+	case "regr_avgy":
+		return value.NewValue(state[_BIVARIATE_MEANY])
+	case "regr_sxx":
+		return value.NewValue(sxx)
+	case "regr_syy":
+		return value.NewValue(syy)
+	case "regr_sxy":
+		return value.NewValue(sxy)
+	case "covar_pop":
+		return value.NewValue(sxy / count)
+	case "covar_samp":
+		if count > 1.0 {
+			return value.NewValue(sxy / (count - 1.0))
+		}
+	case "corr":
+		if sxx != 0.0 && syy != 0.0 {
+			return value.NewValue(sxy / math.Sqrt(sxx*syy))
+		}
+	case "regr_slope":
+		if sxx != 0.0 {
+			return value.NewValue(sxy / sxx)
+		}
+	case "regr_intercept":
+		if sxx != 0.0 {
+			return value.NewValue(state[_BIVARIATE_MEANY] - sxy/sxx*state[_BIVARIATE_MEANX])
+		}
+	case "regr_r2":
+		if sxx != 0.0 {
+			if syy == 0.0 {
+				return value.ONE_NUMBER
+			}
+			return value.NewValue(sxy * sxy / (sxx * syy))
+		}
+	}
+	return value.NULL_VALUE
+}
+
+/*
+Approximate aggregates, APPROX_COUNT_DISTINCT() and APPROX_PERCENTILE(), keep
+a sketch in an attachment, which is merged in the intermediate phase.
+When the group is spilled to disk, the sketch is written in its binary encoding
+as a base64 string, and it is decoded back when it is next used.
+*/
+func getSketch(cumulative value.Value, name string, sketch encoding.BinaryUnmarshaler) interface{} {
+	av, ok := cumulative.(value.AnnotatedValue)
+	if !ok {
+		return nil
+	}
+
+	a := av.GetAttachment(name)
+	if v, ok := a.(value.Value); ok {
+		a = nil
+		if v.Type() == value.STRING {
+			data, err := base64.StdEncoding.DecodeString(v.ToString())
+			if err == nil && sketch.UnmarshalBinary(data) == nil {
+				a = sketch
+				av.SetAttachment(name, a)
+			}
+		}
+	}
+	return a
+}
+
+func setSketch(cumulative value.Value, name string, sketch interface{}) value.AnnotatedValue {
+	av, ok := cumulative.(value.AnnotatedValue)
+	if !ok {
+		av = value.NewAnnotatedValue(cumulative)
+	}
+	av.SetAttachment(name, sketch)
+	return av
+}
+
+func getHyperLogLog(cumulative value.Value) *util.HyperLogLog {
+	hll, _ := getSketch(cumulative, "hll", &util.HyperLogLog{}).(*util.HyperLogLog)
+	return hll
+}
+
+func getTDigest(cumulative value.Value) *util.TDigest {
+	digest, _ := getSketch(cumulative, "tdigest", &util.TDigest{}).(*util.TDigest)
+	return digest
+}
@@ -116,7 +116,8 @@ Base class for Aggregate functions.
 It inherits from expressions FunctionBase, and has
      text           which represents the function name.
      flags          which represents the modifers/flags
-                         DISTINCT, INCREMENTAL, RESPECT|IGNORE NULLS, FROM FIRST|LAST
+                         DISTINCT, INCREMENTAL, RESPECT|IGNORE NULLS, FROM FIRST|LAST,
+                         WITHIN GROUP (ORDER BY ... DESC)
      filter         include those objects that filter condition is true in aggregation
      windowTerm     which represents the Window information
 */
@@ -219,6 +220,14 @@ func (this *AggregateBase) IsCumulateDone(cumulative value.Value, context Contex
  Returns string representation of aggregate
 */
 func (this *AggregateBase) String() string {
+	return this.toString("")
+}
+
+/*
+Returns string representation of aggregate, with the options that
+follow the arguments, such as ORDER BY, before the closing parenthesis.
+*/
+func (this *AggregateBase) toString(options string) string {
 	var buf bytes.Buffer
 	stringer := expression.NewStringer()
 
@@ -229,7 +238,14 @@ func (this *AggregateBase) String() string {
 		buf.WriteString("DISTINCT ")
 	}
 
-	for i, op := range this.Operands() {
+	// the first operand of WITHIN GROUP aggregates is the ORDER BY expression
+	ops := this.Operands()
+	withinGroup := len(ops) > 1 && AggregateHasProperty(this.Name(), AGGREGATE_WITHIN_GROUP)
+	if withinGroup {
+		ops = ops[1:]
+	}
+
+	for i, op := range ops {
 		if i > 0 {
 			buf.WriteString(", ")
 		}
@@ -242,8 +258,18 @@ func (this *AggregateBase) String() string {
 		}
 	}
 
+	buf.WriteString(options)
 	buf.WriteString(")")
 
+	if withinGroup {
+		buf.WriteString(" WITHIN GROUP (ORDER BY ")
+		buf.WriteString(stringer.Visit(this.Operands()[0]))
+		if this.HasFlags(AGGREGATE_DESCENDING) {
+			buf.WriteString(" DESC")
+		}
+		buf.WriteString(")")
+	}
+
 	if this.Filter() != nil {
 		buf.WriteString(" FILTER (WHERE ")
 		buf.WriteString(stringer.Visit(this.Filter()))
@@ -31,6 +31,7 @@ type Subselect struct {
 	projection *Projection           `json:"projection"`
 	window     WindowTerms           `json:"window"`
 	correlated bool                  `json:"correlated"`
+	recursive  RecursiveWiths        `json:"recursive"`
 }
 
 /*
@@ -76,11 +77,30 @@ expressions and calls PushBindings for the let clause.
 func (this *Subselect) Formalize(parent *expression.Formalizer) (f *expression.Formalizer, err error) {
 	if this.with != nil {
 		f = expression.NewFormalizer("", parent)
+
+		// recursive terms are referenced from within their own subqueries
+		if this.recursive != nil {
+			f.SetPermanentWiths(this.with)
+		}
 		err = f.PushBindings(this.with, false)
 		if err != nil {
 			return nil, err
 		}
-		f.SetWiths(this.with)
+		if this.recursive == nil {
+			f.SetWiths(this.with)
+		}
+
+		for _, r := range this.recursive {
+			for _, b := range this.with {
+				if b.Variable() == r.Variable() {
+					err = r.Bind(b.Expression())
+					break
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if this.from != nil {
@@ -294,7 +314,7 @@ func (this *Subselect) String() string {
 	var s string
 
 	if len(this.with) > 0 {
-		s += withBindings(this.with)
+		s += withBindings(this.with, this.recursive)
 	}
 
 	s += "select " + this.projection.String()
@@ -337,6 +357,21 @@ func (this *Subselect) With() expression.Bindings {
 	return this.with
 }
 
+/*
+Returns the terms of a WITH RECURSIVE clause, nil for
+a plain WITH clause.
+*/
+func (this *Subselect) Recursive() RecursiveWiths {
+	return this.recursive
+}
+
+/*
+Marks the WITH clause as WITH RECURSIVE.
+*/
+func (this *Subselect) SetRecursive(recursive RecursiveWiths) {
+	this.recursive = recursive
+}
+
 /*
 Returns a FromTerm that represents the From clause
 in the subselect statement.
@@ -413,8 +448,11 @@ func stringBindings(bindings expression.Bindings) string {
    Representation as a N1QL WITH clause string.
 */
 
-func withBindings(bindings expression.Bindings) string {
+func withBindings(bindings expression.Bindings, recursive RecursiveWiths) string {
 	s := " WITH "
+	if recursive != nil {
+		s += "RECURSIVE "
+	}
 
 	for i, b := range bindings {
 		if i > 0 {
@@ -424,6 +462,10 @@ func withBindings(bindings expression.Bindings) string {
 		s += "`" + b.Variable() + "` AS ( "
 		s += b.Expression().String()
 		s += " ) "
+
+		if r := recursive.Get(b.Variable()); r != nil {
+			s += r.String() + " "
+		}
 	}
 
 	return s
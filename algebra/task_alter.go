@@ -0,0 +1,104 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+/*
+Represents the Alter task ddl statement, which pauses or
+resumes a recurring task.
+*/
+type AlterTask struct {
+	statementBase
+
+	name  string `json:"name"`
+	pause bool   `json:"pause"`
+}
+
+/*
+The function NewAlterTask returns a pointer to the
+AlterTask struct with the input argument values as fields.
+*/
+func NewAlterTask(name string, pause bool) *AlterTask {
+	rv := &AlterTask{
+		name:  name,
+		pause: pause,
+	}
+
+	rv.stmt = rv
+	return rv
+}
+
+func (this *AlterTask) Name() string {
+	return this.name
+}
+
+/*
+Returns true for PAUSE, false for RESUME.
+*/
+func (this *AlterTask) Pause() bool {
+	return this.pause
+}
+
+/*
+It calls the VisitAlterTask method by passing
+in the receiver and returns the interface. It is a
+visitor pattern.
+*/
+func (this *AlterTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitAlterTask(this)
+}
+
+/*
+Returns nil.
+*/
+func (this *AlterTask) Signature() value.Value {
+	return nil
+}
+
+/*
+Returns nil.
+*/
+func (this *AlterTask) Formalize() error {
+	return nil
+}
+
+/*
+This method maps all the constituent clauses, but here none have expressions
+*/
+func (this *AlterTask) MapExpressions(mapper expression.Mapper) (err error) {
+	return
+}
+
+/*
+Return expr from the alter task statement.
+*/
+func (this *AlterTask) Expressions() expression.Expressions {
+	return nil
+}
+
+/*
+Returns all required privileges: tasks are managed through system:tasks_cache.
+Only the creator of the task, or an administrator, can alter it, which is checked
+when the statement runs.
+*/
+func (this *AlterTask) Privileges() (*auth.Privileges, errors.Error) {
+	privs := auth.NewPrivileges()
+	privs.Add("", auth.PRIV_SYSTEM_READ, auth.PRIV_PROPS_NONE)
+	return privs, nil
+}
+
+func (this *AlterTask) Type() string {
+	return "ALTER_TASK"
+}
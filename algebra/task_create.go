@@ -0,0 +1,125 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+/*
+Represents the Create task ddl statement. Type CreateTask is
+a struct that contains fields mapping to each clause in the
+create task statement: the task name, its schedule, and the
+statement it runs, which is kept as text, as it is prepared
+anew every time the task executes.
+*/
+type CreateTask struct {
+	statementBase
+
+	name         string    `json:"name"`
+	schedule     string    `json:"schedule"`
+	stmt         Statement `json:"stmt"`
+	text         string    `json:"text"`
+	failIfExists bool      `json:"failIfExists"`
+}
+
+/*
+The function NewCreateTask returns a pointer to the
+CreateTask struct with the input argument values as fields.
+*/
+func NewCreateTask(name, schedule string, stmt Statement, text string, failIfExists bool) *CreateTask {
+	rv := &CreateTask{
+		name:         name,
+		schedule:     schedule,
+		stmt:         stmt,
+		text:         text,
+		failIfExists: failIfExists,
+	}
+
+	rv.statementBase.stmt = rv
+	return rv
+}
+
+func (this *CreateTask) Name() string {
+	return this.name
+}
+
+func (this *CreateTask) Schedule() string {
+	return this.schedule
+}
+
+/*
+Return the statement run by the task.
+*/
+func (this *CreateTask) Statement() Statement {
+	return this.stmt
+}
+
+/*
+Return the text of the statement run by the task.
+*/
+func (this *CreateTask) Text() string {
+	return this.text
+}
+
+func (this *CreateTask) FailIfExists() bool {
+	return this.failIfExists
+}
+
+/*
+It calls the VisitCreateTask method by passing
+in the receiver and returns the interface. It is a
+visitor pattern.
+*/
+func (this *CreateTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitCreateTask(this)
+}
+
+/*
+Returns nil.
+*/
+func (this *CreateTask) Signature() value.Value {
+	return nil
+}
+
+/*
+Formalize the statement run by the task, so that its privileges are known.
+*/
+func (this *CreateTask) Formalize() error {
+	return this.stmt.Formalize()
+}
+
+/*
+This method maps all the constituent clauses, but here none have expressions
+*/
+func (this *CreateTask) MapExpressions(mapper expression.Mapper) (err error) {
+	return
+}
+
+/*
+Return expr from the create task statement.
+*/
+func (this *CreateTask) Expressions() expression.Expressions {
+	return nil
+}
+
+/*
+Tasks run under the credentials of their creator, who needs
+the privileges to run the statement in the first place.
+*/
+func (this *CreateTask) Privileges() (*auth.Privileges, errors.Error) {
+	return this.stmt.Privileges()
+}
+
+func (this *CreateTask) Type() string {
+	return "CREATE_TASK"
+}
@@ -0,0 +1,102 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+/*
+Represents the Drop task ddl statement. Type DropTask is
+a struct that contains fields mapping to each clause in the
+drop task statement. The fields just refer to the task name.
+*/
+type DropTask struct {
+	statementBase
+
+	name            string `json:"name"`
+	failIfNotExists bool   `json:"failIfNotExists"`
+}
+
+/*
+The function NewDropTask returns a pointer to the
+DropTask struct with the input argument values as fields.
+*/
+func NewDropTask(name string, failIfNotExists bool) *DropTask {
+	rv := &DropTask{
+		name:            name,
+		failIfNotExists: failIfNotExists,
+	}
+
+	rv.stmt = rv
+	return rv
+}
+
+func (this *DropTask) Name() string {
+	return this.name
+}
+
+func (this *DropTask) FailIfNotExists() bool {
+	return this.failIfNotExists
+}
+
+/*
+It calls the VisitDropTask method by passing
+in the receiver and returns the interface. It is a
+visitor pattern.
+*/
+func (this *DropTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitDropTask(this)
+}
+
+/*
+Returns nil.
+*/
+func (this *DropTask) Signature() value.Value {
+	return nil
+}
+
+/*
+Returns nil.
+*/
+func (this *DropTask) Formalize() error {
+	return nil
+}
+
+/*
+This method maps all the constituent clauses, but here none have expressions
+*/
+func (this *DropTask) MapExpressions(mapper expression.Mapper) (err error) {
+	return
+}
+
+/*
+Return expr from the drop task statement.
+*/
+func (this *DropTask) Expressions() expression.Expressions {
+	return nil
+}
+
+/*
+Returns all required privileges: tasks are managed through system:tasks_cache.
+Only the creator of the task, or an administrator, can drop it, which is checked
+when the statement runs.
+*/
+func (this *DropTask) Privileges() (*auth.Privileges, errors.Error) {
+	privs := auth.NewPrivileges()
+	privs.Add("", auth.PRIV_SYSTEM_READ, auth.PRIV_PROPS_NONE)
+	return privs, nil
+}
+
+func (this *DropTask) Type() string {
+	return "DROP_TASK"
+}
@@ -81,6 +81,13 @@ type Visitor interface {
 	VisitDropFunction(stmt *DropFunction) (interface{}, error)
 	VisitExecuteFunction(stmt *ExecuteFunction) (interface{}, error)
 
+	/*
+	   Visitor TASK statements
+	*/
+	VisitCreateTask(stmt *CreateTask) (interface{}, error)
+	VisitDropTask(stmt *DropTask) (interface{}, error)
+	VisitAlterTask(stmt *AlterTask) (interface{}, error)
+
 	/*
 	   Visitor for UPDATE STATISTICS statements.
 	*/
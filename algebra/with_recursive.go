@@ -0,0 +1,190 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package algebra
+
+import (
+	"fmt"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+)
+
+/*
+Represents a term of a WITH RECURSIVE clause:
+
+	alias AS ( anchor UNION [ALL] recursive ) [OPTIONS expr] [CYCLE exprs RESTRICT]
+
+The anchor is evaluated once, and the recursive part is then evaluated
+repeatedly, with the alias bound to the documents produced by the previous
+iteration, until it produces no documents. UNION discards documents that
+have already been produced, CYCLE ... RESTRICT discards documents whose
+cycle expressions have already been seen, and OPTIONS can limit the number
+of levels and documents produced.
+Terms that do not reference themselves are evaluated as plain WITH terms.
+*/
+type RecursiveWith struct {
+	variable  string
+	options   expression.Expression
+	cycle     expression.Expressions
+	anchor    *Select
+	recursive *Select
+	distinct  bool
+}
+
+type RecursiveWiths []*RecursiveWith
+
+func NewRecursiveWith(variable string, options expression.Expression,
+	cycle expression.Expressions) *RecursiveWith {
+	return &RecursiveWith{
+		variable: variable,
+		options:  options,
+		cycle:    cycle,
+	}
+}
+
+/*
+Splits the formalized term expression into anchor and recursive part.
+*/
+func (this *RecursiveWith) Bind(expr expression.Expression) error {
+	this.anchor = nil
+	this.recursive = nil
+	this.distinct = false
+
+	subq, ok := expr.(*Subquery)
+	if !ok || !references(subq.Select().Expressions(), this.variable) {
+		if this.options != nil || this.cycle != nil {
+			return errors.NewRecursiveWithSemanticError(fmt.Sprintf("%s has OPTIONS or CYCLE "+
+				"but does not reference itself", this.variable))
+		}
+		return nil
+	}
+
+	sel := subq.Select()
+	if sel.Order() != nil || sel.Offset() != nil || sel.Limit() != nil {
+		return errors.NewRecursiveWithSemanticError(fmt.Sprintf("%s cannot have ORDER BY, OFFSET or LIMIT",
+			this.variable))
+	}
+
+	var first, second Subresult
+	switch subresult := sel.Subresult().(type) {
+	case *Union:
+		first, second = subresult.First(), subresult.Second()
+		this.distinct = true
+	case *UnionAll:
+		first, second = subresult.First(), subresult.Second()
+	default:
+		return errors.NewRecursiveWithSemanticError(fmt.Sprintf("%s must be of the form "+
+			"anchor UNION [ALL] recursive", this.variable))
+	}
+
+	if references(first.Expressions(), this.variable) {
+		return errors.NewRecursiveWithSemanticError(fmt.Sprintf("%s anchor cannot reference itself",
+			this.variable))
+	}
+
+	this.anchor = NewSelect(first, nil, nil, nil)
+	if first.IsCorrelated() {
+		this.anchor.SetCorrelated()
+	}
+
+	// the recursive part depends on the previous iteration, so never cache its results
+	this.recursive = NewSelect(second, nil, nil, nil)
+	this.recursive.SetCorrelated()
+	return nil
+}
+
+/*
+Returns true if any of the expressions, or the subqueries within,
+reference the variable.
+*/
+func references(exprs expression.Expressions, variable string) bool {
+	for _, expr := range exprs {
+		switch expr := expr.(type) {
+		case *expression.Identifier:
+			if expr.Identifier() == variable {
+				return true
+			}
+		case *Subquery:
+			if references(expr.Select().Expressions(), variable) {
+				return true
+			}
+		}
+		if references(expr.Children(), variable) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *RecursiveWith) Variable() string {
+	return this.variable
+}
+
+func (this *RecursiveWith) Options() expression.Expression {
+	return this.options
+}
+
+func (this *RecursiveWith) Cycle() expression.Expressions {
+	return this.cycle
+}
+
+/*
+Returns true if the term references itself.
+*/
+func (this *RecursiveWith) IsRecursive() bool {
+	return this.recursive != nil
+}
+
+func (this *RecursiveWith) Anchor() *Select {
+	return this.anchor
+}
+
+func (this *RecursiveWith) Recursive() *Select {
+	return this.recursive
+}
+
+/*
+Returns true for UNION, false for UNION ALL.
+*/
+func (this *RecursiveWith) Distinct() bool {
+	return this.distinct
+}
+
+/*
+Representation as a N1QL string.
+*/
+func (this *RecursiveWith) String() string {
+	s := ""
+	if this.options != nil {
+		s += " OPTIONS " + this.options.String()
+	}
+	if this.cycle != nil {
+		s += " CYCLE "
+		for i, c := range this.cycle {
+			if i > 0 {
+				s += ", "
+			}
+			s += c.String()
+		}
+		s += " RESTRICT"
+	}
+	return s
+}
+
+/*
+Returns the term for the variable, if any.
+*/
+func (this RecursiveWiths) Get(variable string) *RecursiveWith {
+	for _, r := range this {
+		if r.variable == variable {
+			return r
+		}
+	}
+	return nil
+}
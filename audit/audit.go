@@ -416,6 +416,9 @@ var _EVENT_TYPE_MAP = map[string]uint32{
 	"ROLLBACK_SAVEPOINT":        28723,
 	"SET_TRANSACTION_ISOLATION": 28724,
 	"SAVEPOINT":                 28725,
+	"CREATE_TASK":               28729,
+	"DROP_TASK":                 28730,
+	"ALTER_TASK":                28731,
 }
 
 func Submit(event Auditable) {
@@ -487,6 +490,7 @@ const (
 	API_ADMIN_TRANSACTIONS               = 28726
 	API_ADMIN_INDEXES_TRANSACTIONS       = 28727
 	API_ADMIN_FUNCTIONS_BACKUP           = 28728
+	API_ADMIN_CHANGES                    = 28732
 )
 
 func SubmitApiRequest(event *ApiAuditFields) {
@@ -0,0 +1,365 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	adt "github.com/couchbase/goutils/go-cbaudit"
+	"github.com/couchbase/query/accounting"
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/logging"
+)
+
+// Standalone query nodes have no audit daemon to send records to. Instead, a local
+// auditor writes them to a sink: a JSONL file that is rotated when it grows too large,
+// or syslog. Which events are audited is set through the "audit" object of
+// /admin/settings rather than fetched from the datastore.
+
+// A sink accepts audit records from a single worker, and configuration change
+// records from the settings API.
+type auditSink interface {
+	write(eventId uint32, record interface{}) error
+	close() error
+}
+
+// The JSON of a record, with the event id first as the audit daemon writes it.
+func auditLine(eventId uint32, record interface{}) ([]byte, error) {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, 0, len(body)+16)
+	line = append(line, `{"id":`...)
+	line = strconv.AppendUint(line, uint64(eventId), 10)
+	if len(body) > 2 {
+		line = append(line, ',')
+	}
+	return append(line, body[1:]...), nil
+}
+
+type fileSink struct {
+	sync.Mutex
+	path     string
+	maxSize  int64 // rotate when the file would grow beyond this; 0 to never rotate
+	maxFiles int   // number of rotated files kept, as path.1 (newest) to path.maxFiles
+	file     *os.File
+	size     int64
+}
+
+func newFileSink(path string, maxSize int64, maxFiles int) (*fileSink, error) {
+	sink := &fileSink{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	err := sink.open()
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (this *fileSink) open() error {
+	file, err := os.OpenFile(this.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	this.file = file
+	this.size = info.Size()
+	return nil
+}
+
+func (this *fileSink) rotated(n int) string {
+	return this.path + "." + strconv.Itoa(n)
+}
+
+func (this *fileSink) rotate() error {
+	this.file.Close()
+	this.file = nil
+
+	if this.maxFiles > 0 {
+		os.Remove(this.rotated(this.maxFiles))
+		for n := this.maxFiles - 1; n > 0; n-- {
+			os.Rename(this.rotated(n), this.rotated(n+1))
+		}
+		err := os.Rename(this.path, this.rotated(1))
+		if err != nil {
+			return err
+		}
+	} else {
+		os.Remove(this.path)
+	}
+	return this.open()
+}
+
+func (this *fileSink) write(eventId uint32, record interface{}) error {
+	line, err := auditLine(eventId, record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	this.Lock()
+	defer this.Unlock()
+
+	// reopen after a failed rotation
+	if this.file == nil {
+		err = this.open()
+		if err != nil {
+			return err
+		}
+	}
+	if this.maxSize > 0 && this.size > 0 && this.size+int64(len(line)) > this.maxSize {
+		err = this.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := this.file.Write(line)
+	this.size += int64(n)
+	return err
+}
+
+func (this *fileSink) close() error {
+	this.Lock()
+	defer this.Unlock()
+	if this.file == nil {
+		return nil
+	}
+	err := this.file.Close()
+	this.file = nil
+	return err
+}
+
+type localAuditor struct {
+	sink             auditSink
+	auditRecordQueue chan auditQueueEntry
+
+	auditInfoLock sync.RWMutex
+	info          *datastore.AuditInfo
+	uid           int
+}
+
+func (la *localAuditor) auditInfo() *datastore.AuditInfo {
+	la.auditInfoLock.RLock()
+	ret := la.info
+	la.auditInfoLock.RUnlock()
+	return ret
+}
+
+func (la *localAuditor) setAuditInfo(info *datastore.AuditInfo) {
+	la.auditInfoLock.Lock()
+	la.info = info
+	la.auditInfoLock.Unlock()
+}
+
+func (la *localAuditor) submit(entry auditQueueEntry) {
+	la.auditRecordQueue <- entry
+}
+
+// Start auditing to a sink, which is file:PATH, syslog or syslog:TAG. Files are
+// rotated when they would grow beyond maxSize bytes, keeping maxFiles old files.
+// All events are audited until disabled through the settings API.
+func StartLocalAuditService(sink string, maxSize int64, maxFiles int, numServicers int) error {
+	var s auditSink
+	var err error
+
+	switch {
+	case strings.HasPrefix(sink, "file:"):
+		s, err = newFileSink(sink[len("file:"):], maxSize, maxFiles)
+	case sink == "syslog":
+		s, err = newSyslogSink("cbq-engine")
+	case strings.HasPrefix(sink, "syslog:"):
+		s, err = newSyslogSink(sink[len("syslog:"):])
+	default:
+		err = fmt.Errorf("unknown audit sink %s, expected file:PATH or syslog[:TAG]", sink)
+	}
+	if err != nil {
+		return fmt.Errorf("Audit service not started: %v", err)
+	}
+
+	auditor := &localAuditor{sink: s}
+	auditor.info = &datastore.AuditInfo{
+		AuditEnabled:    true,
+		EventDisabled:   make(map[uint32]bool),
+		UserWhitelisted: make(map[datastore.UserInfo]bool),
+		Uid:             "0",
+	}
+	auditor.auditRecordQueue = make(chan auditQueueEntry, numServicers*25)
+
+	// the sink serializes writes, so one worker will do
+	go localAuditWorker(auditor, 1)
+
+	_AUDITOR = auditor
+	logging.Infof("Auditing to %s", sink)
+	return nil
+}
+
+func localAuditWorker(auditor *localAuditor, num int) {
+	// If this audit worker panics, start up a replacement.
+	defer func() {
+		r := recover()
+		if r != nil {
+			logging.Errorf("Local audit worker %d: Panic: %v. Starting a replacement.", num, r)
+			go localAuditWorker(auditor, num+1)
+		}
+	}()
+	logging.Infof("Starting local audit worker %d", num)
+
+	for {
+		entry := <-auditor.auditRecordQueue
+
+		var err error
+		accounting.UpdateCounter(accounting.AUDIT_ACTIONS)
+		if entry.isQueryType {
+			err = auditor.sink.write(entry.eventId, entry.queryAuditRecord)
+			if err != nil {
+				logging.Errorf("Local audit worker %d: unable to write audit record %+v: %v", num, stringifyQueryAR(*entry.queryAuditRecord), err)
+			}
+		} else {
+			err = auditor.sink.write(entry.eventId, entry.apiAuditRecord)
+			if err != nil {
+				logging.Errorf("Local audit worker %d: unable to write audit record %+v: %v", num, stringifyAPIAR(*entry.apiAuditRecord), err)
+			}
+		}
+		if err != nil {
+			accounting.UpdateCounter(accounting.AUDIT_ACTIONS_FAILED)
+		}
+	}
+}
+
+// The settings of the local auditor for /admin/settings, or nil if there is none.
+// Disabled events are listed by id and disabled users as domain:name.
+func AuditSettings() map[string]interface{} {
+	auditor, ok := _AUDITOR.(*localAuditor)
+	if !ok {
+		return nil
+	}
+	info := auditor.auditInfo()
+
+	disabled := make([]int, 0, len(info.EventDisabled))
+	for eventId, off := range info.EventDisabled {
+		if off {
+			disabled = append(disabled, int(eventId))
+		}
+	}
+	sort.Ints(disabled)
+
+	users := make([]string, 0, len(info.UserWhitelisted))
+	for user, off := range info.UserWhitelisted {
+		if off {
+			users = append(users, user.Domain+":"+user.Name)
+		}
+	}
+	sort.Strings(users)
+
+	return map[string]interface{}{
+		"enabled":        info.AuditEnabled,
+		"disabled":       disabled,
+		"disabled_users": users,
+	}
+}
+
+// Change the settings of the local auditor. Fields that are not given keep their
+// values. Events may be disabled by id, or by statement type such as "SELECT".
+func SetAuditSettings(settings interface{}) errors.Error {
+	auditor, ok := _AUDITOR.(*localAuditor)
+	if !ok {
+		return errors.NewAdminUnknownSettingError("audit")
+	}
+	object, ok := settings.(map[string]interface{})
+	if !ok {
+		return errors.NewAdminSettingTypeError("audit", settings)
+	}
+
+	auditor.auditInfoLock.Lock()
+	defer auditor.auditInfoLock.Unlock()
+
+	info := *auditor.info
+	for name, val := range object {
+		switch name {
+		case "enabled":
+			enabled, ok := val.(bool)
+			if !ok {
+				return errors.NewAdminSettingTypeError("audit.enabled", val)
+			}
+			info.AuditEnabled = enabled
+		case "disabled":
+			events, ok := val.([]interface{})
+			if !ok {
+				return errors.NewAdminSettingTypeError("audit.disabled", val)
+			}
+			info.EventDisabled = make(map[uint32]bool, len(events))
+			for _, event := range events {
+				eventId := eventIdFromSetting(event)
+				if eventId == 0 {
+					return errors.NewAdminSettingTypeError("audit.disabled", event)
+				}
+				info.EventDisabled[eventId] = true
+			}
+		case "disabled_users":
+			users, ok := val.([]interface{})
+			if !ok {
+				return errors.NewAdminSettingTypeError("audit.disabled_users", val)
+			}
+			info.UserWhitelisted = make(map[datastore.UserInfo]bool, len(users))
+			for _, user := range users {
+				name, ok := user.(string)
+				if !ok || name == "" {
+					return errors.NewAdminSettingTypeError("audit.disabled_users", user)
+				}
+				info.UserWhitelisted[userInfoFromUsername(name)] = true
+			}
+		default:
+			return errors.NewAdminUnknownSettingError("audit." + name)
+		}
+	}
+
+	auditor.uid++
+	info.Uid = strconv.Itoa(auditor.uid)
+	auditor.info = &info
+
+	change := n1qlConfigurationChangeEvent{
+		Timestamp:  time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+		RealUserid: adt.RealUserId{Domain: "internal", Username: "couchbase"},
+		Uuid:       info.Uid,
+	}
+	err := auditor.sink.write(28703, &change)
+	if err != nil {
+		logging.Errorf("Unable to write audit configuration change record: %v", err)
+	}
+	logging.Infof("Audit settings changed: %v", stringifyauditInfo(info))
+	return nil
+}
+
+func eventIdFromSetting(event interface{}) uint32 {
+	switch event := event.(type) {
+	case float64:
+		if event > 0 && event == float64(uint32(event)) {
+			return uint32(event)
+		}
+	case int64:
+		if event > 0 && event == int64(uint32(event)) {
+			return uint32(event)
+		}
+	case string:
+		return _EVENT_TYPE_MAP[strings.ToUpper(event)]
+	}
+	return 0
+}
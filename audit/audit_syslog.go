@@ -0,0 +1,41 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+// +build !windows
+
+package audit
+
+import (
+	"log/syslog"
+)
+
+// Audit records go to the local syslog daemon at the info level of the authpriv
+// facility, one JSON record per message.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink(tag string) (auditSink, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (this *syslogSink) write(eventId uint32, record interface{}) error {
+	line, err := auditLine(eventId, record)
+	if err != nil {
+		return err
+	}
+	return this.writer.Info(string(line))
+}
+
+func (this *syslogSink) close() error {
+	return this.writer.Close()
+}
@@ -0,0 +1,19 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+// +build windows
+
+package audit
+
+import (
+	"fmt"
+)
+
+func newSyslogSink(tag string) (auditSink, error) {
+	return nil, fmt.Errorf("syslog is not supported on windows")
+}
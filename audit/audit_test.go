@@ -11,6 +11,12 @@ licenses/APL.txt.
 package audit
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -365,3 +371,139 @@ func TestWhitelistedUsers(t *testing.T) {
 		}
 	}
 }
+
+// A sink that keeps the records written to it.
+type memorySink struct {
+	lines []string
+}
+
+func (ms *memorySink) write(eventId uint32, record interface{}) error {
+	line, err := auditLine(eventId, record)
+	if err != nil {
+		return err
+	}
+	ms.lines = append(ms.lines, string(line))
+	return nil
+}
+
+func (ms *memorySink) close() error {
+	return nil
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("Unable to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	record := map[string]interface{}{"statement": strings.Repeat("x", 40)}
+	line, _ := auditLine(28672, record)
+
+	// three records to a file, two rotated files kept
+	sink, err := newFileSink(path, int64(3*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatalf("Unable to open sink: %v", err)
+	}
+	defer sink.close()
+
+	for i := 0; i < 10; i++ {
+		err = sink.write(28672, record)
+		if err != nil {
+			t.Fatalf("Unable to write record %d: %v", i, err)
+		}
+	}
+
+	for file, expected := range map[string]int{path: 1, path + ".1": 3, path + ".2": 3, path + ".3": -1} {
+		contents, err := ioutil.ReadFile(file)
+		if expected < 0 {
+			if err == nil {
+				t.Errorf("Expected %s to be removed", file)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("Unable to read %s: %v", file, err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+		if len(lines) != expected {
+			t.Errorf("Expected %d records in %s, found %d", expected, file, len(lines))
+		}
+		var parsed map[string]interface{}
+		err = json.Unmarshal([]byte(lines[0]), &parsed)
+		if err != nil || parsed["id"] != float64(28672) || parsed["statement"] != record["statement"] {
+			t.Errorf("Unexpected record %s in %s (%v)", lines[0], file, err)
+		}
+	}
+}
+
+func TestLocalAuditSettings(t *testing.T) {
+	prevAuditor := _AUDITOR
+	defer func() { _AUDITOR = prevAuditor }()
+
+	_AUDITOR = &mockAuditor{}
+	if AuditSettings() != nil {
+		t.Fatalf("Expected no audit settings without a local auditor")
+	}
+	if SetAuditSettings(map[string]interface{}{"enabled": false}) == nil {
+		t.Fatalf("Expected audit settings to be rejected without a local auditor")
+	}
+
+	sink := &memorySink{}
+	auditor := &localAuditor{
+		sink: sink,
+		info: &datastore.AuditInfo{
+			AuditEnabled:    true,
+			EventDisabled:   make(map[uint32]bool),
+			UserWhitelisted: make(map[datastore.UserInfo]bool),
+			Uid:             "0",
+		},
+		auditRecordQueue: make(chan auditQueueEntry, 10),
+	}
+	_AUDITOR = auditor
+
+	var settings map[string]interface{}
+	json.Unmarshal([]byte(`{"disabled": ["select", 28678], "disabled_users": ["nina", "external:nick"]}`), &settings)
+	err := SetAuditSettings(settings)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"enabled":        true,
+		"disabled":       []int{28672, 28678},
+		"disabled_users": []string{"external:nick", "local:nina"},
+	}
+	if !reflect.DeepEqual(AuditSettings(), expected) {
+		t.Fatalf("Expected settings %v, found %v", expected, AuditSettings())
+	}
+	if len(sink.lines) != 1 || !strings.HasPrefix(sink.lines[0], `{"id":28703,`) {
+		t.Fatalf("Expected a configuration change record, found %v", sink.lines)
+	}
+
+	Submit(&simpleAuditable{eventType: "SELECT", eventUsers: []string{"bill"}})
+	Submit(&simpleAuditable{eventType: "INSERT", eventUsers: []string{"bill"}})
+	Submit(&simpleAuditable{eventType: "DELETE", eventUsers: []string{"bill"}})
+	Submit(&simpleAuditable{eventType: "UPDATE", eventUsers: []string{"nina"}})
+	Submit(&simpleAuditable{eventType: "UPDATE", eventUsers: []string{"nick"}})
+	if len(auditor.auditRecordQueue) != 2 {
+		t.Fatalf("Expected 2 events, found %d", len(auditor.auditRecordQueue))
+	}
+	for _, eventId := range []uint32{28676, 28679} {
+		entry := <-auditor.auditRecordQueue
+		if entry.eventId != eventId {
+			t.Fatalf("Expected event id %d, found %d", eventId, entry.eventId)
+		}
+	}
+
+	if SetAuditSettings(map[string]interface{}{"disabled": []interface{}{"GARBAGE"}}) == nil {
+		t.Fatalf("Expected an unknown event to be rejected")
+	}
+	if SetAuditSettings(map[string]interface{}{"rotate": true}) == nil {
+		t.Fatalf("Expected an unknown audit setting to be rejected")
+	}
+	err = SetAuditSettings(map[string]interface{}{"enabled": false})
+	if err != nil || AuditSettings()["enabled"] != false || len(AuditSettings()["disabled"].([]int)) != 2 {
+		t.Fatalf("Expected auditing to be disabled with the events kept, found %v (%v)", AuditSettings(), err)
+	}
+}
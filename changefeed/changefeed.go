@@ -0,0 +1,290 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+/*
+Package changefeed publishes the mutations performed by the query service, so
+that caches and indexes outside of the service can follow them without polling.
+
+Changes are published once their mutation has been applied: at once outside of
+transactions, and when the transaction commits inside one. Changes that are rolled
+back, to a savepoint or because a statement failed, are never published.
+
+Subscribers receive changes through a buffered channel. A subscriber that falls
+behind is dropped rather than allowed to slow down queries; it can subscribe again
+from the sequence number of the last change it received, and catch up from the
+recent changes retained by the feed.
+*/
+package changefeed
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/query/value"
+)
+
+const (
+	INSERT = "insert"
+	UPSERT = "upsert"
+	UPDATE = "update"
+	DELETE = "delete"
+)
+
+const (
+	_RETAINED  = 1024            // changes kept for subscribers that resume
+	_BUFFER    = 1024            // changes queued for a subscriber before it is dropped
+	_LINGER    = time.Minute     // how long changes are still collected after the last subscriber left
+	_STATEMENT = "\x00statement" // the savepoint of the statement being executed in a transaction
+)
+
+// A change to one document. Before is missing for inserts and for upserts of new
+// documents, and After for deletes.
+type Change struct {
+	Seq       uint64      `json:"seq"`
+	Time      time.Time   `json:"time"`
+	Type      string      `json:"type"`
+	Keyspace  string      `json:"keyspace"`
+	Key       string      `json:"key"`
+	Before    value.Value `json:"before,omitempty"`
+	After     value.Value `json:"after,omitempty"`
+	RequestId string      `json:"requestId"`
+	Users     []string    `json:"users,omitempty"`
+	TxId      string      `json:"txid,omitempty"`
+}
+
+// A subscription to the changes of some keyspaces, or all of them.
+type Subscription struct {
+	keyspaces map[string]bool
+	changes   chan *Change
+	dropped   bool
+	closed    bool
+}
+
+// The changes of the subscription, in sequence order. The channel is closed when
+// the subscription is closed or dropped.
+func (this *Subscription) Changes() <-chan *Change {
+	return this.changes
+}
+
+// Whether the subscription was dropped for not keeping up with changes.
+func (this *Subscription) Dropped() bool {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+	return this.dropped
+}
+
+func (this *Subscription) Close() {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+	_FEED.unsubscribe(this)
+}
+
+func (this *Subscription) matches(change *Change) bool {
+	return len(this.keyspaces) == 0 || this.keyspaces[change.Keyspace]
+}
+
+type txChanges struct {
+	changes    []*Change
+	savepoints map[string]int
+}
+
+type feed struct {
+	sync.Mutex
+	seq         uint64
+	retained    []*Change // a ring, oldest at next once full
+	next        int
+	subscribers map[*Subscription]bool
+	txs         map[string]*txChanges
+
+	active      int32 // accessed atomically
+	lingerUntil int64 // accessed atomically
+}
+
+var _FEED = &feed{
+	retained:    make([]*Change, 0, _RETAINED),
+	subscribers: make(map[*Subscription]bool),
+	txs:         make(map[string]*txChanges),
+}
+
+// Whether changes are wanted: callers should not build them otherwise.
+func Enabled() bool {
+	return atomic.LoadInt32(&_FEED.active) > 0 || time.Now().UnixNano() < atomic.LoadInt64(&_FEED.lingerUntil)
+}
+
+// Subscribe to the changes of keyspaces, given by qualified name, or to all changes
+// if none are given. Subscribers that resume pass the sequence number of the last
+// change they received as since, or 0 to only receive new changes; the result tells
+// whether all the changes they missed were still retained.
+func Subscribe(since uint64, keyspaces ...string) (*Subscription, bool) {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+
+	var replay []*Change
+	complete := true
+	if since > 0 && since < _FEED.seq {
+		retained := _FEED.ordered()
+		complete = len(retained) > 0 && retained[0].Seq <= since+1
+		for _, change := range retained {
+			if change.Seq > since {
+				replay = append(replay, change)
+			}
+		}
+	}
+
+	sub := &Subscription{changes: make(chan *Change, _BUFFER+len(replay))}
+	if len(keyspaces) > 0 {
+		sub.keyspaces = make(map[string]bool, len(keyspaces))
+		for _, keyspace := range keyspaces {
+			sub.keyspaces[keyspace] = true
+		}
+	}
+	for _, change := range replay {
+		if sub.matches(change) {
+			sub.changes <- change
+		}
+	}
+
+	_FEED.subscribers[sub] = true
+	atomic.StoreInt32(&_FEED.active, int32(len(_FEED.subscribers)))
+	return sub, complete
+}
+
+// The sequence number of the last change published.
+func LastSeq() uint64 {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+	return _FEED.seq
+}
+
+// Publish changes made outside of a transaction.
+func Publish(changes ...*Change) {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+	_FEED.publish(changes)
+}
+
+// Keep the changes of a transaction until it commits.
+func Stage(txId string, changes ...*Change) {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+	tx := _FEED.tx(txId)
+	tx.changes = append(tx.changes, changes...)
+}
+
+// Mark a savepoint of a transaction, so that rolling back to it discards the changes
+// since. Transactions without changes need no savepoints.
+func Savepoint(txId, savepoint string) {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+	if tx, ok := _FEED.txs[txId]; ok {
+		tx.savepoints[savepoint] = len(tx.changes)
+	}
+}
+
+// Publish the changes of a transaction.
+func Commit(txId string) {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+	if tx, ok := _FEED.txs[txId]; ok {
+		delete(_FEED.txs, txId)
+		_FEED.publish(tx.changes)
+	}
+}
+
+// Discard the changes of a transaction since a savepoint, or all of them if
+// the savepoint is empty.
+func Rollback(txId, savepoint string) {
+	_FEED.Lock()
+	defer _FEED.Unlock()
+	tx, ok := _FEED.txs[txId]
+	if !ok {
+		return
+	}
+
+	if savepoint == "" {
+		delete(_FEED.txs, txId)
+		return
+	}
+
+	// savepoints that are not known were marked before the first change
+	n := tx.savepoints[savepoint]
+	tx.changes = tx.changes[:n]
+	for name, m := range tx.savepoints {
+		if m > n {
+			delete(tx.savepoints, name)
+		}
+	}
+}
+
+// Statements in a transaction are atomic: the changes of a failed statement are
+// discarded, and those of the previous statements kept.
+func StartStatement(txId string) {
+	Savepoint(txId, _STATEMENT)
+}
+
+func RollbackStatement(txId string) {
+	Rollback(txId, _STATEMENT)
+}
+
+func (this *feed) tx(txId string) *txChanges {
+	tx, ok := this.txs[txId]
+	if !ok {
+		tx = &txChanges{savepoints: make(map[string]int)}
+		this.txs[txId] = tx
+	}
+	return tx
+}
+
+func (this *feed) publish(changes []*Change) {
+	now := time.Now()
+	for _, change := range changes {
+		this.seq++
+		change.Seq = this.seq
+		change.Time = now
+
+		if len(this.retained) < _RETAINED {
+			this.retained = append(this.retained, change)
+		} else {
+			this.retained[this.next] = change
+			this.next = (this.next + 1) % _RETAINED
+		}
+
+		for sub := range this.subscribers {
+			if !sub.matches(change) {
+				continue
+			}
+			select {
+			case sub.changes <- change:
+			default:
+				sub.dropped = true
+				this.unsubscribe(sub)
+			}
+		}
+	}
+}
+
+func (this *feed) unsubscribe(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.changes)
+	delete(this.subscribers, sub)
+	atomic.StoreInt32(&this.active, int32(len(this.subscribers)))
+	if len(this.subscribers) == 0 {
+		atomic.StoreInt64(&this.lingerUntil, time.Now().Add(_LINGER).UnixNano())
+	}
+}
+
+// the retained changes, oldest first
+func (this *feed) ordered() []*Change {
+	rv := make([]*Change, 0, len(this.retained))
+	rv = append(rv, this.retained[this.next:]...)
+	return append(rv, this.retained[:this.next]...)
+}
@@ -0,0 +1,103 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package changefeed
+
+import (
+	"testing"
+)
+
+func newChange(keyspace, key string) *Change {
+	return &Change{Type: UPSERT, Keyspace: keyspace, Key: key}
+}
+
+func receive(t *testing.T, sub *Subscription, keys ...string) {
+	for _, key := range keys {
+		select {
+		case change := <-sub.Changes():
+			if change == nil || change.Key != key {
+				t.Fatalf("expected change to %s, got %v", key, change)
+			}
+		default:
+			t.Fatalf("expected change to %s, got none", key)
+		}
+	}
+	select {
+	case change := <-sub.Changes():
+		t.Fatalf("unexpected change %v", change)
+	default:
+	}
+}
+
+func TestChangeFeed(t *testing.T) {
+	all, _ := Subscribe(0)
+	defer all.Close()
+	some, _ := Subscribe(0, "default:b1")
+	defer some.Close()
+
+	if !Enabled() {
+		t.Fatalf("expected feed to be enabled")
+	}
+
+	Publish(newChange("default:b1", "k1"), newChange("default:b2", "k2"))
+	receive(t, all, "k1", "k2")
+	receive(t, some, "k1")
+
+	// transactions publish on commit, less what was rolled back
+	Stage("tx1", newChange("default:b1", "k3"))
+	Savepoint("tx1", "s1")
+	Stage("tx1", newChange("default:b1", "k4"))
+	StartStatement("tx1")
+	Stage("tx1", newChange("default:b1", "k5"))
+	RollbackStatement("tx1")
+	receive(t, all)
+	Rollback("tx1", "s1")
+	Stage("tx1", newChange("default:b1", "k6"))
+	Commit("tx1")
+	receive(t, some, "k3", "k6")
+	receive(t, all, "k3", "k6")
+
+	Stage("tx2", newChange("default:b1", "k7"))
+	Rollback("tx2", "")
+	Commit("tx2")
+	receive(t, all)
+
+	// resuming replays the changes missed
+	last := LastSeq()
+	Publish(newChange("default:b2", "k8"), newChange("default:b1", "k9"))
+	resumed, complete := Subscribe(last, "default:b1")
+	if !complete {
+		t.Fatalf("expected complete replay")
+	}
+	receive(t, resumed, "k9")
+	resumed.Close()
+	if _, ok := <-resumed.Changes(); ok {
+		t.Fatalf("expected closed subscription")
+	}
+	receive(t, all, "k8", "k9")
+
+	// slow subscribers are dropped
+	slow, _ := Subscribe(0)
+	for i := 0; i <= _BUFFER; i++ {
+		Publish(newChange("default:b2", "k"))
+		<-all.Changes()
+	}
+	if !slow.Dropped() {
+		t.Fatalf("expected slow subscriber to be dropped")
+	}
+	if all.Dropped() {
+		t.Fatalf("unexpected drop of subscriber")
+	}
+
+	// resuming after the retained changes is incomplete
+	late, complete := Subscribe(1)
+	late.Close()
+	if complete {
+		t.Fatalf("expected incomplete replay")
+	}
+}
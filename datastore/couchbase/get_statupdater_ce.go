@@ -6,8 +6,8 @@
 // be governed by the Apache License, Version 2.0, included in the file
 // licenses/APL.txt.
 //
-// Currently, the community edition does not have access to update
-// statistics, so this stub returns an error.
+// The community edition collects statistics with the statistics package,
+// which keeps them in memory, or in the statistics directory if one is set.
 
 // +build !enterprise
 
@@ -16,31 +16,9 @@ package couchbase
 import (
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
-	"github.com/couchbase/query/expression"
-	"github.com/couchbase/query/value"
+	"github.com/couchbase/query/statistics"
 )
 
-type NopStatUpdater struct {
-}
-
-func (dsu *NopStatUpdater) Name() datastore.StatUpdaterType {
-	return ("UpdateStatisticsUnsuppored")
-}
-
-func (dsu *NopStatUpdater) UpdateStatistics(ks datastore.Keyspace, indexes []datastore.Index,
-	terms expression.Expressions, with value.Value, conn *datastore.ValueConnection,
-	exContext interface{}, internal bool) {
-	conn.Error(errors.NewOtherNotImplementedError(nil, "UPDATE STATISTICS. This is an Enterprise only feature."))
-	close(conn.ValueChannel())
-}
-
-func (dsu *NopStatUpdater) DeleteStatistics(ks datastore.Keyspace, terms expression.Expressions,
-	conn *datastore.ValueConnection, exContext interface{}) {
-	conn.Error(errors.NewOtherNotImplementedError(nil, "UPDATE STATISTICS. This is an Enterprise only feature."))
-	close(conn.ValueChannel())
-}
-
 func GetDefaultStatUpdater(store datastore.Datastore) (datastore.StatUpdater, errors.Error) {
-	statUpdater := new(NopStatUpdater)
-	return statUpdater, nil
+	return statistics.NewStatUpdater(), nil
 }
@@ -18,18 +18,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 
-	"github.com/couchbase/query/auth"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/datastore/virtual"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/expression"
 	"github.com/couchbase/query/logging"
+	"github.com/couchbase/query/statistics"
 	"github.com/couchbase/query/timestamp"
 	"github.com/couchbase/query/util"
 	"github.com/couchbase/query/value"
@@ -42,7 +41,12 @@ type store struct {
 	namespaceNames []string
 	inferencer     datastore.Inferencer // what we use to infer schemas
 
-	users map[string]*datastore.User
+	users     map[string]*fileUser // by domain:id
+	usersFile string               // set if the users are kept in a file
+	usersLock sync.RWMutex
+
+	// held while transactions move their documents in place
+	commitLock sync.RWMutex
 }
 
 func (s *store) Id() string {
@@ -93,17 +97,6 @@ func (s *store) NamespaceByName(name string) (p datastore.Namespace, e errors.Er
 	return
 }
 
-func (s *store) Authorize(*auth.Privileges, *auth.Credentials) (auth.AuthenticatedUsers, errors.Error) {
-	return nil, nil
-}
-
-func (s *store) PreAuthorize(*auth.Privileges) {
-}
-
-func (s *store) CredsString(req *http.Request) string {
-	return ""
-}
-
 func (s *store) SetLogLevel(level logging.Level) {
 	// No-op. Uses query engine logger.
 }
@@ -118,7 +111,7 @@ func (s *store) Inferencers() ([]datastore.Inferencer, errors.Error) {
 }
 
 func (s *store) StatUpdater() (datastore.StatUpdater, errors.Error) {
-	return nil, errors.NewOtherNotImplementedError(nil, "UPDATE STATISTICS")
+	return statistics.NewStatUpdater(), nil
 }
 
 func (s *store) SetConnectionSecurityConfig(conSecConfig *datastore.ConnectionSecurityConfig) {
@@ -136,34 +129,6 @@ func (s *store) ProcessAuditUpdateStream(callb func(uid string) error) errors.Er
 func (s *store) EnableStorageAudit(val bool) {
 }
 
-func (s *store) UserInfo() (value.Value, errors.Error) {
-	// Return an array of no users.
-	jsonData := make([]interface{}, 0)
-	v := value.NewValue(jsonData)
-	return v, nil
-}
-
-func (s *store) GetUserInfoAll() ([]datastore.User, errors.Error) {
-	ret := make([]datastore.User, 0, len(s.users))
-	for _, v := range s.users {
-		ret = append(ret, *v)
-	}
-	return ret, nil
-}
-
-func (s *store) PutUserInfo(u *datastore.User) errors.Error {
-	s.users[u.Id] = u
-	return nil
-}
-
-func (s *store) GetRolesAll() ([]datastore.Role, errors.Error) {
-	return []datastore.Role{
-		datastore.Role{Name: "cluster_admin"},
-		datastore.Role{Name: "replication_admin"},
-		datastore.Role{Name: "bucket_admin", Target: "*"},
-	}, nil
-}
-
 func (s *store) CreateSystemCBOStats(requestId string) errors.Error {
 	return nil
 }
@@ -176,26 +141,6 @@ func (s *store) HasSystemCBOStats() (bool, errors.Error) {
 	return false, nil
 }
 
-func (s *store) StartTransaction(stmtAtomicity bool, context datastore.QueryContext) (map[string]bool, errors.Error) {
-	return nil, errors.NewTranDatastoreNotSupportedError("file")
-}
-
-func (s *store) CommitTransaction(stmtAtomicity bool, context datastore.QueryContext) errors.Error {
-	return errors.NewTranDatastoreNotSupportedError("file")
-}
-
-func (s *store) RollbackTransaction(stmtAtomicity bool, context datastore.QueryContext, sname string) errors.Error {
-	return errors.NewTranDatastoreNotSupportedError("file")
-}
-
-func (s *store) SetSavepoint(stmtAtomicity bool, context datastore.QueryContext, sname string) errors.Error {
-	return errors.NewTranDatastoreNotSupportedError("file")
-}
-
-func (s *store) TransactionDeltaKeyScan(keyspace string, conn *datastore.IndexConnection) {
-	defer conn.Sender().Close()
-}
-
 // NewStore creates a new file-based store for the given filepath.
 func NewDatastore(path string) (s datastore.Datastore, e errors.Error) {
 	path, er := filepath.Abs(path)
@@ -203,12 +148,17 @@ func NewDatastore(path string) (s datastore.Datastore, e errors.Error) {
 		return nil, errors.NewFileDatastoreError(er, "")
 	}
 
-	fs := &store{path: path, users: make(map[string]*datastore.User, 4)}
+	fs := &store{path: path, users: make(map[string]*fileUser, 4)}
 
 	e = fs.loadNamespaces()
 	if e != nil {
 		return
 	}
+	e = fs.loadUsers()
+	if e != nil {
+		return
+	}
+	fs.recoverTransactions()
 
 	// get the schema inferencer
 	var err errors.Error
@@ -283,7 +233,7 @@ func (p *namespace) Objects(preload bool) ([]datastore.Object, errors.Error) {
 	rv := make([]datastore.Object, len(p.keyspaceNames))
 	i := 0
 	for _, k := range p.keyspaceNames {
-		rv[i] = datastore.Object{Id: k, Name: k, IsKeyspace: true}
+		rv[i] = datastore.Object{Id: k, Name: k, IsKeyspace: true, IsBucket: true}
 		i++
 	}
 	return rv, nil
@@ -358,28 +308,41 @@ func (p *namespace) loadKeyspaces() (e errors.Error) {
 	return
 }
 
+// every keyspace of a namespace is also a bucket
 func (p *namespace) BucketIds() ([]string, errors.Error) {
-	return datastore.NO_STRINGS, nil
+	return p.KeyspaceNames()
 }
 
 func (p *namespace) BucketNames() ([]string, errors.Error) {
-	return datastore.NO_STRINGS, nil
+	return p.KeyspaceNames()
 }
 
-func (p *namespace) BucketById(name string) (datastore.Bucket, errors.Error) {
-	return nil, errors.NewOtherNoBuckets("file")
+func (p *namespace) BucketById(id string) (datastore.Bucket, errors.Error) {
+	return p.BucketByName(id)
 }
 
 func (p *namespace) BucketByName(name string) (datastore.Bucket, errors.Error) {
-	return nil, errors.NewOtherNoBuckets("file")
+	b, ok := p.keyspaces[strings.ToUpper(name)]
+	if !ok {
+		return nil, errors.NewFileBucketNotFoundError(nil, p.name+":"+name)
+	}
+	return b, nil
 }
 
-// keyspace is a file-based keyspace.
+// keyspace is a file-based keyspace: either a bucket, which is a directory
+// of the namespace, or a collection in one of the scopes of a bucket.
 type keyspace struct {
 	namespace *namespace
+	scope     *scope // nil for buckets
 	name      string
-	fi        datastore.Indexer
+	fi        *fileIndexer
 	fileLock  sync.Mutex
+
+	expiriesLock sync.RWMutex
+	expiries     map[string]uint32 // the documents that expire, by key
+
+	scopesLock sync.RWMutex
+	scopes     map[string]*scope // the scopes of a bucket, by upper case name
 }
 
 func (b *keyspace) NamespaceId() string {
@@ -403,19 +366,39 @@ func (b *keyspace) Uid() string {
 }
 
 func (b *keyspace) QualifiedName() string {
+	if b.scope != nil {
+		return b.namespace.name + ":" + b.scope.bucket.name + "." + b.scope.name + "." + b.name
+	}
 	return b.namespace.name + ":" + b.name
 }
 
 func (b *keyspace) AuthKey() string {
+	if b.scope != nil {
+		return b.scope.AuthKey() + ":" + b.name
+	}
 	return b.name
 }
 
 func (b *keyspace) Scope() datastore.Scope {
-	return nil
+	if b.scope == nil {
+		return nil
+	}
+	return b.scope
 }
 
 func (b *keyspace) ScopeId() string {
-	return ""
+	if b.scope == nil {
+		return ""
+	}
+	return b.scope.Id()
+}
+
+// the bucket of a collection, empty for buckets
+func (b *keyspace) bucketId() string {
+	if b.scope == nil {
+		return ""
+	}
+	return b.scope.BucketId()
 }
 
 func (b *keyspace) MetadataVersion() uint64 {
@@ -448,7 +431,14 @@ func (b *keyspace) Count(context datastore.QueryContext) (int64, errors.Error) {
 	if er != nil {
 		return 0, errors.NewFileDatastoreError(er, "")
 	}
-	return int64(len(dirEntries)), nil
+	var count int64
+	now := unixNow()
+	for _, ent := range dirEntries {
+		if !ent.IsDir() && !b.expired(documentPathToId(ent.Name()), now) {
+			count++
+		}
+	}
+	return count, nil
 }
 
 func (b *keyspace) Size(context datastore.QueryContext) (int64, errors.Error) {
@@ -458,7 +448,9 @@ func (b *keyspace) Size(context datastore.QueryContext) (int64, errors.Error) {
 	}
 	var size int64
 	for _, ent := range dirEntries {
-		size += ent.Size()
+		if !ent.IsDir() {
+			size += ent.Size()
+		}
 	}
 	return size, nil
 }
@@ -475,6 +467,18 @@ func (b *keyspace) Fetch(keys []string, keysMap map[string]value.AnnotatedValue,
 	context datastore.QueryContext, subPaths []string) []errors.Error {
 	var errs []errors.Error
 
+	tx, err := getTransaction(context)
+	if err != nil {
+		return []errors.Error{err}
+	}
+
+	b.namespace.store.commitLock.RLock()
+	defer b.namespace.store.commitLock.RUnlock()
+
+	if tx != nil {
+		return b.txFetch(tx, keys, keysMap)
+	}
+
 	for _, k := range keys {
 		item, e := b.fetchOne(k)
 
@@ -501,19 +505,28 @@ func (b *keyspace) Fetch(keys []string, keysMap map[string]value.AnnotatedValue,
 }
 
 func (b *keyspace) fetchOne(key string) (value.AnnotatedValue, errors.Error) {
+	meta, er := b.readMeta(key)
+	if er != nil {
+		return nil, errors.NewFileDatastoreError(er, "")
+	}
+	if meta.expired(unixNow()) {
+		return nil, errors.NewFileDatastoreError(os.ErrNotExist, "")
+	}
+
 	path := filepath.Join(b.path(), key+".json")
 	item, e := fetch(path)
 	if e != nil {
-		item = nil
+		return nil, e
 	}
-
-	return item, e
+	b.setMeta(item, meta)
+	return item, nil
 }
 
 const (
 	INSERT = 0x01
 	UPDATE = 0x02
 	UPSERT = 0x04
+	DELETE = 0x08
 )
 
 func opToString(op int) string {
@@ -525,6 +538,8 @@ func opToString(op int) string {
 		return "update"
 	case UPSERT:
 		return "upsert"
+	case DELETE:
+		return "delete"
 	}
 
 	return "unknown operation"
@@ -536,40 +551,57 @@ func (b *keyspace) performOp(op int, kvPairs []value.Pair, context datastore.Que
 		return nil, errors.NewFileNoKeysInsertError(nil, "keyspace "+b.Name())
 	}
 
+	tx, err := getTransaction(context)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		return b.txPerformOp(tx, op, kvPairs)
+	}
+
 	insertedKeys := make([]value.Pair, 0)
+	indexed := make([]value.Pair, 0, len(kvPairs))
 	var returnErr errors.Error
 
 	// this lock can be mode more granular FIXME
 	b.fileLock.Lock()
 	defer b.fileLock.Unlock()
 
+	now := unixNow()
 	for _, kv := range kvPairs {
 		var file *os.File
 		var err error
 
 		key := kv.Name
-		value, _ := json.Marshal(kv.Value.Actual())
+		data, _ := json.Marshal(kv.Value.Actual())
 		filename := filepath.Join(b.path(), key+".json")
+		cas, flags := getMeta(kv.Value)
 
 		switch op {
 
 		case INSERT:
-			// add the key only if it doesn't exist
-			if _, err = os.Stat(filename); err == nil {
+			// add the key only if it doesn't exist, or has expired
+			if b.exists(key, now) {
 				err = errors.NewFileKeyExists(nil, "Key (File) "+filename)
 			} else {
 				// create and write the file
 				if file, err = os.Create(filename); err == nil {
-					_, err = file.Write(value)
+					_, err = file.Write(data)
 					file.Close()
 				}
 			}
 		case UPDATE:
-			// add the key only if it doesn't exist
-			if _, err = os.Stat(filename); err == nil {
-				// open and write the file
-				if file, err = os.OpenFile(filename, os.O_TRUNC|os.O_RDWR, 0666); err == nil {
-					_, err = file.Write(value)
+			// update the key only if it exists, and has not changed since it was fetched
+			var meta *docMeta
+			if meta, err = b.readMeta(key); err == nil {
+				if meta.expired(now) {
+					err = os.ErrNotExist
+				} else if cas != 0 && cas != meta.Cas {
+					returnErr = errors.NewFileCasMismatchError(returnErr, "key "+key)
+					continue
+				} else if file, err = os.OpenFile(filename, os.O_TRUNC|os.O_RDWR, 0666); err == nil {
+					// open and write the file
+					_, err = file.Write(data)
 					file.Close()
 				}
 			}
@@ -577,18 +609,28 @@ func (b *keyspace) performOp(op int, kvPairs []value.Pair, context datastore.Que
 		case UPSERT:
 			// open the file for writing, if doesn't exist then create
 			if file, err = os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666); err == nil {
-				_, err = file.Write(value)
+				_, err = file.Write(data)
 				file.Close()
 			}
 		}
 
+		if err == nil {
+			cas = newCas()
+			err = b.writeMeta(key, &docMeta{Cas: cas, Expiration: getExpiration(kv.Options, now), Flags: flags})
+		}
+
 		if err != nil {
 			returnErr = errors.NewFileDMLError(returnErr, opToString(op)+" Failed "+err.Error())
 		} else {
+			setMetaCas(kv.Value, cas)
 			insertedKeys = append(insertedKeys, kv)
+			doc := value.NewAnnotatedValue(value.NewValue(data))
+			doc.SetId(key)
+			indexed = append(indexed, value.Pair{Name: key, Value: doc})
 		}
 	}
 
+	b.fi.updateIndexes(indexed)
 	return insertedKeys, returnErr
 
 }
@@ -608,78 +650,157 @@ func (b *keyspace) Upsert(upserts []value.Pair, context datastore.QueryContext)
 func (b *keyspace) Delete(deletes []value.Pair, context datastore.QueryContext) ([]value.Pair, errors.Error) {
 
 	var fileError []string
-	var deleted []value.Pair
+	var casError errors.Error
+	var deleted, removed []value.Pair
+
+	tx, err := getTransaction(context)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		return b.txDelete(tx, deletes)
+	}
+
+	b.fileLock.Lock()
+	defer b.fileLock.Unlock()
+
+	now := unixNow()
 	for _, pair := range deletes {
 		key := pair.Name
 		filename := filepath.Join(b.path(), key+".json")
-		if err := os.Remove(filename); err != nil {
-			if !os.IsNotExist(err) {
-				fileError = append(fileError, err.Error())
+
+		// documents that have changed since they were fetched are kept
+		meta, err := b.readMeta(key)
+		if err == nil && !meta.expired(now) {
+			if cas, _ := getMeta(pair.Value); cas != 0 && cas != meta.Cas {
+				casError = errors.NewFileCasMismatchError(casError, "key "+key)
+				continue
 			}
-		} else {
-			deleted = append(deleted, pair)
+		}
+
+		// expired documents are purged, but were not there to be deleted
+		if err = os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			fileError = append(fileError, err.Error())
+			continue
+		}
+		b.removeMeta(key)
+		if err == nil {
+			if meta == nil || !meta.expired(now) {
+				deleted = append(deleted, pair)
+			}
+			removed = append(removed, value.Pair{Name: key})
 		}
 	}
 
+	b.fi.updateIndexes(removed)
+
 	if len(fileError) > 0 {
 		errLine := fmt.Sprintf("Delete failed on some keys %v", fileError)
-		return deleted, errors.NewFileDatastoreError(nil, errLine)
+		return deleted, errors.NewFileDatastoreError(casError, errLine)
 	}
 
-	return deleted, nil
+	return deleted, casError
 }
 
 func (b *keyspace) Release(close bool) {
 }
 
-func (b *keyspace) CreateScope(name string) errors.Error {
-	return errors.NewScopesNotSupportedError(b.name)
-}
+// Flush removes all the documents of the keyspace.
+func (b *keyspace) Flush() errors.Error {
+	b.fileLock.Lock()
+	defer b.fileLock.Unlock()
 
-func (b *keyspace) DropScope(name string) errors.Error {
-	return errors.NewScopesNotSupportedError(b.name)
-}
+	dirEntries, er := ioutil.ReadDir(b.path())
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	removed := make([]value.Pair, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		er = os.Remove(filepath.Join(b.path(), dirEntry.Name()))
+		if er != nil && !os.IsNotExist(er) {
+			b.fi.updateIndexes(removed)
+			return errors.NewFileDatastoreError(er, "")
+		}
+		removed = append(removed, value.Pair{Name: documentPathToId(dirEntry.Name())})
+	}
+	b.fi.updateIndexes(removed)
 
-func (b *keyspace) Flush() errors.Error {
-	return errors.NewNoFlushError(b.name)
+	er = os.RemoveAll(filepath.Join(b.path(), _META_DIR))
+	b.expiriesLock.Lock()
+	b.expiries = make(map[string]uint32)
+	b.expiriesLock.Unlock()
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	return nil
 }
 
 func (b *keyspace) IsBucket() bool {
-	return true
+	return b.scope == nil
 }
 
 func (b *keyspace) path() string {
+	if b.scope != nil {
+		return filepath.Join(b.scope.path(), b.name)
+	}
 	return filepath.Join(b.namespace.path(), b.name)
 }
 
+// the documents and directories of the keyspace, never halfway through a commit
+func (b *keyspace) readDir() ([]os.FileInfo, error) {
+	b.namespace.store.commitLock.RLock()
+	defer b.namespace.store.commitLock.RUnlock()
+	return ioutil.ReadDir(b.path())
+}
+
 // newKeyspace creates a new keyspace.
 func newKeyspace(p *namespace, dir string) (b *keyspace, e errors.Error) {
 	b = new(keyspace)
 	b.namespace = p
 	b.name = dir
 
+	if e = b.load(); e != nil {
+		return nil, e
+	}
+	if e = b.loadScopes(); e != nil {
+		return nil, e
+	}
+
+	return
+}
+
+// load checks the directory of the keyspace and loads its metadata and indexes.
+func (b *keyspace) load() errors.Error {
 	fi, er := os.Stat(b.path())
 	if er != nil {
-		return nil, errors.NewFileDatastoreError(er, "")
+		return errors.NewFileDatastoreError(er, "")
 	}
 
 	if !fi.IsDir() {
-		return nil, errors.NewFileKeyspaceNotDirError(nil, "Keyspace path "+dir)
+		return errors.NewFileKeyspaceNotDirError(nil, "Keyspace path "+b.name)
+	}
+
+	if er = b.loadMeta(); er != nil {
+		return errors.NewFileDatastoreError(er, "")
 	}
 
 	b.fi = newFileIndexer(b)
 	b.fi.CreatePrimaryIndex("", "#primary", nil)
-
-	return
+	return b.fi.loadIndexes()
 }
 
 type fileIndexer struct {
+	sync.RWMutex
 	keyspace *keyspace
 	indexes  map[string]datastore.Index
 	primary  datastore.PrimaryIndex
+	version  uint64
 }
 
-func newFileIndexer(keyspace *keyspace) datastore.Indexer {
+func newFileIndexer(keyspace *keyspace) *fileIndexer {
 
 	return &fileIndexer{
 		keyspace: keyspace,
@@ -688,11 +809,11 @@ func newFileIndexer(keyspace *keyspace) datastore.Indexer {
 }
 
 func (fi *fileIndexer) BucketId() string {
-	return ""
+	return fi.keyspace.bucketId()
 }
 
 func (fi *fileIndexer) ScopeId() string {
-	return ""
+	return fi.keyspace.ScopeId()
 }
 
 func (fi *fileIndexer) KeyspaceId() string {
@@ -704,14 +825,12 @@ func (fi *fileIndexer) Name() datastore.IndexType {
 }
 
 func (fi *fileIndexer) IndexIds() ([]string, errors.Error) {
-	rv := make([]string, 0, len(fi.indexes))
-	for name, _ := range fi.indexes {
-		rv = append(rv, name)
-	}
-	return rv, nil
+	return fi.IndexNames()
 }
 
 func (fi *fileIndexer) IndexNames() ([]string, errors.Error) {
+	fi.RLock()
+	defer fi.RUnlock()
 	rv := make([]string, 0, len(fi.indexes))
 	for name, _ := range fi.indexes {
 		rv = append(rv, name)
@@ -724,6 +843,8 @@ func (fi *fileIndexer) IndexById(id string) (datastore.Index, errors.Error) {
 }
 
 func (fi *fileIndexer) IndexByName(name string) (datastore.Index, errors.Error) {
+	fi.RLock()
+	defer fi.RUnlock()
 	index, ok := fi.indexes[name]
 	if !ok {
 		return nil, errors.NewFileIdxNotFound(nil, name)
@@ -736,11 +857,19 @@ func (fi *fileIndexer) PrimaryIndexes() ([]datastore.PrimaryIndex, errors.Error)
 }
 
 func (fi *fileIndexer) Indexes() ([]datastore.Index, errors.Error) {
-	return []datastore.Index{fi.primary}, nil
+	fi.RLock()
+	defer fi.RUnlock()
+	rv := make([]datastore.Index, 0, len(fi.indexes))
+	for _, index := range fi.indexes {
+		rv = append(rv, index)
+	}
+	return rv, nil
 }
 
 func (fi *fileIndexer) CreatePrimaryIndex(requestId, name string, with value.Value) (
 	datastore.PrimaryIndex, errors.Error) {
+	fi.Lock()
+	defer fi.Unlock()
 	if fi.primary == nil {
 		pi := new(primaryIndex)
 		fi.primary = pi
@@ -753,13 +882,173 @@ func (fi *fileIndexer) CreatePrimaryIndex(requestId, name string, with value.Val
 	return fi.primary, nil
 }
 
-func (b *fileIndexer) CreateIndex(requestId, name string, seekKey, rangeKey expression.Expressions,
+func (fi *fileIndexer) CreatePrimaryIndex3(requestId, name string, indexPartition *datastore.IndexPartition,
+	with value.Value) (datastore.PrimaryIndex, errors.Error) {
+	if indexPartition != nil {
+		return nil, errors.NewFileNotSupported(nil, "Partitioned indexes are not supported for file-based datastore.")
+	}
+	return fi.CreatePrimaryIndex(requestId, name, with)
+}
+
+func (fi *fileIndexer) CreateIndex(requestId, name string, seekKey, rangeKey expression.Expressions,
 	where expression.Expression, with value.Value) (datastore.Index, errors.Error) {
-	return nil, errors.NewFileNotSupported(nil, "CREATE INDEX is not supported for file-based datastore.")
+	keys := make(datastore.IndexKeys, len(rangeKey))
+	for i, expr := range rangeKey {
+		keys[i] = &datastore.IndexKey{Expr: expr}
+	}
+	return fi.CreateIndex3(requestId, name, keys, nil, where, with)
+}
+
+func (fi *fileIndexer) CreateIndex2(requestId, name string, seekKey expression.Expressions,
+	rangeKey datastore.IndexKeys, where expression.Expression, with value.Value) (
+	datastore.Index, errors.Error) {
+	return fi.CreateIndex3(requestId, name, rangeKey, nil, where, with)
+}
+
+func (fi *fileIndexer) CreateIndex3(requestId, name string, rangeKey datastore.IndexKeys,
+	indexPartition *datastore.IndexPartition, where expression.Expression, with value.Value) (
+	datastore.Index, errors.Error) {
+	if indexPartition != nil {
+		return nil, errors.NewFileNotSupported(nil, "Partitioned indexes are not supported for file-based datastore.")
+	}
+
+	fi.Lock()
+	if _, ok := fi.indexes[name]; ok {
+		fi.Unlock()
+		return nil, errors.NewFileIdxExistsError(nil, name)
+	}
+	si := newSecondaryIndex(fi, name, rangeKey, where)
+	fi.indexes[name] = si
+	fi.version++
+	fi.Unlock()
+
+	var err errors.Error
+	if deferBuild(with) {
+		err = si.save()
+	} else {
+		err = si.build()
+	}
+	if err != nil {
+		fi.Lock()
+		delete(fi.indexes, name)
+		fi.Unlock()
+		si.remove()
+		return nil, err
+	}
+	return si, nil
 }
 
-func (b *fileIndexer) BuildIndexes(requestId string, names ...string) errors.Error {
-	return errors.NewFileNotSupported(nil, "BUILD INDEXES is not supported for file-based datastore.")
+func deferBuild(with value.Value) bool {
+	if with == nil {
+		return false
+	}
+	deferred, ok := with.Field("defer_build")
+	return ok && deferred.Truth()
+}
+
+func (fi *fileIndexer) BuildIndexes(requestId string, names ...string) errors.Error {
+	indexes := make([]*secondaryIndex, 0, len(names))
+	for _, name := range names {
+		index, err := fi.IndexByName(name)
+		if err != nil {
+			return err
+		}
+		if si, ok := index.(*secondaryIndex); ok {
+			if state, _, _ := si.State(); state == datastore.DEFERRED {
+				indexes = append(indexes, si)
+			}
+		}
+	}
+
+	for _, si := range indexes {
+		if err := si.build(); err != nil {
+			return err
+		}
+	}
+
+	fi.Lock()
+	fi.version++
+	fi.Unlock()
+	return nil
+}
+
+func (fi *fileIndexer) dropIndex(si *secondaryIndex) errors.Error {
+	fi.Lock()
+	if fi.indexes[si.name] != si {
+		fi.Unlock()
+		return errors.NewFileIdxNotFound(nil, si.name)
+	}
+	delete(fi.indexes, si.name)
+	fi.version++
+	fi.Unlock()
+
+	// not while document changes are being logged
+	fi.keyspace.fileLock.Lock()
+	defer fi.keyspace.fileLock.Unlock()
+	return si.remove()
+}
+
+// load the persisted secondary indexes of the keyspace
+func (fi *fileIndexer) loadIndexes() errors.Error {
+	dirEntries, er := ioutil.ReadDir(filepath.Join(fi.keyspace.path(), _INDEX_DIR))
+	if er != nil {
+		if os.IsNotExist(er) {
+			return nil
+		}
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || filepath.Ext(dirEntry.Name()) != ".json" {
+			continue
+		}
+		si, err := loadIndex(fi, filepath.Join(fi.keyspace.path(), _INDEX_DIR, dirEntry.Name()))
+		if err != nil {
+			return err
+		}
+		fi.indexes[si.name] = si
+	}
+	return nil
+}
+
+// keep the secondary indexes in step with the documents; a nil value denotes a deletion
+func (fi *fileIndexer) updateIndexes(docs []value.Pair) {
+	if len(docs) == 0 {
+		return
+	}
+
+	fi.RLock()
+	indexes := make([]*secondaryIndex, 0, len(fi.indexes))
+	for _, index := range fi.indexes {
+		if si, ok := index.(*secondaryIndex); ok {
+			indexes = append(indexes, si)
+		}
+	}
+	fi.RUnlock()
+
+	context := expression.NewIndexContext()
+	for _, si := range indexes {
+		records := make([]indexLogRecord, 0, len(docs))
+		for _, doc := range docs {
+			entries, ok := si.update(doc.Name, doc.Value, context)
+			if !ok {
+				break
+			}
+			r := indexLogRecord{Id: doc.Name}
+			if len(entries) > 0 {
+				r.Entries = make([]indexEntryFile, len(entries))
+				for i, e := range entries {
+					r.Entries[i] = newIndexEntryFile(e)
+				}
+			}
+			records = append(records, r)
+		}
+		if len(records) > 0 {
+			if err := si.log(records); err != nil {
+				logging.Errorf("Failed to save index %v on keyspace %v: %v", si.name, fi.keyspace.name, err)
+			}
+		}
+	}
 }
 
 func (b *fileIndexer) Refresh() errors.Error {
@@ -767,7 +1056,9 @@ func (b *fileIndexer) Refresh() errors.Error {
 }
 
 func (b *fileIndexer) MetadataVersion() uint64 {
-	return 0
+	b.RLock()
+	defer b.RUnlock()
+	return b.version
 }
 
 func (b *fileIndexer) SetLogLevel(level logging.Level) {
@@ -786,11 +1077,11 @@ type primaryIndex struct {
 }
 
 func (pi *primaryIndex) BucketId() string {
-	return ""
+	return pi.keyspace.bucketId()
 }
 
 func (pi *primaryIndex) ScopeId() string {
-	return ""
+	return pi.keyspace.ScopeId()
 }
 
 func (pi *primaryIndex) KeyspaceId() string {
@@ -875,13 +1166,14 @@ func (pi *primaryIndex) Scan(requestId string, span *datastore.Span, distinct bo
 		}
 	}
 
-	dirEntries, er := ioutil.ReadDir(pi.keyspace.path())
+	dirEntries, er := pi.keyspace.readDir()
 	if er != nil {
 		conn.Error(errors.NewFileDatastoreError(er, ""))
 		return
 	}
 
 	var n int64 = 0
+	now := unixNow()
 	for _, dirEntry := range dirEntries {
 
 		logging.Debugf("Dir entry being scanned <ud>%v</ud>", dirEntry.Name())
@@ -905,7 +1197,7 @@ func (pi *primaryIndex) Scan(requestId string, span *datastore.Span, distinct bo
 			break
 		}
 
-		if !dirEntry.IsDir() {
+		if !dirEntry.IsDir() && !pi.keyspace.expired(id, now) {
 			entry := datastore.IndexEntry{PrimaryKey: id}
 			conn.Sender().SendEntry(&entry)
 			n++
@@ -917,18 +1209,20 @@ func (pi *primaryIndex) ScanEntries(requestId string, limit int64, cons datastor
 	vector timestamp.Vector, conn *datastore.IndexConnection) {
 	defer conn.Sender().Close()
 
-	dirEntries, er := ioutil.ReadDir(pi.keyspace.path())
+	dirEntries, er := pi.keyspace.readDir()
 	if er != nil {
 		conn.Error(errors.NewFileDatastoreError(er, ""))
 		return
 	}
 
+	now := unixNow()
 	for i, dirEntry := range dirEntries {
 		if limit > 0 && int64(i) > limit {
 			break
 		}
-		if !dirEntry.IsDir() {
-			entry := datastore.IndexEntry{PrimaryKey: documentPathToId(dirEntry.Name())}
+		id := documentPathToId(dirEntry.Name())
+		if !dirEntry.IsDir() && !pi.keyspace.expired(id, now) {
+			entry := datastore.IndexEntry{PrimaryKey: id}
 			conn.Sender().SendEntry(&entry)
 		}
 	}
@@ -0,0 +1,217 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package file
+
+import (
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+// Grouping and aggregation pushed down to secondary index scans.
+
+type aggGroup struct {
+	group []value.Value
+	aggs  []*aggState
+	ids   map[string]bool
+}
+
+type aggState struct {
+	val      value.Value
+	count    int64
+	distinct *value.Set
+}
+
+// group and aggregate the scanned entries, producing one row per group,
+// in the order in which the groups are first seen
+func aggregate(entries []*indexEntry, nKeys int, groupAggs *datastore.IndexGroupAggregates,
+	projection *datastore.IndexProjection) ([]*datastore.IndexEntry, errors.Error) {
+
+	for _, agg := range groupAggs.Aggregates {
+		switch agg.Operation {
+		case datastore.AGG_MIN, datastore.AGG_MAX, datastore.AGG_SUM, datastore.AGG_COUNT,
+			datastore.AGG_COUNTN, datastore.AGG_AVG:
+		default:
+			return nil, errors.NewFileNotSupported(nil, "Index aggregate "+string(agg.Operation))
+		}
+	}
+
+	context := expression.NewIndexContext()
+	groups := make(map[string]*aggGroup)
+	var order []*aggGroup
+
+	for _, e := range entries {
+		var item value.AnnotatedValue
+		eval := func(keyPos int, expr expression.Expression) (value.Value, errors.Error) {
+			if keyPos >= 0 {
+				if keyPos < nKeys {
+					return e.key[keyPos], nil
+				}
+				return value.NewValue(e.id), nil
+			}
+			if item == nil {
+				item = value.NewAnnotatedValue(value.NewValue(map[string]interface{}{}))
+				for i, name := range groupAggs.IndexKeyNames {
+					if i < nKeys {
+						item.SetCover(name, e.key[i])
+					} else {
+						item.SetCover(name, value.NewValue(e.id))
+					}
+				}
+			}
+			v, err := expr.Evaluate(item, context)
+			if err != nil {
+				return nil, errors.NewEvaluationError(err, "index aggregate")
+			}
+			return v, nil
+		}
+
+		group := make([]value.Value, len(groupAggs.Group))
+		for i, g := range groupAggs.Group {
+			v, err := eval(g.KeyPos, g.Expr)
+			if err != nil {
+				return nil, err
+			}
+			group[i] = v
+		}
+
+		gkey := entryString(group)
+		g, ok := groups[gkey]
+		if !ok {
+			g = &aggGroup{group: group, aggs: make([]*aggState, len(groupAggs.Aggregates))}
+			for i, agg := range groupAggs.Aggregates {
+				g.aggs[i] = &aggState{}
+				if agg.Distinct {
+					g.aggs[i].distinct = value.NewSet(64, false, false)
+				}
+			}
+			if groupAggs.OneForPrimaryKey {
+				g.ids = make(map[string]bool)
+			}
+			groups[gkey] = g
+			order = append(order, g)
+		}
+
+		// array index entries of the same document count once
+		if g.ids != nil {
+			if g.ids[e.id] {
+				continue
+			}
+			g.ids[e.id] = true
+		}
+
+		for i, agg := range groupAggs.Aggregates {
+			state := g.aggs[i]
+
+			// COUNT(*)
+			if agg.KeyPos < 0 && agg.Expr == nil {
+				state.count++
+				continue
+			}
+
+			v, err := eval(agg.KeyPos, agg.Expr)
+			if err != nil {
+				return nil, err
+			}
+			if v.Type() <= value.NULL {
+				continue
+			}
+			if state.distinct != nil {
+				if state.distinct.Has(v) {
+					continue
+				}
+				state.distinct.Add(v)
+			}
+			state.add(agg.Operation, v)
+		}
+	}
+
+	// no groups means a single row, even when there is nothing to aggregate
+	if len(order) == 0 && len(groupAggs.Group) == 0 {
+		g := &aggGroup{aggs: make([]*aggState, len(groupAggs.Aggregates))}
+		for i := range g.aggs {
+			g.aggs[i] = &aggState{}
+		}
+		order = append(order, g)
+	}
+
+	rows := make([]*datastore.IndexEntry, len(order))
+	for r, g := range order {
+		row := &datastore.IndexEntry{}
+		if projection != nil {
+			row.EntryKey = make(value.Values, 0, len(projection.EntryKeys))
+			for _, id := range projection.EntryKeys {
+				row.EntryKey = append(row.EntryKey, g.value(id, groupAggs))
+			}
+		}
+		rows[r] = row
+	}
+	return rows, nil
+}
+
+func (this *aggState) add(op datastore.AggregateType, v value.Value) {
+	switch op {
+	case datastore.AGG_COUNT:
+		this.count++
+	case datastore.AGG_COUNTN:
+		if v.Type() == value.NUMBER {
+			this.count++
+		}
+	case datastore.AGG_SUM, datastore.AGG_AVG:
+		if v.Type() == value.NUMBER {
+			if this.val == nil {
+				this.val = v
+			} else {
+				this.val = value.AsNumberValue(this.val).Add(value.AsNumberValue(v))
+			}
+			this.count++
+		}
+	case datastore.AGG_MIN:
+		if this.val == nil || v.Collate(this.val) < 0 {
+			this.val = v
+		}
+	case datastore.AGG_MAX:
+		if this.val == nil || v.Collate(this.val) > 0 {
+			this.val = v
+		}
+	}
+}
+
+func (this *aggState) result(op datastore.AggregateType) value.Value {
+	switch op {
+	case datastore.AGG_COUNT, datastore.AGG_COUNTN:
+		return value.NewValue(this.count)
+	case datastore.AGG_AVG:
+		if this.val == nil {
+			return value.NULL_VALUE
+		}
+		return value.NewValue(value.AsNumberValue(this.val).Float64() / float64(this.count))
+	default:
+		if this.val == nil {
+			return value.NULL_VALUE
+		}
+		return this.val
+	}
+}
+
+// the group key or aggregate with the given entry key id
+func (this *aggGroup) value(id int, groupAggs *datastore.IndexGroupAggregates) value.Value {
+	for i, g := range groupAggs.Group {
+		if g.EntryKeyId == id {
+			return this.group[i]
+		}
+	}
+	for i, agg := range groupAggs.Aggregates {
+		if agg.EntryKeyId == id {
+			return this.aggs[i].result(agg.Operation)
+		}
+	}
+	return value.MISSING_VALUE
+}
@@ -0,0 +1,489 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/value"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+Users and their roles are kept in the file users.json at the top of
+the datastore directory, in the format of system:user_info with a
+bcrypt password hash for each local user:
+
+	[{"id": "alice", "domain": "local", "name": "Alice",
+	  "password": "$2y$10$...",
+	  "roles": [{"role": "query_select", "bucket_name": "contacts"}]}]
+
+A hash can be made with htpasswd -nbBC 10 "" password. If the file
+exists, requests are authorized against the roles of the users whose
+credentials they carry, and GRANT and REVOKE update the file. If it
+does not, all requests are allowed and users only live in memory.
+*/
+const _USERS_FILE = "users.json"
+
+type fileUser struct {
+	Id       string     `json:"id"`
+	Domain   string     `json:"domain"`
+	Name     string     `json:"name,omitempty"`
+	Password string     `json:"password,omitempty"`
+	Roles    []fileRole `json:"roles"`
+}
+
+type fileRole struct {
+	Role       string `json:"role"`
+	Bucket     string `json:"bucket_name,omitempty"`
+	Scope      string `json:"scope_name,omitempty"`
+	Collection string `json:"collection_name,omitempty"`
+}
+
+/*
+The privileges each role grants. Keyspace roles are granted on a
+bucket, scope or collection, or on all of them with *, and grant
+their privileges only on what is below it.
+*/
+type rolePrivileges struct {
+	keyspace bool
+	all      bool
+	privs    []auth.Privilege
+}
+
+var _BUCKET_PRIVILEGES = []auth.Privilege{
+	auth.PRIV_READ, auth.PRIV_WRITE, auth.PRIV_UPSERT,
+	auth.PRIV_QUERY_SELECT, auth.PRIV_QUERY_UPDATE, auth.PRIV_QUERY_INSERT, auth.PRIV_QUERY_DELETE,
+	auth.PRIV_QUERY_BUILD_INDEX, auth.PRIV_QUERY_CREATE_INDEX, auth.PRIV_QUERY_ALTER_INDEX,
+	auth.PRIV_QUERY_DROP_INDEX, auth.PRIV_QUERY_LIST_INDEX,
+	auth.PRIV_QUERY_MANAGE_SCOPE_FUNCTIONS, auth.PRIV_QUERY_EXECUTE_SCOPE_FUNCTIONS,
+	auth.PRIV_QUERY_MANAGE_SCOPE_FUNCTIONS_EXTERNAL, auth.PRIV_QUERY_EXECUTE_SCOPE_FUNCTIONS_EXTERNAL,
+	auth.PRIV_QUERY_BUCKET_ADMIN,
+}
+
+var _ROLES = map[string]*rolePrivileges{
+	"admin":             &rolePrivileges{all: true},
+	"cluster_admin":     &rolePrivileges{all: true},
+	"security_admin":    &rolePrivileges{privs: []auth.Privilege{auth.PRIV_SECURITY_READ, auth.PRIV_SECURITY_WRITE}},
+	"replication_admin": &rolePrivileges{},
+	"ro_admin": &rolePrivileges{privs: []auth.Privilege{auth.PRIV_SYSTEM_OPEN, auth.PRIV_SYSTEM_READ,
+		auth.PRIV_SECURITY_READ, auth.PRIV_QUERY_STATS}},
+
+	"bucket_admin":       &rolePrivileges{keyspace: true, privs: _BUCKET_PRIVILEGES},
+	"bucket_full_access": &rolePrivileges{keyspace: true, privs: _BUCKET_PRIVILEGES},
+	"data_reader":        &rolePrivileges{keyspace: true, privs: []auth.Privilege{auth.PRIV_READ}},
+	"data_writer":        &rolePrivileges{keyspace: true, privs: []auth.Privilege{auth.PRIV_WRITE, auth.PRIV_UPSERT}},
+
+	"query_select": &rolePrivileges{keyspace: true, privs: []auth.Privilege{auth.PRIV_QUERY_SELECT}},
+	"query_insert": &rolePrivileges{keyspace: true, privs: []auth.Privilege{auth.PRIV_QUERY_INSERT}},
+	"query_update": &rolePrivileges{keyspace: true, privs: []auth.Privilege{auth.PRIV_QUERY_UPDATE}},
+	"query_delete": &rolePrivileges{keyspace: true, privs: []auth.Privilege{auth.PRIV_QUERY_DELETE}},
+	"query_manage_index": &rolePrivileges{keyspace: true, privs: []auth.Privilege{auth.PRIV_QUERY_BUILD_INDEX,
+		auth.PRIV_QUERY_CREATE_INDEX, auth.PRIV_QUERY_ALTER_INDEX, auth.PRIV_QUERY_DROP_INDEX,
+		auth.PRIV_QUERY_LIST_INDEX}},
+	"query_system_catalog":  &rolePrivileges{privs: []auth.Privilege{auth.PRIV_SYSTEM_OPEN, auth.PRIV_SYSTEM_READ}},
+	"query_external_access": &rolePrivileges{privs: []auth.Privilege{auth.PRIV_QUERY_EXTERNAL_ACCESS}},
+
+	"query_manage_global_functions":  &rolePrivileges{privs: []auth.Privilege{auth.PRIV_QUERY_MANAGE_FUNCTIONS}},
+	"query_execute_global_functions": &rolePrivileges{privs: []auth.Privilege{auth.PRIV_QUERY_EXECUTE_FUNCTIONS}},
+	"query_manage_functions": &rolePrivileges{keyspace: true,
+		privs: []auth.Privilege{auth.PRIV_QUERY_MANAGE_SCOPE_FUNCTIONS}},
+	"query_execute_functions": &rolePrivileges{keyspace: true,
+		privs: []auth.Privilege{auth.PRIV_QUERY_EXECUTE_SCOPE_FUNCTIONS}},
+	"query_manage_global_external_functions": &rolePrivileges{
+		privs: []auth.Privilege{auth.PRIV_QUERY_MANAGE_FUNCTIONS_EXTERNAL}},
+	"query_execute_global_external_functions": &rolePrivileges{
+		privs: []auth.Privilege{auth.PRIV_QUERY_EXECUTE_FUNCTIONS_EXTERNAL}},
+	"query_manage_external_functions": &rolePrivileges{keyspace: true,
+		privs: []auth.Privilege{auth.PRIV_QUERY_MANAGE_SCOPE_FUNCTIONS_EXTERNAL}},
+	"query_execute_external_functions": &rolePrivileges{keyspace: true,
+		privs: []auth.Privilege{auth.PRIV_QUERY_EXECUTE_SCOPE_FUNCTIONS_EXTERNAL}},
+}
+
+func (this *rolePrivileges) has(priv auth.Privilege) bool {
+	if this.all {
+		return true
+	}
+	for _, p := range this.privs {
+		if p == priv {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *fileRole) target() []string {
+	var target []string
+	for _, part := range []string{this.Bucket, this.Scope, this.Collection} {
+		if part == "" || part == "*" {
+			break
+		}
+		target = append(target, part)
+	}
+	return target
+}
+
+func (this *fileRole) grants(pair auth.PrivilegePair) bool {
+	role, ok := _ROLES[this.Role]
+	if !ok || !role.has(pair.Priv) {
+		return false
+	}
+	if !role.keyspace {
+		return true
+	}
+
+	// the privilege target is namespace:bucket[.scope.collection]
+	target := this.target()
+	if len(target) == 0 {
+		return this.Bucket == "*"
+	}
+	elems := algebra.ParsePath(pair.Target)
+	if len(elems) < 2 || len(elems)-1 < len(target) {
+		return false
+	}
+	for i, part := range target {
+		if elems[i+1] != part {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *store) loadUsers() errors.Error {
+	fileName := filepath.Join(s.path, _USERS_FILE)
+	bytes, er := ioutil.ReadFile(fileName)
+	if os.IsNotExist(er) {
+		return nil
+	} else if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	var users []*fileUser
+	er = json.Unmarshal(bytes, &users)
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "Unable to parse "+fileName)
+	}
+	for _, u := range users {
+		if u.Domain == "" {
+			u.Domain = "local"
+		}
+		s.users[u.Domain+":"+u.Id] = u
+	}
+	s.usersFile = fileName
+	return nil
+}
+
+/* Write the users to a new file and move it in place. */
+func (s *store) saveUsers() errors.Error {
+	if s.usersFile == "" {
+		return nil
+	}
+
+	bytes, er := json.MarshalIndent(s.sortedUsers(), "", "    ")
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	file, er := ioutil.TempFile(s.path, "."+_USERS_FILE)
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	_, er = file.Write(bytes)
+	if er == nil {
+		er = file.Close()
+	} else {
+		file.Close()
+	}
+	if er == nil {
+		er = os.Rename(file.Name(), s.usersFile)
+	}
+	if er != nil {
+		os.Remove(file.Name())
+		return errors.NewFileDatastoreError(er, "")
+	}
+	return nil
+}
+
+func (s *store) sortedUsers() []*fileUser {
+	keys := make([]string, 0, len(s.users))
+	for k, _ := range s.users {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	users := make([]*fileUser, len(keys))
+	for i, k := range keys {
+		users[i] = s.users[k]
+	}
+	return users
+}
+
+/*
+Authenticate the users of the request from its basic authorization,
+or else from its credentials, the first time the request is
+authorized. User names may carry a local: prefix.
+*/
+func (s *store) authenticate(credentials *auth.Credentials) errors.Error {
+	if credentials.AuthenticatedUsers != nil {
+		return nil
+	}
+
+	creds := credentials.Users
+	if req := credentials.HttpRequest; req != nil {
+		user, password, er := auth.GetWebAuth(req)
+		if er == nil {
+			creds = auth.Users{user: password}
+		}
+	}
+
+	authenticatedUsers := make(auth.AuthenticatedUsers, 0, len(creds))
+	for username, password := range creds {
+		id := username
+		if i := strings.IndexByte(id, ':'); i >= 0 {
+			id = id[i+1:]
+		}
+		if id == "" {
+			continue
+		}
+
+		key := "local:" + id
+		user := s.users[key]
+		if user == nil || user.Password == "" ||
+			bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+			return errors.NewDatastoreAuthorizationError(fmt.Errorf("Authentication failed for user %s", id))
+		}
+		authenticatedUsers = append(authenticatedUsers, key)
+	}
+	credentials.AuthenticatedUsers = authenticatedUsers
+	return nil
+}
+
+func (s *store) Authorize(privileges *auth.Privileges, credentials *auth.Credentials) (auth.AuthenticatedUsers, errors.Error) {
+	s.usersLock.RLock()
+	defer s.usersLock.RUnlock()
+
+	if s.usersFile == "" {
+		return nil, nil
+	}
+	if credentials == nil {
+		credentials = auth.NewCredentials()
+	}
+	err := s.authenticate(credentials)
+	if err != nil {
+		return nil, err
+	}
+	if privileges == nil {
+		return credentials.AuthenticatedUsers, nil
+	}
+
+	for _, pair := range privileges.List {
+		if pair.Priv == auth.PRIV_QUERY_TRANSACTION_STMT {
+			// transaction statements need no privileges
+			continue
+		}
+		if !s.granted(credentials.AuthenticatedUsers, pair) {
+			return nil, errors.NewDatastoreInsufficientCredentials(messageForDeniedPrivilege(pair))
+		}
+	}
+	return credentials.AuthenticatedUsers, nil
+}
+
+func (s *store) granted(users auth.AuthenticatedUsers, pair auth.PrivilegePair) bool {
+	for _, key := range users {
+		user := s.users[key]
+		if user == nil {
+			continue
+		}
+		for i, _ := range user.Roles {
+			if user.Roles[i].grants(pair) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+The message for a privilege that was denied names the role with the
+fewest privileges that grants it.
+*/
+func messageForDeniedPrivilege(pair auth.PrivilegePair) string {
+	role, fewest := "admin", -1
+	for _, name := range roleNames() {
+		r := _ROLES[name]
+		if !r.all && r.has(pair.Priv) && (fewest < 0 || len(r.privs) < fewest) {
+			role, fewest = name, len(r.privs)
+		}
+	}
+	if _ROLES[role].keyspace {
+		role += " on " + pair.Target
+	}
+
+	privilege := ""
+	switch pair.Priv {
+	case auth.PRIV_READ:
+		privilege = "data read queries"
+	case auth.PRIV_WRITE:
+		privilege = "data write queries"
+	case auth.PRIV_UPSERT:
+		privilege = "data upsert queries"
+	case auth.PRIV_SYSTEM_OPEN, auth.PRIV_SYSTEM_READ:
+		privilege = "queries accessing the system tables"
+	case auth.PRIV_SECURITY_WRITE:
+		privilege = "queries updating user information"
+	case auth.PRIV_SECURITY_READ:
+		privilege = "queries accessing user information"
+	case auth.PRIV_QUERY_SELECT:
+		privilege = fmt.Sprintf("SELECT queries on %s", pair.Target)
+	case auth.PRIV_QUERY_UPDATE:
+		privilege = fmt.Sprintf("UPDATE queries on %s", pair.Target)
+	case auth.PRIV_QUERY_INSERT:
+		privilege = fmt.Sprintf("INSERT queries on %s", pair.Target)
+	case auth.PRIV_QUERY_DELETE:
+		privilege = fmt.Sprintf("DELETE queries on %s", pair.Target)
+	case auth.PRIV_QUERY_BUILD_INDEX, auth.PRIV_QUERY_CREATE_INDEX,
+		auth.PRIV_QUERY_ALTER_INDEX, auth.PRIV_QUERY_DROP_INDEX, auth.PRIV_QUERY_LIST_INDEX:
+		privilege = "index operations"
+	case auth.PRIV_QUERY_EXTERNAL_ACCESS:
+		privilege = "queries using the CURL() function"
+	default:
+		privilege = "this type of query"
+	}
+
+	return fmt.Sprintf("User does not have credentials to run %s. Add role %s to allow the query to run.", privilege, role)
+}
+
+func roleNames() []string {
+	names := make([]string, 0, len(_ROLES))
+	for name, _ := range _ROLES {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *store) PreAuthorize(*auth.Privileges) {
+}
+
+func (s *store) CredsString(req *http.Request) string {
+	if req != nil {
+		user, _, err := auth.GetWebAuth(req)
+		if err == nil {
+			return user
+		}
+	}
+	return ""
+}
+
+func (s *store) UserInfo() (value.Value, errors.Error) {
+	s.usersLock.RLock()
+	defer s.usersLock.RUnlock()
+
+	users := s.sortedUsers()
+	data := make([]interface{}, len(users))
+	for i, u := range users {
+		roles := make([]interface{}, len(u.Roles))
+		for j, r := range u.Roles {
+			role := map[string]interface{}{"role": r.Role}
+			if r.Bucket != "" {
+				role["bucket_name"] = r.Bucket
+			}
+			if r.Scope != "" {
+				role["scope_name"] = r.Scope
+			}
+			if r.Collection != "" {
+				role["collection_name"] = r.Collection
+			}
+			roles[j] = role
+		}
+		data[i] = map[string]interface{}{"id": u.Id, "domain": u.Domain, "name": u.Name, "roles": roles}
+	}
+	return value.NewValue(data), nil
+}
+
+func (s *store) GetUserInfoAll() ([]datastore.User, errors.Error) {
+	s.usersLock.RLock()
+	defer s.usersLock.RUnlock()
+
+	ret := make([]datastore.User, 0, len(s.users))
+	for _, u := range s.sortedUsers() {
+		roles := make([]datastore.Role, len(u.Roles))
+		for i, r := range u.Roles {
+			roles[i].Name = r.Role
+			roles[i].Target = strings.Join(r.target(), ":")
+			if roles[i].Target == "" {
+				roles[i].Target = r.Bucket
+			}
+		}
+		ret = append(ret, datastore.User{Name: u.Name, Id: u.Id, Domain: u.Domain, Roles: roles})
+	}
+	return ret, nil
+}
+
+func (s *store) PutUserInfo(u *datastore.User) errors.Error {
+	s.usersLock.Lock()
+	defer s.usersLock.Unlock()
+
+	domain := u.Domain
+	if domain == "" {
+		domain = "local"
+	}
+	key := domain + ":" + u.Id
+	prev := s.users[key]
+	user := &fileUser{Id: u.Id, Domain: domain, Name: u.Name}
+	if prev != nil {
+		user.Password = prev.Password
+	}
+
+	user.Roles = make([]fileRole, len(u.Roles))
+	for i, r := range u.Roles {
+		user.Roles[i].Role = r.Name
+		target := strings.Split(r.Target, ":")
+		user.Roles[i].Bucket = target[0]
+		if len(target) > 1 {
+			user.Roles[i].Scope = target[1]
+		}
+		if len(target) > 2 {
+			user.Roles[i].Collection = target[2]
+		}
+	}
+
+	s.users[key] = user
+	err := s.saveUsers()
+	if err != nil {
+		if prev != nil {
+			s.users[key] = prev
+		} else {
+			delete(s.users, key)
+		}
+	}
+	return err
+}
+
+func (s *store) GetRolesAll() ([]datastore.Role, errors.Error) {
+	names := roleNames()
+	roles := make([]datastore.Role, len(names))
+	for i, name := range names {
+		roles[i].Name = name
+		if _ROLES[name].keyspace {
+			roles[i].Target = "*"
+		}
+	}
+	return roles, nil
+}
@@ -0,0 +1,357 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+)
+
+// Buckets contain scopes, which contain collections, each one a directory in the
+// directory of its parent: namespace/bucket/scope/collection. Directories whose
+// names start with a dot hold indexes and other metadata, and are neither scopes
+// nor collections.
+//
+// The documents of a bucket are those of its default collection, so that
+// bucket._default._default is the bucket itself. The _default scope always
+// exists, and only gets a directory when collections are created in it.
+
+const _DEFAULT_NAME = "_default"
+
+// scope is a file-based scope.
+type scope struct {
+	sync.RWMutex
+	bucket    *keyspace
+	name      string
+	keyspaces map[string]*keyspace // by upper case name
+}
+
+func (s *scope) Id() string {
+	return s.Name()
+}
+
+func (s *scope) Name() string {
+	return s.name
+}
+
+func (s *scope) AuthKey() string {
+	return s.bucket.name + ":" + s.name
+}
+
+func (s *scope) BucketId() string {
+	return s.bucket.Id()
+}
+
+func (s *scope) Bucket() datastore.Bucket {
+	return s.bucket
+}
+
+func (s *scope) KeyspaceIds() ([]string, errors.Error) {
+	return s.KeyspaceNames()
+}
+
+// the default collection is the bucket, and is listed as such
+func (s *scope) KeyspaceNames() ([]string, errors.Error) {
+	s.RLock()
+	names := make([]string, 0, len(s.keyspaces))
+	for _, ks := range s.keyspaces {
+		names = append(names, ks.name)
+	}
+	s.RUnlock()
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *scope) KeyspaceById(id string) (datastore.Keyspace, errors.Error) {
+	return s.KeyspaceByName(id)
+}
+
+func (s *scope) KeyspaceByName(name string) (datastore.Keyspace, errors.Error) {
+	if s.isDefault() && strings.EqualFold(name, _DEFAULT_NAME) {
+		return s.bucket, nil
+	}
+
+	s.RLock()
+	ks, ok := s.keyspaces[strings.ToUpper(name)]
+	s.RUnlock()
+	if !ok {
+		return nil, errors.NewFileCollectionNotFoundError(nil, s.fullName(name))
+	}
+	return ks, nil
+}
+
+func (s *scope) CreateCollection(name string) errors.Error {
+	if !validName(name) {
+		return errors.NewFileInvalidNameError(nil, s.fullName(name))
+	}
+	if s.isDefault() && strings.EqualFold(name, _DEFAULT_NAME) {
+		return errors.NewFileCollectionExistsError(nil, s.fullName(name))
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	nameu := strings.ToUpper(name)
+	if _, ok := s.keyspaces[nameu]; ok {
+		return errors.NewFileCollectionExistsError(nil, s.fullName(name))
+	}
+
+	// the default scope may not have a directory yet
+	er := os.MkdirAll(s.path(), 0777)
+	if er == nil {
+		er = os.Mkdir(filepath.Join(s.path(), name), 0777)
+	}
+	if os.IsExist(er) {
+		return errors.NewFileCollectionExistsError(nil, s.fullName(name))
+	} else if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	ks, err := newCollection(s, name)
+	if err != nil {
+		os.RemoveAll(filepath.Join(s.path(), name))
+		return err
+	}
+	s.keyspaces[nameu] = ks
+	return nil
+}
+
+func (s *scope) DropCollection(name string) errors.Error {
+	if s.isDefault() && strings.EqualFold(name, _DEFAULT_NAME) {
+		return errors.NewFileNotSupported(nil, "dropping the default collection of "+s.bucket.name)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	nameu := strings.ToUpper(name)
+	ks, ok := s.keyspaces[nameu]
+	if !ok {
+		return errors.NewFileCollectionNotFoundError(nil, s.fullName(name))
+	}
+
+	ks.fileLock.Lock()
+	er := os.RemoveAll(ks.path())
+	ks.fileLock.Unlock()
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	delete(s.keyspaces, nameu)
+	return nil
+}
+
+func (s *scope) isDefault() bool {
+	return s.name == _DEFAULT_NAME
+}
+
+func (s *scope) path() string {
+	return filepath.Join(s.bucket.path(), s.name)
+}
+
+// the full name of one of the collections of the scope
+func (s *scope) fullName(collection string) string {
+	return s.bucket.scopeFullName(s.name) + "." + collection
+}
+
+func newScope(b *keyspace, dir string) (*scope, errors.Error) {
+	s := &scope{bucket: b, name: dir, keyspaces: make(map[string]*keyspace)}
+
+	dirEntries, er := ioutil.ReadDir(s.path())
+	if er != nil {
+		if os.IsNotExist(er) && s.isDefault() {
+			return s, nil
+		}
+		return nil, errors.NewFileDatastoreError(er, "")
+	}
+
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() || strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+		diru := strings.ToUpper(dirEntry.Name())
+		if _, ok := s.keyspaces[diru]; ok {
+			return nil, errors.NewFileDuplicateKeyspaceError(nil, s.fullName(dirEntry.Name()))
+		}
+		ks, err := newCollection(s, dirEntry.Name())
+		if err != nil {
+			return nil, err
+		}
+		s.keyspaces[diru] = ks
+	}
+	return s, nil
+}
+
+// newCollection creates a new keyspace in a scope.
+func newCollection(s *scope, dir string) (*keyspace, errors.Error) {
+	ks := &keyspace{namespace: s.bucket.namespace, scope: s, name: dir}
+	err := ks.load()
+	if err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// the names of scopes and collections become directory names
+func validName(name string) bool {
+	return name != "" && name[0] != '.' && !strings.ContainsAny(name, "/\\:"+string(os.PathSeparator))
+}
+
+// the bucket holds the documents of the default collection, so direct access
+// uses the bucket itself
+func (b *keyspace) DefaultKeyspace() (datastore.Keyspace, errors.Error) {
+	return nil, nil
+}
+
+func (b *keyspace) ScopeIds() ([]string, errors.Error) {
+	return b.ScopeNames()
+}
+
+func (b *keyspace) ScopeNames() ([]string, errors.Error) {
+	b.scopesLock.RLock()
+	names := make([]string, 0, len(b.scopes))
+	for _, s := range b.scopes {
+		names = append(names, s.name)
+	}
+	b.scopesLock.RUnlock()
+	sort.Strings(names)
+	return names, nil
+}
+
+func (b *keyspace) ScopeById(id string) (datastore.Scope, errors.Error) {
+	return b.ScopeByName(id)
+}
+
+func (b *keyspace) ScopeByName(name string) (datastore.Scope, errors.Error) {
+	b.scopesLock.RLock()
+	s, ok := b.scopes[strings.ToUpper(name)]
+	b.scopesLock.RUnlock()
+	if !ok {
+		return nil, errors.NewFileScopeNotFoundError(nil, b.scopeFullName(name))
+	}
+	return s, nil
+}
+
+func (b *keyspace) CreateScope(name string) errors.Error {
+	if b.scope != nil {
+		return errors.NewScopesNotSupportedError(b.name)
+	}
+	if !validName(name) {
+		return errors.NewFileInvalidNameError(nil, b.scopeFullName(name))
+	}
+
+	b.scopesLock.Lock()
+	defer b.scopesLock.Unlock()
+
+	nameu := strings.ToUpper(name)
+	if _, ok := b.scopes[nameu]; ok {
+		return errors.NewFileScopeExistsError(nil, b.scopeFullName(name))
+	}
+	s := &scope{bucket: b, name: name, keyspaces: make(map[string]*keyspace)}
+	er := os.Mkdir(s.path(), 0777)
+	if os.IsExist(er) {
+		return errors.NewFileScopeExistsError(nil, b.scopeFullName(name))
+	} else if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	b.scopes[nameu] = s
+	return nil
+}
+
+func (b *keyspace) DropScope(name string) errors.Error {
+	if b.scope != nil {
+		return errors.NewScopesNotSupportedError(b.name)
+	}
+	if strings.EqualFold(name, _DEFAULT_NAME) {
+		return errors.NewFileNotSupported(nil, "dropping the default scope of "+b.name)
+	}
+
+	b.scopesLock.Lock()
+	defer b.scopesLock.Unlock()
+
+	nameu := strings.ToUpper(name)
+	s, ok := b.scopes[nameu]
+	if !ok {
+		return errors.NewFileScopeNotFoundError(nil, b.scopeFullName(name))
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	for _, ks := range s.keyspaces {
+		ks.fileLock.Lock()
+		defer ks.fileLock.Unlock()
+	}
+	er := os.RemoveAll(s.path())
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	s.keyspaces = make(map[string]*keyspace)
+	delete(b.scopes, nameu)
+	return nil
+}
+
+func (b *keyspace) scopeFullName(name string) string {
+	return b.namespace.name + ":" + b.name + "." + name
+}
+
+func (b *keyspace) loadScopes() errors.Error {
+	dirEntries, er := ioutil.ReadDir(b.path())
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	b.scopes = make(map[string]*scope)
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() || strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+		diru := strings.ToUpper(dirEntry.Name())
+		if _, ok := b.scopes[diru]; ok {
+			return errors.NewFileScopeExistsError(nil, b.scopeFullName(dirEntry.Name()))
+		}
+		s, err := newScope(b, dirEntry.Name())
+		if err != nil {
+			return err
+		}
+		b.scopes[diru] = s
+	}
+
+	if _, ok := b.scopes[strings.ToUpper(_DEFAULT_NAME)]; !ok {
+		s, err := newScope(b, _DEFAULT_NAME)
+		if err != nil {
+			return err
+		}
+		b.scopes[strings.ToUpper(_DEFAULT_NAME)] = s
+	}
+	return nil
+}
+
+// all the keyspaces of the namespace: the buckets, and the collections in their scopes
+func (p *namespace) allKeyspaces() []*keyspace {
+	rv := make([]*keyspace, 0, len(p.keyspaces))
+	for _, b := range p.keyspaces {
+		rv = append(rv, b)
+		b.scopesLock.RLock()
+		for _, s := range b.scopes {
+			s.RLock()
+			for _, ks := range s.keyspaces {
+				rv = append(rv, ks)
+			}
+			s.RUnlock()
+		}
+		b.scopesLock.RUnlock()
+	}
+	return rv
+}
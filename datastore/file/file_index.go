@@ -0,0 +1,898 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/logging"
+	"github.com/couchbase/query/parser/n1ql"
+	"github.com/couchbase/query/timestamp"
+	"github.com/couchbase/query/value"
+)
+
+// Index definitions and entries are persisted in a hidden directory of
+// the keyspace, which document scans skip.
+const _INDEX_DIR = ".indexes"
+
+// Document changes are appended to a log next to the index file, so that
+// DML does not rewrite the whole index. The log is folded back into the
+// index file when the index is built or opened, and once it holds more
+// records than the index has documents.
+const _INDEX_LOG_MIN = 1024
+
+// secondaryIndex is a persisted secondary index on a file-based keyspace.
+// Entries are held in memory in index order; changes are logged to disk
+// as they happen.
+type secondaryIndex struct {
+	sync.RWMutex
+	name      string
+	keyspace  *keyspace
+	indexer   *fileIndexer
+	keys      datastore.IndexKeys
+	condition expression.Expression
+	state     datastore.IndexState
+	entries   []*indexEntry
+	docs      map[string][]*indexEntry
+	logged    int
+}
+
+type indexEntry struct {
+	key value.Values
+	id  string
+}
+
+func newSecondaryIndex(indexer *fileIndexer, name string, keys datastore.IndexKeys,
+	condition expression.Expression) *secondaryIndex {
+	return &secondaryIndex{
+		name:      name,
+		keyspace:  indexer.keyspace,
+		indexer:   indexer,
+		keys:      keys,
+		condition: condition,
+		state:     datastore.DEFERRED,
+	}
+}
+
+func (si *secondaryIndex) BucketId() string {
+	return si.keyspace.bucketId()
+}
+
+func (si *secondaryIndex) ScopeId() string {
+	return si.keyspace.ScopeId()
+}
+
+func (si *secondaryIndex) KeyspaceId() string {
+	return si.keyspace.Id()
+}
+
+func (si *secondaryIndex) Id() string {
+	return si.Name()
+}
+
+func (si *secondaryIndex) Name() string {
+	return si.name
+}
+
+func (si *secondaryIndex) Type() datastore.IndexType {
+	return datastore.DEFAULT
+}
+
+func (si *secondaryIndex) Indexer() datastore.Indexer {
+	return si.indexer
+}
+
+func (si *secondaryIndex) SeekKey() expression.Expressions {
+	return nil
+}
+
+func (si *secondaryIndex) RangeKey() expression.Expressions {
+	rv := make(expression.Expressions, len(si.keys))
+	for i, key := range si.keys {
+		rv[i] = key.Expr
+	}
+	return rv
+}
+
+func (si *secondaryIndex) RangeKey2() datastore.IndexKeys {
+	return si.keys
+}
+
+func (si *secondaryIndex) Condition() expression.Expression {
+	return si.condition
+}
+
+func (si *secondaryIndex) IsPrimary() bool {
+	return false
+}
+
+func (si *secondaryIndex) State() (state datastore.IndexState, msg string, err errors.Error) {
+	si.RLock()
+	defer si.RUnlock()
+	return si.state, "", nil
+}
+
+func (si *secondaryIndex) Statistics(requestId string, span *datastore.Span) (
+	datastore.Statistics, errors.Error) {
+	return nil, nil
+}
+
+func (si *secondaryIndex) Drop(requestId string) errors.Error {
+	return si.indexer.dropIndex(si)
+}
+
+func (si *secondaryIndex) Scan(requestId string, span *datastore.Span, distinct bool, limit int64,
+	cons datastore.ScanConsistency, vector timestamp.Vector, conn *datastore.IndexConnection) {
+	defer conn.Sender().Close()
+
+	entries, err := si.matching(func(key value.Values) bool {
+		return matchSpan(key, span)
+	})
+	if err != nil {
+		conn.Error(err)
+		return
+	}
+
+	si.send(entries, nil, distinct, 0, limit, conn)
+}
+
+func (si *secondaryIndex) Count(span *datastore.Span, cons datastore.ScanConsistency,
+	vector timestamp.Vector) (int64, errors.Error) {
+	entries, err := si.matching(func(key value.Values) bool {
+		return matchSpan(key, span)
+	})
+	return int64(len(entries)), err
+}
+
+func (si *secondaryIndex) Scan2(requestId string, spans datastore.Spans2, reverse, distinctAfterProjection,
+	ordered bool, projection *datastore.IndexProjection, offset, limit int64,
+	cons datastore.ScanConsistency, vector timestamp.Vector, conn *datastore.IndexConnection) {
+	si.Scan3(requestId, spans, reverse, distinctAfterProjection, projection, offset, limit,
+		nil, nil, cons, vector, conn)
+}
+
+func (si *secondaryIndex) Count2(requestId string, spans datastore.Spans2, cons datastore.ScanConsistency,
+	vector timestamp.Vector) (int64, errors.Error) {
+	entries, err := si.matching(func(key value.Values) bool {
+		return matchSpans2(key, spans)
+	})
+	return int64(len(entries)), err
+}
+
+func (si *secondaryIndex) CanCountDistinct() bool {
+	return true
+}
+
+// count the distinct leading key values within the spans
+func (si *secondaryIndex) CountDistinct(requestId string, spans datastore.Spans2, cons datastore.ScanConsistency,
+	vector timestamp.Vector) (int64, errors.Error) {
+	entries, err := si.matching(func(key value.Values) bool {
+		return matchSpans2(key, spans) && key[0].Type() > value.NULL
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	set := value.NewSet(len(entries), false, false)
+	for _, e := range entries {
+		set.Add(e.key[0])
+	}
+	return int64(set.Len()), nil
+}
+
+func (si *secondaryIndex) CreateAggregate(requestId string, groupAggs *datastore.IndexGroupAggregates,
+	with value.Value) errors.Error {
+	return errors.NewFileNotSupported(nil, "CREATE AGGREGATE is not supported for file-based datastore.")
+}
+
+func (si *secondaryIndex) DropAggregate(requestId, name string) errors.Error {
+	return errors.NewFileNotSupported(nil, "DROP AGGREGATE is not supported for file-based datastore.")
+}
+
+func (si *secondaryIndex) Aggregates() ([]datastore.IndexGroupAggregates, errors.Error) {
+	return nil, errors.NewFileNotSupported(nil, "Precomputed aggregates are not supported for file-based datastore.")
+}
+
+func (si *secondaryIndex) PartitionKeys() (*datastore.IndexPartition, errors.Error) {
+	return nil, nil
+}
+
+func (si *secondaryIndex) Scan3(requestId string, spans datastore.Spans2, reverse, distinctAfterProjection bool,
+	projection *datastore.IndexProjection, offset, limit int64,
+	groupAggs *datastore.IndexGroupAggregates, indexOrders datastore.IndexKeyOrders,
+	cons datastore.ScanConsistency, vector timestamp.Vector, conn *datastore.IndexConnection) {
+	defer conn.Sender().Close()
+
+	entries, err := si.matching(func(key value.Values) bool {
+		return matchSpans2(key, spans)
+	})
+	if err != nil {
+		conn.Error(err)
+		return
+	}
+
+	if reverse {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+
+	if len(indexOrders) > 0 {
+		sortEntries(entries, indexOrders)
+	}
+
+	if groupAggs != nil {
+		rows, err := aggregate(entries, len(si.keys), groupAggs, projection)
+		if err != nil {
+			conn.Error(err)
+			return
+		}
+		sendRows(rows, offset, limit, conn)
+		return
+	}
+
+	si.send(entries, projection, distinctAfterProjection, offset, limit, conn)
+}
+
+func (si *secondaryIndex) Alter(requestId string, with value.Value) (datastore.Index, errors.Error) {
+	return nil, errors.NewFileNotSupported(nil, "ALTER INDEX is not supported for file-based datastore.")
+}
+
+// collect the entries of unexpired documents whose keys satisfy the filter, in index order
+func (si *secondaryIndex) matching(filter func(value.Values) bool) ([]*indexEntry, errors.Error) {
+	si.RLock()
+	defer si.RUnlock()
+
+	if si.state != datastore.ONLINE {
+		return nil, errors.NewFileIdxNotOnlineError(nil, si.name)
+	}
+
+	var rv []*indexEntry
+	now := unixNow()
+	for _, e := range si.entries {
+		if filter(e.key) && !si.keyspace.expired(e.id, now) {
+			rv = append(rv, e)
+		}
+	}
+	return rv, nil
+}
+
+// project the entries and send them down the connection
+func (si *secondaryIndex) send(entries []*indexEntry, projection *datastore.IndexProjection,
+	distinct bool, offset, limit int64, conn *datastore.IndexConnection) {
+	var seen map[string]bool
+	if distinct {
+		seen = make(map[string]bool, len(entries))
+	}
+
+	var n int64
+	for _, e := range entries {
+		entry := &datastore.IndexEntry{PrimaryKey: e.id, EntryKey: e.key}
+		if projection != nil {
+			entry.EntryKey = make(value.Values, 0, len(projection.EntryKeys))
+			for _, pos := range projection.EntryKeys {
+				if pos < len(e.key) {
+					entry.EntryKey = append(entry.EntryKey, e.key[pos])
+				} else {
+					entry.EntryKey = append(entry.EntryKey, value.NewValue(e.id))
+				}
+			}
+		}
+
+		if distinct {
+			dkey := entryString(entry.EntryKey)
+			if projection == nil || projection.PrimaryKey {
+				dkey += e.id
+			}
+			if seen[dkey] {
+				continue
+			}
+			seen[dkey] = true
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit > 0 && n >= limit {
+			break
+		}
+		if !conn.Sender().SendEntry(entry) {
+			break
+		}
+		n++
+	}
+}
+
+func sendRows(rows []*datastore.IndexEntry, offset, limit int64, conn *datastore.IndexConnection) {
+	var n int64
+	for _, row := range rows {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit > 0 && n >= limit {
+			break
+		}
+		if !conn.Sender().SendEntry(row) {
+			break
+		}
+		n++
+	}
+}
+
+// a string that tells apart entries that do not collate equal
+func entryString(key value.Values) string {
+	var b strings.Builder
+	for _, v := range key {
+		b.WriteString(v.Type().String())
+		if v.Type() != value.MISSING {
+			bytes, _ := v.MarshalJSON()
+			b.Write(bytes)
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func sortEntries(entries []*indexEntry, orders datastore.IndexKeyOrders) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		for _, o := range orders {
+			c := entries[i].key[o.KeyPos].Collate(entries[j].key[o.KeyPos])
+			if c == 0 {
+				continue
+			}
+			if o.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// API1 spans are compared as composite keys
+func matchSpan(key value.Values, span *datastore.Span) bool {
+	if len(span.Seek) > 0 {
+		return compareKeys(key, span.Seek) == 0
+	}
+
+	rng := span.Range
+	if len(rng.Low) > 0 {
+		c := compareKeys(key, rng.Low)
+		if c < 0 || (c == 0 && rng.Inclusion&datastore.LOW == 0) {
+			return false
+		}
+	}
+	if len(rng.High) > 0 {
+		c := compareKeys(key, rng.High)
+		if c > 0 || (c == 0 && rng.Inclusion&datastore.HIGH == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare the leading index keys against a bound
+func compareKeys(key, bound value.Values) int {
+	for i, b := range bound {
+		if i >= len(key) {
+			return -1
+		}
+		if c := key[i].Collate(b); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// API2 and API3 spans are ranges on each of the leading index keys
+func matchSpans2(key value.Values, spans datastore.Spans2) bool {
+	for _, span := range spans {
+		if matchSpan2(key, span) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSpan2(key value.Values, span *datastore.Span2) bool {
+	if len(span.Seek) > 0 {
+		return compareKeys(key, span.Seek) == 0
+	}
+
+	for i, rng := range span.Ranges {
+		if i >= len(key) {
+			break
+		}
+		if rng.Low != nil {
+			c := key[i].Collate(rng.Low)
+			if c < 0 || (c == 0 && rng.Inclusion&datastore.LOW == 0) {
+				return false
+			}
+		}
+		if rng.High != nil {
+			c := key[i].Collate(rng.High)
+			if c > 0 || (c == 0 && rng.Inclusion&datastore.HIGH == 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// index order: keys in collation order, descending keys reversed, then document key
+func (si *secondaryIndex) compare(a, b *indexEntry) int {
+	for i, key := range si.keys {
+		c := a.key[i].Collate(b.key[i])
+		if c != 0 {
+			if key.HasAttribute(datastore.IK_DESC) {
+				return -c
+			}
+			return c
+		}
+	}
+	return strings.Compare(a.id, b.id)
+}
+
+// evaluate the index keys for a document, with one entry per array element;
+// index keys and condition are expressed in terms of the document itself
+func (si *secondaryIndex) evaluate(id string, doc value.Value, context expression.Context) []*indexEntry {
+	if si.condition != nil {
+		cond, err := si.condition.Evaluate(doc, context)
+		if err != nil || !cond.Truth() {
+			return nil
+		}
+	}
+
+	keys := []value.Values{make(value.Values, 0, len(si.keys))}
+	for i, ik := range si.keys {
+		val, vals, err := ik.Expr.EvaluateForIndex(doc, context)
+		if err != nil {
+			logging.Debugf("Index %v: cannot index <ud>%v</ud>: %v", si.name, id, err)
+			return nil
+		}
+
+		elems := value.Values{val}
+		if isArray, distinct := ik.Expr.IsArrayIndexKey(); isArray {
+			elems = arrayKeyValues(val, vals, distinct)
+		}
+
+		if i == 0 && !ik.HasAttribute(datastore.IK_MISSING) &&
+			(len(elems) == 0 || (len(elems) == 1 && elems[0].Type() == value.MISSING)) {
+			return nil
+		}
+		if len(elems) == 0 {
+			elems = value.Values{value.MISSING_VALUE}
+		}
+
+		next := make([]value.Values, 0, len(keys)*len(elems))
+		for _, key := range keys {
+			for _, elem := range elems {
+				nkey := make(value.Values, len(key), len(si.keys))
+				copy(nkey, key)
+				next = append(next, append(nkey, elem))
+			}
+		}
+		keys = next
+	}
+
+	rv := make([]*indexEntry, len(keys))
+	for i, key := range keys {
+		rv[i] = &indexEntry{key: key, id: id}
+	}
+	return rv
+}
+
+func arrayKeyValues(val value.Value, vals value.Values, distinct bool) value.Values {
+	if vals == nil {
+		if val.Type() != value.ARRAY {
+			return nil
+		}
+		act := val.Actual().([]interface{})
+		vals = make(value.Values, len(act))
+		for i, a := range act {
+			vals[i] = value.NewValue(a)
+		}
+	}
+
+	if distinct {
+		set := value.NewSet(len(vals), true, false)
+		rv := make(value.Values, 0, len(vals))
+		for _, v := range vals {
+			if !set.Has(v) {
+				set.Add(v)
+				rv = append(rv, v)
+			}
+		}
+		vals = rv
+	}
+	return vals
+}
+
+// replace the entries for a document; a nil document removes them.
+// Returns the new entries, and false if the index is not online.
+func (si *secondaryIndex) update(id string, doc value.Value, context expression.Context) ([]*indexEntry, bool) {
+	si.Lock()
+	defer si.Unlock()
+
+	if si.state != datastore.ONLINE {
+		return nil, false
+	}
+
+	var entries []*indexEntry
+	if doc != nil {
+		entries = si.evaluate(id, doc, context)
+	}
+	si.replace(id, entries)
+	return entries, true
+}
+
+func (si *secondaryIndex) replace(id string, entries []*indexEntry) {
+	old := si.docs[id]
+	for _, e := range old {
+		i := sort.Search(len(si.entries), func(i int) bool {
+			return si.compare(si.entries[i], e) >= 0
+		})
+		if i < len(si.entries) && si.compare(si.entries[i], e) == 0 {
+			si.entries = append(si.entries[:i], si.entries[i+1:]...)
+		}
+	}
+	delete(si.docs, id)
+
+	for _, e := range entries {
+		i := sort.Search(len(si.entries), func(i int) bool {
+			return si.compare(si.entries[i], e) >= 0
+		})
+		si.entries = append(si.entries, nil)
+		copy(si.entries[i+1:], si.entries[i:])
+		si.entries[i] = e
+	}
+	if len(entries) > 0 {
+		si.docs[id] = entries
+	}
+}
+
+// (re)build the index from all the documents in the keyspace
+func (si *secondaryIndex) build() errors.Error {
+
+	// no document changes while the index is being built
+	si.keyspace.fileLock.Lock()
+	defer si.keyspace.fileLock.Unlock()
+
+	si.Lock()
+	si.state = datastore.BUILDING
+	si.Unlock()
+
+	dirEntries, er := ioutil.ReadDir(si.keyspace.path())
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	context := expression.NewIndexContext()
+	entries := make([]*indexEntry, 0, len(dirEntries))
+	docs := make(map[string][]*indexEntry, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		doc, err := fetch(filepath.Join(si.keyspace.path(), dirEntry.Name()))
+		if err != nil {
+			return err
+		}
+		id := documentPathToId(dirEntry.Name())
+		docEntries := si.evaluate(id, doc, context)
+		if len(docEntries) > 0 {
+			docs[id] = docEntries
+			entries = append(entries, docEntries...)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return si.compare(entries[i], entries[j]) < 0
+	})
+
+	si.Lock()
+	si.entries = entries
+	si.docs = docs
+	si.state = datastore.ONLINE
+	si.Unlock()
+
+	return si.save()
+}
+
+// persisted form of an index
+type indexFile struct {
+	Name      string           `json:"name"`
+	Keys      []indexKeyFile   `json:"keys"`
+	Condition string           `json:"condition,omitempty"`
+	State     string           `json:"state"`
+	Entries   []indexEntryFile `json:"entries,omitempty"`
+}
+
+type indexKeyFile struct {
+	Expr    string `json:"expr"`
+	Desc    bool   `json:"desc,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+type indexEntryFile struct {
+	Id      string        `json:"id,omitempty"`
+	Key     []interface{} `json:"key"`
+	Missing []int         `json:"missing,omitempty"`
+}
+
+// logged form of a document change; no entries denotes a removal
+type indexLogRecord struct {
+	Id      string           `json:"id"`
+	Entries []indexEntryFile `json:"entries,omitempty"`
+}
+
+func newIndexEntryFile(e *indexEntry) indexEntryFile {
+	rv := indexEntryFile{Key: make([]interface{}, len(e.key))}
+	for j, v := range e.key {
+		if v.Type() == value.MISSING {
+			rv.Missing = append(rv.Missing, j)
+		} else {
+			rv.Key[j] = v.Actual()
+		}
+	}
+	return rv
+}
+
+func (ef *indexEntryFile) entry(id string) *indexEntry {
+	e := &indexEntry{id: id, key: make(value.Values, len(ef.Key))}
+	for j, k := range ef.Key {
+		e.key[j] = value.NewValue(k)
+	}
+	for _, j := range ef.Missing {
+		e.key[j] = value.MISSING_VALUE
+	}
+	return e
+}
+
+func (si *secondaryIndex) filename() string {
+	return filepath.Join(si.keyspace.path(), _INDEX_DIR, si.name+".json")
+}
+
+func (si *secondaryIndex) logFilename() string {
+	return filepath.Join(si.keyspace.path(), _INDEX_DIR, si.name+".log")
+}
+
+// write the index definition and entries to disk, and empty the log
+func (si *secondaryIndex) save() errors.Error {
+	si.RLock()
+	f := indexFile{
+		Name:    si.name,
+		Keys:    make([]indexKeyFile, len(si.keys)),
+		State:   string(si.state),
+		Entries: make([]indexEntryFile, len(si.entries)),
+	}
+	for i, key := range si.keys {
+		f.Keys[i] = indexKeyFile{
+			Expr:    expression.NewStringer().Visit(key.Expr),
+			Desc:    key.HasAttribute(datastore.IK_DESC),
+			Missing: key.HasAttribute(datastore.IK_MISSING),
+		}
+	}
+	if si.condition != nil {
+		f.Condition = expression.NewStringer().Visit(si.condition)
+	}
+	for i, e := range si.entries {
+		f.Entries[i] = newIndexEntryFile(e)
+		f.Entries[i].Id = e.id
+	}
+	bytes, er := json.Marshal(f)
+	si.RUnlock()
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	dir := filepath.Join(si.keyspace.path(), _INDEX_DIR)
+	if er = os.MkdirAll(dir, 0755); er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	// write and rename, so that a failure never leaves a truncated index behind
+	tmp := si.filename() + ".tmp"
+	if er = ioutil.WriteFile(tmp, bytes, 0666); er == nil {
+		er = os.Rename(tmp, si.filename())
+	}
+	if er == nil {
+		er = os.Remove(si.logFilename())
+		if os.IsNotExist(er) {
+			er = nil
+		}
+	}
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	si.Lock()
+	si.logged = 0
+	si.Unlock()
+	return nil
+}
+
+// append document changes to the log, folding it into the index file once it grows too long
+func (si *secondaryIndex) log(records []indexLogRecord) errors.Error {
+	buf := make([]byte, 0, 64*len(records))
+	for _, r := range records {
+		bytes, er := json.Marshal(r)
+		if er != nil {
+			return errors.NewFileDatastoreError(er, "")
+		}
+		buf = append(append(buf, bytes...), '\n')
+	}
+
+	file, er := os.OpenFile(si.logFilename(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if er == nil {
+		_, er = file.Write(buf)
+		if cer := file.Close(); er == nil {
+			er = cer
+		}
+	}
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	si.Lock()
+	si.logged += len(records)
+	compact := si.logged > _INDEX_LOG_MIN && si.logged > len(si.docs)
+	si.Unlock()
+	if compact {
+		return si.save()
+	}
+	return nil
+}
+
+// apply the logged document changes to the entries loaded from the index file
+func (si *secondaryIndex) replay() (int, error) {
+	file, er := os.Open(si.logFilename())
+	if er != nil {
+		if os.IsNotExist(er) {
+			return 0, nil
+		}
+		return 0, er
+	}
+	defer file.Close()
+
+	n := 0
+	decoder := json.NewDecoder(file)
+	for {
+		var r indexLogRecord
+		if er = decoder.Decode(&r); er == io.EOF {
+			return n, nil
+		} else if er != nil {
+			return n, er
+		}
+		entries := make([]*indexEntry, len(r.Entries))
+		for i := range r.Entries {
+			entries[i] = r.Entries[i].entry(r.Id)
+		}
+		si.replace(r.Id, entries)
+		n++
+	}
+}
+
+func (si *secondaryIndex) remove() errors.Error {
+	for _, name := range []string{si.filename(), si.logFilename()} {
+		if er := os.Remove(name); er != nil && !os.IsNotExist(er) {
+			return errors.NewFileDatastoreError(er, "")
+		}
+	}
+	return nil
+}
+
+// load an index from disk, rebuilding it if documents have changed since it was saved
+func loadIndex(fi *fileIndexer, path string) (*secondaryIndex, errors.Error) {
+	bytes, er := ioutil.ReadFile(path)
+	if er != nil {
+		return nil, errors.NewFileDatastoreError(er, "")
+	}
+
+	var f indexFile
+	if er = json.Unmarshal(bytes, &f); er != nil {
+		return nil, errors.NewFileDatastoreError(er, fmt.Sprintf("index file %v", path))
+	}
+
+	keys := make(datastore.IndexKeys, len(f.Keys))
+	for i, k := range f.Keys {
+		expr, er := n1ql.ParseExpression(k.Expr)
+		if er != nil {
+			return nil, errors.NewFileDatastoreError(er, fmt.Sprintf("index %v key %v", f.Name, k.Expr))
+		}
+		keys[i] = &datastore.IndexKey{Expr: expr}
+		if k.Desc {
+			keys[i].SetAttribute(datastore.IK_DESC, true)
+		}
+		if k.Missing {
+			keys[i].SetAttribute(datastore.IK_MISSING, true)
+		}
+	}
+
+	var condition expression.Expression
+	if f.Condition != "" {
+		condition, er = n1ql.ParseExpression(f.Condition)
+		if er != nil {
+			return nil, errors.NewFileDatastoreError(er, fmt.Sprintf("index %v condition %v", f.Name, f.Condition))
+		}
+	}
+
+	si := newSecondaryIndex(fi, f.Name, keys, condition)
+	if datastore.IndexState(f.State) != datastore.ONLINE {
+		return si, nil
+	}
+
+	if stale, err := si.stale(path); err != nil || stale {
+		logging.Infof("Rebuilding index %v on keyspace %v", si.name, si.keyspace.name)
+		return si, si.build()
+	}
+
+	si.entries = make([]*indexEntry, len(f.Entries))
+	si.docs = make(map[string][]*indexEntry, len(f.Entries))
+	for i := range f.Entries {
+		e := f.Entries[i].entry(f.Entries[i].Id)
+		si.entries[i] = e
+		si.docs[e.id] = append(si.docs[e.id], e)
+	}
+	si.state = datastore.ONLINE
+
+	if n, er := si.replay(); er != nil {
+		logging.Infof("Rebuilding index %v on keyspace %v: %v", si.name, si.keyspace.name, er)
+		return si, si.build()
+	} else if n > 0 {
+		return si, si.save()
+	}
+	return si, nil
+}
+
+// documents may have been edited while the datastore was not running
+func (si *secondaryIndex) stale(path string) (bool, error) {
+	indexInfo, er := os.Stat(path)
+	if er != nil {
+		return true, er
+	}
+
+	// the log is written after the documents it records
+	if logInfo, er := os.Stat(si.logFilename()); er == nil && logInfo.ModTime().After(indexInfo.ModTime()) {
+		indexInfo = logInfo
+	}
+	dirInfo, er := os.Stat(si.keyspace.path())
+	if er != nil {
+		return true, er
+	}
+
+	// the directory changes when documents are added or removed
+	if dirInfo.ModTime().After(indexInfo.ModTime()) {
+		return true, nil
+	}
+
+	dirEntries, er := ioutil.ReadDir(si.keyspace.path())
+	if er != nil {
+		return true, er
+	}
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() && dirEntry.ModTime().After(indexInfo.ModTime()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,214 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/couchbase/query/value"
+)
+
+// The metadata of a document is kept in .meta/KEY.json in the keyspace directory,
+// and is rewritten by every INSERT, UPDATE and UPSERT of the document, and when a
+// transaction that wrote the document commits. Documents without metadata, such
+// as those copied into the directory by hand, never expire and get their cas from
+// the modification time of their file.
+//
+// Expired documents are hidden rather than removed: they are purged when they
+// are next written or deleted.
+
+const _META_DIR = ".meta"
+
+// expirations up to 30 days are relative to now, as in memcached
+const _MONTH = uint32(30 * 24 * 60 * 60)
+
+type docMeta struct {
+	Cas        uint64 `json:"cas"`
+	Expiration uint32 `json:"expiration"`
+	Flags      uint32 `json:"flags"`
+}
+
+func (m *docMeta) expired(now uint32) bool {
+	return m.Expiration != 0 && m.Expiration <= now
+}
+
+func (b *keyspace) metaPath(key string) string {
+	return filepath.Join(b.path(), _META_DIR, key+".json")
+}
+
+// the metadata is read before the document, so that a concurrent write can make
+// the cas of a fetched document stale, but never newer than its content
+func (b *keyspace) readMeta(key string) (*docMeta, error) {
+	bytes, er := ioutil.ReadFile(b.metaPath(key))
+	if er == nil {
+		meta := &docMeta{}
+		er = json.Unmarshal(bytes, meta)
+		if er != nil {
+			return nil, er
+		}
+		return meta, nil
+	} else if !os.IsNotExist(er) {
+		return nil, er
+	}
+
+	info, er := os.Stat(filepath.Join(b.path(), key+".json"))
+	if er != nil {
+		return nil, er
+	}
+	return &docMeta{Cas: uint64(info.ModTime().UnixNano())}, nil
+}
+
+// the caller holds the file lock
+func (b *keyspace) writeMeta(key string, meta *docMeta) error {
+	bytes, er := json.Marshal(meta)
+	if er != nil {
+		return er
+	}
+	er = os.MkdirAll(filepath.Join(b.path(), _META_DIR), 0777)
+	if er == nil {
+		er = ioutil.WriteFile(b.metaPath(key), bytes, 0666)
+	}
+	if er != nil {
+		return er
+	}
+
+	b.expiriesLock.Lock()
+	if meta.Expiration != 0 {
+		b.expiries[key] = meta.Expiration
+	} else {
+		delete(b.expiries, key)
+	}
+	b.expiriesLock.Unlock()
+	return nil
+}
+
+// the caller holds the file lock, or is committing a transaction; the metadata
+// directory goes with the last document that has metadata
+func (b *keyspace) removeMeta(key string) {
+	if os.Remove(b.metaPath(key)) == nil {
+		os.Remove(filepath.Join(b.path(), _META_DIR))
+	}
+	b.expiriesLock.Lock()
+	delete(b.expiries, key)
+	b.expiriesLock.Unlock()
+}
+
+// whether the document exists and has not expired
+func (b *keyspace) exists(key string, now uint32) bool {
+	_, er := os.Stat(filepath.Join(b.path(), key+".json"))
+	return er == nil && !b.expired(key, now)
+}
+
+// scans check expiration in memory rather than reading the metadata of each document
+func (b *keyspace) expired(key string, now uint32) bool {
+	b.expiriesLock.RLock()
+	expiration, ok := b.expiries[key]
+	b.expiriesLock.RUnlock()
+	return ok && expiration <= now
+}
+
+// loadMeta collects the expirations of the documents of the keyspace.
+func (b *keyspace) loadMeta() error {
+	b.expiries = make(map[string]uint32)
+	dirEntries, er := ioutil.ReadDir(filepath.Join(b.path(), _META_DIR))
+	if os.IsNotExist(er) {
+		return nil
+	} else if er != nil {
+		return er
+	}
+
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || filepath.Ext(dirEntry.Name()) != ".json" {
+			continue
+		}
+		bytes, er := ioutil.ReadFile(filepath.Join(b.path(), _META_DIR, dirEntry.Name()))
+		if er != nil {
+			return er
+		}
+		meta := &docMeta{}
+		if er = json.Unmarshal(bytes, meta); er != nil {
+			return er
+		}
+		if meta.Expiration != 0 {
+			b.expiries[documentPathToId(dirEntry.Name())] = meta.Expiration
+		}
+	}
+	return nil
+}
+
+func (b *keyspace) setMeta(item value.AnnotatedValue, meta *docMeta) {
+	metaType := "json"
+	if item.Type() == value.BINARY {
+		metaType = "base64"
+	}
+	m := item.NewMeta()
+	m["keyspace"] = b.QualifiedName()
+	m["cas"] = meta.Cas
+	m["type"] = metaType
+	m["flags"] = meta.Flags
+	m["expiration"] = meta.Expiration
+}
+
+// the cas and flags of a value to be written, if it was fetched
+func getMeta(val value.Value) (cas uint64, flags uint32) {
+	if av, ok := val.(value.AnnotatedValue); ok && av != nil {
+		meta := av.GetMeta()
+		cas, _ = meta["cas"].(uint64)
+		flags, _ = meta["flags"].(uint32)
+	}
+	return
+}
+
+func setMetaCas(val value.Value, cas uint64) {
+	if av, ok := val.(value.AnnotatedValue); ok && av != nil {
+		av.NewMeta()["cas"] = cas
+	}
+}
+
+// the absolute expiration requested by the options of a mutation
+func getExpiration(options value.Value, now uint32) uint32 {
+	var expiration uint32
+	if options != nil && options.Type() == value.OBJECT {
+		if v, ok := options.Field("expiration"); ok && v.Type() == value.NUMBER {
+			if exp := value.AsNumberValue(v).Int64(); exp > 0 {
+				expiration = uint32(exp)
+			}
+		}
+	}
+	if expiration > 0 && expiration < _MONTH {
+		expiration += now
+	}
+	return expiration
+}
+
+func unixNow() uint32 {
+	return uint32(time.Now().Unix())
+}
+
+// cas values increase across the store, even if the clock does not
+var casGen struct {
+	sync.Mutex
+	last uint64
+}
+
+func newCas() uint64 {
+	casGen.Lock()
+	defer casGen.Unlock()
+	cas := uint64(time.Now().UnixNano())
+	if cas <= casGen.last {
+		cas = casGen.last + 1
+	}
+	casGen.last = cas
+	return cas
+}
@@ -0,0 +1,60 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/couchbase/query/errors"
+)
+
+// Optimizer statistics are persisted in a hidden directory of the keyspace,
+// next to the indexes.
+const _STATISTICS_DIR = ".statistics"
+
+func (b *keyspace) statisticsFile() string {
+	return filepath.Join(b.path(), _STATISTICS_DIR, "statistics.json")
+}
+
+func (b *keyspace) LoadStatistics() ([]byte, errors.Error) {
+	bytes, er := ioutil.ReadFile(b.statisticsFile())
+	if er != nil {
+		if os.IsNotExist(er) {
+			return nil, nil
+		}
+		return nil, errors.NewFileDatastoreError(er, "")
+	}
+	return bytes, nil
+}
+
+func (b *keyspace) SaveStatistics(data []byte) errors.Error {
+	if er := os.MkdirAll(filepath.Dir(b.statisticsFile()), 0755); er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	// write and rename, so that a failure never leaves truncated statistics behind
+	tmp := b.statisticsFile() + ".tmp"
+	er := ioutil.WriteFile(tmp, data, 0666)
+	if er == nil {
+		er = os.Rename(tmp, b.statisticsFile())
+	}
+	if er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	return nil
+}
+
+func (b *keyspace) DropStatistics() errors.Error {
+	if er := os.Remove(b.statisticsFile()); er != nil && !os.IsNotExist(er) {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	return nil
+}
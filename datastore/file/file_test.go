@@ -10,13 +10,20 @@ package file
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/couchbase/query/auth"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/parser/n1ql"
 	"github.com/couchbase/query/value"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestFile(t *testing.T) {
@@ -186,6 +193,522 @@ func TestFile(t *testing.T) {
 
 }
 
+func TestFileIndex(t *testing.T) {
+	dir, er := ioutil.TempDir("", "fileindex")
+	if er != nil {
+		t.Fatalf("failed to create directory: %v", er)
+	}
+	defer os.RemoveAll(dir)
+
+	// work on a copy of the contacts, so that indexes and DML don't touch the test data
+	src := "../../test/filestore/json/default/contacts"
+	dst := filepath.Join(dir, "default", "contacts")
+	if er = os.MkdirAll(dst, 0755); er != nil {
+		t.Fatalf("failed to create keyspace: %v", er)
+	}
+	files, _ := ioutil.ReadDir(src)
+	for _, f := range files {
+		bytes, _ := ioutil.ReadFile(filepath.Join(src, f.Name()))
+		ioutil.WriteFile(filepath.Join(dst, f.Name()), bytes, 0666)
+	}
+
+	indexer := openIndexer(t, dir)
+	byName, err := indexer.CreateIndex3("", "by_name", indexKeys(t, "name"), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	byHobby, err := indexer.CreateIndex3("", "by_hobby",
+		indexKeys(t, "DISTINCT ARRAY h FOR h IN hobbies END", "name"), nil, nil,
+		value.NewValue(map[string]interface{}{"defer_build": true}))
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	_, err = indexer.CreateIndex3("", "by_name", indexKeys(t, "type"), nil, nil, nil)
+	if err == nil || !errors.IsIndexExistsError(err) {
+		t.Errorf("expected index exists error, got %v", err)
+	}
+
+	if state, _, _ := byHobby.State(); state != datastore.DEFERRED {
+		t.Errorf("expected deferred index, got %v", state)
+	}
+	if err = indexer.BuildIndexes("", "by_hobby"); err != nil {
+		t.Fatalf("failed to build index: %v", err)
+	}
+
+	names := scanIndex(t, byName, span("e", "i"), false, nil, nil)
+	expectKeys(t, "range", names, "earl", "fred", "harry")
+
+	names = scanIndex(t, byName, span("e", "i"), true, nil, nil)
+	expectKeys(t, "reverse range", names, "harry", "fred", "earl")
+
+	names = scanIndex(t, byHobby, span("golf", "golf"), false, nil, nil)
+	expectKeys(t, "array key", names, "dave", "fred", "ian")
+
+	// covering scan on the second key
+	proj := &datastore.IndexProjection{EntryKeys: []int{1}}
+	entries := scanEntries(t, byHobby, span("surfing", "surfing"), proj, nil)
+	if len(entries) != 4 || len(entries[0].EntryKey) != 1 || entries[0].EntryKey[0].Actual() != "dave" {
+		t.Errorf("unexpected projected entries %v", entries)
+	}
+
+	// COUNT(*) pushed down to the index
+	groupAggs := &datastore.IndexGroupAggregates{
+		Aggregates: datastore.IndexAggregates{&datastore.IndexAggregate{Operation: datastore.AGG_COUNT,
+			EntryKeyId: 2, KeyPos: -1}},
+	}
+	proj = &datastore.IndexProjection{EntryKeys: []int{2}}
+	entries = scanEntries(t, byHobby, span("golf", "golf"), proj, groupAggs)
+	if len(entries) != 1 || entries[0].EntryKey[0].String() != "3" {
+		t.Errorf("unexpected count %v", entries[0].EntryKey)
+	}
+
+	// indexes follow the documents
+	saved, _ := os.Stat(byName.(*secondaryIndex).filename())
+	grace := value.NewValue(map[string]interface{}{"type": "contact", "name": "grace", "hobbies": []interface{}{"golf"}})
+	ks := indexer.keyspace
+	if _, err = ks.Insert([]value.Pair{value.Pair{Name: "grace", Value: grace}}, datastore.NULL_QUERY_CONTEXT); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if _, err = ks.Delete([]value.Pair{value.Pair{Name: "fred"}}, datastore.NULL_QUERY_CONTEXT); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	names = scanIndex(t, byName, span("e", "i"), false, nil, nil)
+	expectKeys(t, "range after DML", names, "earl", "grace", "harry")
+	names = scanIndex(t, byHobby, span("golf", "golf"), false, nil, nil)
+	expectKeys(t, "array key after DML", names, "dave", "grace", "ian")
+
+	if count, _ := ks.Count(datastore.NULL_QUERY_CONTEXT); count != 6 {
+		t.Errorf("expected 6 documents, got %v", count)
+	}
+
+	// changes are logged rather than rewriting the index file
+	if info, _ := os.Stat(byName.(*secondaryIndex).filename()); !info.ModTime().Equal(saved.ModTime()) {
+		t.Errorf("index file rewritten by DML")
+	}
+	if _, er = os.Stat(byName.(*secondaryIndex).logFilename()); er != nil {
+		t.Errorf("expected DML to be logged: %v", er)
+	}
+
+	// indexes survive a restart
+	indexer = openIndexer(t, dir)
+	index, err := indexer.IndexByName("by_name")
+	if err != nil {
+		t.Fatalf("index not persisted: %v", err)
+	}
+	names = scanIndex(t, index.(datastore.Index3), span("e", "i"), false, nil, nil)
+	expectKeys(t, "range after restart", names, "earl", "grace", "harry")
+	if _, er = os.Stat(index.(*secondaryIndex).logFilename()); !os.IsNotExist(er) {
+		t.Errorf("expected log to be compacted on open: %v", er)
+	}
+
+	// and the log is compacted once it outgrows the index
+	ks = indexer.keyspace
+	for i := 0; i < _INDEX_LOG_MIN+1; i++ {
+		if _, err = ks.Upsert([]value.Pair{value.Pair{Name: "grace", Value: grace}}, datastore.NULL_QUERY_CONTEXT); err != nil {
+			t.Fatalf("failed to upsert: %v", err)
+		}
+	}
+	if _, er = os.Stat(index.(*secondaryIndex).logFilename()); !os.IsNotExist(er) {
+		t.Errorf("expected log to be compacted: %v", er)
+	}
+	names = scanIndex(t, index.(datastore.Index3), span("e", "i"), false, nil, nil)
+	expectKeys(t, "range after compaction", names, "earl", "grace", "harry")
+
+	if err = index.Drop(""); err != nil {
+		t.Errorf("failed to drop index: %v", err)
+	}
+	indexer = openIndexer(t, dir)
+	if _, err = indexer.IndexByName("by_name"); err == nil {
+		t.Errorf("dropped index still exists")
+	}
+	if indexes, _ := indexer.Indexes(); len(indexes) != 2 {
+		t.Errorf("expected primary and one secondary index, got %v", len(indexes))
+	}
+}
+
+func TestFileAuth(t *testing.T) {
+	dir, er := ioutil.TempDir("", "fileauth")
+	if er != nil {
+		t.Fatalf("failed to create directory: %v", er)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, ks := range []string{"contacts", "orders"} {
+		if er = os.MkdirAll(filepath.Join(dir, "default", ks), 0755); er != nil {
+			t.Fatalf("failed to create keyspace: %v", er)
+		}
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	users := `[{"id": "alice", "domain": "local", "name": "Alice", "password": "` + string(hash) + `",
+		"roles": [{"role": "query_select", "bucket_name": "contacts"}]},
+		{"id": "bob", "domain": "local", "password": "` + string(hash) + `", "roles": [{"role": "admin"}]}]`
+	if er = ioutil.WriteFile(filepath.Join(dir, _USERS_FILE), []byte(users), 0600); er != nil {
+		t.Fatalf("failed to write users: %v", er)
+	}
+
+	store, err := NewDatastore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	authorize := func(user, password string, target string, priv auth.Privilege) (auth.AuthenticatedUsers, errors.Error) {
+		creds := auth.NewCredentials()
+		if user != "" {
+			creds.Users[user] = password
+		}
+		privs := auth.NewPrivileges()
+		privs.Add(target, priv, auth.PRIV_PROPS_NONE)
+		return store.Authorize(privs, creds)
+	}
+
+	authUsers, err := authorize("alice", "secret", "default:contacts", auth.PRIV_QUERY_SELECT)
+	if err != nil || len(authUsers) != 1 || authUsers[0] != "local:alice" {
+		t.Errorf("expected alice to select from contacts, got %v %v", authUsers, err)
+	}
+	if _, err = authorize("local:alice", "secret", "default:orders", auth.PRIV_QUERY_SELECT); err == nil ||
+		err.Code() != 13014 {
+		t.Errorf("expected insufficient credentials for orders, got %v", err)
+	}
+	if _, err = authorize("alice", "secret", "default:contacts", auth.PRIV_QUERY_DELETE); err == nil {
+		t.Errorf("expected alice not to delete from contacts")
+	}
+	if _, err = authorize("alice", "wrong", "default:contacts", auth.PRIV_QUERY_SELECT); err == nil ||
+		err.Code() != errors.DS_AUTH_ERROR {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+	if _, err = authorize("", "", "default:contacts", auth.PRIV_QUERY_SELECT); err == nil {
+		t.Errorf("expected anonymous select to fail")
+	}
+	if _, err = authorize("bob", "secret", "", auth.PRIV_SECURITY_WRITE); err != nil {
+		t.Errorf("expected admin to write security, got %v", err)
+	}
+	if _, err = store.Authorize(auth.NewPrivileges(), auth.NewCredentials()); err != nil {
+		t.Errorf("expected no privileges to need no credentials, got %v", err)
+	}
+
+	// GRANT and REVOKE keep the password and persist the roles
+	err = store.PutUserInfo(&datastore.User{Id: "alice", Domain: "local", Name: "Alice",
+		Roles: []datastore.Role{datastore.Role{Name: "query_select", Target: "contacts"},
+			datastore.Role{Name: "query_select", Target: "orders"}}})
+	if err != nil {
+		t.Fatalf("failed to put user: %v", err)
+	}
+	store, err = NewDatastore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if _, err = authorize("alice", "secret", "default:orders", auth.PRIV_QUERY_SELECT); err != nil {
+		t.Errorf("expected granted role to persist, got %v", err)
+	}
+
+	info, err := store.UserInfo()
+	if err != nil {
+		t.Fatalf("failed to get user info: %v", err)
+	}
+	if bytes, _ := info.MarshalJSON(); strings.Contains(string(bytes), "password") ||
+		!strings.Contains(string(bytes), `"bucket_name":"orders"`) {
+		t.Errorf("unexpected user info %s", bytes)
+	}
+}
+
+func TestFileCollections(t *testing.T) {
+	dir, s, ks := newTxStore(t)
+	defer os.RemoveAll(dir)
+
+	namespace, _ := s.NamespaceByName("default")
+	bucket, err := namespace.BucketByName("orders")
+	if err != nil {
+		t.Fatalf("failed to get bucket: %v", err)
+	}
+	if names, _ := bucket.ScopeNames(); len(names) != 1 || names[0] != "_default" {
+		t.Errorf("expected only the default scope, got %v", names)
+	}
+	defaultScope, _ := bucket.ScopeByName("_default")
+	if defaultCollection, _ := defaultScope.KeyspaceByName("_default"); defaultCollection != ks {
+		t.Errorf("expected the default collection to be the bucket")
+	}
+
+	if err = bucket.CreateScope("inventory"); err != nil {
+		t.Fatalf("failed to create scope: %v", err)
+	}
+	if err = bucket.CreateScope("inventory"); !errors.IsScopeExistsError(err) {
+		t.Errorf("expected scope exists error, got %v", err)
+	}
+	if err = bucket.CreateScope("../inventory"); err == nil {
+		t.Errorf("expected an invalid scope name to fail")
+	}
+	scope, _ := bucket.ScopeByName("inventory")
+	if err = scope.CreateCollection("airline"); err != nil {
+		t.Fatalf("failed to create collection: %v", err)
+	}
+	if err = scope.CreateCollection("airline"); !errors.IsCollectionExistsError(err) {
+		t.Errorf("expected collection exists error, got %v", err)
+	}
+	if err = defaultScope.CreateCollection("archive"); err != nil {
+		t.Fatalf("failed to create collection in the default scope: %v", err)
+	}
+	if _, er := os.Stat(filepath.Join(dir, "default", "orders", "_default", "archive")); er != nil {
+		t.Errorf("expected a directory for the collection: %v", er)
+	}
+
+	airline, _ := scope.KeyspaceByName("airline")
+	if airline.QualifiedName() != "default:orders.inventory.airline" || airline.AuthKey() != "orders:inventory:airline" {
+		t.Errorf("unexpected collection names %v %v", airline.QualifiedName(), airline.AuthKey())
+	}
+	pairs := []value.Pair{{Name: "a1", Value: value.NewValue(map[string]interface{}{"name": "Ace"})}}
+	if _, err = airline.Insert(pairs, &txQueryContext{}); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if _, er := os.Stat(filepath.Join(dir, "default", "orders", "inventory", "airline", "a1.json")); er != nil {
+		t.Errorf("expected the document in the collection directory: %v", er)
+	}
+	if count, _ := ks.Count(nil); count != 1 {
+		t.Errorf("expected the bucket to keep 1 document, got %v", count)
+	}
+
+	// scopes and collections are found again on restart
+	s, err = NewDatastore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	namespace, _ = s.NamespaceByName("default")
+	bucket, _ = namespace.BucketByName("orders")
+	if names, _ := bucket.ScopeNames(); len(names) != 2 || names[0] != "_default" || names[1] != "inventory" {
+		t.Errorf("expected default and inventory scopes, got %v", names)
+	}
+	scope, _ = bucket.ScopeByName("inventory")
+	airline, err = scope.KeyspaceByName("airline")
+	if err != nil {
+		t.Fatalf("failed to get collection: %v", err)
+	}
+	if fetchTx(t, airline, &txQueryContext{}, "a1") == nil {
+		t.Errorf("expected the document to persist")
+	}
+
+	if err = airline.Flush(); err != nil {
+		t.Fatalf("failed to flush collection: %v", err)
+	}
+	if count, _ := airline.Count(nil); count != 0 {
+		t.Errorf("expected an empty collection, got %v documents", count)
+	}
+	if err = scope.DropCollection("airline"); err != nil {
+		t.Fatalf("failed to drop collection: %v", err)
+	}
+	if err = scope.DropCollection("airline"); !errors.IsCollectionNotFoundError(err) {
+		t.Errorf("expected collection not found error, got %v", err)
+	}
+	if err = bucket.DropScope("_default"); err == nil {
+		t.Errorf("expected dropping the default scope to fail")
+	}
+	if err = bucket.DropScope("inventory"); err != nil {
+		t.Fatalf("failed to drop scope: %v", err)
+	}
+	if err = bucket.DropScope("inventory"); !errors.IsScopeNotFoundError(err) {
+		t.Errorf("expected scope not found error, got %v", err)
+	}
+	if _, er := os.Stat(filepath.Join(dir, "default", "orders", "inventory")); !os.IsNotExist(er) {
+		t.Errorf("expected the scope directory to be removed")
+	}
+}
+
+func TestFileExpirationAndCas(t *testing.T) {
+	dir, s, ks := newTxStore(t)
+	defer os.RemoveAll(dir)
+	context := &txQueryContext{}
+
+	// documents written by hand get their cas from the file
+	o1, _ := fetchTx(t, ks, context, "o1").(value.AnnotatedValue)
+	if o1 == nil {
+		t.Fatalf("expected to fetch o1")
+	}
+	if cas, _ := o1.GetMeta()["cas"].(uint64); cas == 0 {
+		t.Errorf("expected a cas for o1, got %v", o1.GetMeta())
+	}
+
+	// expirations are relative up to 30 days, absolute beyond
+	now := time.Now().Unix()
+	pairs := []value.Pair{
+		{Name: "o2", Value: value.NewValue(map[string]interface{}{"n": 2}),
+			Options: value.NewValue(map[string]interface{}{"expiration": now - 10})},
+		{Name: "o3", Value: value.NewValue(map[string]interface{}{"n": 3}),
+			Options: value.NewValue(map[string]interface{}{"expiration": 3600})},
+	}
+	if _, err := ks.Insert(pairs, context); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if o2 := fetchTx(t, ks, context, "o2"); o2 != nil {
+		t.Errorf("expected o2 to have expired, got %v", o2)
+	}
+	o3, _ := fetchTx(t, ks, context, "o3").(value.AnnotatedValue)
+	if exp, _ := o3.GetMeta()["expiration"].(uint32); int64(exp) < now+3600 || int64(exp) > now+3610 {
+		t.Errorf("expected o3 to expire in an hour, got %v", o3.GetMeta())
+	}
+	if count, _ := ks.Count(nil); count != 2 {
+		t.Errorf("expected 2 unexpired documents, got %v", count)
+	}
+	indexer, _ := ks.Indexer(datastore.DEFAULT)
+	primaries, _ := indexer.PrimaryIndexes()
+	conn := datastore.NewIndexConnection(&testingContext{t})
+	go primaries[0].ScanEntries("", math.MaxInt64, datastore.UNBOUNDED, nil, conn)
+	var keys []string
+	for entry, ok := conn.Sender().GetEntry(); ok && entry != nil; entry, ok = conn.Sender().GetEntry() {
+		keys = append(keys, entry.PrimaryKey)
+	}
+	expectKeys(t, "primary scan", keys, "o1", "o3")
+
+	// expiration survives a restart, and expired keys can be inserted again
+	s, _ = NewDatastore(dir)
+	namespace, _ := s.NamespaceByName("default")
+	ks, _ = namespace.KeyspaceByName("orders")
+	if o2 := fetchTx(t, ks, context, "o2"); o2 != nil {
+		t.Errorf("expected o2 to stay expired, got %v", o2)
+	}
+	if _, err := ks.Insert(pairs[:1], context); err != nil {
+		t.Errorf("expected to insert over an expired document, got %v", err)
+	}
+
+	// updates and deletes are rejected if the document changed since it was fetched
+	update := func(doc value.AnnotatedValue, n int) errors.Error {
+		val := value.NewAnnotatedValue(value.NewValue(map[string]interface{}{"n": n}))
+		val.CopyAnnotations(doc)
+		_, err := ks.Update([]value.Pair{{Name: "o1", Value: val}}, context)
+		return err
+	}
+	if err := update(o1, 10); err != nil {
+		t.Fatalf("failed to update o1: %v", err)
+	}
+	if err := update(o1, 11); err == nil || err.Code() != 15020 {
+		t.Errorf("expected a cas mismatch, got %v", err)
+	}
+	if deleted, err := ks.Delete([]value.Pair{{Name: "o1", Value: o1}}, context); len(deleted) != 0 || err == nil {
+		t.Errorf("expected a cas mismatch on delete, got %v %v", deleted, err)
+	}
+	current := fetchTx(t, ks, context, "o1")
+	if n, _ := current.Field("n"); n.Actual() != float64(10) {
+		t.Errorf("expected the first update only, got %v", current)
+	}
+	if deleted, err := ks.Delete([]value.Pair{{Name: "o1", Value: current}}, context); len(deleted) != 1 || err != nil {
+		t.Errorf("expected to delete o1, got %v %v", deleted, err)
+	}
+	if _, er := os.Stat(filepath.Join(dir, "default", "orders", _META_DIR, "o1.json")); !os.IsNotExist(er) {
+		t.Errorf("expected the metadata of o1 to be removed")
+	}
+
+	// transactions honour expirations and cas too
+	stale := o3
+	o3, _ = fetchTx(t, ks, context, "o3").(value.AnnotatedValue)
+	if _, err := ks.Update([]value.Pair{{Name: "o3", Value: o3}}, context); err != nil {
+		t.Fatalf("failed to update o3: %v", err)
+	}
+	tx := &txQueryContext{}
+	tx.begin(t, s)
+	pairs = []value.Pair{
+		{Name: "o4", Value: value.NewValue(map[string]interface{}{"n": 4}),
+			Options: value.NewValue(map[string]interface{}{"expiration": 3600})},
+		{Name: "o5", Value: value.NewValue(map[string]interface{}{"n": 5}),
+			Options: value.NewValue(map[string]interface{}{"expiration": now - 10})},
+	}
+	if _, err := ks.Insert(pairs, tx); err != nil {
+		t.Fatalf("failed to insert in transaction: %v", err)
+	}
+	if _, err := ks.Update([]value.Pair{{Name: "o3", Value: stale}}, tx); err == nil || err.Code() != 15020 {
+		t.Errorf("expected a cas mismatch in transaction, got %v", err)
+	}
+	if deleted, err := ks.Delete([]value.Pair{{Name: "o3", Value: stale}}, tx); len(deleted) != 0 || err == nil {
+		t.Errorf("expected a cas mismatch on delete in transaction, got %v %v", deleted, err)
+	}
+	if err := s.CommitTransaction(false, tx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	o4, _ := fetchTx(t, ks, context, "o4").(value.AnnotatedValue)
+	if o4 == nil {
+		t.Fatalf("expected to fetch o4")
+	}
+	if exp, _ := o4.GetMeta()["expiration"].(uint32); int64(exp) < now+3600 || int64(exp) > now+3610 {
+		t.Errorf("expected o4 to expire in an hour, got %v", o4.GetMeta())
+	}
+	if cas, _ := o4.GetMeta()["cas"].(uint64); cas == 0 {
+		t.Errorf("expected a cas for o4, got %v", o4.GetMeta())
+	}
+	if o5 := fetchTx(t, ks, context, "o5"); o5 != nil {
+		t.Errorf("expected o5 to have expired, got %v", o5)
+	}
+	if current, _ := fetchTx(t, ks, context, "o3").(value.AnnotatedValue); current == nil {
+		t.Errorf("expected o3 to be kept")
+	}
+}
+
+func openIndexer(t *testing.T, dir string) *fileIndexer {
+	store, err := NewDatastore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	namespace, err := store.NamespaceByName("default")
+	if err != nil {
+		t.Fatalf("failed to get namespace: %v", err)
+	}
+	keyspace, err := namespace.KeyspaceByName("contacts")
+	if err != nil {
+		t.Fatalf("failed to get keyspace: %v", err)
+	}
+	indexer, _ := keyspace.Indexer(datastore.DEFAULT)
+	return indexer.(*fileIndexer)
+}
+
+func indexKeys(t *testing.T, exprs ...string) datastore.IndexKeys {
+	keys := make(datastore.IndexKeys, len(exprs))
+	for i, s := range exprs {
+		expr, er := n1ql.ParseExpression(s)
+		if er != nil {
+			t.Fatalf("failed to parse %v: %v", s, er)
+		}
+		keys[i] = &datastore.IndexKey{Expr: expr}
+	}
+	return keys
+}
+
+func span(low, high string) datastore.Spans2 {
+	return datastore.Spans2{&datastore.Span2{Ranges: datastore.Ranges2{&datastore.Range2{
+		Low: value.NewValue(low), High: value.NewValue(high), Inclusion: datastore.BOTH}}}}
+}
+
+func scanEntries(t *testing.T, index datastore.Index, spans datastore.Spans2, proj *datastore.IndexProjection,
+	groupAggs *datastore.IndexGroupAggregates) []*datastore.IndexEntry {
+	return scanAll(t, index.(datastore.Index3), spans, false, proj, groupAggs)
+}
+
+func scanIndex(t *testing.T, index datastore.Index, spans datastore.Spans2, reverse bool,
+	proj *datastore.IndexProjection, groupAggs *datastore.IndexGroupAggregates) []string {
+	var keys []string
+	for _, entry := range scanAll(t, index.(datastore.Index3), spans, reverse, proj, groupAggs) {
+		keys = append(keys, entry.PrimaryKey)
+	}
+	return keys
+}
+
+func scanAll(t *testing.T, index datastore.Index3, spans datastore.Spans2, reverse bool,
+	proj *datastore.IndexProjection, groupAggs *datastore.IndexGroupAggregates) []*datastore.IndexEntry {
+	conn := datastore.NewIndexConnection(&testingContext{t})
+	go index.Scan3("", spans, reverse, false, proj, 0, math.MaxInt64, groupAggs, nil,
+		datastore.UNBOUNDED, nil, conn)
+
+	var entries []*datastore.IndexEntry
+	for {
+		entry, ok := conn.Sender().GetEntry()
+		if !ok || entry == nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func expectKeys(t *testing.T, what string, keys []string, expected ...string) {
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Errorf("%v: expected %v, got %v", what, expected, keys)
+	}
+}
+
 type testingContext struct {
 	t *testing.T
 }
@@ -0,0 +1,669 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/logging"
+	"github.com/couchbase/query/transactions"
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+// Transactions.
+//
+// The mutations of a transaction are kept in a delta, by keyspace and key,
+// which the statements of the transaction see in place of the document files,
+// while everybody else only ever sees committed documents (read committed).
+// An undo log of the previous state of every key changed provides statement
+// atomicity and savepoints.
+// Every change records the cas of the committed document when the transaction
+// first changed the key, and the commit fails if somebody else has changed the
+// document since. Updates and deletes of documents fetched with a stale cas fail
+// straight away, as they do outside of transactions.
+// The expiration and flags of the documents written are staged with them, and
+// committed documents get a new cas.
+// On commit the documents are first staged in every keyspace involved, then a
+// commit marker is written to the datastore directory, and finally the staged
+// files are moved in place. When the datastore is opened, the staged files of
+// a commit that has its marker are moved in place, and the others discarded.
+
+const _TXN_DIR = ".transactions"
+const _TXN_MARKER = ".transaction_"
+const _TXN_DELETE = ".delete"
+const _TXN_META = ".meta"
+
+type txMutation struct {
+	op         int // INSERT, UPDATE, UPSERT or DELETE
+	data       []byte
+	base       uint64 // cas of the committed document when first changed, 0 if there was none
+	expiration uint32
+	flags      uint32
+}
+
+type txUndo struct {
+	keyspace string
+	key      string
+	prev     *txMutation // nil if the key had not been changed
+}
+
+type transaction struct {
+	sync.Mutex
+	id         string
+	implicit   bool
+	keyspaces  map[string]*keyspace
+	deltas     map[string]map[string]*txMutation
+	log        []txUndo
+	savepoints map[string]int
+	stmtStart  int
+}
+
+func newTransaction(id string, implicit bool) *transaction {
+	return &transaction{
+		id:         id,
+		implicit:   implicit,
+		keyspaces:  make(map[string]*keyspace, 4),
+		deltas:     make(map[string]map[string]*txMutation, 4),
+		savepoints: make(map[string]int, 4),
+	}
+}
+
+// the transaction of the request, if any
+func getTransaction(context datastore.QueryContext) (*transaction, errors.Error) {
+	if context == nil {
+		return nil, nil
+	}
+	txContext, _ := context.GetTxContext().(*transactions.TranContext)
+	if txContext == nil {
+		return nil, nil
+	}
+	if txContext.TxExpired() {
+		return nil, errors.NewTransactionExpired(nil)
+	}
+	tx, _ := txContext.TxMutations().(*transaction)
+	return tx, nil
+}
+
+func (this *transaction) get(ks *keyspace, key string) *txMutation {
+	this.Lock()
+	defer this.Unlock()
+	return this.deltas[ks.QualifiedName()][key]
+}
+
+// a nil mutation reverts the key to the committed document
+func (this *transaction) set(ks *keyspace, key string, mutation *txMutation) {
+	this.Lock()
+	defer this.Unlock()
+	name := ks.QualifiedName()
+	delta := this.deltas[name]
+	if delta == nil {
+		delta = make(map[string]*txMutation, 64)
+		this.deltas[name] = delta
+		this.keyspaces[name] = ks
+	}
+	this.log = append(this.log, txUndo{keyspace: name, key: key, prev: delta[key]})
+	if mutation == nil {
+		delete(delta, key)
+	} else {
+		delta[key] = mutation
+	}
+}
+
+// undo all changes made after the given log position
+func (this *transaction) undo(pos int) {
+	this.Lock()
+	defer this.Unlock()
+	for i := len(this.log) - 1; i >= pos; i-- {
+		u := this.log[i]
+		if u.prev == nil {
+			delete(this.deltas[u.keyspace], u.key)
+		} else {
+			this.deltas[u.keyspace][u.key] = u.prev
+		}
+	}
+	this.log = this.log[:pos]
+	for name, sp := range this.savepoints {
+		if sp > len(this.log) {
+			delete(this.savepoints, name)
+		}
+	}
+}
+
+// a statement starts: note where, and which keyspaces it has to merge with the delta
+func (this *transaction) startStatement(dks map[string]bool) {
+	this.Lock()
+	defer this.Unlock()
+	this.stmtStart = len(this.log)
+	if this.implicit {
+		return
+	}
+	for name, delta := range this.deltas {
+		if len(delta) > 0 {
+			dks[name] = true
+		}
+	}
+}
+
+func (this *transaction) endStatement() {
+	this.Lock()
+	this.stmtStart = len(this.log)
+	this.Unlock()
+}
+
+func (this *transaction) setSavepoint(name string) {
+	this.Lock()
+	this.savepoints[name] = len(this.log)
+	this.Unlock()
+}
+
+func (this *transaction) savepoint(name string) (int, errors.Error) {
+	this.Lock()
+	defer this.Unlock()
+	if name == "" {
+		return this.stmtStart, nil
+	}
+	pos, ok := this.savepoints[name]
+	if !ok {
+		return 0, errors.NewNoSavepointError(name)
+	}
+	return pos, nil
+}
+
+// keys changed in a keyspace, true if deleted
+func (this *transaction) deltaKeys(name string) map[string]bool {
+	this.Lock()
+	defer this.Unlock()
+	delta := this.deltas[name]
+	keys := make(map[string]bool, len(delta))
+	for k, m := range delta {
+		keys[k] = (m.op == DELETE)
+	}
+	return keys
+}
+
+func (s *store) StartTransaction(stmtAtomicity bool, context datastore.QueryContext) (map[string]bool, errors.Error) {
+	txContext, _ := context.GetTxContext().(*transactions.TranContext)
+	if txContext == nil {
+		return nil, nil
+	}
+	if txContext.TxExpired() {
+		return nil, errors.NewTransactionExpired(nil)
+	}
+
+	if stmtAtomicity {
+		dks := make(map[string]bool, 8)
+		if tx, _ := txContext.TxMutations().(*transaction); tx != nil {
+			tx.startStatement(dks)
+		}
+		return dks, nil
+	}
+
+	if len(txContext.TxData()) > 0 {
+		return nil, errors.NewStartTransactionError(nil, "transactions cannot be resumed on file store")
+	}
+	id, err := util.UUIDV3()
+	if err != nil {
+		return nil, errors.NewStartTransactionError(err, nil)
+	}
+	txContext.SetTxMutations(newTransaction(id, txContext.TxImplicit()))
+	txContext.SetTxId(id, txContext.TxTimeout())
+	return nil, nil
+}
+
+func (s *store) CommitTransaction(stmtAtomicity bool, context datastore.QueryContext) errors.Error {
+	txContext, _ := context.GetTxContext().(*transactions.TranContext)
+	if txContext == nil {
+		return nil
+	}
+	tx, _ := txContext.TxMutations().(*transaction)
+	if tx == nil {
+		return nil
+	}
+
+	if stmtAtomicity {
+		tx.endStatement()
+		return nil
+	}
+
+	err := s.commit(tx)
+	txContext.SetTxMutations(nil)
+	if err != nil {
+		return errors.NewCommitTransactionError(err, nil)
+	}
+	return nil
+}
+
+func (s *store) RollbackTransaction(stmtAtomicity bool, context datastore.QueryContext, sname string) errors.Error {
+	txContext, _ := context.GetTxContext().(*transactions.TranContext)
+	if txContext == nil {
+		return nil
+	}
+	tx, _ := txContext.TxMutations().(*transaction)
+	if tx == nil {
+		return nil
+	}
+
+	// statement level atomicity or savepoint
+	if !tx.implicit && (stmtAtomicity || sname != "") {
+		if sname != "" && txContext.TxExpired() {
+			return errors.NewTransactionExpired(nil)
+		}
+		pos, err := tx.savepoint(sname)
+		if err == nil {
+			tx.undo(pos)
+		}
+		return err
+	}
+
+	txContext.SetTxMutations(nil)
+	return nil
+}
+
+func (s *store) SetSavepoint(stmtAtomicity bool, context datastore.QueryContext, sname string) errors.Error {
+	if sname == "" {
+		return nil
+	}
+	tx, err := getTransaction(context)
+	if tx == nil || err != nil {
+		return err
+	}
+	if !tx.implicit {
+		tx.setSavepoint(sname)
+	}
+	return nil
+}
+
+func (s *store) TransactionDeltaKeyScan(keyspace string, conn *datastore.IndexConnection) {
+	defer conn.Sender().Close()
+
+	tx, err := getTransaction(conn.QueryContext())
+	if err != nil {
+		conn.Fatal(err)
+		return
+	}
+	if tx == nil || tx.implicit {
+		return
+	}
+
+	// deleted keys are only sent to exclude them from the index scan
+	for k, deleted := range tx.deltaKeys(keyspace) {
+		ie := &datastore.IndexEntry{PrimaryKey: k}
+		if deleted {
+			ie.MetaData = value.NULL_VALUE
+		}
+		if !conn.Sender().SendEntry(ie) {
+			return
+		}
+	}
+}
+
+// write all mutations of the transaction to the document files
+func (s *store) commit(tx *transaction) errors.Error {
+	tx.Lock()
+	defer tx.Unlock()
+
+	names := make([]string, 0, len(tx.deltas))
+	for name, delta := range tx.deltas {
+		if len(delta) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	// always lock in the same order, so that concurrent commits do not deadlock
+	sort.Strings(names)
+	for _, name := range names {
+		ks := tx.keyspaces[name]
+		ks.fileLock.Lock()
+		defer ks.fileLock.Unlock()
+	}
+
+	// documents may have been changed by others since the transaction changed them
+	now := unixNow()
+	for _, name := range names {
+		ks := tx.keyspaces[name]
+		for key, m := range tx.deltas[name] {
+			cas := ks.committedCas(key, now)
+			if m.op == INSERT && cas != 0 {
+				return errors.NewFileKeyExists(nil, "Key "+key+" in keyspace "+name)
+			} else if cas != m.base {
+				return errors.NewFileCasMismatchError(nil, "key "+key+" in keyspace "+name+" changed by another request")
+			}
+		}
+	}
+
+	// stage
+	staged := make([]string, 0, len(names))
+	for _, name := range names {
+		ks := tx.keyspaces[name]
+		dir := filepath.Join(ks.path(), _TXN_DIR, tx.id)
+		staged = append(staged, dir)
+		err := stage(dir, tx.deltas[name])
+		if err != nil {
+			for _, dir := range staged {
+				os.RemoveAll(dir)
+			}
+			return err
+		}
+	}
+
+	// from here on the transaction is committed
+	marker := filepath.Join(s.path, _TXN_MARKER+tx.id)
+	er := ioutil.WriteFile(marker, []byte(strings.Join(names, "\n")), 0666)
+	if er != nil {
+		for _, dir := range staged {
+			os.RemoveAll(dir)
+		}
+		return errors.NewFileDatastoreError(er, "")
+	}
+
+	var err errors.Error
+	s.commitLock.Lock()
+	for i, name := range names {
+		ks := tx.keyspaces[name]
+		indexed, err1 := ks.applyStaged(staged[i])
+		ks.fi.updateIndexes(indexed)
+		if err1 != nil && err == nil {
+			err = err1
+		}
+	}
+	s.commitLock.Unlock()
+
+	// if something went wrong, the marker allows to complete the commit later
+	if err == nil {
+		os.Remove(marker)
+	}
+	return err
+}
+
+func stage(dir string, delta map[string]*txMutation) errors.Error {
+	if er := os.MkdirAll(dir, 0777); er != nil {
+		return errors.NewFileDatastoreError(er, "")
+	}
+	for key, m := range delta {
+		var er error
+		if m.op == DELETE {
+			er = ioutil.WriteFile(filepath.Join(dir, key+_TXN_DELETE), nil, 0666)
+		} else {
+			var meta []byte
+			meta, er = json.Marshal(&docMeta{Expiration: m.expiration, Flags: m.flags})
+			if er == nil {
+				er = ioutil.WriteFile(filepath.Join(dir, key+_TXN_META), meta, 0666)
+			}
+			if er == nil {
+				er = ioutil.WriteFile(filepath.Join(dir, key+".json"), m.data, 0666)
+			}
+		}
+		if er != nil {
+			return errors.NewFileDatastoreError(er, "")
+		}
+	}
+	return nil
+}
+
+// move the staged documents in place with new metadata, and return them for the
+// indexes. The staged metadata is removed last, so that the metadata of documents
+// already moved in place can still be written after a failure.
+func (b *keyspace) applyStaged(dir string) ([]value.Pair, errors.Error) {
+	dirEntries, er := ioutil.ReadDir(dir)
+	if er != nil {
+		return nil, errors.NewFileDatastoreError(er, "")
+	}
+
+	var err errors.Error
+	path := b.path()
+	indexed := make([]value.Pair, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if strings.HasSuffix(name, _TXN_DELETE) {
+			key := name[:len(name)-len(_TXN_DELETE)]
+			er = os.Remove(filepath.Join(path, key+".json"))
+			if er == nil || os.IsNotExist(er) {
+				b.removeMeta(key)
+				er = os.Remove(filepath.Join(dir, name))
+				indexed = append(indexed, value.Pair{Name: key})
+			}
+		} else if strings.HasSuffix(name, _TXN_META) {
+
+			// documents moved in place before a failure
+			key := name[:len(name)-len(_TXN_META)]
+			if _, er = os.Stat(filepath.Join(dir, key+".json")); er == nil {
+				continue
+			}
+			er = b.applyStagedMeta(dir, key)
+			if er == nil {
+				er = os.Remove(filepath.Join(dir, name))
+			} else if os.IsNotExist(er) {
+				er = nil
+			}
+		} else {
+			key := documentPathToId(name)
+			var data []byte
+			data, er = ioutil.ReadFile(filepath.Join(dir, name))
+			if er == nil {
+				er = os.Rename(filepath.Join(dir, name), filepath.Join(path, name))
+			}
+			if er == nil {
+				doc := value.NewAnnotatedValue(value.NewValue(data))
+				doc.SetId(key)
+				indexed = append(indexed, value.Pair{Name: key, Value: doc})
+
+				er = b.applyStagedMeta(dir, key)
+				if os.IsNotExist(er) {
+					er = b.writeMeta(key, &docMeta{Cas: newCas()})
+				} else if er == nil {
+					er = os.Remove(filepath.Join(dir, key+_TXN_META))
+				}
+			}
+		}
+		if er != nil && err == nil {
+			err = errors.NewFileDatastoreError(er, "")
+		}
+	}
+	if err == nil {
+		os.Remove(dir)
+	}
+	return indexed, err
+}
+
+func (b *keyspace) applyStagedMeta(dir, key string) error {
+	data, er := ioutil.ReadFile(filepath.Join(dir, key+_TXN_META))
+	if er != nil {
+		return er
+	}
+	meta := &docMeta{}
+	if er = json.Unmarshal(data, meta); er != nil {
+		return er
+	}
+	meta.Cas = newCas()
+	return b.writeMeta(key, meta)
+}
+
+// complete or discard the commits that were interrupted
+func (s *store) recoverTransactions() {
+	for _, p := range s.namespaces {
+		for _, ks := range p.allKeyspaces() {
+			root := filepath.Join(ks.path(), _TXN_DIR)
+			dirEntries, er := ioutil.ReadDir(root)
+			if er != nil {
+				continue
+			}
+			for _, dirEntry := range dirEntries {
+				dir := filepath.Join(root, dirEntry.Name())
+				if _, er = os.Stat(filepath.Join(s.path, _TXN_MARKER+dirEntry.Name())); er != nil {
+					os.RemoveAll(dir)
+					continue
+				}
+				indexed, err := ks.applyStaged(dir)
+				ks.fi.updateIndexes(indexed)
+				if err != nil {
+					logging.Errorf("Failed to complete transaction %v on keyspace %v: %v",
+						dirEntry.Name(), ks.name, err)
+				}
+			}
+		}
+	}
+
+	dirEntries, er := ioutil.ReadDir(s.path)
+	if er != nil {
+		return
+	}
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() && strings.HasPrefix(dirEntry.Name(), _TXN_MARKER) {
+			os.Remove(filepath.Join(s.path, dirEntry.Name()))
+		}
+	}
+}
+
+func (b *keyspace) txFetch(tx *transaction, keys []string, keysMap map[string]value.AnnotatedValue) []errors.Error {
+	var errs []errors.Error
+
+	for _, k := range keys {
+		var item value.AnnotatedValue
+		var e errors.Error
+
+		if m := tx.get(b, k); m != nil {
+			if m.op == DELETE {
+				continue
+			}
+			item = value.NewAnnotatedValue(value.NewValue(m.data))
+			b.setMeta(item, &docMeta{Cas: m.base, Expiration: m.expiration, Flags: m.flags})
+		} else {
+			item, e = b.fetchOne(k)
+			if e != nil {
+				if !os.IsNotExist(e.GetICause()) {
+					errs = append(errs, e)
+				}
+				continue
+			}
+		}
+		item.SetId(k)
+		keysMap[k] = item
+	}
+
+	return errs
+}
+
+func (b *keyspace) txPerformOp(tx *transaction, op int, kvPairs []value.Pair) ([]value.Pair, errors.Error) {
+	if len(kvPairs) == 0 {
+		return nil, errors.NewFileNoKeysInsertError(nil, "keyspace "+b.Name())
+	}
+
+	insertedKeys := make([]value.Pair, 0, len(kvPairs))
+	var returnErr errors.Error
+
+	now := unixNow()
+	for _, kv := range kvPairs {
+		key := kv.Name
+		prev := tx.get(b, key)
+		exists := b.txExists(prev, key)
+
+		newOp := op
+		switch op {
+		case INSERT:
+			if exists {
+				returnErr = errors.NewFileKeyExists(returnErr, "Key "+key)
+				continue
+			}
+		case UPDATE:
+			if !exists {
+				returnErr = errors.NewFileDMLError(returnErr, opToString(op)+" Failed key "+key+" not found")
+				continue
+			}
+		}
+
+		// the commit must check that inserted keys are still free
+		if prev != nil && prev.op == INSERT && op != INSERT {
+			newOp = INSERT
+		}
+
+		// updates of documents that have changed since they were fetched fail
+		base := b.txBase(prev, key, now)
+		cas, flags := getMeta(kv.Value)
+		if op == UPDATE && cas != 0 && cas != base {
+			returnErr = errors.NewFileCasMismatchError(returnErr, "key "+key)
+			continue
+		}
+
+		data, err := kv.Value.MarshalJSON()
+		if err != nil {
+			returnErr = errors.NewFileDMLError(returnErr, opToString(op)+" Failed "+err.Error())
+			continue
+		}
+		tx.set(b, key, &txMutation{op: newOp, data: data, base: base,
+			expiration: getExpiration(kv.Options, now), flags: flags})
+		insertedKeys = append(insertedKeys, kv)
+	}
+
+	return insertedKeys, returnErr
+}
+
+func (b *keyspace) txDelete(tx *transaction, deletes []value.Pair) ([]value.Pair, errors.Error) {
+	var deleted []value.Pair
+	var casError errors.Error
+
+	now := unixNow()
+	for _, pair := range deletes {
+		prev := tx.get(b, pair.Name)
+		if !b.txExists(prev, pair.Name) {
+			continue
+		}
+
+		// documents that have changed since they were fetched are kept
+		base := b.txBase(prev, pair.Name, now)
+		if cas, _ := getMeta(pair.Value); cas != 0 && cas != base {
+			casError = errors.NewFileCasMismatchError(casError, "key "+pair.Name)
+			continue
+		}
+
+		// deleting a key the transaction inserted leaves nothing to commit
+		if prev != nil && prev.op == INSERT {
+			tx.set(b, pair.Name, nil)
+		} else {
+			tx.set(b, pair.Name, &txMutation{op: DELETE, base: base})
+		}
+		deleted = append(deleted, pair)
+	}
+	return deleted, casError
+}
+
+func (b *keyspace) txExists(m *txMutation, key string) bool {
+	if m != nil {
+		return m.op != DELETE
+	}
+	return b.exists(key, unixNow())
+}
+
+// the cas the commit expects to find, as of the first change to the key
+func (b *keyspace) txBase(m *txMutation, key string, now uint32) uint64 {
+	if m != nil {
+		return m.base
+	}
+	return b.committedCas(key, now)
+}
+
+// the cas of the committed document, 0 if there is none
+func (b *keyspace) committedCas(key string, now uint32) uint64 {
+	meta, er := b.readMeta(key)
+	if er != nil || meta.expired(now) {
+		return 0
+	}
+	return meta.Cas
+}
@@ -0,0 +1,248 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/transactions"
+	"github.com/couchbase/query/value"
+)
+
+type txQueryContext struct {
+	txContext *transactions.TranContext
+}
+
+func (this *txQueryContext) GetReqDeadline() time.Time      { return time.Time{} }
+func (this *txQueryContext) Credentials() *auth.Credentials { return auth.NewCredentials() }
+func (this *txQueryContext) AuthenticatedUsers() []string   { return nil }
+func (this *txQueryContext) Warning(errors.Error)           {}
+func (this *txQueryContext) GetTxContext() interface{}      { return this.txContext }
+func (this *txQueryContext) SetTxContext(tc interface{})    {}
+func (this *txQueryContext) Datastore() datastore.Datastore { return nil }
+func (this *txQueryContext) TxDataVal() value.Value         { return nil }
+func (this *txQueryContext) begin(t *testing.T, s datastore.Datastore) {
+	this.txContext = transactions.NewTxContext(false, nil, time.Minute, 0, 0, datastore.DL_NONE,
+		datastore.IL_READ_COMMITTED, datastore.SCAN_PLUS, "", 0, 0)
+	if _, err := s.StartTransaction(false, this); err != nil {
+		t.Fatalf("failed to start transaction: %v", err)
+	}
+	if this.txContext.TxId() == "" {
+		t.Fatalf("expected a transaction id")
+	}
+}
+
+func newTxStore(t *testing.T) (string, datastore.Datastore, datastore.Keyspace) {
+	dir, er := ioutil.TempDir("", "file_tx_")
+	if er != nil {
+		t.Fatalf("failed to create directory: %v", er)
+	}
+	if er = os.MkdirAll(filepath.Join(dir, "default", "orders"), 0777); er != nil {
+		t.Fatalf("failed to create keyspace: %v", er)
+	}
+	if er = ioutil.WriteFile(filepath.Join(dir, "default", "orders", "o1.json"), []byte(`{"n":1}`), 0666); er != nil {
+		t.Fatalf("failed to create document: %v", er)
+	}
+	s, err := NewDatastore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	namespace, _ := s.NamespaceByName("default")
+	ks, err := namespace.KeyspaceByName("orders")
+	if err != nil {
+		t.Fatalf("failed to get keyspace: %v", err)
+	}
+	return dir, s, ks
+}
+
+func fetchTx(t *testing.T, ks datastore.Keyspace, context datastore.QueryContext, key string) value.Value {
+	docs := make(map[string]value.AnnotatedValue, 1)
+	if errs := ks.Fetch([]string{key}, docs, context, nil); len(errs) > 0 {
+		t.Fatalf("failed to fetch %v: %v", key, errs)
+	}
+	if doc, ok := docs[key]; ok {
+		return doc
+	}
+	return nil
+}
+
+func TestFileTransactions(t *testing.T) {
+	dir, s, ks := newTxStore(t)
+	defer os.RemoveAll(dir)
+
+	tx := &txQueryContext{}
+	other := &txQueryContext{}
+	tx.begin(t, s)
+
+	pairs := []value.Pair{{Name: "o2", Value: value.NewValue(map[string]interface{}{"n": 2})}}
+	if _, err := ks.Insert(pairs, tx); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if _, err := ks.Delete([]value.Pair{{Name: "o1"}}, tx); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	// the transaction sees its own changes, nobody else does
+	if fetchTx(t, ks, tx, "o2") == nil || fetchTx(t, ks, tx, "o1") != nil {
+		t.Fatalf("expected the transaction to see its changes")
+	}
+	if fetchTx(t, ks, other, "o2") != nil || fetchTx(t, ks, other, "o1") == nil {
+		t.Fatalf("expected uncommitted changes not to be visible")
+	}
+	if _, err := ks.Insert(pairs, tx); err == nil {
+		t.Fatalf("expected inserting an existing key to fail")
+	}
+
+	// savepoints and statement atomicity
+	if err := s.SetSavepoint(false, tx, "s1"); err != nil {
+		t.Fatalf("failed to set savepoint: %v", err)
+	}
+	dks, err := s.StartTransaction(true, tx)
+	if err != nil || !dks[ks.QualifiedName()] {
+		t.Fatalf("expected %v as delta keyspace, got %v (%v)", ks.QualifiedName(), dks, err)
+	}
+	pairs = []value.Pair{{Name: "o2", Value: value.NewValue(map[string]interface{}{"n": 3})}}
+	if _, err := ks.Update(pairs, tx); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if err := s.RollbackTransaction(true, tx, ""); err != nil {
+		t.Fatalf("failed to roll back statement: %v", err)
+	}
+	if n, _ := fetchTx(t, ks, tx, "o2").Field("n"); n.Actual() != float64(2) {
+		t.Fatalf("expected the statement to be rolled back, got %v", n)
+	}
+	if _, err := ks.Upsert(pairs, tx); err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+	if err := s.RollbackTransaction(false, tx, "s1"); err != nil {
+		t.Fatalf("failed to roll back to savepoint: %v", err)
+	}
+	if n, _ := fetchTx(t, ks, tx, "o2").Field("n"); n.Actual() != float64(2) {
+		t.Fatalf("expected the savepoint to be rolled back, got %v", n)
+	}
+	if err := s.RollbackTransaction(false, tx, "s2"); err == nil {
+		t.Fatalf("expected rolling back to an unknown savepoint to fail")
+	}
+
+	if err := s.CommitTransaction(false, tx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if fetchTx(t, ks, other, "o2") == nil || fetchTx(t, ks, other, "o1") != nil {
+		t.Fatalf("expected committed changes to be visible")
+	}
+	entries, _ := ioutil.ReadDir(filepath.Join(dir, "default", "orders", _TXN_DIR))
+	if len(entries) > 0 {
+		t.Fatalf("expected no staged files after commit")
+	}
+
+	// rollback
+	tx.begin(t, s)
+	if _, err := ks.Delete([]value.Pair{{Name: "o2"}}, tx); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if err := s.RollbackTransaction(false, tx, ""); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	if fetchTx(t, ks, other, "o2") == nil {
+		t.Fatalf("expected the rolled back delete not to happen")
+	}
+}
+
+func TestFileTransactionConflicts(t *testing.T) {
+	dir, s, ks := newTxStore(t)
+	defer os.RemoveAll(dir)
+
+	tx := &txQueryContext{}
+	other := &txQueryContext{}
+
+	// a key inserted and deleted by a transaction is left alone by its commit
+	tx.begin(t, s)
+	pairs := []value.Pair{{Name: "o2", Value: value.NewValue(map[string]interface{}{"n": 2})}}
+	if _, err := ks.Insert(pairs, tx); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if deleted, err := ks.Delete([]value.Pair{{Name: "o2"}}, tx); len(deleted) != 1 || err != nil {
+		t.Fatalf("failed to delete: %v %v", deleted, err)
+	}
+	if _, err := ks.Insert(pairs, other); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if err := s.CommitTransaction(false, tx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if fetchTx(t, ks, other, "o2") == nil {
+		t.Fatalf("expected the document inserted by another request to survive the commit")
+	}
+
+	// documents changed by somebody else since the transaction changed them fail the commit
+	for _, change := range []func() errors.Error{
+		func() errors.Error {
+			_, err := ks.Update([]value.Pair{{Name: "o1", Value: value.NewValue(map[string]interface{}{"n": 10})}}, tx)
+			return err
+		},
+		func() errors.Error {
+			_, err := ks.Delete([]value.Pair{{Name: "o1"}}, tx)
+			return err
+		},
+	} {
+		tx.begin(t, s)
+		if err := change(); err != nil {
+			t.Fatalf("failed to change o1: %v", err)
+		}
+		pairs = []value.Pair{{Name: "o1", Value: value.NewValue(map[string]interface{}{"n": 20})}}
+		if _, err := ks.Upsert(pairs, other); err != nil {
+			t.Fatalf("failed to upsert: %v", err)
+		}
+		if err := s.CommitTransaction(false, tx); err == nil {
+			t.Errorf("expected a write write conflict")
+		}
+		if n, _ := fetchTx(t, ks, other, "o1").Field("n"); n.Actual() != float64(20) {
+			t.Errorf("expected the conflicting commit not to apply, got %v", n)
+		}
+	}
+}
+
+func TestFileTransactionRecovery(t *testing.T) {
+	dir, _, _ := newTxStore(t)
+	defer os.RemoveAll(dir)
+
+	// a commit interrupted after its marker completes, one interrupted before is discarded
+	ksDir := filepath.Join(dir, "default", "orders")
+	for _, id := range []string{"committed", "aborted"} {
+		staged := filepath.Join(ksDir, _TXN_DIR, id)
+		os.MkdirAll(staged, 0777)
+		ioutil.WriteFile(filepath.Join(staged, id+".json"), []byte(`{"n":4}`), 0666)
+	}
+	ioutil.WriteFile(filepath.Join(ksDir, _TXN_DIR, "committed", "o1"+_TXN_DELETE), nil, 0666)
+	ioutil.WriteFile(filepath.Join(dir, _TXN_MARKER+"committed"), nil, 0666)
+
+	_, err := NewDatastore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if _, er := os.Stat(filepath.Join(ksDir, "committed.json")); er != nil {
+		t.Fatalf("expected the committed document to be in place")
+	}
+	if _, er := os.Stat(filepath.Join(ksDir, "o1.json")); !os.IsNotExist(er) {
+		t.Fatalf("expected the committed delete to be in place")
+	}
+	if _, er := os.Stat(filepath.Join(ksDir, "aborted.json")); !os.IsNotExist(er) {
+		t.Fatalf("expected the aborted document to be discarded")
+	}
+	if _, er := os.Stat(filepath.Join(dir, _TXN_MARKER+"committed")); !os.IsNotExist(er) {
+		t.Fatalf("expected the commit marker to be removed")
+	}
+}
@@ -150,6 +150,10 @@ func (b *requestLogKeyspace) Fetch(keys []string, keysMap map[string]value.Annot
 				if entry.Mutations != 0 {
 					item.SetField("mutations", entry.Mutations)
 				}
+				if entry.SpillCount != 0 {
+					item.SetField("spills", entry.SpillCount)
+					item.SetField("spillSize", entry.SpillSize)
+				}
 				if entry.PhaseTimes != nil {
 					item.SetField("phaseTimes", entry.PhaseTimes)
 				}
@@ -9,6 +9,8 @@
 package system
 
 import (
+	"strings"
+
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/distributed"
 	"github.com/couchbase/query/errors"
@@ -100,6 +102,9 @@ func (b *tasksCacheKeyspace) Fetch(keys []string, keysMap map[string]value.Annot
 					"submitTime": entry.PostTime.String(),
 					"delay":      entry.Delay.String(),
 				}
+				if len(entry.Users) > 0 {
+					itemMap["users"] = strings.Join(entry.Users, ",")
+				}
 				if entry.Results != nil {
 					itemMap["results"] = entry.Results
 				}
@@ -118,6 +123,7 @@ func (b *tasksCacheKeyspace) Fetch(keys []string, keysMap map[string]value.Annot
 				if !entry.EndTime.IsZero() {
 					itemMap["stopTime"] = entry.EndTime.String()
 				}
+				entry.DescribeSchedule(itemMap)
 				if node != "" {
 					itemMap["node"] = node
 				}
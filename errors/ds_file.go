@@ -71,3 +71,48 @@ func NewFilePrimaryIdxNoDropError(e error, msg string) Error {
 	return &err{level: EXCEPTION, ICode: 15011, IKey: "datastore.file.primary_idx_no_drop", ICause: e,
 		InternalMsg: "Primary Index cannot be dropped " + msg, InternalCaller: CallerN(1)}
 }
+
+func NewFileIdxExistsError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15012, IKey: "datastore.file.idx_exists", ICause: e,
+		InternalMsg: "Index already exists " + msg, InternalCaller: CallerN(1)}
+}
+
+func NewFileIdxNotOnlineError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15013, IKey: "datastore.file.idx_not_online", ICause: e,
+		InternalMsg: "Index is not online " + msg, InternalCaller: CallerN(1)}
+}
+
+func NewFileBucketNotFoundError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15014, IKey: "datastore.file.bucket_not_found", ICause: e,
+		InternalMsg: "Bucket not found in file store " + msg, InternalCaller: CallerN(1)}
+}
+
+func NewFileScopeNotFoundError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15015, IKey: "datastore.file.scope_not_found", ICause: e,
+		InternalMsg: "Scope not found in file store " + msg, InternalCaller: CallerN(1)}
+}
+
+func NewFileScopeExistsError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15016, IKey: "datastore.file.scope_exists", ICause: e,
+		InternalMsg: "Scope already exists " + msg, InternalCaller: CallerN(1)}
+}
+
+func NewFileCollectionNotFoundError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15017, IKey: "datastore.file.collection_not_found", ICause: e,
+		InternalMsg: "Collection not found in file store " + msg, InternalCaller: CallerN(1)}
+}
+
+func NewFileCollectionExistsError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15018, IKey: "datastore.file.collection_exists", ICause: e,
+		InternalMsg: "Collection already exists " + msg, InternalCaller: CallerN(1)}
+}
+
+func NewFileInvalidNameError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15019, IKey: "datastore.file.invalid_name", ICause: e,
+		InternalMsg: "Invalid name " + msg, InternalCaller: CallerN(1)}
+}
+
+func NewFileCasMismatchError(e error, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 15020, IKey: "datastore.file.cas_mismatch", ICause: e,
+		InternalMsg: "CAS mismatch, document has changed since it was fetched " + msg, InternalCaller: CallerN(1)}
+}
@@ -303,3 +303,21 @@ func NewMemoryQuotaExceededError() Error {
 		InternalMsg:    "Request has exceeded memory quota",
 		InternalCaller: CallerN(1)}
 }
+
+func NewSpillError(e error, op string) Error {
+	return &err{level: EXCEPTION, ICode: 5510, IKey: "execution.spill_error", ICause: e,
+		InternalMsg:    fmt.Sprintf("Error spilling to disk (%s)", op),
+		InternalCaller: CallerN(1)}
+}
+
+func NewRecursionLimitError(alias string, limit int) Error {
+	return &err{level: EXCEPTION, ICode: 5520, IKey: "execution.recursive_with.limit_exceeded",
+		InternalMsg:    fmt.Sprintf("Recursive WITH %s exceeded the maximum of %d iterations", alias, limit),
+		InternalCaller: CallerN(1)}
+}
+
+func NewRecursiveWithOptionsError(alias string, msg string) Error {
+	return &err{level: EXCEPTION, ICode: 5521, IKey: "execution.recursive_with.invalid_options",
+		InternalMsg:    fmt.Sprintf("Invalid OPTIONS for recursive WITH %s: %s", alias, msg),
+		InternalCaller: CallerN(1)}
+}
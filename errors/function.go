@@ -109,3 +109,9 @@ func NewFunctionExecutionError(what string, name string, reason error) Error {
 		InternalMsg:    fmt.Sprintf("Error executing function %v %v: %v", name, what, reason),
 		InternalCaller: CallerN(1)}
 }
+
+func NewFunctionLibraryError(what string, library string, reason error) Error {
+	return &err{level: EXCEPTION, ICode: 10110, IKey: "function.library.error", ICause: reason,
+		InternalMsg:    fmt.Sprintf("Error %v library %v: %v", what, library, reason),
+		InternalCaller: CallerN(1)}
+}
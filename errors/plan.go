@@ -104,6 +104,11 @@ func NewPredefinedPreparedNameError(msg string) Error {
 		InternalMsg: fmt.Sprintf("Prepared name %s is predefined (reserved). ", msg), InternalCaller: CallerN(1)}
 }
 
+func NewPreparedStoreError(op, path string, e error) Error {
+	return &err{level: EXCEPTION, ICode: 4093, IKey: "plan.build_prepared.store",
+		ICause: e, InternalMsg: fmt.Sprintf("Unable to %s prepared statements store %s", op, path), InternalCaller: CallerN(1)}
+}
+
 const NO_INDEX_JOIN = 4100
 
 func NewNoIndexJoinError(alias, op string) Error {
@@ -35,3 +35,33 @@ func NewTaskNotFoundError(t string) Error {
 		InternalMsg:    fmt.Sprintf("the task %v was not found", t),
 		InternalCaller: CallerN(1)}
 }
+
+func NewTaskScheduleError(s string, e error) Error {
+	return &err{level: EXCEPTION, ICode: 6005, IKey: "scheduler.schedule.error", ICause: e,
+		InternalMsg:    fmt.Sprintf("Invalid schedule %v", s),
+		InternalCaller: CallerN(1)}
+}
+
+func NewTaskStateError(t string, state, action string) Error {
+	return &err{level: EXCEPTION, ICode: 6006, IKey: "scheduler.state.error", ICause: fmt.Errorf("%v", t),
+		InternalMsg:    fmt.Sprintf("Task %v is %v and cannot be %v", t, state, action),
+		InternalCaller: CallerN(1)}
+}
+
+func NewTaskStatementError(stmtType string) Error {
+	return &err{level: EXCEPTION, ICode: 6007, IKey: "scheduler.statement.error", ICause: fmt.Errorf("%v", stmtType),
+		InternalMsg:    fmt.Sprintf("%v statements cannot be run by tasks", stmtType),
+		InternalCaller: CallerN(1)}
+}
+
+func NewTaskOwnerError(t string, action string) Error {
+	return &err{level: EXCEPTION, ICode: 6008, IKey: "scheduler.owner.error", ICause: fmt.Errorf("%v", t),
+		InternalMsg:    fmt.Sprintf("Task %v can only be %v by its creator or an administrator", t, action),
+		InternalCaller: CallerN(1)}
+}
+
+func NewTaskStoreError(op, path string, e error) Error {
+	return &err{level: EXCEPTION, ICode: 6009, IKey: "scheduler.store.error", ICause: e,
+		InternalMsg:    fmt.Sprintf("Unable to %s tasks store %s", op, path),
+		InternalCaller: CallerN(1)}
+}
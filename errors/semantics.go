@@ -175,6 +175,13 @@ func NewUpdateStatIndexAllCollectionOnly() Error {
 		InternalMsg: "INDEX ALL option for UPDATE STATISTICS (ANALYZE) can only be used for a collection.", InternalCaller: CallerN(1)}
 }
 
+const RECURSIVE_WITH_SEMANTICS = 3280
+
+func NewRecursiveWithSemanticError(msg string) Error {
+	return &err{level: EXCEPTION, ICode: RECURSIVE_WITH_SEMANTICS, IKey: "semantics_recursive_with",
+		InternalMsg: "recursive WITH " + msg, InternalCaller: CallerN(1)}
+}
+
 /* ---- BEGIN MOVED error numbers ----
    The following error numbers (in the 4000 range) originally reside in plan.go (before the introduction of the semantics package)
    although they are semantic errors. They are moved from plan.go to semantics.go but their original error numbers are kept.
@@ -73,6 +73,10 @@ const (
 	BATCH_MODE_MSG      = "Error when running in batch mode for Analytics. Incorrect input value"
 	STRING_WRITE        = 143
 	STRING_WRITE_MSG    = "Cannot write to string buffer. "
+	OUTPUT_FORMAT       = 144
+	OUTPUT_FORMAT_MSG   = "Incorrect output format. Values : json, jsonl, table, csv "
+	NO_RESULTS          = 145
+	NO_RESULTS_MSG      = "No query results to export. "
 
 	//Generic Errors (170 - 199)
 	OPERATION_TIMEOUT           = 170
@@ -217,6 +221,14 @@ func NewShellErrorStringWrite(msg string) Error {
 
 }
 
+func NewShellErrorOutputFormat(msg string) Error {
+	return &err{level: EXCEPTION, ICode: OUTPUT_FORMAT, IKey: "shell.output.format.incorrect.input", InternalMsg: OUTPUT_FORMAT_MSG + msg, InternalCaller: CallerN(1)}
+}
+
+func NewShellErrorNoResults(msg string) Error {
+	return &err{level: EXCEPTION, ICode: NO_RESULTS, IKey: "shell.no.results.to.export", InternalMsg: NO_RESULTS_MSG + msg, InternalCaller: CallerN(1)}
+}
+
 //Generic Errors
 
 func NewShellErrorOperationTimeout(msg string) Error {
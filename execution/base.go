@@ -145,6 +145,8 @@ type base struct {
 	inDocs         int64
 	outDocs        int64
 	phaseSwitches  int64
+	spills         int64
+	spillSize      int64
 	stopped        bool
 	isRoot         bool
 	bit            uint8
@@ -1401,6 +1403,12 @@ func (this *base) addOutDocs(d int64) {
 	go_atomic.AddInt64((*int64)(&this.outDocs), d)
 }
 
+func (this *base) addSpill(size uint64, context *Context) {
+	go_atomic.AddInt64((*int64)(&this.spills), 1)
+	go_atomic.AddInt64((*int64)(&this.spillSize), int64(size))
+	context.AddSpill(size)
+}
+
 // profile marshaller
 func (this *base) marshalTimes(r map[string]interface{}) {
 	var d time.Duration
@@ -1415,6 +1423,10 @@ func (this *base) marshalTimes(r map[string]interface{}) {
 	if this.phaseSwitches != 0 {
 		stats["#phaseSwitches"] = this.phaseSwitches
 	}
+	if this.spills != 0 {
+		stats["#spills"] = this.spills
+		stats["spillSize"] = this.spillSize
+	}
 
 	execTime := this.execTime
 	chanTime := this.chanTime
@@ -1474,6 +1486,8 @@ func (this *base) accrueTime(copy *base) {
 	this.inDocs += copy.inDocs
 	this.outDocs += copy.outDocs
 	this.phaseSwitches += copy.phaseSwitches
+	this.spills += copy.spills
+	this.spillSize += copy.spillSize
 	this.execTime += copy.execTime
 	this.chanTime += copy.chanTime
 	this.servTime += copy.servTime
@@ -703,6 +703,21 @@ func (this *builder) VisitExecuteFunction(plan *plan.ExecuteFunction) (interface
 	return checkOp(NewExecuteFunction(plan, this.context), this.context)
 }
 
+// CreateTask
+func (this *builder) VisitCreateTask(plan *plan.CreateTask) (interface{}, error) {
+	return checkOp(NewCreateTask(plan, this.context), this.context)
+}
+
+// DropTask
+func (this *builder) VisitDropTask(plan *plan.DropTask) (interface{}, error) {
+	return checkOp(NewDropTask(plan, this.context), this.context)
+}
+
+// AlterTask
+func (this *builder) VisitAlterTask(plan *plan.AlterTask) (interface{}, error) {
+	return checkOp(NewAlterTask(plan, this.context), this.context)
+}
+
 // IndexFtsSearch
 func (this *builder) VisitIndexFtsSearch(plan *plan.IndexFtsSearch) (interface{}, error) {
 	this.setScannedIndexes(plan.Term())
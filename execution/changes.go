@@ -0,0 +1,95 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"github.com/couchbase/query/changefeed"
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/value"
+)
+
+// Changes are wanted when somebody follows the feed, and only for documents: the
+// system keyspaces hold the catalogs and caches of the service.
+func changesWanted(keyspace datastore.Keyspace) bool {
+	return changefeed.Enabled() && keyspace.NamespaceId() != datastore.SYSTEM_NAMESPACE
+}
+
+// Send the mutations of a batch to the change feed. The pairs are those the keyspace
+// reports as mutated, and befores holds the documents of an UPDATE or UPSERT before
+// the mutation. Changes made in a transaction are held back until it commits.
+func publishChanges(context *Context, keyspace datastore.Keyspace, changeType string,
+	pairs []value.Pair, befores map[string]value.Value) {
+
+	if len(pairs) == 0 {
+		return
+	}
+
+	var txId string
+	if context.txContext != nil {
+		txId = context.txContext.TxId()
+	}
+
+	changes := make([]*changefeed.Change, 0, len(pairs))
+	for _, pair := range pairs {
+		change := &changefeed.Change{
+			Type:      changeType,
+			Keyspace:  keyspace.QualifiedName(),
+			Key:       pair.Name,
+			RequestId: context.RequestId(),
+			Users:     context.AuthenticatedUsers(),
+			TxId:      txId,
+		}
+		if changeType == changefeed.DELETE {
+			change.Before = changeImage(pair.Value)
+		} else {
+			change.Before = changeImage(befores[pair.Name])
+			change.After = changeImage(pair.Value)
+		}
+		changes = append(changes, change)
+	}
+
+	if txId != "" {
+		changefeed.Stage(txId, changes...)
+	} else {
+		changefeed.Publish(changes...)
+	}
+}
+
+// The documents that mutations are about to replace. Those that are not found are
+// new, and have no before image; a document changed by somebody else between the
+// fetch and the mutation gets a stale one.
+func fetchBefores(context *Context, keyspace datastore.Keyspace, pairs []value.Pair) map[string]value.Value {
+	befores := make(map[string]value.Value, len(pairs))
+	if len(pairs) == 0 {
+		return befores
+	}
+
+	keys := make([]string, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Name
+	}
+	fetchMap := make(map[string]value.AnnotatedValue, len(keys))
+	keyspace.Fetch(keys, fetchMap, context, nil)
+	for key, av := range fetchMap {
+		befores[key] = av
+	}
+	return befores
+}
+
+// images outlive the request, whose values may be recycled
+func changeImage(val value.Value) value.Value {
+	if val == nil {
+		return nil
+	}
+	bytes, err := val.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+	return value.NewValue(bytes)
+}
@@ -128,6 +128,7 @@ type Output interface {
 	MutationCount() uint64
 	SortCount() uint64
 	SetSortCount(i uint64)
+	AddSpill(size uint64)
 	AddPhaseOperator(p Phases)
 	AddPhaseCount(p Phases, c uint64)
 	FmtPhaseCounts() map[string]interface{}
@@ -320,6 +321,10 @@ func (this *Context) SetPrepared(prepared *plan.Prepared) {
 	this.prepared = prepared
 }
 
+func (this *Context) Prepared() *plan.Prepared {
+	return this.prepared
+}
+
 func (this *Context) SetWhitelist(val map[string]interface{}) {
 	this.whitelist = val
 }
@@ -600,6 +605,31 @@ func (this *Context) ReleaseValueSize(size uint64) {
 	atomic.AddUint64(&this.inUseMemory, ^(size - 1))
 }
 
+// spilling
+
+const _SPILL_QUOTA_MIN = 16
+const _SPILL_QUOTA_HEADROOM = 4
+
+// whether an operator holding size bytes of items should spill them to disk
+func (this *Context) ShouldSpill(size uint64) bool {
+	threshold := GetSpillThreshold() * 1024 * 1024
+	if threshold > 0 && size >= threshold {
+		return true
+	}
+
+	// spill before the quota is hit, but don't bother with small buffers
+	return this.memoryQuota > 0 && size >= this.memoryQuota/_SPILL_QUOTA_MIN &&
+		atomic.LoadUint64(&this.inUseMemory) >= this.memoryQuota-this.memoryQuota/_SPILL_QUOTA_HEADROOM
+}
+
+func (this *Context) CanSpill() bool {
+	return this.memoryQuota > 0 || GetSpillThreshold() > 0
+}
+
+func (this *Context) AddSpill(size uint64) {
+	this.output.AddSpill(size)
+}
+
 func (this *Context) SetDeltaKeyspaces(d map[string]bool) {
 	this.deltaKeyspaces = d
 }
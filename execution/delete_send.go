@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/couchbase/query/changefeed"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/plan"
@@ -151,6 +152,10 @@ func (this *SendDelete) flushBatch(context *Context) bool {
 
 	this.switchPhase(_EXECTIME)
 
+	if changesWanted(this.keyspace) {
+		publishChanges(context, this.keyspace, changefeed.DELETE, dpairs, nil)
+	}
+
 	// Update mutation count with number of deleted docs:
 	context.AddMutationCount(uint64(len(dpairs)))
 
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/changefeed"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/parser/n1ql"
 	"github.com/couchbase/query/plan"
@@ -81,6 +82,10 @@ func (this *internalOutput) SortCount() uint64 {
 	return uint64(0)
 }
 
+func (this *internalOutput) AddSpill(size uint64) {
+	// empty
+}
+
 func (this *internalOutput) AddPhaseCount(p Phases, c uint64) {
 	// empty
 }
@@ -282,10 +287,12 @@ func (this *Context) executeTranStatementAtomicity(stmtType string) (map[string]
 
 	switch stmtType {
 	case "START":
+		changefeed.StartStatement(this.txContext.TxId())
 		return this.datastore.StartTransaction(true, this)
 	case "COMMIT":
 		return nil, this.datastore.CommitTransaction(true, this)
 	case "ROLLBACK":
+		changefeed.RollbackStatement(this.txContext.TxId())
 		return nil, this.datastore.RollbackTransaction(true, this, "")
 	}
 
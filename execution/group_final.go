@@ -19,8 +19,11 @@ import (
 
 type FinalGroup struct {
 	base
-	plan   *plan.FinalGroup
-	groups map[string]value.AnnotatedValue
+	plan     *plan.FinalGroup
+	groups   map[string]value.AnnotatedValue
+	canSpill bool
+	size     uint64
+	flushed  bool
 }
 
 func NewFinalGroup(plan *plan.FinalGroup, context *Context) *FinalGroup {
@@ -55,6 +58,11 @@ func (this *FinalGroup) RunOnce(context *Context, parent value.Value) {
 	this.runConsumer(this, context, parent)
 }
 
+func (this *FinalGroup) beforeItems(context *Context, parent value.Value) bool {
+	this.canSpill = context.CanSpill()
+	return true
+}
+
 func (this *FinalGroup) processItem(item value.AnnotatedValue, context *Context) bool {
 	// Generate the group key
 	var gk string
@@ -95,6 +103,13 @@ func (this *FinalGroup) processItem(item value.AnnotatedValue, context *Context)
 			aggregates[agg.String()] = v
 		}
 
+		// final groups are complete: pass them on rather than holding on to them
+		if this.canSpill {
+			this.size += item.Size()
+			if context.ShouldSpill(this.size) {
+				return this.flush()
+			}
+		}
 		return true
 	default:
 		context.Fatal(errors.NewInvalidValueError(fmt.Sprintf(
@@ -105,14 +120,12 @@ func (this *FinalGroup) processItem(item value.AnnotatedValue, context *Context)
 }
 
 func (this *FinalGroup) afterItems(context *Context) {
-	for _, av := range this.groups {
-		if !this.sendItem(av) {
-			return
-		}
+	if !this.flush() {
+		return
 	}
 
 	// Mo matching inputs, so send default values
-	if len(this.plan.Keys()) == 0 && len(this.groups) == 0 {
+	if len(this.plan.Keys()) == 0 && !this.flushed {
 		av := value.NewAnnotatedValue(nil)
 		aggregates := make(map[string]value.Value, len(this.plan.Aggregates()))
 		av.SetAttachment("aggregates", aggregates)
@@ -129,6 +142,18 @@ func (this *FinalGroup) afterItems(context *Context) {
 	}
 }
 
+func (this *FinalGroup) flush() bool {
+	for gk, av := range this.groups {
+		delete(this.groups, gk)
+		this.flushed = true
+		if !this.sendItem(av) {
+			return false
+		}
+	}
+	this.size = 0
+	return true
+}
+
 func (this *FinalGroup) MarshalJSON() ([]byte, error) {
 	r := this.plan.MarshalBase(func(r map[string]interface{}) {
 		this.marshalTimes(r)
@@ -139,5 +164,7 @@ func (this *FinalGroup) MarshalJSON() ([]byte, error) {
 func (this *FinalGroup) reopen(context *Context) bool {
 	rv := this.baseReopen(context)
 	this.groups = make(map[string]value.AnnotatedValue)
+	this.size = 0
+	this.flushed = false
 	return rv
 }
@@ -20,8 +20,10 @@ import (
 // Grouping of input data.
 type InitialGroup struct {
 	base
-	plan   *plan.InitialGroup
-	groups map[string]value.AnnotatedValue
+	plan     *plan.InitialGroup
+	groups   map[string]value.AnnotatedValue
+	canSpill bool
+	size     uint64
 }
 
 func NewInitialGroup(plan *plan.InitialGroup, context *Context) *InitialGroup {
@@ -56,6 +58,11 @@ func (this *InitialGroup) RunOnce(context *Context, parent value.Value) {
 	this.runConsumer(this, context, parent)
 }
 
+func (this *InitialGroup) beforeItems(context *Context, parent value.Value) bool {
+	this.canSpill = context.CanSpill()
+	return true
+}
+
 func (this *InitialGroup) processItem(item value.AnnotatedValue, context *Context) bool {
 	// Generate the group key
 	var gk string
@@ -84,6 +91,9 @@ func (this *InitialGroup) processItem(item value.AnnotatedValue, context *Contex
 		for _, agg := range this.plan.Aggregates() {
 			aggregates[agg.String()], _ = agg.Default(nil, context)
 		}
+		if this.canSpill {
+			this.size += item.Size()
+		}
 	} else {
 		handleQuota = context.UseRequestQuota()
 	}
@@ -112,15 +122,27 @@ func (this *InitialGroup) processItem(item value.AnnotatedValue, context *Contex
 	}
 	item.Recycle()
 
+	// partial groups are merged by the intermediate phase, which can spill them:
+	// no need to hold on to them here
+	if this.canSpill && context.ShouldSpill(this.size) {
+		return this.flush()
+	}
 	return true
 }
 
 func (this *InitialGroup) afterItems(context *Context) {
-	for _, av := range this.groups {
+	this.flush()
+}
+
+func (this *InitialGroup) flush() bool {
+	for gk, av := range this.groups {
+		delete(this.groups, gk)
 		if !this.sendItem(av) {
-			return
+			return false
 		}
 	}
+	this.size = 0
+	return true
 }
 
 func (this *InitialGroup) MarshalJSON() ([]byte, error) {
@@ -133,5 +155,6 @@ func (this *InitialGroup) MarshalJSON() ([]byte, error) {
 func (this *InitialGroup) reopen(context *Context) bool {
 	rv := this.baseReopen(context)
 	this.groups = make(map[string]value.AnnotatedValue)
+	this.size = 0
 	return rv
 }
@@ -20,8 +20,11 @@ import (
 // Grouping of groups. Recursable.
 type IntermediateGroup struct {
 	base
-	plan   *plan.IntermediateGroup
-	groups map[string]value.AnnotatedValue
+	plan       *plan.IntermediateGroup
+	groups     map[string]value.AnnotatedValue
+	canSpill   bool
+	size       uint64
+	partitions *groupPartitions
 }
 
 func NewIntermediateGroup(plan *plan.IntermediateGroup, context *Context) *IntermediateGroup {
@@ -53,10 +56,28 @@ func (this *IntermediateGroup) PlanOp() plan.Operator {
 }
 
 func (this *IntermediateGroup) RunOnce(context *Context, parent value.Value) {
+	defer this.releasePartitions()
 	this.runConsumer(this, context, parent)
 }
 
+func (this *IntermediateGroup) beforeItems(context *Context, parent value.Value) bool {
+	this.canSpill = context.CanSpill()
+	return true
+}
+
 func (this *IntermediateGroup) processItem(item value.AnnotatedValue, context *Context) bool {
+	seeded, ok := this.groupItem(item, context)
+	if ok && seeded && this.canSpill {
+		this.size += item.Size()
+		if context.ShouldSpill(this.size) {
+			return this.spill(context)
+		}
+	}
+	return ok
+}
+
+// add the item to its group, returns whether it seeded a new group
+func (this *IntermediateGroup) groupItem(item value.AnnotatedValue, context *Context) (bool, bool) {
 	// Generate the group key
 	var gk string
 	if len(this.plan.Keys()) > 0 {
@@ -65,7 +86,7 @@ func (this *IntermediateGroup) processItem(item value.AnnotatedValue, context *C
 		if e != nil {
 			context.Fatal(errors.NewEvaluationError(e, "GROUP key"))
 			item.Recycle()
-			return false
+			return false, false
 		}
 	}
 
@@ -76,7 +97,7 @@ func (this *IntermediateGroup) processItem(item value.AnnotatedValue, context *C
 		// avoid recycling of seeding values
 		gv = item
 		this.groups[gk] = gv
-		return true
+		return true, true
 	}
 
 	// Cumulate aggregates
@@ -85,7 +106,7 @@ func (this *IntermediateGroup) processItem(item value.AnnotatedValue, context *C
 		context.Fatal(errors.NewInvalidValueError(
 			fmt.Sprintf("Invalid partial aggregates %v of type %T", part, part)))
 		item.Recycle()
-		return false
+		return false, false
 	}
 
 	if context.UseRequestQuota() {
@@ -97,7 +118,7 @@ func (this *IntermediateGroup) processItem(item value.AnnotatedValue, context *C
 	if !ok {
 		context.Fatal(errors.NewInvalidValueError(
 			fmt.Sprintf("Invalid cumulative aggregates %v of type %T", cumulative, cumulative)))
-		return false
+		return false, false
 	}
 
 	for _, agg := range this.plan.Aggregates() {
@@ -106,21 +127,70 @@ func (this *IntermediateGroup) processItem(item value.AnnotatedValue, context *C
 		if e != nil {
 			context.Fatal(errors.NewGroupUpdateError(
 				e, "Error updating intermediate GROUP value."))
-			return false
+			return false, false
 		}
 
 		cumulative[a] = v
 	}
 
+	return false, true
+}
+
+// move the groups to disk
+func (this *IntermediateGroup) spill(context *Context) bool {
+	if this.partitions == nil {
+		this.partitions = newGroupPartitions()
+	}
+	for gk, av := range this.groups {
+		if !this.partitions.put(gk, av, context) {
+			return false
+		}
+	}
+	if context.UseRequestQuota() {
+		context.ReleaseValueSize(this.size)
+	}
+	for gk, av := range this.groups {
+		av.Recycle()
+		delete(this.groups, gk)
+	}
+	this.size = 0
 	return true
 }
 
 func (this *IntermediateGroup) afterItems(context *Context) {
-	for _, av := range this.groups {
-		if !this.sendItem(av) {
+	if this.partitions != nil {
+
+		// the remaining groups need merging with the spilled ones
+		if this.stopped || !this.spill(context) {
 			return
 		}
+		this.partitions.merge(&this.base, context,
+			func(item value.AnnotatedValue) bool {
+				_, ok := this.groupItem(item, context)
+				return ok
+			},
+			this.flush)
+		return
+	}
+	this.flush()
+}
+
+func (this *IntermediateGroup) flush() bool {
+	for gk, av := range this.groups {
+		delete(this.groups, gk)
+		if !this.sendItem(av) {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *IntermediateGroup) releasePartitions() {
+	if this.partitions != nil {
+		this.partitions.close()
+		this.partitions = nil
 	}
+	this.size = 0
 }
 
 func (this *IntermediateGroup) MarshalJSON() ([]byte, error) {
@@ -132,6 +202,7 @@ func (this *IntermediateGroup) MarshalJSON() ([]byte, error) {
 
 func (this *IntermediateGroup) reopen(context *Context) bool {
 	rv := this.baseReopen(context)
+	this.releasePartitions()
 	this.groups = make(map[string]value.AnnotatedValue)
 	return rv
 }
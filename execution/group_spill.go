@@ -0,0 +1,102 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+// Spilling of group state.
+//
+// When the groups held by the intermediate phase outgrow the spill threshold,
+// they are split into partitions on the hash of the group key and written to
+// disk, partial aggregates included. Since all the partial groups for a key
+// end up in the same partition, once the input is exhausted each partition
+// can be read back and merged in memory in turn.
+
+type groupPartitions struct {
+	files []*spillFile
+}
+
+func newGroupPartitions() *groupPartitions {
+	return &groupPartitions{
+		files: make([]*spillFile, _HASH_PARTITIONS),
+	}
+}
+
+func (this *groupPartitions) put(gk string, item value.AnnotatedValue, context *Context) bool {
+	var err errors.Error
+
+	// same as hash partitions: use the high bits
+	p := int((util.SeaHashSum64([]byte(gk)) >> 32) % _HASH_PARTITIONS)
+	if this.files[p] == nil {
+		this.files[p], err = newSpillFile()
+	}
+	if err == nil {
+		err = this.files[p].write(item)
+	}
+	if err != nil {
+		context.Error(err)
+		return false
+	}
+	return true
+}
+
+// read back one partition at a time, grouping its items and flushing the groups
+func (this *groupPartitions) merge(base *base, context *Context,
+	group func(item value.AnnotatedValue) bool, flush func() bool) bool {
+
+	for _, f := range this.files {
+		if f != nil {
+			if err := f.rewind(); err != nil {
+				context.Error(err)
+				return false
+			}
+			base.addSpill(f.size, context)
+		}
+	}
+
+	for _, f := range this.files {
+		if f == nil {
+			continue
+		}
+		for {
+			item, err := f.read()
+			if err != nil {
+				context.Error(err)
+				return false
+			}
+			if item == nil {
+				break
+			}
+			if context.UseRequestQuota() && context.TrackValueSize(item.Size()) {
+				context.Error(errors.NewMemoryQuotaExceededError())
+				return false
+			}
+			if !group(item) {
+				return false
+			}
+		}
+		if !flush() {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *groupPartitions) close() {
+	for i, f := range this.files {
+		if f != nil {
+			f.close()
+			this.files[i] = nil
+		}
+	}
+}
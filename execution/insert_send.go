@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/couchbase/query/changefeed"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/plan"
@@ -203,6 +204,10 @@ func (this *SendInsert) flushBatch(context *Context) bool {
 
 	this.switchPhase(_EXECTIME)
 
+	if changesWanted(this.keyspace) {
+		publishChanges(context, this.keyspace, changefeed.INSERT, dpairs, nil)
+	}
+
 	// Update mutation count with number of inserted docs
 	context.AddMutationCount(uint64(len(dpairs)))
 
@@ -20,13 +20,14 @@ import (
 
 type HashJoin struct {
 	base
-	plan      *plan.HashJoin
-	child     Operator
-	aliasMap  map[string]string
-	ansiFlags uint32
-	hashTab   *util.HashTable
-	buildVals value.Values
-	probeVals value.Values
+	plan       *plan.HashJoin
+	child      Operator
+	aliasMap   map[string]string
+	ansiFlags  uint32
+	hashTab    *util.HashTable
+	partitions *hashPartitions
+	buildVals  value.Values
+	probeVals  value.Values
 }
 
 func NewHashJoin(plan *plan.HashJoin, context *Context, child Operator, aliasMap map[string]string) *HashJoin {
@@ -102,15 +103,16 @@ func (this *HashJoin) beforeItems(context *Context, parent value.Value) bool {
 
 	this.fork(this.child, context, parent)
 
-	ok := buildHashTab(&(this.base), this.child, this.hashTab,
+	partitions, ok := buildHashTab(&(this.base), this.child, this.hashTab,
 		this.plan.BuildExprs(), this.buildVals, context)
 	if !ok {
 		return false
 	}
+	this.partitions = partitions
 
 	// if the build side is empty and this is not an outer join,
 	// no need to activate the probe side.
-	if this.hashTab.Count() == 0 && !this.plan.Outer() {
+	if this.hashTab.Count() == 0 && this.partitions == nil && !this.plan.Outer() {
 		return false
 	}
 
@@ -118,39 +120,56 @@ func (this *HashJoin) beforeItems(context *Context, parent value.Value) bool {
 }
 
 func buildHashTab(base *base, buildOp Operator, hashTab *util.HashTable,
-	buildExprs expression.Expressions, buildVals value.Values, context *Context) bool {
+	buildExprs expression.Expressions, buildVals value.Values, context *Context) (*hashPartitions, bool) {
 	var err error
+	var partitions *hashPartitions
 	stopped := false
 	n := 1
+	canSpill := context.CanSpill()
+
+	fail := func() (*hashPartitions, bool) {
+		if partitions != nil {
+			partitions.close()
+		}
+		return nil, false
+	}
 
 loop:
 	for {
 		build_item, child, cont := base.getItemChildrenOp(buildOp)
 		if cont {
 			if build_item != nil {
-				for i, be := range buildExprs {
-					buildVals[i], err = be.Evaluate(build_item, context)
-					if err != nil {
-						context.Error(errors.NewEvaluationError(err, "Hash Table Build Expression"))
-						return false
-					}
-				}
-				var buildVal value.Value
 				var size uint64
 
-				if len(buildVals) == 1 {
-					buildVal = buildVals[0]
-				} else {
-					buildVal = value.NewValue(buildVals)
+				buildVal := getBuildVal(build_item, buildExprs, buildVals, context)
+				if buildVal == nil {
+					return fail()
+				}
+
+				// the build side has already been moved to disk
+				if partitions != nil {
+					if !partitions.putBuild(buildVal, build_item, context) {
+						return fail()
+					}
+					continue
 				}
-				if context.UseRequestQuota() {
+
+				if context.UseRequestQuota() || canSpill {
 					size = build_item.Size()
 				}
 
 				err = hashTab.Put(buildVal, build_item, value.MarshalValue, value.EqualValue, size)
 				if err != nil {
 					context.Error(errors.NewHashTablePutError(err))
-					return false
+					return fail()
+				}
+				if canSpill && context.ShouldSpill(hashTab.Size()) {
+					var ok bool
+
+					partitions, ok = spillHashTab(hashTab, buildExprs, buildVals, context)
+					if !ok {
+						return fail()
+					}
 				}
 			} else if child >= 0 {
 				n--
@@ -169,10 +188,10 @@ loop:
 	}
 
 	if stopped {
-		return false
+		return fail()
 	}
 
-	return true
+	return partitions, true
 }
 
 func getProbeVal(item value.AnnotatedValue, probeExprs expression.Expressions,
@@ -197,15 +216,24 @@ func getProbeVal(item value.AnnotatedValue, probeExprs expression.Expressions,
 func (this *HashJoin) processItem(item value.AnnotatedValue, context *Context) bool {
 	defer this.switchPhase(_EXECTIME)
 
+	probeVal := getProbeVal(item, this.plan.ProbeExprs(), this.probeVals, context)
+	if probeVal == nil {
+		return false
+	}
+
+	// the build side is on disk: partition the probe side too
+	if this.partitions != nil {
+		return this.partitions.putProbe(probeVal, item, context)
+	}
+	return this.probe(item, probeVal, context)
+}
+
+func (this *HashJoin) probe(item value.AnnotatedValue, probeVal value.Value, context *Context) bool {
 	var err error
 	var outVal interface{}
 	ok := true
 	matched := false
 
-	probeVal := getProbeVal(item, this.plan.ProbeExprs(), this.probeVals, context)
-	if probeVal == nil {
-		return false
-	}
 	outVal, err = this.hashTab.Get(probeVal, value.MarshalValue, value.EqualValue)
 	if err != nil {
 		context.Error(errors.NewHashTableGetError(err))
@@ -250,6 +278,23 @@ func (this *HashJoin) processItem(item value.AnnotatedValue, context *Context) b
 }
 
 func (this *HashJoin) afterItems(context *Context) {
+	if this.partitions != nil {
+		this.dropHashTable(context)
+		if !this.stopped {
+			this.partitions.join(&this.base, this.plan.BuildExprs(), this.buildVals, context,
+				func(hashTab *util.HashTable, item value.AnnotatedValue) bool {
+					probeVal := getProbeVal(item, this.plan.ProbeExprs(), this.probeVals, context)
+					if probeVal == nil {
+						return false
+					}
+					this.hashTab = hashTab
+					return this.probe(item, probeVal, context)
+				})
+		}
+		this.hashTab = nil
+		this.partitions.close()
+		this.partitions = nil
+	}
 	this.dropHashTable(context)
 	onclause := this.plan.Onclause()
 	if onclause != nil {
@@ -0,0 +1,217 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+// Grace hash join and nest.
+//
+// When the build side outgrows the spill threshold, the hash table and the
+// rest of the build side are split into partitions on the hash of the build
+// key, and written to disk. Probe items are then partitioned in the same way,
+// and once the probe side is exhausted, each pair of partitions is joined in
+// memory in turn.
+
+const _HASH_PARTITIONS = 32
+
+type hashPartitions struct {
+	build []*spillFile
+	probe []*spillFile
+	count uint64
+}
+
+// the partition for a build or probe value
+func hashPartition(val value.Value) (int, errors.Error) {
+	bytes, err := value.MarshalValue(val)
+	if err != nil {
+		return 0, errors.NewHashTablePutError(err)
+	}
+
+	// the hash table uses the low bits: use the high ones
+	return int((util.SeaHashSum64(bytes) >> 32) % _HASH_PARTITIONS), nil
+}
+
+func getBuildVal(item value.AnnotatedValue, buildExprs expression.Expressions,
+	buildVals value.Values, context *Context) value.Value {
+
+	var err error
+	for i, be := range buildExprs {
+		buildVals[i], err = be.Evaluate(item, context)
+		if err != nil {
+			context.Error(errors.NewEvaluationError(err, "Hash Table Build Expression"))
+			return nil
+		}
+	}
+
+	if len(buildVals) == 1 {
+		return buildVals[0]
+	} else {
+		return value.NewValue(buildVals)
+	}
+}
+
+// move the hash table to disk
+func spillHashTab(hashTab *util.HashTable, buildExprs expression.Expressions,
+	buildVals value.Values, context *Context) (*hashPartitions, bool) {
+
+	rv := &hashPartitions{
+		build: make([]*spillFile, _HASH_PARTITIONS),
+		probe: make([]*spillFile, _HASH_PARTITIONS),
+	}
+	for v := hashTab.Iterate(); v != nil; v = hashTab.Iterate() {
+		item := v.(value.AnnotatedValue)
+		buildVal := getBuildVal(item, buildExprs, buildVals, context)
+		if buildVal == nil || !rv.put(rv.build, buildVal, item, context) {
+			rv.close()
+			return nil, false
+		}
+		rv.count++
+	}
+	if context.UseRequestQuota() {
+		context.ReleaseValueSize(hashTab.Size())
+	}
+	hashTab.Drop()
+	return rv, true
+}
+
+func (this *hashPartitions) putBuild(buildVal value.Value, item value.AnnotatedValue, context *Context) bool {
+	if !this.put(this.build, buildVal, item, context) {
+		return false
+	}
+	this.count++
+	if context.UseRequestQuota() {
+		context.ReleaseValueSize(item.Size())
+	}
+	return true
+}
+
+func (this *hashPartitions) putProbe(probeVal value.Value, item value.AnnotatedValue, context *Context) bool {
+	if !this.put(this.probe, probeVal, item, context) {
+		return false
+	}
+	if context.UseRequestQuota() {
+		context.ReleaseValueSize(item.Size())
+	}
+	return true
+}
+
+func (this *hashPartitions) put(files []*spillFile, val value.Value, item value.AnnotatedValue, context *Context) bool {
+	p, err := hashPartition(val)
+	if err == nil && files[p] == nil {
+		files[p], err = newSpillFile()
+	}
+	if err == nil {
+		err = files[p].write(item)
+	}
+	if err != nil {
+		context.Error(err)
+		return false
+	}
+	return true
+}
+
+// join each build partition with the matching probe partition
+func (this *hashPartitions) join(base *base, buildExprs expression.Expressions, buildVals value.Values,
+	context *Context, probe func(hashTab *util.HashTable, item value.AnnotatedValue) bool) bool {
+
+	var item value.AnnotatedValue
+	var err errors.Error
+
+	for _, files := range [][]*spillFile{this.build, this.probe} {
+		for _, f := range files {
+			if f != nil {
+				if err = f.rewind(); err != nil {
+					context.Error(err)
+					return false
+				}
+				base.addSpill(f.size, context)
+			}
+		}
+	}
+
+	for p := 0; p < _HASH_PARTITIONS; p++ {
+		build := this.build[p]
+		probes := this.probe[p]
+		if probes == nil {
+			continue
+		}
+
+		hashTab := util.NewHashTable(util.HASH_TABLE_FOR_HASH_JOIN)
+		ok := true
+		for build != nil {
+			item, err = build.read()
+			if err != nil {
+				context.Error(err)
+				ok = false
+			}
+			if item == nil {
+				break
+			}
+			buildVal := getBuildVal(item, buildExprs, buildVals, context)
+			if buildVal == nil {
+				ok = false
+				break
+			}
+			size := item.Size()
+			if context.UseRequestQuota() && context.TrackValueSize(size) {
+				context.Error(errors.NewMemoryQuotaExceededError())
+				ok = false
+				break
+			}
+			e := hashTab.Put(buildVal, item, value.MarshalValue, value.EqualValue, size)
+			if e != nil {
+				context.Error(errors.NewHashTablePutError(e))
+				ok = false
+				break
+			}
+		}
+
+		for ok {
+			item, err = probes.read()
+			if err != nil {
+				context.Error(err)
+				ok = false
+			}
+			if item == nil {
+				break
+			}
+			if context.UseRequestQuota() && context.TrackValueSize(item.Size()) {
+				context.Error(errors.NewMemoryQuotaExceededError())
+				ok = false
+				break
+			}
+			ok = probe(hashTab, item)
+		}
+
+		if context.UseRequestQuota() {
+			context.ReleaseValueSize(hashTab.Size())
+		}
+		hashTab.Drop()
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *hashPartitions) close() {
+	for _, files := range [][]*spillFile{this.build, this.probe} {
+		for i, f := range files {
+			if f != nil {
+				f.close()
+				files[i] = nil
+			}
+		}
+	}
+}
@@ -19,13 +19,14 @@ import (
 
 type HashNest struct {
 	base
-	plan      *plan.HashNest
-	child     Operator
-	aliasMap  map[string]string
-	ansiFlags uint32
-	hashTab   *util.HashTable
-	buildVals value.Values
-	probeVals value.Values
+	plan       *plan.HashNest
+	child      Operator
+	aliasMap   map[string]string
+	ansiFlags  uint32
+	hashTab    *util.HashTable
+	partitions *hashPartitions
+	buildVals  value.Values
+	probeVals  value.Values
 }
 
 func NewHashNest(plan *plan.HashNest, context *Context, child Operator, aliasMap map[string]string) *HashNest {
@@ -98,22 +99,33 @@ func (this *HashNest) beforeItems(context *Context, parent value.Value) bool {
 
 	this.fork(this.child, context, parent)
 
-	return buildHashTab(&(this.base), this.child, this.hashTab,
+	partitions, ok := buildHashTab(&(this.base), this.child, this.hashTab,
 		this.plan.BuildExprs(), this.buildVals, context)
+	this.partitions = partitions
+	return ok
 }
 
 func (this *HashNest) processItem(item value.AnnotatedValue, context *Context) bool {
 	defer this.switchPhase(_EXECTIME)
 
+	probeVal := getProbeVal(item, this.plan.ProbeExprs(), this.probeVals, context)
+	if probeVal == nil {
+		return false
+	}
+
+	// the build side is on disk: partition the probe side too
+	if this.partitions != nil {
+		return this.partitions.putProbe(probeVal, item, context)
+	}
+	return this.probe(item, probeVal, context)
+}
+
+func (this *HashNest) probe(item value.AnnotatedValue, probeVal value.Value, context *Context) bool {
 	var err error
 	var outVal interface{}
 	var right_items value.AnnotatedValues
 	ok := true
 
-	probeVal := getProbeVal(item, this.plan.ProbeExprs(), this.probeVals, context)
-	if probeVal == nil {
-		return false
-	}
 	outVal, err = this.hashTab.Get(probeVal, value.MarshalValue, value.EqualValue)
 	if err != nil {
 		context.Error(errors.NewHashTableGetError(err))
@@ -176,6 +188,23 @@ func (this *HashNest) processItem(item value.AnnotatedValue, context *Context) b
 }
 
 func (this *HashNest) afterItems(context *Context) {
+	if this.partitions != nil {
+		this.dropHashTable(context)
+		if !this.stopped {
+			this.partitions.join(&this.base, this.plan.BuildExprs(), this.buildVals, context,
+				func(hashTab *util.HashTable, item value.AnnotatedValue) bool {
+					probeVal := getProbeVal(item, this.plan.ProbeExprs(), this.probeVals, context)
+					if probeVal == nil {
+						return false
+					}
+					this.hashTab = hashTab
+					return this.probe(item, probeVal, context)
+				})
+		}
+		this.hashTab = nil
+		this.partitions.close()
+		this.partitions = nil
+	}
 	this.dropHashTable(context)
 	this.plan.Onclause().ResetMemory(context)
 }
@@ -9,8 +9,10 @@
 package execution
 
 import (
+	"container/heap"
 	"encoding/json"
 
+	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/plan"
 	"github.com/couchbase/query/sort"
 	"github.com/couchbase/query/value"
@@ -18,10 +20,13 @@ import (
 
 type Order struct {
 	base
-	plan    *plan.Order
-	values  value.AnnotatedValues
-	context *Context
-	terms   []string
+	plan     *plan.Order
+	values   value.AnnotatedValues
+	context  *Context
+	terms    []string
+	canSpill bool
+	size     uint64
+	runs     []*spillFile
 }
 
 const _ORDER_CAP = 1024
@@ -62,15 +67,65 @@ func (this *Order) RunOnce(context *Context, parent value.Value) {
 	this.runConsumer(this, context, parent)
 }
 
+func (this *Order) beforeItems(context *Context, parent value.Value) bool {
+	this.canSpill = context.CanSpill()
+	return true
+}
+
 func (this *Order) processItem(item value.AnnotatedValue, context *Context) bool {
 	if len(this.values) == cap(this.values) {
 		values := make(value.AnnotatedValues, len(this.values), len(this.values)<<1)
 		copy(values, this.values)
-		this.releaseValues()
+		_ORDER_POOL.Put(this.values)
 		this.values = values
 	}
 
 	this.values = append(this.values, item)
+	if this.canSpill {
+		this.size += item.Size()
+		if context.ShouldSpill(this.size) {
+			return this.spill(context)
+		}
+	}
+	return true
+}
+
+// sort the buffered items and write them out to disk as a sorted run
+func (this *Order) spill(context *Context) bool {
+	if this.terms == nil {
+		this.setupTerms(context)
+	}
+	sort.Sort(this)
+
+	run, err := newSpillFile()
+	if err != nil {
+		context.Error(err)
+		return false
+	}
+	this.runs = append(this.runs, run)
+	for _, av := range this.values {
+		err = run.write(av)
+		if err != nil {
+			context.Error(err)
+			return false
+		}
+	}
+	err = run.rewind()
+	if err != nil {
+		context.Error(err)
+		return false
+	}
+
+	if context.UseRequestQuota() {
+		context.ReleaseValueSize(this.size)
+	}
+	for i, av := range this.values {
+		av.Recycle()
+		this.values[i] = nil
+	}
+	this.values = this.values[0:0]
+	this.size = 0
+	this.addSpill(run.size, context)
 	return true
 }
 
@@ -97,8 +152,17 @@ func (this *Order) afterItems(context *Context) {
 	this.setupTerms(context)
 	sort.Sort(this)
 
-	context.SetSortCount(uint64(this.Len()))
-	context.AddPhaseCount(SORT, uint64(this.Len()))
+	count := uint64(this.Len())
+	for _, run := range this.runs {
+		count += run.count
+	}
+	context.SetSortCount(count)
+	context.AddPhaseCount(SORT, count)
+
+	if len(this.runs) > 0 {
+		this.merge(context)
+		return
+	}
 
 	for _, av := range this.values {
 		if !this.sendItem(av) {
@@ -107,9 +171,49 @@ func (this *Order) afterItems(context *Context) {
 	}
 }
 
+// merge the sorted runs on disk with the items still in memory
+func (this *Order) merge(context *Context) {
+	merge := &orderMerge{order: this}
+	if len(this.values) > 0 {
+		merge.sources = append(merge.sources, &orderSource{item: this.values[0], values: this.values[1:]})
+	}
+	for _, run := range this.runs {
+		source := &orderSource{run: run}
+		ok := source.next(context)
+		if !ok {
+			return
+		}
+		if source.item != nil {
+			merge.sources = append(merge.sources, source)
+		}
+	}
+	heap.Init(merge)
+
+	for merge.Len() > 0 {
+		source := merge.sources[0]
+		item := source.item
+		if !source.next(context) {
+			return
+		}
+		if source.item == nil {
+			heap.Pop(merge)
+		} else {
+			heap.Fix(merge, 0)
+		}
+		if !this.sendItem(item) {
+			return
+		}
+	}
+}
+
 func (this *Order) releaseValues() {
 	_ORDER_POOL.Put(this.values)
 	this.values = nil
+	for _, run := range this.runs {
+		run.close()
+	}
+	this.runs = nil
+	this.size = 0
 }
 
 func (this *Order) Len() int {
@@ -165,6 +269,70 @@ func (this *Order) Swap(i, j int) {
 	this.values[i], this.values[j] = this.values[j], this.values[i]
 }
 
+// a sorted stream of items, either in memory or spilled
+type orderSource struct {
+	item   value.AnnotatedValue
+	values value.AnnotatedValues
+	run    *spillFile
+}
+
+// advance to the next item, nil when the source is exhausted
+func (this *orderSource) next(context *Context) bool {
+	if this.run == nil {
+		if len(this.values) == 0 {
+			this.item = nil
+		} else {
+			this.item = this.values[0]
+			this.values = this.values[1:]
+		}
+		return true
+	}
+
+	item, err := this.run.read()
+	if err != nil {
+		context.Error(err)
+		return false
+	}
+
+	// items read back count against the quota again
+	if item != nil && context.UseRequestQuota() && context.TrackValueSize(item.Size()) {
+		context.Error(errors.NewMemoryQuotaExceededError())
+		item.Recycle()
+		return false
+	}
+	this.item = item
+	return true
+}
+
+// a heap of sources ordered on their current item
+type orderMerge struct {
+	order   *Order
+	sources []*orderSource
+}
+
+func (this *orderMerge) Len() int {
+	return len(this.sources)
+}
+
+func (this *orderMerge) Less(i, j int) bool {
+	return this.order.lessThan(this.sources[i].item, this.sources[j].item)
+}
+
+func (this *orderMerge) Swap(i, j int) {
+	this.sources[i], this.sources[j] = this.sources[j], this.sources[i]
+}
+
+func (this *orderMerge) Push(item interface{}) {
+	this.sources = append(this.sources, item.(*orderSource))
+}
+
+func (this *orderMerge) Pop() interface{} {
+	index := len(this.sources) - 1
+	source := this.sources[index]
+	this.sources = this.sources[0:index]
+	return source
+}
+
 func (this *Order) MarshalJSON() ([]byte, error) {
 	r := this.plan.MarshalBase(func(r map[string]interface{}) {
 		this.marshalTimes(r)
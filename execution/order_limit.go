@@ -134,6 +134,9 @@ func (this *OrderLimit) beforeItems(context *Context, parent value.Value) bool {
 	// Will ignore input rows if numReturnedRows is not positive.
 	this.ignoreInput = this.ignoreInput || this.numReturnedRows <= 0
 
+	// Only the standard sort can spill.
+	this.canSpill = this.fallback && context.CanSpill()
+
 	// Allocate more space if necessary.
 	if this.numReturnedRows > cap(this.values) {
 		values := make(value.AnnotatedValues, len(this.values), this.numReturnedRows)
@@ -182,7 +185,7 @@ func (this *OrderLimit) afterItems(context *Context) {
 	if this.offset != nil {
 		offset = this.offset.offset
 	}
-	if offset >= int64(len) {
+	if offset >= int64(len) && this.runs == nil {
 		this.values = this.values[0:0]
 	}
 
@@ -0,0 +1,340 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	atomic "github.com/couchbase/go-couchbase/platform"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/value"
+)
+
+// Spilling to disk.
+//
+// Operators that buffer their input (sorts, hash tables, groups) write it
+// out to temporary files when it outgrows the spill threshold, or when the
+// request gets close to its memory quota, and read it back when needed.
+// Items are written as length prefixed JSON records, which hold the item
+// value, the original document for projections, covers, meta data and any
+// cached expression values.
+
+const _SPILL_PREFIX = "query_spill_"
+const _SPILL_BUFFER = 64 * 1024
+
+var spillThreshold atomic.AlignedUint64
+var spillDir string
+var spillDirLock sync.RWMutex
+
+// the in memory size in MB above which operators spill, 0 to spill only on memory quota
+func SetSpillThreshold(threshold uint64) {
+	atomic.StoreUint64(&spillThreshold, threshold)
+}
+
+func GetSpillThreshold() uint64 {
+	return atomic.LoadUint64(&spillThreshold)
+}
+
+// the directory used for spill files, the system temporary directory if empty
+func SetSpillDir(dir string) {
+	spillDirLock.Lock()
+	spillDir = dir
+	spillDirLock.Unlock()
+}
+
+func GetSpillDir() string {
+	spillDirLock.RLock()
+	defer spillDirLock.RUnlock()
+	return spillDir
+}
+
+type spillFile struct {
+	file   *os.File
+	writer *bufio.Writer
+	reader *bufio.Reader
+	buf    []byte
+	count  uint64
+	size   uint64
+}
+
+func newSpillFile() (*spillFile, errors.Error) {
+	f, err := ioutil.TempFile(GetSpillDir(), _SPILL_PREFIX)
+	if err != nil {
+		return nil, errors.NewSpillError(err, "create")
+	}
+	return &spillFile{file: f, writer: bufio.NewWriterSize(f, _SPILL_BUFFER)}, nil
+}
+
+func (this *spillFile) write(item value.AnnotatedValue) errors.Error {
+	data, err := encodeSpill(item)
+	if err != nil {
+		return errors.NewSpillError(err, "encode")
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(data)))
+	_, err = this.writer.Write(prefix[:n])
+	if err == nil {
+		_, err = this.writer.Write(data)
+	}
+	if err != nil {
+		return errors.NewSpillError(err, "write")
+	}
+	this.count++
+	this.size += uint64(n + len(data))
+	return nil
+}
+
+// done writing: the file can now be read from the start
+func (this *spillFile) rewind() errors.Error {
+	err := this.writer.Flush()
+	if err == nil {
+		_, err = this.file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return errors.NewSpillError(err, "rewind")
+	}
+	this.writer = nil
+	this.reader = bufio.NewReaderSize(this.file, _SPILL_BUFFER)
+	return nil
+}
+
+// the next item, or nil at the end of the file
+func (this *spillFile) read() (value.AnnotatedValue, errors.Error) {
+	l, err := binary.ReadUvarint(this.reader)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.NewSpillError(err, "read")
+	}
+	if uint64(cap(this.buf)) < l {
+		this.buf = make([]byte, l)
+	}
+	buf := this.buf[:l]
+	_, err = io.ReadFull(this.reader, buf)
+	if err != nil {
+		return nil, errors.NewSpillError(err, "read")
+	}
+
+	// the decoded item must not share the read buffer
+	data := make([]byte, l)
+	copy(data, buf)
+	return decodeSpill(data), nil
+}
+
+func (this *spillFile) close() {
+	name := this.file.Name()
+	this.file.Close()
+	os.Remove(name)
+	this.writer = nil
+	this.reader = nil
+	this.buf = nil
+}
+
+func encodeSpill(item value.AnnotatedValue) ([]byte, error) {
+	rec := make(map[string]interface{}, 8)
+	rec["v"] = item.GetValue()
+	orig := item.Original()
+	if orig != item {
+		rec["o"] = orig.GetValue()
+	}
+	if covers := item.Covers(); covers != nil {
+		rec["c"] = covers
+	}
+	if meta := item.GetMeta(); len(meta) > 0 {
+		rec["m"] = meta
+	}
+	if id := item.GetId(); id != nil {
+		rec["i"] = id
+	}
+
+	// only values and group aggregates can be spilled: other attachments are rebuilt on demand
+	var attachments map[string]interface{}
+	for k, a := range item.Attachments() {
+		switch a := a.(type) {
+		case value.Value:
+			if a.Type() != value.MISSING {
+				if attachments == nil {
+					attachments = make(map[string]interface{}, len(item.Attachments()))
+				}
+				attachments[k] = a
+			}
+		case map[string]value.Value:
+			if k == "aggregates" {
+				rec["g"] = encodeAggregates(a)
+			}
+		}
+	}
+	if attachments != nil {
+		rec["a"] = attachments
+	}
+	if item.Self() {
+		rec["s"] = true
+	}
+	if item.Bit() != 0 {
+		rec["b"] = int64(item.Bit())
+	}
+	return value.NewValue(rec).MarshalJSON()
+}
+
+func decodeSpill(data []byte) value.AnnotatedValue {
+	var av value.AnnotatedValue
+
+	rec := value.NewValue(data)
+	v, _ := rec.Field("v")
+	o, projected := rec.Field("o")
+	if projected {
+		av = value.NewAnnotatedValue(o)
+	} else {
+		av = value.NewAnnotatedValue(v)
+	}
+	if c, ok := rec.Field("c"); ok {
+		for k, cv := range c.Fields() {
+			av.SetCover(k, value.NewValue(cv))
+		}
+	}
+	if m, ok := rec.Field("m"); ok {
+		meta := av.NewMeta()
+		for k, mv := range m.Fields() {
+			meta[k] = value.NewValue(mv).Actual()
+		}
+	}
+	if i, ok := rec.Field("i"); ok {
+		av.SetId(i.Actual())
+	}
+	if a, ok := rec.Field("a"); ok {
+		for k, a := range a.Fields() {
+			av.SetAttachment(k, value.NewValue(a))
+		}
+	}
+	if g, ok := rec.Field("g"); ok {
+		av.SetAttachment("aggregates", decodeAggregates(g))
+	}
+	if s, ok := rec.Field("s"); ok && s.Truth() {
+		av.SetSelf(true)
+	}
+	if b, ok := rec.Field("b"); ok && b.Type() == value.NUMBER {
+		av.SetBit(uint8(value.AsNumberValue(b).Int64()))
+	}
+	if projected {
+		av.SetProjection(v)
+	}
+	return av
+}
+
+// partial aggregates keep their state in attachments: distinct values in a set,
+// collected values in a list, running sums in values, and sketches in their
+// binary encoding
+func encodeAggregates(aggregates map[string]value.Value) map[string]interface{} {
+	rv := make(map[string]interface{}, len(aggregates))
+	for k, agg := range aggregates {
+		if agg == nil {
+			continue
+		}
+		rec := make(map[string]interface{}, 4)
+		rv[k] = rec
+		if agg.Type() != value.MISSING {
+			rec["v"] = agg
+		}
+		av, ok := agg.(value.AnnotatedValue)
+		if !ok {
+			continue
+		}
+		if agg.Type() != value.MISSING {
+			rec["v"] = av.GetValue()
+		}
+		for n, a := range av.Attachments() {
+			switch a := a.(type) {
+			case value.Value:
+				if a.Type() != value.MISSING {
+					addSpillField(rec, "a", n, a)
+				}
+			case *value.Set:
+				addSpillField(rec, "s", n, map[string]interface{}{"c": a.ObjectCap(), "v": a.Values()})
+			case *value.List:
+				addSpillField(rec, "l", n, a.Values())
+			case encoding.BinaryMarshaler:
+
+				// sketches are decoded by the aggregates themselves
+				if data, err := a.MarshalBinary(); err == nil {
+					addSpillField(rec, "a", n, base64.StdEncoding.EncodeToString(data))
+				}
+			}
+		}
+	}
+	return rv
+}
+
+func addSpillField(rec map[string]interface{}, field, name string, val interface{}) {
+	fields, ok := rec[field].(map[string]interface{})
+	if !ok {
+		fields = make(map[string]interface{}, 1)
+		rec[field] = fields
+	}
+	fields[name] = val
+}
+
+func decodeAggregates(g value.Value) map[string]value.Value {
+	fields := g.Fields()
+	rv := make(map[string]value.Value, len(fields))
+	for k, f := range fields {
+		rec := value.NewValue(f)
+
+		// rebuild the value so that aggregates can update it in place
+		agg := value.MISSING_VALUE
+		if v, ok := rec.Field("v"); ok {
+			agg = value.NewValue(v.Actual())
+		}
+		a, hasA := rec.Field("a")
+		s, hasS := rec.Field("s")
+		l, hasL := rec.Field("l")
+		if !hasA && !hasS && !hasL {
+			rv[k] = agg
+			continue
+		}
+
+		av := value.NewAnnotatedValue(agg)
+		if hasA {
+			for n, a := range a.Fields() {
+				av.SetAttachment(n, value.NewValue(a))
+			}
+		}
+		if hasS {
+			for n, sf := range s.Fields() {
+				sv := value.NewValue(sf)
+				c, _ := sv.Field("c")
+				vals, _ := sv.Field("v")
+				set := value.NewSet(int(value.AsNumberValue(c).Int64()), true, false)
+				for _, e := range vals.Actual().([]interface{}) {
+					set.Add(value.NewValue(e))
+				}
+				av.SetAttachment(n, set)
+			}
+		}
+		if hasL {
+			for n, lf := range l.Fields() {
+				vals := value.NewValue(lf).Actual().([]interface{})
+				list := value.NewList(len(vals))
+				for _, e := range vals {
+					list.Add(value.NewValue(e))
+				}
+				av.SetAttachment(n, list)
+			}
+		}
+		rv[k] = av
+	}
+	return rv
+}
@@ -0,0 +1,171 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+func TestSpillFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	SetSpillDir(dir)
+	defer SetSpillDir("")
+
+	// a projected item, with covers, meta data and a cached sort term
+	doc := value.NewAnnotatedValue(map[string]interface{}{"name": "fred", "age": 42})
+	doc.NewMeta()["type"] = "json"
+	doc.SetId("fred")
+	doc.SetCover("cover ((`c`.`age`))", value.NewValue(42))
+	doc.SetAttachment("(`c`.`age`)", value.NewValue(42))
+	doc.SetAttachment("missing", value.MISSING_VALUE)
+	doc.SetAttachment("other", 42)
+	doc.SetProjection(value.NewValue(map[string]interface{}{"n": "fred"}))
+
+	plain := value.NewAnnotatedValue([]interface{}{1, "two", nil})
+	plain.SetBit(2)
+
+	f, err1 := newSpillFile()
+	if err1 != nil {
+		t.Fatal(err1)
+	}
+	for _, item := range []value.AnnotatedValue{doc, plain} {
+		if err1 = f.write(item); err1 != nil {
+			t.Fatal(err1)
+		}
+	}
+	if err1 = f.rewind(); err1 != nil {
+		t.Fatal(err1)
+	}
+
+	item, err1 := f.read()
+	if err1 != nil || item == nil {
+		t.Fatalf("expected item, got %v %v", item, err1)
+	}
+	if item.String() != `{"n":"fred"}` {
+		t.Errorf("unexpected projection %v", item)
+	}
+	if v, _ := item.Original().Field("age"); v.String() != "42" {
+		t.Errorf("unexpected original %v", item.Original())
+	}
+	if item.GetId() != "fred" || item.GetMeta()["type"] != "json" {
+		t.Errorf("unexpected meta %v %v", item.GetId(), item.GetMeta())
+	}
+	if c := item.GetCover("cover ((`c`.`age`))"); c == nil || c.String() != "42" {
+		t.Errorf("unexpected cover %v", c)
+	}
+	if a, ok := item.GetAttachment("(`c`.`age`)").(value.Value); !ok || a.String() != "42" {
+		t.Errorf("unexpected attachment %v", item.GetAttachment("(`c`.`age`)"))
+	}
+	if item.GetAttachment("missing") != nil || item.GetAttachment("other") != nil {
+		t.Errorf("unexpected attachments %v", item.Attachments())
+	}
+
+	item, err1 = f.read()
+	if err1 != nil || item == nil {
+		t.Fatalf("expected item, got %v %v", item, err1)
+	}
+	if item.String() != `[1,"two",null]` || item.Bit() != 2 || item.Original() != item {
+		t.Errorf("unexpected item %v", item)
+	}
+
+	item, err1 = f.read()
+	if err1 != nil || item != nil {
+		t.Fatalf("expected end of file, got %v %v", item, err1)
+	}
+
+	f.close()
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("spill file not removed")
+	}
+}
+
+func TestSpillAggregates(t *testing.T) {
+	set := value.NewSet(16, true, false)
+	set.Add(value.NewValue(1))
+	set.Add(value.NewValue("two"))
+	list := value.NewList(2)
+	list.Add(value.NewValue(3))
+	list.Add(value.NewValue(4))
+	variance := value.NewAnnotatedValue(value.NewValue(map[string]interface{}{"count": 2}))
+	variance.SetAttachment("sum", value.NewValue(7.5))
+	variance.SetAttachment("set", set)
+	median := value.NewAnnotatedValue(value.NULL_VALUE)
+	median.SetAttachment("list", list)
+	hll := util.NewHyperLogLog(util.HLL_PRECISION)
+	hll.Add([]byte("1"))
+	hll.Add([]byte("2"))
+	approx := value.NewAnnotatedValue(value.ZERO_VALUE)
+	approx.SetAttachment("hll", hll)
+
+	group := value.NewAnnotatedValue(map[string]interface{}{"k": 1})
+	group.SetAttachment("aggregates", map[string]value.Value{
+		"count(*)":                   value.NewValue(2),
+		"max(`k`)":                   value.MISSING_VALUE,
+		"variance()":                 variance,
+		"median(`k`)":                median,
+		"approx_count_distinct(`k`)": approx,
+	})
+
+	data, err := encodeSpill(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aggregates, ok := decodeSpill(data).GetAttachment("aggregates").(map[string]value.Value)
+	if !ok || len(aggregates) != 5 {
+		t.Fatalf("unexpected aggregates %v", aggregates)
+	}
+	if aggregates["count(*)"].String() != "2" || aggregates["max(`k`)"].Type() != value.MISSING {
+		t.Errorf("unexpected aggregates %v", aggregates)
+	}
+
+	v, ok := aggregates["variance()"].(value.AnnotatedValue)
+	if !ok || v.String() != `{"count":2}` {
+		t.Fatalf("unexpected variance %v", aggregates["variance()"])
+	}
+	if sum, ok := v.GetAttachment("sum").(value.NumberValue); !ok || sum.Float64() != 7.5 {
+		t.Errorf("unexpected sum %v", v.GetAttachment("sum"))
+	}
+	if s, ok := v.GetAttachment("set").(*value.Set); !ok || s.Len() != 2 || !s.Has(value.NewValue("two")) {
+		t.Errorf("unexpected set %v", v.GetAttachment("set"))
+	}
+
+	m, ok := aggregates["median(`k`)"].(value.AnnotatedValue)
+	if !ok || m.Type() != value.NULL {
+		t.Fatalf("unexpected median %v", aggregates["median(`k`)"])
+	}
+	if l, ok := m.GetAttachment("list").(*value.List); !ok || l.Len() != 2 || l.ItemAt(1).String() != "4" {
+		t.Errorf("unexpected list %v", m.GetAttachment("list"))
+	}
+
+	// sketches are read back in their binary encoding
+	a, ok := aggregates["approx_count_distinct(`k`)"].(value.AnnotatedValue)
+	if !ok {
+		t.Fatalf("unexpected approx_count_distinct %v", aggregates["approx_count_distinct(`k`)"])
+	}
+	enc, ok := a.GetAttachment("hll").(value.Value)
+	if !ok || enc.Type() != value.STRING {
+		t.Fatalf("unexpected sketch %v", a.GetAttachment("hll"))
+	}
+	data, _ = base64.StdEncoding.DecodeString(enc.ToString())
+	hll = &util.HyperLogLog{}
+	if err := hll.UnmarshalBinary(data); err != nil || hll.Count() != 2 {
+		t.Errorf("unexpected sketch %v %v", enc, err)
+	}
+}
@@ -0,0 +1,95 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"encoding/json"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/plan"
+	"github.com/couchbase/query/scheduler"
+	"github.com/couchbase/query/value"
+)
+
+type AlterTask struct {
+	base
+	plan *plan.AlterTask
+}
+
+func NewAlterTask(plan *plan.AlterTask, context *Context) *AlterTask {
+	rv := &AlterTask{
+		plan: plan,
+	}
+
+	newRedirectBase(&rv.base)
+	rv.output = rv
+	return rv
+}
+
+func (this *AlterTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitAlterTask(this)
+}
+
+func (this *AlterTask) Copy() Operator {
+	rv := &AlterTask{plan: this.plan}
+	this.base.copy(&rv.base)
+	return rv
+}
+
+func (this *AlterTask) PlanOp() plan.Operator {
+	return this.plan
+}
+
+func (this *AlterTask) RunOnce(context *Context, parent value.Value) {
+	this.once.Do(func() {
+		defer context.Recover(&this.base) // Recover from any panic
+		active := this.active()
+		defer this.close(context)
+		this.switchPhase(_EXECTIME)
+		defer this.switchPhase(_NOTIME)
+		defer this.notify() // Notify that I have stopped
+
+		if !active || context.Readonly() {
+			return
+		}
+
+		id, err := scheduler.TaskId(this.plan.Name(), _TASK_CLASS, _TASK_SUBCLASS)
+		if err != nil {
+			context.Error(err)
+			return
+		}
+		if !taskExists(id) {
+			context.Error(errors.NewTaskNotFoundError(this.plan.Name()))
+			return
+		}
+		err = authorizeTask(context, id, this.plan.Name(), "altered")
+		if err != nil {
+			context.Error(err)
+			return
+		}
+
+		this.switchPhase(_SERVTIME)
+		if this.plan.Pause() {
+			err = scheduler.PauseTask(id)
+		} else {
+			err = scheduler.ResumeTask(id)
+		}
+		this.switchPhase(_EXECTIME)
+		if err != nil {
+			context.Error(err)
+		}
+	})
+}
+
+func (this *AlterTask) MarshalJSON() ([]byte, error) {
+	r := this.plan.MarshalBase(func(r map[string]interface{}) {
+		this.marshalTimes(r)
+	})
+	return json.Marshal(r)
+}
@@ -0,0 +1,189 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/plan"
+	"github.com/couchbase/query/scheduler"
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+// user tasks in system:tasks_cache
+const (
+	_TASK_CLASS    = "task"
+	_TASK_SUBCLASS = "statement"
+)
+
+type CreateTask struct {
+	base
+	plan *plan.CreateTask
+}
+
+func NewCreateTask(plan *plan.CreateTask, context *Context) *CreateTask {
+	rv := &CreateTask{
+		plan: plan,
+	}
+
+	newRedirectBase(&rv.base)
+	rv.output = rv
+	return rv
+}
+
+func (this *CreateTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitCreateTask(this)
+}
+
+func (this *CreateTask) Copy() Operator {
+	rv := &CreateTask{plan: this.plan}
+	this.base.copy(&rv.base)
+	return rv
+}
+
+func (this *CreateTask) PlanOp() plan.Operator {
+	return this.plan
+}
+
+func (this *CreateTask) RunOnce(context *Context, parent value.Value) {
+	this.once.Do(func() {
+		defer context.Recover(&this.base) // Recover from any panic
+		active := this.active()
+		defer this.close(context)
+		this.switchPhase(_EXECTIME)
+		defer this.switchPhase(_NOTIME)
+		defer this.notify() // Notify that I have stopped
+
+		if !active || context.Readonly() {
+			return
+		}
+
+		schedule, err := scheduler.ParseSchedule(this.plan.Schedule())
+		if err != nil {
+			context.Error(err)
+			return
+		}
+
+		id, err := scheduler.TaskId(this.plan.Name(), _TASK_CLASS, _TASK_SUBCLASS)
+		if err != nil {
+			context.Error(err)
+			return
+		}
+		if !this.plan.FailIfExists() && taskExists(id) {
+			return
+		}
+
+		// report statement errors now rather than at the first execution
+		taskContext := context.newTaskContext()
+		_, _, er := taskContext.PrepareStatement(this.plan.Text(), nil, nil, false, false, false)
+		if er != nil {
+			context.Error(errors.NewError(er, ""))
+			return
+		}
+
+		def := &taskDefinition{
+			Text:         this.plan.Text(),
+			Namespace:    context.namespace,
+			QueryContext: context.queryContext,
+		}
+		this.switchPhase(_SERVTIME)
+		err = scheduleTask(this.plan.Name(), schedule, def, taskContext)
+		this.switchPhase(_EXECTIME)
+		if err != nil {
+			context.Error(err)
+		}
+	})
+}
+
+func (this *CreateTask) MarshalJSON() ([]byte, error) {
+	r := this.plan.MarshalBase(func(r map[string]interface{}) {
+		this.marshalTimes(r)
+	})
+	return json.Marshal(r)
+}
+
+// what each execution of a task runs
+type taskDefinition struct {
+	Text         string
+	Namespace    string
+	QueryContext string
+}
+
+func scheduleTask(name string, schedule scheduler.Schedule, def *taskDefinition, context *Context) errors.Error {
+	return scheduler.ScheduleRecurringTask(name, _TASK_CLASS, _TASK_SUBCLASS, schedule, runTask, nil, def, context)
+}
+
+func runTask(context scheduler.Context, parms interface{}) (interface{}, []errors.Error) {
+	text := parms.(*taskDefinition).Text
+	res, mutations, err := context.(*Context).newTaskContext().EvaluateStatement(text, nil, nil, false, false)
+	if err != nil {
+		if e, ok := err.(errors.Error); ok {
+			return nil, []errors.Error{e}
+		}
+		return nil, []errors.Error{errors.NewError(err, "")}
+	}
+	return map[string]interface{}{
+		"results":       res,
+		"mutationCount": mutations,
+	}, nil
+}
+
+// Tasks outlive the request that creates them: every execution gets a fresh
+// context, with the credentials and query context of the creator, but no output
+// or transaction of the original request
+func (this *Context) newTaskContext() *Context {
+	rv := this.Copy()
+	rv.requestId, _ = util.UUIDV3()
+	rv.now = time.Now()
+	rv.queryContext = this.queryContext
+	rv.authenticatedUsers = this.authenticatedUsers
+	rv.output = &internalOutput{}
+	rv.httpRequest = nil
+	rv.deltaKeyspaces = nil
+	rv.txContext = nil
+	rv.txImplicit = false
+	rv.txData = nil
+	rv.txDataVal = nil
+	return rv
+}
+
+func taskExists(id string) bool {
+	found := false
+	scheduler.TaskDo(id, func(entry *scheduler.TaskEntry) {
+		found = true
+	})
+	return found
+}
+
+// Tasks run with the credentials of their creator, so only the creator can drop
+// or alter them, or somebody who can manage users, and so act as anybody
+func authorizeTask(context *Context, id, name, action string) errors.Error {
+	creator := false
+	scheduler.TaskDo(id, func(entry *scheduler.TaskEntry) {
+		creator = entry.CreatedBy(context.AuthenticatedUsers())
+	})
+	if creator {
+		return nil
+	}
+
+	ds := datastore.GetDatastore()
+	if ds != nil {
+		privs := auth.NewPrivileges()
+		privs.Add("", auth.PRIV_SECURITY_WRITE, auth.PRIV_PROPS_NONE)
+		if _, err := ds.Authorize(privs, context.Credentials()); err == nil {
+			return nil
+		}
+	}
+	return errors.NewTaskOwnerError(name, action)
+}
@@ -0,0 +1,94 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"encoding/json"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/plan"
+	"github.com/couchbase/query/scheduler"
+	"github.com/couchbase/query/value"
+)
+
+type DropTask struct {
+	base
+	plan *plan.DropTask
+}
+
+func NewDropTask(plan *plan.DropTask, context *Context) *DropTask {
+	rv := &DropTask{
+		plan: plan,
+	}
+
+	newRedirectBase(&rv.base)
+	rv.output = rv
+	return rv
+}
+
+func (this *DropTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitDropTask(this)
+}
+
+func (this *DropTask) Copy() Operator {
+	rv := &DropTask{plan: this.plan}
+	this.base.copy(&rv.base)
+	return rv
+}
+
+func (this *DropTask) PlanOp() plan.Operator {
+	return this.plan
+}
+
+func (this *DropTask) RunOnce(context *Context, parent value.Value) {
+	this.once.Do(func() {
+		defer context.Recover(&this.base) // Recover from any panic
+		active := this.active()
+		defer this.close(context)
+		this.switchPhase(_EXECTIME)
+		defer this.switchPhase(_NOTIME)
+		defer this.notify() // Notify that I have stopped
+
+		if !active || context.Readonly() {
+			return
+		}
+
+		id, err := scheduler.TaskId(this.plan.Name(), _TASK_CLASS, _TASK_SUBCLASS)
+		if err != nil {
+			context.Error(err)
+			return
+		}
+		if !taskExists(id) {
+			if this.plan.FailIfNotExists() {
+				context.Error(errors.NewTaskNotFoundError(this.plan.Name()))
+			}
+			return
+		}
+		err = authorizeTask(context, id, this.plan.Name(), "dropped")
+		if err != nil {
+			context.Error(err)
+			return
+		}
+
+		// Actually drop task
+		this.switchPhase(_SERVTIME)
+		err = scheduler.DeleteTask(id)
+		this.switchPhase(_EXECTIME)
+		if err != nil {
+			context.Error(err)
+		}
+	})
+}
+
+func (this *DropTask) MarshalJSON() ([]byte, error) {
+	r := this.plan.MarshalBase(func(r map[string]interface{}) {
+		this.marshalTimes(r)
+	})
+	return json.Marshal(r)
+}
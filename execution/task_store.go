@@ -0,0 +1,303 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	atomic "github.com/couchbase/go-couchbase/platform"
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/logging"
+	"github.com/couchbase/query/scheduler"
+)
+
+// Optional on disk store for user tasks, so that CREATE TASK survives a restart.
+//
+// The store is a single file with one task per line, each line being the CRC32
+// of the record followed by the record in JSON, in the same format as the
+// prepared statements store.
+// Each record holds the definition of the task, whether it is paused, and its
+// execution history. Restored tasks run as the users who created them: their
+// privileges are checked at each execution, but their passwords are not kept.
+// The file is rewritten in the background when tasks have changed.
+
+const (
+	_TASK_STORE_FILE     = "tasks.json"
+	_TASK_STORE_INTERVAL = 10 * time.Second
+)
+
+type taskRecord struct {
+	Name          string            `json:"name"`
+	Schedule      string            `json:"schedule"`
+	Text          string            `json:"text"`
+	Namespace     string            `json:"namespace"`
+	QueryContext  string            `json:"queryContext,omitempty"`
+	Users         []string          `json:"users,omitempty"`
+	Paused        bool              `json:"paused,omitempty"`
+	PostTime      time.Time         `json:"postTime"`
+	Runs          int               `json:"runs"`
+	History       []*taskRunRecord  `json:"history,omitempty"`
+	LastError     []json.RawMessage `json:"lastError,omitempty"`
+	LastErrorTime time.Time         `json:"lastErrorTime"`
+}
+
+type taskRunRecord struct {
+	StartTime time.Time         `json:"startTime"`
+	EndTime   time.Time         `json:"stopTime"`
+	Errors    []json.RawMessage `json:"errors,omitempty"`
+}
+
+// creates the contexts restored tasks run in
+type TaskContextFactory func(namespace, queryContext string, credentials *auth.Credentials) *Context
+
+type taskStore struct {
+	path       string
+	newContext TaskContextFactory
+	dirty      int32
+}
+
+// load the tasks saved by a previous incarnation, and start saving tasks to dir
+func TasksPersistInit(dir string, newContext TaskContextFactory) errors.Error {
+	if dir == "" {
+		return nil
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return errors.NewTaskStoreError("create", dir, err)
+	}
+	this := &taskStore{path: filepath.Join(dir, _TASK_STORE_FILE), newContext: newContext}
+	this.load()
+	scheduler.SetRecurringChanged(this.changed)
+	go this.flusher()
+
+	// rewrite the store with just the tasks that could be restored
+	this.changed()
+	return nil
+}
+
+// flag that the tasks need to be saved
+func (this *taskStore) changed() {
+	atomic.StoreInt32(&this.dirty, 1)
+}
+
+func (this *taskStore) flusher() {
+	ticker := time.NewTicker(_TASK_STORE_INTERVAL)
+	defer ticker.Stop()
+	for range ticker.C {
+		if atomic.CompareAndSwapInt32(&this.dirty, 1, 0) {
+			if err := this.save(); err != nil {
+				logging.Errorf("Tasks store: %v", err)
+
+				// try again next time round
+				atomic.StoreInt32(&this.dirty, 1)
+			}
+		}
+	}
+}
+
+func (this *taskStore) load() {
+	f, err := os.Open(this.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Errorf("Tasks store: cannot open %v: %v", this.path, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	loaded := 0
+	corrupted := 0
+	failed := 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			rec, ok := readTaskRecord(line)
+			if !ok {
+				corrupted++
+			} else if err1 := this.restore(rec); err1 != nil {
+				failed++
+				logging.Infof("Tasks store: cannot restore <ud>%v</ud>: %v", rec.Name, err1)
+			} else {
+				loaded++
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				logging.Errorf("Tasks store: error reading %v: %v", this.path, err)
+			}
+			break
+		}
+	}
+	if corrupted > 0 {
+		logging.Errorf("Tasks store: skipped %v corrupted entries in %v", corrupted, this.path)
+	}
+	logging.Infof("Tasks store: restored %v tasks, %v failed", loaded, failed)
+}
+
+func (this *taskStore) restore(rec *taskRecord) errors.Error {
+	schedule, err := scheduler.ParseSchedule(rec.Schedule)
+	if err != nil {
+		return err
+	}
+	id, err := scheduler.TaskId(rec.Name, _TASK_CLASS, _TASK_SUBCLASS)
+	if err != nil {
+		return err
+	}
+
+	// the users were authenticated when the task was created
+	creds := auth.NewCredentials()
+	if len(rec.Users) > 0 {
+		creds.AuthenticatedUsers = auth.AuthenticatedUsers(rec.Users)
+	}
+	context := this.newContext(rec.Namespace, rec.QueryContext, creds)
+	context.authenticatedUsers = rec.Users
+
+	def := &taskDefinition{Text: rec.Text, Namespace: rec.Namespace, QueryContext: rec.QueryContext}
+	err = scheduleTask(rec.Name, schedule, def, context)
+	if err != nil {
+		return err
+	}
+	if rec.Paused {
+		err = scheduler.PauseTask(id)
+		if err != nil {
+			return err
+		}
+	}
+	history := make([]*scheduler.TaskRun, 0, len(rec.History))
+	for _, run := range rec.History {
+		history = append(history, &scheduler.TaskRun{StartTime: run.StartTime, EndTime: run.EndTime,
+			Errors: decodeErrors(run.Errors)})
+	}
+	return scheduler.RestoreTaskHistory(id, rec.PostTime, rec.Runs, history, decodeErrors(rec.LastError),
+		rec.LastErrorTime)
+}
+
+func (this *taskStore) save() error {
+	records := make([]*taskRecord, 0, 16)
+	scheduler.TasksForeach(func(id string, entry *scheduler.TaskEntry) bool {
+		def, ok := entry.Parameters().(*taskDefinition)
+		if ok && entry.Class == _TASK_CLASS && entry.SubClass == _TASK_SUBCLASS && entry.Schedule != nil {
+			records = append(records, newTaskRecord(entry, def))
+		}
+		return true
+	}, nil)
+
+	tmp := this.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	for _, rec := range records {
+		line, err := writeTaskRecord(rec)
+		if err != nil {
+			logging.Infof("Tasks store: cannot save <ud>%v</ud>: %v", rec.Name, err)
+			continue
+		}
+		writer.Write(line)
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmp, this.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// called with the entry locked
+func newTaskRecord(entry *scheduler.TaskEntry, def *taskDefinition) *taskRecord {
+	rec := &taskRecord{
+		Name:          entry.Name,
+		Schedule:      entry.Schedule.String(),
+		Text:          def.Text,
+		Namespace:     def.Namespace,
+		QueryContext:  def.QueryContext,
+		Users:         entry.Users,
+		Paused:        entry.Paused(),
+		PostTime:      entry.PostTime,
+		Runs:          entry.Runs,
+		LastError:     encodeErrors(entry.LastError),
+		LastErrorTime: entry.LastErrorTime,
+	}
+	for _, run := range entry.History {
+		rec.History = append(rec.History, &taskRunRecord{StartTime: run.StartTime, EndTime: run.EndTime,
+			Errors: encodeErrors(run.Errors)})
+	}
+	return rec
+}
+
+func encodeErrors(errs []errors.Error) []json.RawMessage {
+	var rv []json.RawMessage
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		data, er := json.Marshal(err)
+		if er == nil {
+			rv = append(rv, data)
+		}
+	}
+	return rv
+}
+
+func decodeErrors(data []json.RawMessage) []errors.Error {
+	var rv []errors.Error
+	for _, d := range data {
+		err := errors.NewError(nil, "")
+		if json.Unmarshal(d, err) == nil {
+			rv = append(rv, err)
+		}
+	}
+	return rv
+}
+
+func writeTaskRecord(rec *taskRecord) ([]byte, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, 0, len(data)+10)
+	line = append(line, fmt.Sprintf("%08x ", crc32.ChecksumIEEE(data))...)
+	line = append(line, data...)
+	return append(line, '\n'), nil
+}
+
+func readTaskRecord(line []byte) (*taskRecord, bool) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) < 10 || line[8] != ' ' {
+		return nil, false
+	}
+	crc, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil || uint32(crc) != crc32.ChecksumIEEE(line[9:]) {
+		return nil, false
+	}
+	rec := &taskRecord{}
+	if json.Unmarshal(line[9:], rec) != nil || rec.Name == "" || rec.Text == "" || rec.Schedule == "" {
+		return nil, false
+	}
+	return rec, true
+}
@@ -0,0 +1,135 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/scheduler"
+)
+
+// only authorizes administrators
+type adminDatastore struct {
+	datastore.Datastore
+	admins map[string]bool
+}
+
+func (this *adminDatastore) Authorize(privs *auth.Privileges, creds *auth.Credentials) (auth.AuthenticatedUsers, errors.Error) {
+	for user := range creds.Users {
+		if this.admins[user] {
+			return auth.AuthenticatedUsers{"local:" + user}, nil
+		}
+	}
+	return nil, errors.NewDatastoreInsufficientCredentials("not an administrator")
+}
+
+func TestTaskOwner(t *testing.T) {
+	oldStore := datastore.GetDatastore()
+	datastore.SetDatastore(&adminDatastore{admins: map[string]bool{"carol": true}})
+	defer datastore.SetDatastore(oldStore)
+
+	userContext := func(user string) *Context {
+		creds := auth.NewCredentials()
+		creds.Users[user] = "secret"
+		return &Context{credentials: creds, authenticatedUsers: []string{"local:" + user}}
+	}
+
+	schedule, _ := scheduler.ParseSchedule("@every 1h")
+	exec := func(context scheduler.Context, parms interface{}) (interface{}, []errors.Error) {
+		return nil, nil
+	}
+	err := scheduler.ScheduleRecurringTask("owned", _TASK_CLASS, _TASK_SUBCLASS, schedule, exec, nil, nil, userContext("alice"))
+	if err != nil {
+		t.Fatalf("failed to schedule task: %v", err)
+	}
+	id, _ := scheduler.TaskId("owned", _TASK_CLASS, _TASK_SUBCLASS)
+	defer scheduler.DeleteTask(id)
+
+	if err = authorizeTask(userContext("bob"), id, "owned", "dropped"); err == nil || err.Code() != 6008 {
+		t.Errorf("expected bob not to drop the task of alice, got %v", err)
+	}
+	if err = authorizeTask(userContext("alice"), id, "owned", "dropped"); err != nil {
+		t.Errorf("expected the creator to drop the task, got %v", err)
+	}
+	if err = authorizeTask(userContext("carol"), id, "owned", "altered"); err != nil {
+		t.Errorf("expected an administrator to alter the task, got %v", err)
+	}
+}
+
+func TestTaskStore(t *testing.T) {
+	dir, er := ioutil.TempDir("", "tasks")
+	if er != nil {
+		t.Fatalf("failed to create directory: %v", er)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &taskStore{path: filepath.Join(dir, _TASK_STORE_FILE),
+		newContext: func(namespace, queryContext string, credentials *auth.Credentials) *Context {
+			return &Context{credentials: credentials, namespace: namespace, queryContext: queryContext}
+		}}
+
+	schedule, _ := scheduler.ParseSchedule("@every 1h")
+	def := &taskDefinition{Text: "DELETE FROM orders WHERE expired", Namespace: "default", QueryContext: "default:shop"}
+	context := &Context{authenticatedUsers: []string{"local:alice"}}
+	err := scheduleTask("stored", schedule, def, context)
+	if err != nil {
+		t.Fatalf("failed to schedule task: %v", err)
+	}
+	id, _ := scheduler.TaskId("stored", _TASK_CLASS, _TASK_SUBCLASS)
+	defer scheduler.DeleteTask(id)
+
+	postTime := time.Now().Add(-time.Hour).Round(time.Second)
+	history := []*scheduler.TaskRun{{StartTime: postTime, EndTime: postTime.Add(time.Second),
+		Errors: []errors.Error{errors.NewTaskOwnerError("stored", "run")}}}
+	if err = scheduler.RestoreTaskHistory(id, postTime, 3, history, history[0].Errors, postTime); err != nil {
+		t.Fatalf("failed to set history: %v", err)
+	}
+	if err = scheduler.PauseTask(id); err != nil {
+		t.Fatalf("failed to pause task: %v", err)
+	}
+	if er = store.save(); er != nil {
+		t.Fatalf("failed to save tasks: %v", er)
+	}
+
+	// restart
+	if err = scheduler.DeleteTask(id); err != nil {
+		t.Fatalf("failed to drop task: %v", err)
+	}
+	store.load()
+
+	found := false
+	scheduler.TaskDo(id, func(entry *scheduler.TaskEntry) {
+		found = true
+		restored, _ := entry.Parameters().(*taskDefinition)
+		if restored == nil || *restored != *def {
+			t.Errorf("expected definition %v, got %v", def, restored)
+		}
+		if entry.Schedule.String() != schedule.String() || !entry.Paused() {
+			t.Errorf("expected paused task with schedule %v, got %v %v", schedule, entry.Schedule, entry.State)
+		}
+		if len(entry.Users) != 1 || entry.Users[0] != "local:alice" {
+			t.Errorf("expected task to belong to alice, got %v", entry.Users)
+		}
+		if !entry.PostTime.Equal(postTime) || entry.Runs != 3 || len(entry.History) != 1 ||
+			len(entry.History[0].Errors) != 1 || entry.History[0].Errors[0].Code() != 6008 ||
+			len(entry.LastError) != 1 || !entry.LastErrorTime.Equal(postTime) {
+			t.Errorf("history not restored: %v runs, %v, last error %v", entry.Runs, entry.History, entry.LastError)
+		}
+	})
+	if !found {
+		t.Fatalf("task not restored")
+	}
+}
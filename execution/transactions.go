@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/couchbase/query/changefeed"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/plan"
@@ -188,10 +189,12 @@ func (this *CommitTransaction) RunOnce(context *Context, parent value.Value) {
 		}
 
 		// Commit transaction
+		txId := context.txContext.TxId()
 		if err := context.datastore.CommitTransaction(false, context); err != nil {
 			context.Error(err)
 			return
 		}
+		changefeed.Commit(txId)
 	})
 }
 
@@ -257,10 +260,12 @@ func (this *RollbackTransaction) RunOnce(context *Context, parent value.Value) {
 		}
 
 		// Rollback transaction
+		txId := context.txContext.TxId()
 		if err := context.datastore.RollbackTransaction(false, context, this.plan.Savepoint()); err != nil {
 			context.Error(err)
 			return
 		}
+		changefeed.Rollback(txId, this.plan.Savepoint())
 
 	})
 }
@@ -397,6 +402,7 @@ func (this *Savepoint) RunOnce(context *Context, parent value.Value) {
 			context.Error(err)
 			return
 		}
+		changefeed.Savepoint(context.txContext.TxId(), this.plan.Savepoint())
 	})
 }
 
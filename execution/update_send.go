@@ -14,6 +14,7 @@ import (
 	"math"
 	"time"
 
+	"github.com/couchbase/query/changefeed"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/plan"
@@ -129,6 +130,12 @@ func (this *SendUpdate) flushBatch(context *Context) bool {
 		pairs = make([]value.Pair, 0, len(this.batch))
 	}
 
+	// the documents before the update, for the change feed
+	var befores map[string]value.Value
+	if changesWanted(this.keyspace) {
+		befores = make(map[string]value.Value, len(this.batch))
+	}
+
 	for i, item := range this.batch {
 		uv, ok := item.Field(this.plan.Alias())
 		if !ok {
@@ -149,6 +156,9 @@ func (this *SendUpdate) flushBatch(context *Context) bool {
 
 		pairs = pairs[0 : i+1]
 		pairs[i].Name = key
+		if befores != nil {
+			befores[key] = av
+		}
 
 		var options value.Value
 
@@ -189,6 +199,10 @@ func (this *SendUpdate) flushBatch(context *Context) bool {
 
 	this.switchPhase(_EXECTIME)
 
+	if befores != nil {
+		publishChanges(context, this.keyspace, changefeed.UPDATE, pairs, befores)
+	}
+
 	// Update mutation count with number of updated docs
 	context.AddMutationCount(uint64(len(pairs)))
 
@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/couchbase/query/changefeed"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/plan"
@@ -158,12 +159,22 @@ func (this *SendUpsert) flushBatch(context *Context) bool {
 
 	this.switchPhase(_SERVTIME)
 
+	// the documents the upsert replaces, for the change feed
+	var befores map[string]value.Value
+	if changesWanted(this.keyspace) {
+		befores = fetchBefores(context, this.keyspace, dpairs)
+	}
+
 	// Perform the actual UPSERT
 	var er errors.Error
 	dpairs, er = this.keyspace.Upsert(dpairs, context)
 
 	this.switchPhase(_EXECTIME)
 
+	if befores != nil {
+		publishChanges(context, this.keyspace, changefeed.UPSERT, dpairs, befores)
+	}
+
 	// Update mutation count with number of upserted docs
 	context.AddMutationCount(uint64(len(dpairs)))
 
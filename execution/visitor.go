@@ -149,6 +149,11 @@ type Visitor interface {
 	VisitDropFunction(op *DropFunction) (interface{}, error)
 	VisitExecuteFunction(op *ExecuteFunction) (interface{}, error)
 
+	// Tasks
+	VisitCreateTask(op *CreateTask) (interface{}, error)
+	VisitDropTask(op *DropTask) (interface{}, error)
+	VisitAlterTask(op *AlterTask) (interface{}, error)
+
 	// Index Advisor
 	VisitIndexAdvice(op *IndexAdvice) (interface{}, error)
 	VisitAdvise(op *Advise) (interface{}, error)
@@ -76,8 +76,26 @@ func (this *With) RunOnce(context *Context, parent value.Value) {
 			wv = value.NewAnnotatedValue(make(map[string]interface{}, 1))
 		}
 
+		recursive := this.plan.Recursive()
 		for _, b := range this.plan.Bindings() {
-			v, e := b.Expression().Evaluate(wv, context)
+			var v value.Value
+			var e error
+
+			if rw := recursive.Get(b.Variable()); rw != nil && rw.IsRecursive() {
+				var err errors.Error
+
+				v, err = this.evaluateRecursive(rw, wv, context)
+				if err != nil {
+					context.Error(err)
+					this.notify()
+
+					// the child still has to start, but must not produce anything
+					this.child.SendAction(_ACTION_STOP)
+					break
+				}
+			} else {
+				v, e = b.Expression().Evaluate(wv, context)
+			}
 			if e != nil {
 				context.Error(errors.NewEvaluationError(e, "WITH"))
 				this.notify()
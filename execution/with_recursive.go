@@ -0,0 +1,168 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package execution
+
+import (
+	"fmt"
+
+	atomic "github.com/couchbase/go-couchbase/platform"
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/value"
+)
+
+// Recursive WITH terms.
+//
+// The anchor runs once, then the recursive part runs with the term bound to
+// the documents produced by the previous iteration, until it produces none.
+// Documents are dropped if they have been produced before (UNION) or if their
+// CYCLE expressions have been seen before. OPTIONS {"levels": n} stops after
+// n iterations and OPTIONS {"documents": n} after n documents, while more
+// than the server wide maximum number of iterations is an error.
+
+const _DEF_MAX_RECURSION = 1000
+
+var maxRecursion atomic.AlignedInt64 = atomic.NewAlignedInt64(_DEF_MAX_RECURSION)
+
+// the maximum number of iterations of a recursive WITH term, 0 for no limit
+func SetMaxRecursion(max int) {
+	atomic.StoreInt64(&maxRecursion, int64(max))
+}
+
+func GetMaxRecursion() int {
+	return int(atomic.LoadInt64(&maxRecursion))
+}
+
+func (this *With) evaluateRecursive(rw *algebra.RecursiveWith, wv value.AnnotatedValue,
+	context *Context) (value.Value, errors.Error) {
+
+	levels, documents, err := recursiveOptions(rw, wv, context)
+	if err != nil {
+		return nil, err
+	}
+
+	var seen map[string]bool
+	if rw.Distinct() || rw.Cycle() != nil {
+		seen = make(map[string]bool, 1024)
+	}
+
+	v, e := context.EvaluateSubquery(rw.Anchor(), wv)
+	if e != nil {
+		return nil, errors.NewEvaluationError(e, "WITH")
+	}
+	working, err := restrict(rw, v, seen, context)
+	if err != nil {
+		return nil, err
+	}
+
+	// the term is bound for the recursive part only, and never leaks to the caller
+	rwv := value.NewAnnotatedValue(wv.Copy())
+	max := GetMaxRecursion()
+	rv := make([]interface{}, 0, len(working))
+	for level := 0; len(working) > 0; level++ {
+		if documents >= 0 && len(rv)+len(working) >= documents {
+			rv = append(rv, working[:documents-len(rv)]...)
+			break
+		}
+		rv = append(rv, working...)
+
+		if levels >= 0 && level >= levels {
+			break
+		}
+		if max > 0 && level >= max {
+			return nil, errors.NewRecursionLimitError(rw.Variable(), max)
+		}
+
+		rwv.SetField(rw.Variable(), working)
+		v, e = context.EvaluateSubquery(rw.Recursive(), rwv)
+		if e != nil {
+			return nil, errors.NewEvaluationError(e, "WITH")
+		}
+		working, err = restrict(rw, v, seen, context)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return value.NewValue(rv), nil
+}
+
+// the levels and documents options, -1 if not set
+func recursiveOptions(rw *algebra.RecursiveWith, wv value.AnnotatedValue,
+	context *Context) (levels, documents int, err errors.Error) {
+
+	levels = -1
+	documents = -1
+	if rw.Options() == nil {
+		return
+	}
+
+	options, e := rw.Options().Evaluate(wv, context)
+	if e != nil {
+		return -1, -1, errors.NewEvaluationError(e, "WITH OPTIONS")
+	}
+	if options.Type() != value.OBJECT {
+		return -1, -1, errors.NewRecursiveWithOptionsError(rw.Variable(), "not an object")
+	}
+
+	for n, o := range options.Fields() {
+		val := value.NewValue(o)
+		limit, ok := value.IsIntValue(val)
+		if !ok || limit < 0 {
+			return -1, -1, errors.NewRecursiveWithOptionsError(rw.Variable(),
+				fmt.Sprintf("%s must be a non negative integer", n))
+		}
+		switch n {
+		case "levels":
+			levels = int(limit)
+		case "documents":
+			documents = int(limit)
+		default:
+			return -1, -1, errors.NewRecursiveWithOptionsError(rw.Variable(), fmt.Sprintf("unknown option %s", n))
+		}
+	}
+	return
+}
+
+// drop the documents of an iteration that have been seen before
+func restrict(rw *algebra.RecursiveWith, v value.Value, seen map[string]bool,
+	context *Context) ([]interface{}, errors.Error) {
+
+	docs, ok := v.Actual().([]interface{})
+	if !ok || seen == nil {
+		return docs, nil
+	}
+
+	rv := make([]interface{}, 0, len(docs))
+	for _, d := range docs {
+		doc := value.NewValue(d)
+		key := doc
+		if cycle := rw.Cycle(); cycle != nil {
+			vals := make([]interface{}, len(cycle))
+			for i, c := range cycle {
+				val, e := c.Evaluate(doc, context)
+				if e != nil {
+					return nil, errors.NewEvaluationError(e, "WITH CYCLE")
+				}
+				vals[i] = val
+			}
+			key = value.NewValue(vals)
+		}
+
+		bytes, e := key.MarshalJSON()
+		if e != nil {
+			return nil, errors.NewEvaluationError(e, "WITH")
+		}
+		if !seen[string(bytes)] {
+			seen[string(bytes)] = true
+			rv = append(rv, d)
+		}
+	}
+	return rv, nil
+}
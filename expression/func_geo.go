@@ -0,0 +1,790 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package expression
+
+import (
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+/*
+Implemented by the geospatial predicates that are only true for
+geometries inside a bounding box that depends on their other
+arguments, so that they can be evaluated with a scan of a
+GEOHASH_ENCODE() index key.
+*/
+type GeoBoxFunction interface {
+	Function
+
+	/*
+	   The geometry argument.
+	*/
+	Geometry() Expression
+
+	/*
+	   The bounding box [minLon, minLat, maxLon, maxLat] given by the
+	   constant values of the other arguments, if they have them.
+	*/
+	BoundingBox() ([4]float64, bool)
+}
+
+///////////////////////////////////////////////////
+//
+// STPoint
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_POINT(lon, lat). It
+returns a GeoJSON Point with the given longitude and latitude.
+*/
+type STPoint struct {
+	BinaryFunctionBase
+}
+
+func NewSTPoint(first, second Expression) Function {
+	rv := &STPoint{
+		*NewBinaryFunctionBase("st_point", first, second),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STPoint) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STPoint) Type() value.Type { return value.OBJECT }
+
+func (this *STPoint) Evaluate(item value.Value, context Context) (value.Value, error) {
+	first, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+	second, err := this.operands[1].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+
+	if first.Type() == value.MISSING || second.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	} else if first.Type() != value.NUMBER || second.Type() != value.NUMBER {
+		return value.NULL_VALUE, nil
+	}
+
+	lon := first.(value.NumberValue).Float64()
+	lat := second.(value.NumberValue).Float64()
+	if lon < -180.0 || lon > 180.0 || lat < -90.0 || lat > 90.0 {
+		return value.NULL_VALUE, nil
+	}
+	return geoPointValue(geoPoint{lon, lat}), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STPoint) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTPoint(operands[0], operands[1])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// STDistance
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_DISTANCE(geom1, geom2).
+It returns the shortest distance in meters between the GeoJSON
+geometries, which is 0 if they intersect.
+*/
+type STDistance struct {
+	BinaryFunctionBase
+}
+
+func NewSTDistance(first, second Expression) Function {
+	rv := &STDistance{
+		*NewBinaryFunctionBase("st_distance", first, second),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STDistance) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STDistance) Type() value.Type { return value.NUMBER }
+
+func (this *STDistance) Evaluate(item value.Value, context Context) (value.Value, error) {
+	first, second, rv, err := evaluateGeometries(this.operands, item, context)
+	if rv != nil || err != nil {
+		return rv, err
+	}
+	return value.NewValue(first.distance(second)), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STDistance) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTDistance(operands[0], operands[1])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// STContains
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_CONTAINS(geom1, geom2).
+It returns true if the GeoJSON geometry geom2 lies entirely inside
+or on the boundary of geom1.
+*/
+type STContains struct {
+	BinaryFunctionBase
+}
+
+func NewSTContains(first, second Expression) Function {
+	rv := &STContains{
+		*NewBinaryFunctionBase("st_contains", first, second),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STContains) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STContains) Type() value.Type { return value.BOOLEAN }
+
+func (this *STContains) Evaluate(item value.Value, context Context) (value.Value, error) {
+	first, second, rv, err := evaluateGeometries(this.operands, item, context)
+	if rv != nil || err != nil {
+		return rv, err
+	}
+	return value.NewValue(first.contains(second)), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STContains) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTContains(operands[0], operands[1])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// STWithin
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_WITHIN(geom1, geom2).
+It returns true if the GeoJSON geometry geom1 lies entirely inside
+or on the boundary of geom2, that is ST_CONTAINS(geom2, geom1).
+*/
+type STWithin struct {
+	BinaryFunctionBase
+}
+
+func NewSTWithin(first, second Expression) Function {
+	rv := &STWithin{
+		*NewBinaryFunctionBase("st_within", first, second),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STWithin) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STWithin) Type() value.Type { return value.BOOLEAN }
+
+func (this *STWithin) Evaluate(item value.Value, context Context) (value.Value, error) {
+	first, second, rv, err := evaluateGeometries(this.operands, item, context)
+	if rv != nil || err != nil {
+		return rv, err
+	}
+	return value.NewValue(second.contains(first)), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STWithin) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTWithin(operands[0], operands[1])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// STIntersects
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_INTERSECTS(geom1, geom2).
+It returns true if the GeoJSON geometries have any point in common.
+*/
+type STIntersects struct {
+	BinaryFunctionBase
+}
+
+func NewSTIntersects(first, second Expression) Function {
+	rv := &STIntersects{
+		*NewBinaryFunctionBase("st_intersects", first, second),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STIntersects) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STIntersects) Type() value.Type { return value.BOOLEAN }
+
+func (this *STIntersects) Evaluate(item value.Value, context Context) (value.Value, error) {
+	first, second, rv, err := evaluateGeometries(this.operands, item, context)
+	if rv != nil || err != nil {
+		return rv, err
+	}
+	return value.NewValue(first.intersects(second)), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STIntersects) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTIntersects(operands[0], operands[1])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// STWithinRadius
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_WITHIN_RADIUS(geom,
+center, radius). It returns true if all the points of the GeoJSON
+geometry geom are within radius meters of the GeoJSON Point center.
+*/
+type STWithinRadius struct {
+	TernaryFunctionBase
+}
+
+func NewSTWithinRadius(first, second, third Expression) Function {
+	rv := &STWithinRadius{
+		*NewTernaryFunctionBase("st_within_radius", first, second, third),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STWithinRadius) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STWithinRadius) Type() value.Type { return value.BOOLEAN }
+
+func (this *STWithinRadius) Evaluate(item value.Value, context Context) (value.Value, error) {
+	geom, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+	center, err := this.operands[1].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+	radius, err := this.operands[2].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+
+	if geom.Type() == value.MISSING || center.Type() == value.MISSING || radius.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	}
+
+	g := newGeometry(geom)
+	c, ok := newGeoPoint(center)
+	if g == nil || !ok || radius.Type() != value.NUMBER {
+		return value.NULL_VALUE, nil
+	}
+	r := radius.(value.NumberValue).Float64()
+	if r < 0.0 {
+		return value.NULL_VALUE, nil
+	}
+
+	for _, p := range g.vertices() {
+		if geoDistance(p, c) > r {
+			return value.FALSE_VALUE, nil
+		}
+	}
+	return value.TRUE_VALUE, nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STWithinRadius) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTWithinRadius(operands[0], operands[1], operands[2])
+	}
+}
+
+func (this *STWithinRadius) Geometry() Expression {
+	return this.operands[0]
+}
+
+func (this *STWithinRadius) BoundingBox() ([4]float64, bool) {
+	center := this.operands[1].Value()
+	radius := this.operands[2].Value()
+	if center == nil || radius == nil || radius.Type() != value.NUMBER {
+		return [4]float64{}, false
+	}
+
+	c, ok := newGeoPoint(center)
+	r := radius.(value.NumberValue).Float64()
+	if !ok || r < 0.0 {
+		return [4]float64{}, false
+	}
+	return geoRadiusBox(c, r), true
+}
+
+///////////////////////////////////////////////////
+//
+// STWithinBox
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_WITHIN_BOX(geom, box).
+It returns true if all the points of the GeoJSON geometry geom are
+in the bounding box [minLon, minLat, maxLon, maxLat], which crosses
+the antimeridian if minLon > maxLon.
+*/
+type STWithinBox struct {
+	BinaryFunctionBase
+}
+
+func NewSTWithinBox(first, second Expression) Function {
+	rv := &STWithinBox{
+		*NewBinaryFunctionBase("st_within_box", first, second),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STWithinBox) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STWithinBox) Type() value.Type { return value.BOOLEAN }
+
+func (this *STWithinBox) Evaluate(item value.Value, context Context) (value.Value, error) {
+	geom, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+	box, err := this.operands[1].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+
+	if geom.Type() == value.MISSING || box.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	}
+
+	g := newGeometry(geom)
+	b, ok := geoBox(box)
+	if g == nil || !ok {
+		return value.NULL_VALUE, nil
+	}
+
+	for _, p := range g.vertices() {
+		if !geoInBox(p, b) {
+			return value.FALSE_VALUE, nil
+		}
+	}
+	return value.TRUE_VALUE, nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STWithinBox) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTWithinBox(operands[0], operands[1])
+	}
+}
+
+func (this *STWithinBox) Geometry() Expression {
+	return this.operands[0]
+}
+
+func (this *STWithinBox) BoundingBox() ([4]float64, bool) {
+	box := this.operands[1].Value()
+	if box == nil {
+		return [4]float64{}, false
+	}
+	return geoBox(box)
+}
+
+///////////////////////////////////////////////////
+//
+// STBBox
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_BBOX(geom). It returns
+the bounding box [minLon, minLat, maxLon, maxLat] of the GeoJSON
+geometry geom.
+*/
+type STBBox struct {
+	UnaryFunctionBase
+}
+
+func NewSTBBox(operand Expression) Function {
+	rv := &STBBox{
+		*NewUnaryFunctionBase("st_bbox", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STBBox) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STBBox) Type() value.Type { return value.ARRAY }
+
+func (this *STBBox) Evaluate(item value.Value, context Context) (value.Value, error) {
+	arg, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	} else if arg.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	}
+
+	g := newGeometry(arg)
+	if g == nil {
+		return value.NULL_VALUE, nil
+	}
+	box := g.bbox()
+	return value.NewValue([]interface{}{box[0], box[1], box[2], box[3]}), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STBBox) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTBBox(operands[0])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// STEnvelope
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function ST_ENVELOPE(geom). It
+returns the bounding box of the GeoJSON geometry geom as a GeoJSON
+Polygon, or as a LineString or Point if the box is degenerate.
+*/
+type STEnvelope struct {
+	UnaryFunctionBase
+}
+
+func NewSTEnvelope(operand Expression) Function {
+	rv := &STEnvelope{
+		*NewUnaryFunctionBase("st_envelope", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *STEnvelope) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *STEnvelope) Type() value.Type { return value.OBJECT }
+
+func (this *STEnvelope) Evaluate(item value.Value, context Context) (value.Value, error) {
+	arg, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	} else if arg.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	}
+
+	g := newGeometry(arg)
+	if g == nil {
+		return value.NULL_VALUE, nil
+	}
+	return geoEnvelopeValue(g.bbox()), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *STEnvelope) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSTEnvelope(operands[0])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// GeohashEncode
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function GEOHASH_ENCODE(geom
+[, precision]). It returns the geohash of the given precision,
+from 1 to 12 and 12 by default, of the GeoJSON Point geom, or of
+the center of the bounding box of any other GeoJSON geometry.
+*/
+type GeohashEncode struct {
+	FunctionBase
+}
+
+func NewGeohashEncode(operands ...Expression) Function {
+	rv := &GeohashEncode{
+		*NewFunctionBase("geohash_encode", operands...),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *GeohashEncode) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *GeohashEncode) Type() value.Type { return value.STRING }
+
+func (this *GeohashEncode) Evaluate(item value.Value, context Context) (value.Value, error) {
+	geom, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+	precision := util.GEOHASH_MAX_PRECISION
+	if len(this.operands) > 1 {
+		prec, err := this.operands[1].Evaluate(item, context)
+		if err != nil {
+			return nil, err
+		} else if prec.Type() == value.MISSING {
+			return value.MISSING_VALUE, nil
+		}
+
+		var ok bool
+		precision, ok = geohashPrecision(prec)
+		if !ok {
+			return value.NULL_VALUE, nil
+		}
+	}
+
+	if geom.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	}
+
+	g := newGeometry(geom)
+	if g == nil {
+		return value.NULL_VALUE, nil
+	}
+	box := g.bbox()
+	return value.NewValue(util.GeohashEncode((box[0]+box[2])/2, (box[1]+box[3])/2, precision)), nil
+}
+
+/*
+Minimum input arguments required is 1.
+*/
+func (this *GeohashEncode) MinArgs() int { return 1 }
+
+/*
+Maximum input arguments allowed is 2.
+*/
+func (this *GeohashEncode) MaxArgs() int { return 2 }
+
+/*
+Factory method pattern.
+*/
+func (this *GeohashEncode) Constructor() FunctionConstructor {
+	return NewGeohashEncode
+}
+
+/*
+The constant precision of the geohashes.
+*/
+func (this *GeohashEncode) Precision() (int, bool) {
+	if len(this.operands) < 2 {
+		return util.GEOHASH_MAX_PRECISION, true
+	}
+	prec := this.operands[1].Value()
+	if prec == nil {
+		return 0, false
+	}
+	return geohashPrecision(prec)
+}
+
+func geohashPrecision(prec value.Value) (int, bool) {
+	if prec.Type() != value.NUMBER {
+		return 0, false
+	}
+	p, ok := value.IsIntValue(prec)
+	if !ok || p < 1 || p > util.GEOHASH_MAX_PRECISION {
+		return 0, false
+	}
+	return int(p), true
+}
+
+///////////////////////////////////////////////////
+//
+// GeohashDecode
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the geospatial function GEOHASH_DECODE(geohash).
+It returns the center of the cell named by geohash, as a GeoJSON
+Point.
+*/
+type GeohashDecode struct {
+	UnaryFunctionBase
+}
+
+func NewGeohashDecode(operand Expression) Function {
+	rv := &GeohashDecode{
+		*NewUnaryFunctionBase("geohash_decode", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *GeohashDecode) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *GeohashDecode) Type() value.Type { return value.OBJECT }
+
+func (this *GeohashDecode) Evaluate(item value.Value, context Context) (value.Value, error) {
+	arg, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	} else if arg.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	} else if arg.Type() != value.STRING {
+		return value.NULL_VALUE, nil
+	}
+
+	minLon, minLat, maxLon, maxLat, ok := util.GeohashDecode(arg.ToString())
+	if !ok {
+		return value.NULL_VALUE, nil
+	}
+	return geoPointValue(geoPoint{(minLon + maxLon) / 2, (minLat + maxLat) / 2}), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *GeohashDecode) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewGeohashDecode(operands[0])
+	}
+}
+
+/*
+Evaluate the two GeoJSON geometry operands of a function. If either
+is MISSING or not a geometry, return the MISSING or NULL result.
+*/
+func evaluateGeometries(operands Expressions, item value.Value, context Context) (
+	first, second *geometry, rv value.Value, err error) {
+
+	arg1, err := operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	arg2, err := operands[1].Evaluate(item, context)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if arg1.Type() == value.MISSING || arg2.Type() == value.MISSING {
+		return nil, nil, value.MISSING_VALUE, nil
+	}
+
+	first = newGeometry(arg1)
+	second = newGeometry(arg2)
+	if first == nil || second == nil {
+		return nil, nil, value.NULL_VALUE, nil
+	}
+	return first, second, nil, nil
+}
@@ -0,0 +1,445 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package expression
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/query/util"
+	"github.com/couchbase/query/value"
+)
+
+///////////////////////////////////////////////////
+//
+// MD5
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the function MD5(expr). It returns the MD5 digest
+of the string or binary value expr, as a hexadecimal string.
+*/
+type MD5 struct {
+	UnaryFunctionBase
+}
+
+func NewMD5(operand Expression) Function {
+	rv := &MD5{
+		*NewUnaryFunctionBase("md5", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *MD5) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *MD5) Type() value.Type { return value.STRING }
+
+func (this *MD5) Evaluate(item value.Value, context Context) (value.Value, error) {
+	return digest(this.operands[0], item, context, md5.New())
+}
+
+/*
+Factory method pattern.
+*/
+func (this *MD5) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewMD5(operands[0])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// SHA1
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the function SHA1(expr). It returns the SHA-1 digest
+of the string or binary value expr, as a hexadecimal string.
+*/
+type SHA1 struct {
+	UnaryFunctionBase
+}
+
+func NewSHA1(operand Expression) Function {
+	rv := &SHA1{
+		*NewUnaryFunctionBase("sha1", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *SHA1) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *SHA1) Type() value.Type { return value.STRING }
+
+func (this *SHA1) Evaluate(item value.Value, context Context) (value.Value, error) {
+	return digest(this.operands[0], item, context, sha1.New())
+}
+
+/*
+Factory method pattern.
+*/
+func (this *SHA1) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSHA1(operands[0])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// SHA256
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the function SHA256(expr). It returns the SHA-256
+digest of the string or binary value expr, as a hexadecimal string.
+*/
+type SHA256 struct {
+	UnaryFunctionBase
+}
+
+func NewSHA256(operand Expression) Function {
+	rv := &SHA256{
+		*NewUnaryFunctionBase("sha256", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *SHA256) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *SHA256) Type() value.Type { return value.STRING }
+
+func (this *SHA256) Evaluate(item value.Value, context Context) (value.Value, error) {
+	return digest(this.operands[0], item, context, sha256.New())
+}
+
+/*
+Factory method pattern.
+*/
+func (this *SHA256) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSHA256(operands[0])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// SHA512
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the function SHA512(expr). It returns the SHA-512
+digest of the string or binary value expr, as a hexadecimal string.
+*/
+type SHA512 struct {
+	UnaryFunctionBase
+}
+
+func NewSHA512(operand Expression) Function {
+	rv := &SHA512{
+		*NewUnaryFunctionBase("sha512", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *SHA512) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *SHA512) Type() value.Type { return value.STRING }
+
+func (this *SHA512) Evaluate(item value.Value, context Context) (value.Value, error) {
+	return digest(this.operands[0], item, context, sha512.New())
+}
+
+/*
+Factory method pattern.
+*/
+func (this *SHA512) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewSHA512(operands[0])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// HMAC
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the function HMAC(alg, key, data). It returns the
+HMAC of the string or binary value data under the string or binary
+value key, as a hexadecimal string. The hash algorithm alg is one
+of "md5", "sha1", "sha256" or "sha512".
+*/
+type HMAC struct {
+	TernaryFunctionBase
+}
+
+func NewHMAC(first, second, third Expression) Function {
+	rv := &HMAC{
+		*NewTernaryFunctionBase("hmac", first, second, third),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *HMAC) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *HMAC) Type() value.Type { return value.STRING }
+
+func (this *HMAC) Evaluate(item value.Value, context Context) (value.Value, error) {
+	alg, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+	key, err := this.operands[1].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+	data, err := this.operands[2].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	}
+
+	if alg.Type() == value.MISSING || key.Type() == value.MISSING || data.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	} else if alg.Type() != value.STRING {
+		return value.NULL_VALUE, nil
+	}
+
+	newHash, ok := _HMAC_HASHES[strings.ToLower(alg.ToString())]
+	if !ok {
+		return value.NULL_VALUE, nil
+	}
+	keyBytes, ok := hashBytes(key)
+	if !ok {
+		return value.NULL_VALUE, nil
+	}
+	dataBytes, ok := hashBytes(data)
+	if !ok {
+		return value.NULL_VALUE, nil
+	}
+
+	h := hmac.New(newHash, keyBytes)
+	h.Write(dataBytes)
+	return value.NewValue(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *HMAC) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewHMAC(operands[0], operands[1], operands[2])
+	}
+}
+
+var _HMAC_HASHES = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+///////////////////////////////////////////////////
+//
+// CRC32
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the function CRC32(expr). It returns the IEEE CRC-32
+checksum of the string or binary value expr, as a number.
+*/
+type CRC32 struct {
+	UnaryFunctionBase
+}
+
+func NewCRC32(operand Expression) Function {
+	rv := &CRC32{
+		*NewUnaryFunctionBase("crc32", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *CRC32) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *CRC32) Type() value.Type { return value.NUMBER }
+
+func (this *CRC32) Evaluate(item value.Value, context Context) (value.Value, error) {
+	arg, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	} else if arg.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	}
+
+	bytes, ok := hashBytes(arg)
+	if !ok {
+		return value.NULL_VALUE, nil
+	}
+	return value.NewValue(int64(crc32.ChecksumIEEE(bytes))), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *CRC32) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewCRC32(operands[0])
+	}
+}
+
+///////////////////////////////////////////////////
+//
+// XXHash64
+//
+///////////////////////////////////////////////////
+
+/*
+This represents the function XXHASH64(expr). It returns the XXH64
+hash of the string or binary value expr, as a hexadecimal string,
+since not all 64 bit values are exactly representable as numbers.
+*/
+type XXHash64 struct {
+	UnaryFunctionBase
+}
+
+func NewXXHash64(operand Expression) Function {
+	rv := &XXHash64{
+		*NewUnaryFunctionBase("xxhash64", operand),
+	}
+
+	rv.expr = rv
+	return rv
+}
+
+/*
+Visitor pattern.
+*/
+func (this *XXHash64) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitFunction(this)
+}
+
+func (this *XXHash64) Type() value.Type { return value.STRING }
+
+func (this *XXHash64) Evaluate(item value.Value, context Context) (value.Value, error) {
+	arg, err := this.operands[0].Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	} else if arg.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	}
+
+	bytes, ok := hashBytes(arg)
+	if !ok {
+		return value.NULL_VALUE, nil
+	}
+
+	// zero padded, as are the digests
+	str := strconv.FormatUint(util.XXHashSum64(bytes), 16)
+	return value.NewValue(strings.Repeat("0", 16-len(str)) + str), nil
+}
+
+/*
+Factory method pattern.
+*/
+func (this *XXHash64) Constructor() FunctionConstructor {
+	return func(operands ...Expression) Function {
+		return NewXXHash64(operands[0])
+	}
+}
+
+/*
+Evaluate operand and return its digest under h as a hexadecimal
+string, MISSING for MISSING, and NULL for values other than strings
+and binaries.
+*/
+func digest(operand Expression, item value.Value, context Context, h hash.Hash) (value.Value, error) {
+	arg, err := operand.Evaluate(item, context)
+	if err != nil {
+		return nil, err
+	} else if arg.Type() == value.MISSING {
+		return value.MISSING_VALUE, nil
+	}
+
+	bytes, ok := hashBytes(arg)
+	if !ok {
+		return value.NULL_VALUE, nil
+	}
+
+	h.Write(bytes)
+	return value.NewValue(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+/*
+The bytes that are hashed: the UTF-8 encoding of a string, or the
+contents of a binary value.
+*/
+func hashBytes(arg value.Value) ([]byte, bool) {
+	switch arg.Type() {
+	case value.STRING:
+		return []byte(arg.ToString()), true
+	case value.BINARY:
+		return arg.Actual().([]byte), true
+	}
+	return nil, false
+}
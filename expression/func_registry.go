@@ -318,6 +318,28 @@ var _FUNCTIONS = map[string]Function{
 	"decode_base64": &Base64Decode{},
 	"encode_base64": &Base64Encode{},
 
+	// Hash
+	"crc32":    &CRC32{},
+	"hmac":     &HMAC{},
+	"md5":      &MD5{},
+	"sha1":     &SHA1{},
+	"sha256":   &SHA256{},
+	"sha512":   &SHA512{},
+	"xxhash64": &XXHash64{},
+
+	// Geospatial
+	"geohash_decode":   &GeohashDecode{},
+	"geohash_encode":   &GeohashEncode{},
+	"st_bbox":          &STBBox{},
+	"st_contains":      &STContains{},
+	"st_distance":      &STDistance{},
+	"st_envelope":      &STEnvelope{},
+	"st_intersects":    &STIntersects{},
+	"st_point":         &STPoint{},
+	"st_within":        &STWithin{},
+	"st_within_box":    &STWithinBox{},
+	"st_within_radius": &STWithinRadius{},
+
 	// Comparison
 	"greatest":  &Greatest{},
 	"least":     &Least{},
@@ -0,0 +1,566 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package expression
+
+import (
+	"math"
+
+	"github.com/couchbase/query/value"
+)
+
+/*
+GeoJSON geometries, see RFC 7946. Distances are measured along great
+circles of a sphere with the mean radius of the Earth, in meters.
+Containment and intersection treat edges as straight lines in
+longitude and latitude, and points on the boundary of a polygon are
+contained in it.
+*/
+const (
+	_EARTH_RADIUS = 6371008.8
+	_GEO_EPSILON  = 1e-12
+)
+
+type geoPoint struct {
+	lon float64
+	lat float64
+}
+
+type geometry struct {
+	points   []geoPoint     // Point, MultiPoint
+	lines    [][]geoPoint   // LineString, MultiLineString
+	polygons [][][]geoPoint // Polygon, MultiPolygon: the outer ring, then any holes
+}
+
+/*
+Return the geometry of a GeoJSON geometry, Feature or
+GeometryCollection value, or nil if val is not one.
+*/
+func newGeometry(val value.Value) *geometry {
+	g := &geometry{}
+	if !g.add(val, 0) || g.empty() {
+		return nil
+	}
+	return g
+}
+
+/*
+Return the geometry of a GeoJSON value that is a single Point.
+*/
+func newGeoPoint(val value.Value) (geoPoint, bool) {
+	g := newGeometry(val)
+	if g == nil || len(g.points) != 1 || len(g.lines) > 0 || len(g.polygons) > 0 {
+		return geoPoint{}, false
+	}
+	return g.points[0], true
+}
+
+func (this *geometry) add(val value.Value, depth int) bool {
+	if val.Type() != value.OBJECT || depth > 2 {
+		return false
+	}
+	typ, ok := val.Field("type")
+	if !ok || typ.Type() != value.STRING {
+		return false
+	}
+
+	switch typ.ToString() {
+	case "Feature":
+		geom, ok := val.Field("geometry")
+		return ok && this.add(geom, depth+1)
+	case "GeometryCollection":
+		geoms, ok := geoArray(val.Field("geometries"))
+		if !ok {
+			return false
+		}
+		for _, geom := range geoms {
+			if !this.add(geom, depth+1) {
+				return false
+			}
+		}
+		return true
+	}
+
+	coords, ok := val.Field("coordinates")
+	if !ok {
+		return false
+	}
+
+	switch typ.ToString() {
+	case "Point":
+		p, ok := geoPosition(coords)
+		if ok {
+			this.points = append(this.points, p)
+		}
+		return ok
+	case "MultiPoint":
+		ps, ok := geoPositions(coords, 1)
+		if ok {
+			this.points = append(this.points, ps...)
+		}
+		return ok
+	case "LineString":
+		ps, ok := geoPositions(coords, 2)
+		if ok {
+			this.lines = append(this.lines, ps)
+		}
+		return ok
+	case "MultiLineString":
+		lines, ok := geoArray(coords, true)
+		for _, line := range lines {
+			ps, ok1 := geoPositions(line, 2)
+			if !ok1 {
+				return false
+			}
+			this.lines = append(this.lines, ps)
+		}
+		return ok
+	case "Polygon":
+		poly, ok := geoPolygon(coords)
+		if ok {
+			this.polygons = append(this.polygons, poly)
+		}
+		return ok
+	case "MultiPolygon":
+		polys, ok := geoArray(coords, true)
+		for _, p := range polys {
+			poly, ok1 := geoPolygon(p)
+			if !ok1 {
+				return false
+			}
+			this.polygons = append(this.polygons, poly)
+		}
+		return ok
+	}
+	return false
+}
+
+func (this *geometry) empty() bool {
+	return len(this.points) == 0 && len(this.lines) == 0 && len(this.polygons) == 0
+}
+
+func geoArray(val value.Value, ok bool) ([]value.Value, bool) {
+	if !ok || val.Type() != value.ARRAY {
+		return nil, false
+	}
+	act := val.Actual().([]interface{})
+	rv := make([]value.Value, len(act))
+	for i, a := range act {
+		rv[i] = value.NewValue(a)
+	}
+	return rv, true
+}
+
+// a position is [longitude, latitude], optionally followed by an altitude
+func geoPosition(val value.Value) (geoPoint, bool) {
+	coords, ok := geoArray(val, true)
+	if !ok || len(coords) < 2 || len(coords) > 3 ||
+		coords[0].Type() != value.NUMBER || coords[1].Type() != value.NUMBER {
+		return geoPoint{}, false
+	}
+	p := geoPoint{
+		lon: coords[0].(value.NumberValue).Float64(),
+		lat: coords[1].(value.NumberValue).Float64(),
+	}
+	if p.lon < -180.0 || p.lon > 180.0 || p.lat < -90.0 || p.lat > 90.0 {
+		return geoPoint{}, false
+	}
+	return p, true
+}
+
+func geoPositions(val value.Value, min int) ([]geoPoint, bool) {
+	coords, ok := geoArray(val, true)
+	if !ok || len(coords) < min {
+		return nil, false
+	}
+	rv := make([]geoPoint, len(coords))
+	for i, c := range coords {
+		rv[i], ok = geoPosition(c)
+		if !ok {
+			return nil, false
+		}
+	}
+	return rv, true
+}
+
+// each ring is closed, with at least four positions
+func geoPolygon(val value.Value) ([][]geoPoint, bool) {
+	rings, ok := geoArray(val, true)
+	if !ok || len(rings) == 0 {
+		return nil, false
+	}
+	rv := make([][]geoPoint, len(rings))
+	for i, r := range rings {
+		rv[i], ok = geoPositions(r, 4)
+		if !ok || rv[i][0] != rv[i][len(rv[i])-1] {
+			return nil, false
+		}
+	}
+	return rv, true
+}
+
+/*
+Return the bounding box [minLon, minLat, maxLon, maxLat] of a value
+that is an array of four numbers; minLon > maxLon for a box that
+crosses the antimeridian.
+*/
+func geoBox(val value.Value) (box [4]float64, ok bool) {
+	coords, ok := geoArray(val, true)
+	if !ok || len(coords) != 4 {
+		return box, false
+	}
+	for i, c := range coords {
+		if c.Type() != value.NUMBER {
+			return box, false
+		}
+		box[i] = c.(value.NumberValue).Float64()
+	}
+	if box[0] < -180.0 || box[0] > 180.0 || box[2] < -180.0 || box[2] > 180.0 ||
+		box[1] < -90.0 || box[3] > 90.0 || box[1] > box[3] {
+		return box, false
+	}
+	return box, true
+}
+
+func geoInBox(p geoPoint, box [4]float64) bool {
+	if p.lat < box[1] || p.lat > box[3] {
+		return false
+	} else if box[0] <= box[2] {
+		return p.lon >= box[0] && p.lon <= box[2]
+	}
+	return p.lon >= box[0] || p.lon <= box[2]
+}
+
+/*
+Return the bounding box of the circle of the given radius in meters
+around center. It spans all longitudes if the circle contains a pole,
+and has minLon > maxLon if it crosses the antimeridian. See
+http://janmatuschek.de/LatitudeLongitudeBoundingCoordinates
+*/
+func geoRadiusBox(center geoPoint, radius float64) (box [4]float64) {
+	d := radius / _EARTH_RADIUS
+	lat := center.lat * math.Pi / 180.0
+	minLat := lat - d
+	maxLat := lat + d
+	if minLat <= -math.Pi/2 || maxLat >= math.Pi/2 {
+		// a pole is in the circle
+		return [4]float64{-180.0, math.Max(minLat*180.0/math.Pi, -90.0),
+			180.0, math.Min(maxLat*180.0/math.Pi, 90.0)}
+	}
+
+	dLon := math.Asin(math.Sin(d)/math.Cos(lat)) * 180.0 / math.Pi
+	minLon := center.lon - dLon
+	if minLon < -180.0 {
+		minLon += 360.0
+	}
+	maxLon := center.lon + dLon
+	if maxLon > 180.0 {
+		maxLon -= 360.0
+	}
+	return [4]float64{minLon, minLat * 180.0 / math.Pi, maxLon, maxLat * 180.0 / math.Pi}
+}
+
+func (this *geometry) vertices() []geoPoint {
+	rv := append([]geoPoint(nil), this.points...)
+	for _, line := range this.lines {
+		rv = append(rv, line...)
+	}
+	for _, poly := range this.polygons {
+		for _, ring := range poly {
+			rv = append(rv, ring...)
+		}
+	}
+	return rv
+}
+
+func (this *geometry) segments() [][2]geoPoint {
+	var rv [][2]geoPoint
+	for _, line := range this.lines {
+		for i := 1; i < len(line); i++ {
+			rv = append(rv, [2]geoPoint{line[i-1], line[i]})
+		}
+	}
+	for _, poly := range this.polygons {
+		for _, ring := range poly {
+			for i := 1; i < len(ring); i++ {
+				rv = append(rv, [2]geoPoint{ring[i-1], ring[i]})
+			}
+		}
+	}
+	return rv
+}
+
+func (this *geometry) bbox() (box [4]float64) {
+	box = [4]float64{180.0, 90.0, -180.0, -90.0}
+	for _, p := range this.vertices() {
+		box[0] = math.Min(box[0], p.lon)
+		box[1] = math.Min(box[1], p.lat)
+		box[2] = math.Max(box[2], p.lon)
+		box[3] = math.Max(box[3], p.lat)
+	}
+	return
+}
+
+/*
+Whether p is a point of the geometry, lies on one of its lines,
+or is inside or on the boundary of one of its polygons.
+*/
+func (this *geometry) covers(p geoPoint) bool {
+	for _, q := range this.points {
+		if p == q {
+			return true
+		}
+	}
+	for _, s := range this.segments() {
+		if geoOnSegment(p, s[0], s[1]) {
+			return true
+		}
+	}
+	for _, poly := range this.polygons {
+		if geoInPolygon(p, poly) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *geometry) intersects(other *geometry) bool {
+	for _, p := range this.vertices() {
+		if other.covers(p) {
+			return true
+		}
+	}
+	for _, p := range other.vertices() {
+		if this.covers(p) {
+			return true
+		}
+	}
+	for _, s := range this.segments() {
+		for _, t := range other.segments() {
+			if geoSegmentsIntersect(s[0], s[1], t[0], t[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (this *geometry) contains(other *geometry) bool {
+	if len(other.polygons) > 0 && len(this.polygons) == 0 {
+		return false
+	}
+	for _, p := range other.vertices() {
+		if !this.covers(p) {
+			return false
+		}
+	}
+
+	segments := this.segments()
+	for _, s := range other.segments() {
+		if !this.covers(geoPoint{(s[0].lon + s[1].lon) / 2, (s[0].lat + s[1].lat) / 2}) {
+			return false
+		}
+		for _, t := range segments {
+			if geoSegmentsCross(s[0], s[1], t[0], t[1]) {
+				return false
+			}
+		}
+	}
+
+	// a hole must not be inside a contained polygon
+	for _, poly := range this.polygons {
+		for _, hole := range poly[1:] {
+			for _, p := range hole {
+				for _, opoly := range other.polygons {
+					if geoInPolygon(p, opoly) && !geoOnRings(p, opoly) {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+/*
+The shortest distance in meters between the geometries.
+*/
+func (this *geometry) distance(other *geometry) float64 {
+	if this.intersects(other) {
+		return 0.0
+	}
+
+	d := math.Inf(1)
+	for _, p := range this.vertices() {
+		d = math.Min(d, other.pointDistance(p))
+	}
+	for _, p := range other.vertices() {
+		d = math.Min(d, this.pointDistance(p))
+	}
+	return d
+}
+
+func (this *geometry) pointDistance(p geoPoint) float64 {
+	d := math.Inf(1)
+	for _, q := range this.points {
+		d = math.Min(d, geoDistance(p, q))
+	}
+	for _, s := range this.segments() {
+		d = math.Min(d, geoSegmentDistance(p, s[0], s[1]))
+	}
+	return d
+}
+
+// great circle distance, using the haversine formula
+func geoDistance(p, q geoPoint) float64 {
+	lat1 := p.lat * math.Pi / 180.0
+	lat2 := q.lat * math.Pi / 180.0
+	dLat := lat2 - lat1
+	dLon := (q.lon - p.lon) * math.Pi / 180.0
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * _EARTH_RADIUS * math.Asin(math.Sqrt(math.Min(h, 1.0)))
+}
+
+// distance from p to the great circle arc between a and b
+func geoSegmentDistance(p, a, b geoPoint) float64 {
+	pv, av, bv := geoVector(p), geoVector(a), geoVector(b)
+	n := geoCross(av, bv)
+	nl := math.Sqrt(geoDot(n, n))
+	if nl < _GEO_EPSILON {
+		return math.Min(geoDistance(p, a), geoDistance(p, b))
+	}
+	n = [3]float64{n[0] / nl, n[1] / nl, n[2] / nl}
+
+	// the closest point of the great circle lies on the arc if it is
+	// on the same side of both ends
+	pn := geoDot(pv, n)
+	c := [3]float64{pv[0] - pn*n[0], pv[1] - pn*n[1], pv[2] - pn*n[2]}
+	if geoDot(geoCross(av, c), n) >= 0 && geoDot(geoCross(c, bv), n) >= 0 {
+		return _EARTH_RADIUS * math.Abs(math.Asin(math.Max(-1.0, math.Min(pn, 1.0))))
+	}
+	return math.Min(geoDistance(p, a), geoDistance(p, b))
+}
+
+func geoVector(p geoPoint) [3]float64 {
+	lat := p.lat * math.Pi / 180.0
+	lon := p.lon * math.Pi / 180.0
+	return [3]float64{math.Cos(lat) * math.Cos(lon), math.Cos(lat) * math.Sin(lon), math.Sin(lat)}
+}
+
+func geoCross(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func geoDot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+// > 0 if a, b, c turn counterclockwise, < 0 if clockwise, 0 if collinear
+func geoOrientation(a, b, c geoPoint) float64 {
+	o := (b.lon-a.lon)*(c.lat-a.lat) - (b.lat-a.lat)*(c.lon-a.lon)
+	if math.Abs(o) < _GEO_EPSILON {
+		return 0.0
+	}
+	return o
+}
+
+func geoOnSegment(p, a, b geoPoint) bool {
+	return geoOrientation(a, b, p) == 0.0 &&
+		p.lon >= math.Min(a.lon, b.lon) && p.lon <= math.Max(a.lon, b.lon) &&
+		p.lat >= math.Min(a.lat, b.lat) && p.lat <= math.Max(a.lat, b.lat)
+}
+
+// whether the segments have any point in common
+func geoSegmentsIntersect(a, b, c, d geoPoint) bool {
+	o1, o2 := geoOrientation(a, b, c), geoOrientation(a, b, d)
+	o3, o4 := geoOrientation(c, d, a), geoOrientation(c, d, b)
+	if o1*o2 < 0 && o3*o4 < 0 {
+		return true
+	}
+	return geoOnSegment(c, a, b) || geoOnSegment(d, a, b) ||
+		geoOnSegment(a, c, d) || geoOnSegment(b, c, d)
+}
+
+// whether the segments cross at a point inside both
+func geoSegmentsCross(a, b, c, d geoPoint) bool {
+	return geoOrientation(a, b, c)*geoOrientation(a, b, d) < 0 &&
+		geoOrientation(c, d, a)*geoOrientation(c, d, b) < 0
+}
+
+func geoOnRings(p geoPoint, poly [][]geoPoint) bool {
+	for _, ring := range poly {
+		for i := 1; i < len(ring); i++ {
+			if geoOnSegment(p, ring[i-1], ring[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inside or on the boundary of the outer ring, and not strictly inside a hole
+func geoInPolygon(p geoPoint, poly [][]geoPoint) bool {
+	if geoOnRings(p, poly) {
+		return true
+	}
+	if !geoInRing(p, poly[0]) {
+		return false
+	}
+	for _, hole := range poly[1:] {
+		if geoInRing(p, hole) {
+			return false
+		}
+	}
+	return true
+}
+
+// ray casting; the caller deals with points on the ring
+func geoInRing(p geoPoint, ring []geoPoint) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.lat > p.lat) != (b.lat > p.lat) &&
+			p.lon < (b.lon-a.lon)*(p.lat-a.lat)/(b.lat-a.lat)+a.lon {
+			in = !in
+		}
+	}
+	return in
+}
+
+/*
+GeoJSON values.
+*/
+func geoPointValue(p geoPoint) value.Value {
+	return value.NewValue(map[string]interface{}{
+		"type":        "Point",
+		"coordinates": []interface{}{p.lon, p.lat},
+	})
+}
+
+// the smallest Polygon, or LineString or Point for a degenerate box, that covers box
+func geoEnvelopeValue(box [4]float64) value.Value {
+	minLon, minLat, maxLon, maxLat := box[0], box[1], box[2], box[3]
+	if minLon == maxLon && minLat == maxLat {
+		return geoPointValue(geoPoint{minLon, minLat})
+	} else if minLon == maxLon || minLat == maxLat {
+		return value.NewValue(map[string]interface{}{
+			"type":        "LineString",
+			"coordinates": []interface{}{[]interface{}{minLon, minLat}, []interface{}{maxLon, maxLat}},
+		})
+	}
+	return value.NewValue(map[string]interface{}{
+		"type": "Polygon",
+		"coordinates": []interface{}{[]interface{}{
+			[]interface{}{minLon, minLat},
+			[]interface{}{maxLon, minLat},
+			[]interface{}{maxLon, maxLat},
+			[]interface{}{minLon, maxLat},
+			[]interface{}{minLon, minLat},
+		}},
+	})
+}
@@ -123,6 +123,11 @@ func NewJavascriptBody(library, object string) (functions.FunctionBody, errors.E
 	return &javascriptBody{library: library, object: object}, nil
 }
 
+// the evaluator only runs library functions
+func NewJavascriptInlineBody(text string) (functions.FunctionBody, errors.Error) {
+	return nil, errors.NewFunctionsDisabledError("inline javascript")
+}
+
 func (this *javascriptBody) SetVarNames(vars []string) errors.Error {
 	this.varNames = vars
 	return nil
@@ -11,41 +11,360 @@
 package javascript
 
 import (
+	goerrors "errors"
+	"fmt"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/couchbase/query/auth"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/functions"
 	"github.com/couchbase/query/value"
+	"github.com/dop251/goja"
 	"github.com/gorilla/mux"
 )
 
-// this body is used to fail function creation where not supported
+// Javascript functions run in process, each call in its own interpreter, which
+// has none of the node or browser host objects, and so no access to the file
+// system or the network. The only way out is the N1QL() function, which runs
+// a statement through the function context and returns its results as an array.
+
+// we won't let a javascript function execute more than 2 minutes
+const _MAX_TIMEOUT = 2 * time.Minute
+
+// nor keep running while the heap of the process grows by more than 256MB
+const _MAX_HEAP_GROWTH = 256 * 1024 * 1024
+
+// nor nest calls deeper than this
+const _MAX_STACK = 1024
+
+// how often running functions are checked against their limits
+const _CHECK_INTERVAL = 10 * time.Millisecond
+
+type javascript struct {
+}
+
+// library bodies reference a function in a library; inline bodies have no
+// library and carry their own text
 type javascriptBody struct {
+	varNames []string
+	library  string
+	object   string
+	text     string
+	program  *goja.Program
+}
+
+func Init(mux *mux.Router) {
+	functions.FunctionsNewLanguage(functions.JAVASCRIPT, &javascript{})
+	initLibraries(mux)
+}
+
+func (this *javascript) Execute(name functions.FunctionName, body functions.FunctionBody, modifiers functions.Modifier, values []value.Value, context functions.Context) (value.Value, errors.Error) {
+	funcName := name.Name()
+	funcBody, ok := body.(*javascriptBody)
+
+	if !ok {
+		return nil, errors.NewInternalFunctionError(goerrors.New("Wrong language being executed!"), funcName)
+	}
+
+	if funcBody.varNames != nil && len(values) != len(funcBody.varNames) {
+		return nil, errors.NewArgumentsMismatchError(funcName)
+	}
+
+	program := funcBody.program
+	if program == nil {
+		var err errors.Error
+
+		program, err = getLibrary(funcBody.library)
+		if err != nil {
+			return nil, funcBody.execError(err, funcName)
+		}
+	}
+
+	vm := goja.New()
+	vm.SetMaxCallStackSize(_MAX_STACK)
+	r := &runner{vm: vm, context: context, name: name, readonly: (modifiers & functions.READONLY) != 0}
+	vm.Set("N1QL", r.n1ql)
+
+	args := make([]goja.Value, len(values))
+	for i, _ := range values {
+		args[i] = r.toJS(values[i])
+	}
+
+	timeout := context.GetTimeout()
+	if timeout <= 0 || timeout > _MAX_TIMEOUT {
+		timeout = _MAX_TIMEOUT
+	}
+	stop := watch(vm, timeout, _MAX_HEAP_GROWTH)
+	res, err := funcBody.call(vm, program, funcName, args)
+	stop()
+
+	if err == nil {
+		var val value.Value
+
+		val, err = fromJS(res)
+		if err == nil {
+			return val, nil
+		}
+	}
+
+	// report why we were interrupted rather than where
+	if ie, ok := err.(*goja.InterruptedError); ok {
+		if e, ok := ie.Value().(error); ok {
+			err = e
+		}
+	}
+	return nil, funcBody.execError(err, funcName)
+}
+
+// run the program, which declares the function, and call it
+func (this *javascriptBody) call(vm *goja.Runtime, program *goja.Program, funcName string, args []goja.Value) (goja.Value, error) {
+	res, err := vm.RunProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	object := this.object
+	if object == "" {
+		object = funcName
+	}
+	f, ok := goja.AssertFunction(vm.Get(object))
+
+	// inline bodies may just be a function expression
+	if !ok && this.library == "" {
+		f, ok = goja.AssertFunction(res)
+	}
+	if !ok {
+		return nil, fmt.Errorf("function %v not found", object)
+	}
+	return f(goja.Undefined(), args...)
 }
 
-func Init(mix *mux.Router) {
+func (this *javascriptBody) execError(err error, name string) errors.Error {
+	what := "(inline)"
+	if this.library != "" {
+		what = fmt.Sprintf("(%v:%v)", this.library, this.object)
+	}
+	return errors.NewFunctionExecutionError(what, name, err)
+}
+
+// interrupt the interpreter if it runs for too long, or if the heap of the process
+// grows too much while it runs.
+// The interpreter does not account for what each call allocates, so the heap check
+// is not a per-call limit: the allocations of other requests count against a call
+// while it runs, and a runaway call is only stopped once the whole process has grown.
+// It protects the node from runaway functions, rather than isolating them.
+// Go releases before 1.21 do not report the live heap, and so have no heap check.
+func watch(vm *goja.Runtime, timeout time.Duration, heapGrowth uint64) func() {
+	done := make(chan bool)
+	go func() {
+		timer := time.NewTimer(timeout)
+		ticker := time.NewTicker(_CHECK_INTERVAL)
+		defer timer.Stop()
+		defer ticker.Stop()
+
+		sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+		metrics.Read(sample)
+		checkMemory := sample[0].Value.Kind() == metrics.KindUint64
+		var start uint64
+		if checkMemory {
+			start = sample[0].Value.Uint64()
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+				vm.Interrupt(fmt.Errorf("timeout of %v exceeded", timeout))
+				return
+			case <-ticker.C:
+				if !checkMemory {
+					continue
+				}
+				metrics.Read(sample)
+				if heap := sample[0].Value.Uint64(); heap > start && heap-start > heapGrowth {
+					vm.Interrupt(fmt.Errorf("process heap grew by more than %v bytes", heapGrowth))
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+type runner struct {
+	vm       *goja.Runtime
+	context  functions.Context
+	name     functions.FunctionName
+	readonly bool
+	switched bool
+}
+
+// statements run in the query context of the function, and only read if it is
+// readonly; the context is switched on the first statement, so that functions that
+// run none do not pay for it
+func (this *runner) queryContext() functions.Context {
+	if !this.switched {
+		newContext, ok := this.context.NewQueryContext(this.name.QueryContext(), this.readonly).(functions.Context)
+		if !ok {
+			panic(this.vm.NewGoError(errors.NewInternalFunctionError(fmt.Errorf("Invalid function context received"), this.name.Name())))
+		}
+		this.context = newContext
+		this.switched = true
+	}
+	return this.context
+}
+
+// N1QL(statement [, parameters]) runs a statement and returns its results
+// parameters are positional if an array, named if an object
+func (this *runner) n1ql(call goja.FunctionCall) goja.Value {
+	var namedArgs map[string]value.Value
+	var positionalArgs value.Values
+
+	statement := call.Argument(0)
+	if goja.IsUndefined(statement) || goja.IsNull(statement) {
+		panic(this.vm.NewTypeError("N1QL() needs a statement"))
+	}
+	args, err := fromJS(call.Argument(1))
+	if err != nil {
+		panic(this.vm.NewGoError(err))
+	}
+	switch args.Type() {
+	case value.MISSING, value.NULL:
+	case value.ARRAY:
+		for i := 0; ; i++ {
+			arg, ok := args.Index(i)
+			if !ok {
+				break
+			}
+			positionalArgs = append(positionalArgs, arg)
+		}
+	case value.OBJECT:
+		fields := args.Fields()
+		namedArgs = make(map[string]value.Value, len(fields))
+		for n, arg := range fields {
+			namedArgs[strings.TrimPrefix(n, "$")] = value.NewValue(arg)
+		}
+	default:
+		panic(this.vm.NewTypeError("N1QL() parameters must be an array or an object"))
+	}
+
+	res, _, err := functions.Run(statement.String(), namedArgs, positionalArgs, this.queryContext())
+	if err != nil {
+		panic(this.vm.NewGoError(err))
+	}
+	return this.toJS(res)
+}
+
+// values are copied into native javascript objects, so that functions can
+// modify their arguments freely
+func (this *runner) toJS(val value.Value) goja.Value {
+	switch val.Type() {
+	case value.MISSING:
+		return goja.Undefined()
+	case value.NULL:
+		return goja.Null()
+	case value.OBJECT:
+		fields := val.Fields()
+		names := make([]string, 0, len(fields))
+		for n, _ := range fields {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		obj := this.vm.NewObject()
+		for _, n := range names {
+			field := value.NewValue(fields[n])
+			if field.Type() != value.MISSING {
+				obj.Set(n, this.toJS(field))
+			}
+		}
+		return obj
+	case value.ARRAY:
+		var items []interface{}
+		for i := 0; ; i++ {
+			item, ok := val.Index(i)
+			if !ok {
+				break
+			}
+			items = append(items, this.toJS(item))
+		}
+		return this.vm.NewArray(items...)
+	default:
+		return this.vm.ToValue(val.Actual())
+	}
+}
+
+// results are converted as JSON.stringify() would, except that undefined is MISSING
+func fromJS(val goja.Value) (value.Value, error) {
+	if val == nil || goja.IsUndefined(val) {
+		return value.MISSING_VALUE, nil
+	} else if goja.IsNull(val) {
+		return value.NULL_VALUE, nil
+	} else if obj, ok := val.(*goja.Object); ok {
+		bytes, err := obj.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return value.NewValue(bytes), nil
+	}
+	return value.NewValue(val.Export()), nil
 }
 
 func NewJavascriptBody(library, object string) (functions.FunctionBody, errors.Error) {
-	return nil, errors.NewFunctionsNotSupported("javascript")
+	return &javascriptBody{library: library, object: object}, nil
+}
+
+// inline bodies are compiled upfront, so that syntax errors fail function creation
+func NewJavascriptInlineBody(text string) (functions.FunctionBody, errors.Error) {
+	program, err := goja.Compile("", text, false)
+	if err != nil {
+		return nil, errors.NewFunctionEncodingError("compile", "inline javascript", err)
+	}
+	return &javascriptBody{text: text, program: program}, nil
+}
+
+func (this *javascriptBody) SetVarNames(vars []string) errors.Error {
+	this.varNames = vars
+	return nil
 }
 
 func (this *javascriptBody) Lang() functions.Language {
-	return functions.GOLANG
+	return functions.JAVASCRIPT
 }
 
-// this will never be called, just a placeholder
 func (this *javascriptBody) Body(object map[string]interface{}) {
-	object["functions_feature_disabled"] = true
+	object["#language"] = "javascript"
+	if this.library != "" {
+		object["library"] = this.library
+		object["object"] = this.object
+	} else {
+		object["text"] = this.text
+	}
+	if this.varNames != nil {
+		vars := make([]value.Value, len(this.varNames))
+		for v, _ := range this.varNames {
+			vars[v] = value.NewValue(this.varNames[v])
+		}
+		object["parameters"] = vars
+	}
 }
 
-//ditto
-func (this *javascriptBody) SetVars(vars []string) {
+func (this *javascriptBody) Indexable() value.Tristate {
+	return value.FALSE
 }
 
-func (this *javascriptBody) Indexable() value.Tristate {
+// queryContext and readonly are resolved by N1QL(), as in the enterprise build
+func (this *javascriptBody) SwitchContext() value.Tristate {
 	return value.FALSE
 }
 
-// ditto, for tests
-func MakeJavascript(name functions.FunctionName, body []byte) (functions.FunctionBody, errors.Error) {
-	return nil, errors.NewFunctionsNotSupported("javascript")
+func (this *javascriptBody) IsExternal() bool {
+	return true
+}
+
+func (this *javascriptBody) Privileges() (*auth.Privileges, errors.Error) {
+	return nil, nil
 }
@@ -0,0 +1,187 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+// +build !enterprise !go1.10
+
+package javascript
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/functions"
+	"github.com/couchbase/query/value"
+	"github.com/dop251/goja"
+)
+
+type testName struct {
+	name string
+}
+
+func (this *testName) Path() []string                                              { return []string{"default", this.name} }
+func (this *testName) Remap(p []string)                                            {}
+func (this *testName) Name() string                                                { return this.name }
+func (this *testName) Key() string                                                 { return "default:" + this.name }
+func (this *testName) IsGlobal() bool                                              { return true }
+func (this *testName) QueryContext() string                                        { return "default:" }
+func (this *testName) Signature(object map[string]interface{})                     {}
+func (this *testName) Load() (functions.FunctionBody, errors.Error)                { return nil, nil }
+func (this *testName) Save(body functions.FunctionBody, replace bool) errors.Error { return nil }
+func (this *testName) Delete() errors.Error                                        { return nil }
+func (this *testName) CheckStorage() bool                                          { return false }
+func (this *testName) ResetStorage()                                               {}
+
+type testContext struct {
+	timeout    time.Duration
+	statement  string
+	namedArgs  map[string]value.Value
+	positional value.Values
+	result     value.Value
+	switchedTo string
+}
+
+func (this *testContext) Now() time.Time                 { return time.Now() }
+func (this *testContext) GetTimeout() time.Duration      { return this.timeout }
+func (this *testContext) AuthenticatedUsers() []string   { return nil }
+func (this *testContext) Credentials() *auth.Credentials { return nil }
+func (this *testContext) DatastoreVersion() string       { return "" }
+func (this *testContext) Readonly() bool                 { return false }
+func (this *testContext) SetAdvisor()                    {}
+func (this *testContext) NewQueryContext(queryContext string, readonly bool) interface{} {
+	this.switchedTo = queryContext
+	return this
+}
+
+func (this *testContext) EvaluateStatement(statement string, namedArgs map[string]value.Value, positionalArgs value.Values,
+	subquery, readonly bool) (value.Value, uint64, error) {
+	this.statement = statement
+	this.namedArgs = namedArgs
+	this.positional = positionalArgs
+	return this.result, 1, nil
+}
+
+func execute(body functions.FunctionBody, name string, context functions.Context,
+	args ...value.Value) (value.Value, errors.Error) {
+	rv, err := (&javascript{}).Execute(&testName{name}, body, functions.NONE, args, context)
+	return rv, err
+}
+
+func TestInline(t *testing.T) {
+	context := &testContext{}
+
+	body, err := NewJavascriptInlineBody("function add(a, b) { return a + b; }")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rv, err := execute(body, "add", context, value.NewValue(1), value.NewValue(2))
+	if err != nil || !rv.Equals(value.NewValue(3)).Truth() {
+		t.Errorf("expected 3, got %v, %v", rv, err)
+	}
+
+	// arguments are copies, results are plain JSON
+	body, _ = NewJavascriptInlineBody("(function (o) { o.a.push(o.b); o.d = new Date(0); delete o.c; return o; })")
+	arg := value.NewValue(map[string]interface{}{"a": []interface{}{1}, "b": "x", "c": nil})
+	rv, err = execute(body, "f", context, arg)
+	expected := value.NewValue(map[string]interface{}{"a": []interface{}{1, "x"}, "b": "x", "d": "1970-01-01T00:00:00.000Z"})
+	if err != nil || !rv.Equals(expected).Truth() {
+		t.Errorf("expected %v, got %v, %v", expected, rv, err)
+	}
+	if c, _ := arg.Field("c"); c.Type() != value.NULL {
+		t.Errorf("argument was modified: %v", arg)
+	}
+
+	body, _ = NewJavascriptInlineBody("function f() { }")
+	rv, err = execute(body, "f", context)
+	if err != nil || rv.Type() != value.MISSING {
+		t.Errorf("expected MISSING, got %v, %v", rv, err)
+	}
+
+	body, _ = NewJavascriptInlineBody("function f() { throw new Error('boom'); }")
+	_, err = execute(body, "f", context)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected exception, got %v", err)
+	}
+
+	_, err = NewJavascriptInlineBody("function f( {")
+	if err == nil {
+		t.Errorf("expected syntax error")
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	context := &testContext{}
+
+	err := addLibrary("math", "function square(x) { return x * x; }\nfunction cube(x) { return x * square(x); }")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	body, _ := NewJavascriptBody("math", "cube")
+	rv, err := execute(body, "mycube", context, value.NewValue(3))
+	if err != nil || !rv.Equals(value.NewValue(27)).Truth() {
+		t.Errorf("expected 27, got %v, %v", rv, err)
+	}
+
+	body, _ = NewJavascriptBody("math", "sqrt")
+	_, err = execute(body, "mysqrt", context, value.NewValue(3))
+	if err == nil || !strings.Contains(err.Error(), "sqrt not found") {
+		t.Errorf("expected missing function, got %v", err)
+	}
+}
+
+func TestN1QL(t *testing.T) {
+	context := &testContext{result: value.NewValue([]interface{}{map[string]interface{}{"name": "a"}})}
+
+	body, _ := NewJavascriptInlineBody(
+		"function f(t) { var r = N1QL('SELECT name FROM ks WHERE type = $t', {$t: t}); return r[0].name; }")
+	rv, err := execute(body, "f", context, value.NewValue("x"))
+	if err != nil || !rv.Equals(value.NewValue("a")).Truth() {
+		t.Errorf("expected \"a\", got %v, %v", rv, err)
+	}
+	if context.statement != "SELECT name FROM ks WHERE type = $t" {
+		t.Errorf("unexpected statement %v", context.statement)
+	}
+	if context.switchedTo != "default:" {
+		t.Errorf("expected statement to run in the function query context, got %v", context.switchedTo)
+	}
+	if arg, ok := context.namedArgs["t"]; !ok || !arg.Equals(value.NewValue("x")).Truth() {
+		t.Errorf("unexpected named arguments %v", context.namedArgs)
+	}
+
+	body, _ = NewJavascriptInlineBody("function f() { return N1QL('SELECT $1', [1, 2]).length; }")
+	rv, err = execute(body, "f", context)
+	if err != nil || !rv.Equals(value.NewValue(1)).Truth() || len(context.positional) != 2 {
+		t.Errorf("expected 1 row and 2 positional arguments, got %v, %v, %v", rv, context.positional, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	context := &testContext{timeout: 50 * time.Millisecond}
+
+	body, _ := NewJavascriptInlineBody("function f() { while (true) { } }")
+	_, err := execute(body, "f", context)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected timeout, got %v", err)
+	}
+
+	body, _ = NewJavascriptInlineBody("function f(n) { return f(n + 1); }")
+	_, err = execute(body, "f", context, value.NewValue(0))
+	if err == nil {
+		t.Errorf("expected stack overflow")
+	}
+
+	vm := goja.New()
+	stop := watch(vm, time.Minute, 1024*1024)
+	_, er := vm.RunString("var a = []; while (true) { a.push('x'.repeat(1000) + a.length); }")
+	stop()
+	if er == nil || !strings.Contains(er.Error(), "heap grew") {
+		t.Errorf("expected heap growth limit, got %v", er)
+	}
+}
@@ -0,0 +1,216 @@
+//  Copyright 2019-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+// +build !enterprise !go1.10
+
+package javascript
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/couchbase/cbauth/metakv"
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/functions"
+	"github.com/couchbase/query/logging"
+	"github.com/dop251/goja"
+	"github.com/gorilla/mux"
+)
+
+// Libraries hold the code of functions created with AS "object" AT "library".
+// They are stored in metakv alongside the function definitions, and are managed
+// through the same REST endpoints as the enterprise evaluator:
+//
+//   GET    /evaluator/v1/libraries            all libraries, as [{"name": ..., "code": ...}]
+//   GET    /evaluator/v1/libraries/{library}  the code of a library
+//   POST   /evaluator/v1/libraries/{library}  create or replace a library from the request body
+//   DELETE /evaluator/v1/libraries/{library}  drop a library
+//
+// Every node keeps the compiled libraries in memory, following changes in metakv.
+
+const _LIBRARY_PATH = "/query/javascript/libraries/"
+const _LIBRARIES_PREFIX = "/evaluator/v1/libraries"
+
+type library struct {
+	code    string
+	program *goja.Program
+}
+
+var libraries struct {
+	sync.RWMutex
+	entries map[string]*library
+}
+
+func init() {
+	libraries.entries = make(map[string]*library, 16)
+}
+
+func initLibraries(mux *mux.Router) {
+	if mux != nil {
+		mux.HandleFunc(_LIBRARIES_PREFIX, doLibraries).Methods("GET")
+		mux.HandleFunc(_LIBRARIES_PREFIX+"/{library}", doLibrary).Methods("GET", "POST", "PUT", "DELETE")
+	}
+
+	// fire callback runner. It won't ever return
+	go metakv.RunObserveChildrenV2(_LIBRARY_PATH, callback, make(chan struct{}))
+}
+
+// change callback
+func callback(kve metakv.KVEntry) error {
+	name := strings.TrimPrefix(kve.Path, _LIBRARY_PATH)
+	if kve.Value == nil {
+		removeLibrary(name)
+	} else if err := addLibrary(name, string(kve.Value)); err != nil {
+		logging.Infof("Unable to load javascript library %v: %v", name, err)
+	}
+	return nil
+}
+
+func addLibrary(name, code string) errors.Error {
+	program, err := goja.Compile(name, code, false)
+	if err != nil {
+		return errors.NewFunctionLibraryError("compiling", name, err)
+	}
+	libraries.Lock()
+	libraries.entries[name] = &library{code: code, program: program}
+	libraries.Unlock()
+	return nil
+}
+
+func removeLibrary(name string) {
+	libraries.Lock()
+	delete(libraries.entries, name)
+	libraries.Unlock()
+}
+
+func getLibrary(name string) (*goja.Program, errors.Error) {
+	libraries.RLock()
+	lib, ok := libraries.entries[name]
+	libraries.RUnlock()
+	if ok {
+		return lib.program, nil
+	}
+
+	// the change may not have reached us yet
+	code, _, err := metakv.Get(_LIBRARY_PATH + name)
+	if err != nil {
+		return nil, errors.NewFunctionLibraryError("loading", name, err)
+	} else if code == nil {
+		return nil, errors.NewFunctionLibraryError("loading", name, fmt.Errorf("library not found"))
+	}
+	rv := addLibrary(name, string(code))
+	if rv != nil {
+		return nil, rv
+	}
+	return getLibrary(name)
+}
+
+func saveLibrary(name, code string) errors.Error {
+	_, err := goja.Compile(name, code, false)
+	if err != nil {
+		return errors.NewFunctionLibraryError("compiling", name, err)
+	}
+	err = metakv.Set(_LIBRARY_PATH+name, []byte(code), nil)
+	if err != nil {
+		return errors.NewFunctionLibraryError("saving", name, err)
+	}
+	return addLibrary(name, code)
+}
+
+func deleteLibrary(name string) errors.Error {
+	err := metakv.Delete(_LIBRARY_PATH+name, nil)
+	if err != nil {
+		return errors.NewFunctionLibraryError("deleting", name, err)
+	}
+	removeLibrary(name)
+	return nil
+}
+
+// REST API
+
+func doLibraries(w http.ResponseWriter, req *http.Request) {
+	if !authorizeRequest(w, req) {
+		return
+	}
+
+	type entry struct {
+		Name string `json:"name"`
+		Code string `json:"code"`
+	}
+	libraries.RLock()
+	list := make([]entry, 0, len(libraries.entries))
+	for name, lib := range libraries.entries {
+		list = append(list, entry{Name: name, Code: lib.code})
+	}
+	libraries.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	bytes, err := json.Marshal(list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
+
+func doLibrary(w http.ResponseWriter, req *http.Request) {
+	if !authorizeRequest(w, req) {
+		return
+	}
+
+	name := mux.Vars(req)["library"]
+	switch req.Method {
+	case "GET":
+		libraries.RLock()
+		lib, ok := libraries.entries[name]
+		libraries.RUnlock()
+		if !ok {
+			http.Error(w, fmt.Sprintf("library %v not found", name), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write([]byte(lib.code))
+	case "POST", "PUT":
+		code, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := saveLibrary(name, string(code)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	case "DELETE":
+		if err := deleteLibrary(name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// library code runs with the privileges of whoever executes the functions
+// that reference it, so managing libraries needs the external functions privilege
+func authorizeRequest(w http.ResponseWriter, req *http.Request) bool {
+	creds := auth.NewCredentials()
+	creds.HttpRequest = req
+	if user, pass, ok := req.BasicAuth(); ok {
+		creds.Users[user] = pass
+	}
+	privs := auth.NewPrivileges()
+	privs.Add("", auth.PRIV_QUERY_MANAGE_FUNCTIONS_EXTERNAL, auth.PRIV_PROPS_NONE)
+	if err := functions.Authorize(privs, creds); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
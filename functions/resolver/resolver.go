@@ -131,15 +131,21 @@ func MakeBody(name string, bytes []byte) (functions.FunctionBody, errors.Error)
 			Parameters []string `json:"parameters"`
 			Library    string   `json:"library"`
 			Object     string   `json:"object"`
+			Text       string   `json:"text"`
 		}
 		err := json.Unmarshal(bytes, &_unmarshalled)
 		if err != nil {
 			return nil, errors.NewFunctionEncodingError("decode body", name, err)
 		}
-		if _unmarshalled.Object == "" || _unmarshalled.Library == "" {
+		var body functions.FunctionBody
+		var newErr errors.Error
+		if _unmarshalled.Text != "" {
+			body, newErr = javascript.NewJavascriptInlineBody(_unmarshalled.Text)
+		} else if _unmarshalled.Object == "" || _unmarshalled.Library == "" {
 			return nil, errors.NewFunctionEncodingError("decode body", name, go_errors.New("object is missing"))
+		} else {
+			body, newErr = javascript.NewJavascriptBody(_unmarshalled.Library, _unmarshalled.Object)
 		}
-		body, newErr := javascript.NewJavascriptBody(_unmarshalled.Library, _unmarshalled.Object)
 		if body != nil {
 			newErr = body.SetVarNames(_unmarshalled.Parameters)
 		}
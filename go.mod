@@ -1,6 +1,6 @@
 module github.com/couchbase/query
 
-go 1.13
+go 1.16
 
 replace github.com/couchbase/cbauth => ../cbauth
 
@@ -45,7 +45,9 @@ require (
 	github.com/couchbase/query-ee v0.0.0-00010101000000-000000000000
 	github.com/couchbase/retriever v0.0.0-20150311081435-e3419088e4d3
 	github.com/couchbasedeps/go-curl v0.0.0-20190830233031-f0b2afc926ec
+	github.com/dop251/goja v0.0.0-20230806174421-c933cf95e127
 	github.com/gorilla/mux v1.7.4
+	github.com/klauspost/compress v1.11.7
 	github.com/mattn/go-runewidth v0.0.3
 	github.com/natefinch/npipe v0.0.0-20160621034901-c1b8fa8bdcce // indirect
 	github.com/opentracing/opentracing-go v1.2.0 // indirect
@@ -0,0 +1,55 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package n1ql
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var keywords []string
+var keywordsOnce sync.Once
+
+/*
+The N1QL keywords, in upper case and sorted. These are the names in
+the token list that the scanner returns as tokens rather than as
+identifiers; names such as IDENT or LPAREN are not keywords.
+*/
+func Keywords() []string {
+	keywordsOnce.Do(func() {
+		for _, name := range yyToknames {
+			if !isKeywordName(name) {
+				continue
+			}
+
+			var lval yySymType
+			nex := NewLexer(strings.NewReader(name))
+			tok := nex.Lex(&lval)
+			nex.Stop()
+			if tok != IDENT && tok != IDENT_ICASE && tok != 0 {
+				keywords = append(keywords, name)
+			}
+		}
+		sort.Strings(keywords)
+	})
+	return keywords
+}
+
+func isKeywordName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'A' || r > 'Z') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
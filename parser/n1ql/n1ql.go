@@ -134,6 +134,20 @@ func (this *lexer) Lex(lval *yySymType) int {
 
 	rv := this.nex.Lex(lval)
 
+	// WITHIN GROUP is a single token, to tell it apart from the WITHIN operator
+	if rv == WITHIN {
+		this.hasSaved = true
+		oldLval := *lval
+		this.saved = this.nex.Lex(lval)
+		this.lval = *lval
+		*lval = oldLval
+		if this.saved == GROUP {
+			this.hasSaved = false
+			return WITHIN_GROUP
+		}
+		return WITHIN
+	}
+
 	// we are going to treat identifiers specially to resolve
 	// shift reduce conflicts on namespaces
 	if rv != IDENT {
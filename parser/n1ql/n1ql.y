@@ -18,6 +18,62 @@ import "github.com/couchbase/query/value"
 func logDebugGrammar(format string, v ...interface{}) {
     clog.To("PARSER", format, v...)
 }
+
+// the bindings of a WITH clause, and the terms of a WITH RECURSIVE clause
+type withClause struct {
+    bindings  expression.Bindings
+    recursive algebra.RecursiveWiths
+}
+
+func (this *withClause) Bindings() expression.Bindings {
+    if this == nil {
+        return nil
+    }
+    return this.bindings
+}
+
+func (this *withClause) Recursive() algebra.RecursiveWiths {
+    if this == nil {
+        return nil
+    }
+    return this.recursive
+}
+
+// the ORDER BY and ON OVERFLOW clauses in the argument list of an aggregate
+type aggregateOptions struct {
+    order    *algebra.Order
+    overflow bool
+    flags    uint32
+    filler   string
+}
+
+// check the clauses against the aggregate, and apply them
+func setAggregateOptions(yylex yyLexer, agg algebra.Aggregate, nargs int, options *aggregateOptions, fname, ectx string) bool {
+    if options == nil {
+        return true
+    }
+    if options.order != nil && !algebra.AggregateHasProperty(fname, algebra.AGGREGATE_ORDER_BY) {
+        yylex.Error(fmt.Sprintf("ORDER BY clause syntax is not valid for function %s%s.", fname, ectx))
+        return false
+    }
+    if options.overflow {
+        if !algebra.AggregateHasProperty(fname, algebra.AGGREGATE_OVERFLOW) {
+            yylex.Error(fmt.Sprintf("ON OVERFLOW clause syntax is not valid for function %s%s.", fname, ectx))
+            return false
+        } else if nargs < agg.MaxArgs() {
+            yylex.Error(fmt.Sprintf("ON OVERFLOW clause requires a maximum length for function %s%s.", fname, ectx))
+            return false
+        }
+    }
+    if stringAgg, ok := agg.(*algebra.StringAgg); ok {
+        stringAgg.SetOrder(options.order)
+        if options.overflow {
+            stringAgg.AddFlags(options.flags)
+            stringAgg.SetFiller(options.filler)
+        }
+    }
+    return true
+}
 %}
 
 %union {
@@ -35,6 +91,8 @@ whenTerm         *expression.WhenTerm
 whenTerms        expression.WhenTerms
 binding          *expression.Binding
 bindings         expression.Bindings
+with             *withClause
+aggOptions       *aggregateOptions
 dimensions       []expression.Bindings
 
 node             algebra.Node
@@ -314,6 +372,7 @@ tokOffset    int
 %token WINDOW
 %token WITH
 %token WITHIN
+%token WITHIN_GROUP
 %token WORK
 %token XOR
 
@@ -409,7 +468,10 @@ tokOffset    int
 %type <expr>             on_keys on_key
 %type <indexRefs>        index_refs
 %type <indexRef>         index_ref
-%type <bindings>         opt_let let opt_with
+%type <bindings>         opt_let let
+%type <with>             opt_with recursive_with_list
+%type <expr>             opt_recursive_options
+%type <exprs>            opt_cycle
 %type <expr>             opt_where where opt_filter
 %type <group>            opt_group group
 %type <bindings>         opt_letting letting
@@ -438,6 +500,8 @@ tokOffset    int
 %type <statement>        collection_stmt create_collection drop_collection flush_collection
 %type <statement>        role_stmt grant_role revoke_role
 %type <statement>        function_stmt create_function drop_function execute_function
+%type <statement>        task_stmt create_task drop_task alter_task task_body
+%type <s>                task_name
 
 %type <keyspaceRef>      keyspace_ref simple_keyspace_ref
 %type <pairs>            values values_list next_values
@@ -496,6 +560,9 @@ tokOffset    int
 %type <windowFrameExtents>  window_frame_extents
 %type <windowFrameExtent>   window_frame_extent
 %type <u32>                 opt_nulls_treatment nulls_treatment opt_from_first_last agg_quantifier
+%type <u32>                 opt_agg_count
+%type <aggOptions>          agg_options opt_agg_options agg_overflow opt_agg_overflow
+%type <s>                   opt_agg_filler
 
 %type <isolationLevel>      opt_isolation_level isolation_level isolation_val
 %type <s>                   opt_savepoint savepoint_name
@@ -551,6 +618,8 @@ role_stmt
 |
 function_stmt
 |
+task_stmt
+|
 transaction_stmt
 ;
 
@@ -757,6 +826,14 @@ drop_function
 execute_function
 ;
 
+task_stmt:
+create_task
+|
+drop_task
+|
+alter_task
+;
+
 transaction_stmt:
 start_transaction
 |
@@ -880,14 +957,16 @@ select_from
 from_select:
 opt_with from opt_let opt_where opt_group opt_window_clause select_clause
 {
-    $$ = algebra.NewSubselect($1, $2, $3, $4, $5, $6, $7)
+    $$ = algebra.NewSubselect($1.Bindings(), $2, $3, $4, $5, $6, $7)
+    $$.SetRecursive($1.Recursive())
 }
 ;
 
 select_from:
 opt_with select_clause opt_from opt_let opt_where opt_group opt_window_clause
 {
-    $$ = algebra.NewSubselect($1, $3, $4, $5, $6, $7, $2)
+    $$ = algebra.NewSubselect($1.Bindings(), $3, $4, $5, $6, $7, $2)
+    $$.SetRecursive($1.Recursive())
 }
 ;
 
@@ -1464,7 +1543,15 @@ opt_with:
 |
 WITH with_list
 {
-    $$ = $2
+    $$ = &withClause{bindings: $2}
+}
+|
+WITH IDENT recursive_with_list
+{
+    if strings.ToLower($2) != "recursive" {
+        yylex.Error(fmt.Sprintf("syntax error - unexpected %s after WITH", $2))
+    }
+    $$ = $3
 }
 ;
 
@@ -1492,6 +1579,46 @@ alias AS paren_expr
 }
 ;
 
+recursive_with_list:
+with_term opt_recursive_options opt_cycle
+{
+    $$ = &withClause{
+        bindings:  expression.Bindings{$1},
+        recursive: algebra.RecursiveWiths{algebra.NewRecursiveWith($1.Variable(), $2, $3)},
+    }
+}
+|
+recursive_with_list COMMA with_term opt_recursive_options opt_cycle
+{
+    $1.bindings = append($1.bindings, $3)
+    $1.recursive = append($1.recursive, algebra.NewRecursiveWith($3.Variable(), $4, $5))
+    $$ = $1
+}
+;
+
+opt_recursive_options:
+/* empty */
+{ $$ = nil }
+|
+OPTIONS expr
+{
+    $$ = $2
+}
+;
+
+opt_cycle:
+/* empty */
+{ $$ = nil }
+|
+IDENT exprs IDENT
+{
+    if strings.ToLower($1) != "cycle" || strings.ToLower($3) != "restrict" {
+        yylex.Error("syntax error - expected CYCLE expressions RESTRICT")
+    }
+    $$ = $2
+}
+;
+
 
 /*************************************************
  *
@@ -2946,6 +3073,16 @@ LANGUAGE JAVASCRIPT AS STR AT STR
         $$ = body
     }
 }
+|
+LANGUAGE JAVASCRIPT AS STR
+{
+    body, err := javascript.NewJavascriptInlineBody($4)
+    if err != nil {
+        yylex.Error(err.Error()+yylex.(*lexer).ErrorContext())
+    } else {
+        $$ = body
+    }
+}
 ;
 
 /*************************************************
@@ -2974,6 +3111,74 @@ EXECUTE FUNCTION func_name LPAREN opt_exprs RPAREN
 }
 ;
 
+/*************************************************
+ *
+ * CREATE TASK
+ *
+ *************************************************/
+
+create_task:
+CREATE IDENT task_name opt_if_not_exists IDENT STR AS task_body
+{
+    if strings.ToLower($2) != "task" {
+        yylex.Error(fmt.Sprintf("syntax error - unexpected %s after CREATE", $2))
+    }
+    if strings.ToLower($5) != "schedule" {
+        yylex.Error("syntax error - expected SCHEDULE after task name")
+    }
+    $$ = algebra.NewCreateTask($3, $6, $8, yylex.(*lexer).Remainder($<tokOffset>7), $4)
+}
+;
+
+task_name:
+IDENT
+;
+
+task_body:
+stmt
+|
+execute
+;
+
+/*************************************************
+ *
+ * DROP TASK
+ *
+ *************************************************/
+
+drop_task:
+DROP IDENT task_name opt_if_exists
+{
+    if strings.ToLower($2) != "task" {
+        yylex.Error(fmt.Sprintf("syntax error - unexpected %s after DROP", $2))
+    }
+    $$ = algebra.NewDropTask($3, $4)
+}
+;
+
+/*************************************************
+ *
+ * ALTER TASK
+ *
+ *************************************************/
+
+alter_task:
+ALTER IDENT task_name IDENT
+{
+    if strings.ToLower($2) != "task" {
+        yylex.Error(fmt.Sprintf("syntax error - unexpected %s after ALTER", $2))
+    }
+    switch strings.ToLower($4) {
+    case "pause":
+        $$ = algebra.NewAlterTask($3, true)
+    case "resume":
+        $$ = algebra.NewAlterTask($3, false)
+    default:
+        yylex.Error("syntax error - expected PAUSE or RESUME")
+    }
+}
+;
+
 /*************************************************
  *
  * UPDATE STATISTICS
@@ -3880,6 +4085,8 @@ function_name LPAREN opt_exprs RPAREN opt_filter opt_nulls_treatment opt_window_
             yylex.Error(fmt.Sprintf("RESPECT|IGNORE NULLS syntax is not valid for function %s%s.", fname, ectx))
         } else if ($5 != nil && !algebra.AggregateHasProperty(fname, algebra.AGGREGATE_ALLOWS_FILTER)) {
             yylex.Error(fmt.Sprintf("FILTER clause syntax is not valid for function %s%s.", fname, ectx))
+        } else if algebra.AggregateHasProperty(fname, algebra.AGGREGATE_WITHIN_GROUP) {
+            yylex.Error(fmt.Sprintf("WITHIN GROUP clause is required for function %s%s.", fname, ectx))
         } else if len($3) < f.MinArgs() || len($3) > f.MaxArgs() {
             if f.MinArgs() == f.MaxArgs() {
                 yylex.Error(fmt.Sprintf("Number of arguments to function %s%s must be %d.", fname, ectx, f.MaxArgs()))
@@ -3919,17 +4126,80 @@ function_name LPAREN opt_exprs RPAREN opt_filter opt_nulls_treatment opt_window_
     }
 }
 |
-function_name LPAREN agg_quantifier expr RPAREN opt_filter opt_window_function
+function_name LPAREN opt_exprs RPAREN WITHIN_GROUP LPAREN ORDER BY expr opt_dir RPAREN opt_filter opt_window_function
 {
     fname := $1.Identifier()
-    agg, ok := algebra.GetAggregate(fname, $3 == algebra.AGGREGATE_DISTINCT, ($6 != nil), ($7 != nil))
-    if ok {
-        $$ = agg.Constructor()($4)
+    ectx := $1.ErrorContext()
+    $$ = nil
+    f, ok := algebra.GetAggregate(fname, false, ($12 != nil), ($13 != nil))
+    if !ok || !algebra.AggregateHasProperty(fname, algebra.AGGREGATE_WITHIN_GROUP) {
+        yylex.Error(fmt.Sprintf("WITHIN GROUP clause syntax is not valid for function %s%s.", fname, ectx))
+    } else if len($3)+1 < f.MinArgs() || len($3)+1 > f.MaxArgs() {
+        yylex.Error(fmt.Sprintf("Number of arguments to function %s%s must be %d.", fname, ectx, f.MaxArgs()-1))
+    } else {
+        var flags uint32
+        if $10 {
+            flags = algebra.AGGREGATE_DESCENDING
+        }
+
+        // the ORDER BY expression is the first operand
+        $$ = f.Constructor()(append(expression.Expressions{$9}, $3...)...)
+        if a, ok := $$.(algebra.Aggregate); ok {
+            a.SetAggregateModifiers(flags, $12, $13)
+        }
+        $$.ExprBase().SetErrorContext(yylex.(*lexer).nex.Line()+1,yylex.(*lexer).nex.Column())
+    }
+}
+|
+function_name LPAREN exprs agg_options RPAREN opt_filter opt_window_function
+{
+    fname := $1.Identifier()
+    ectx := $1.ErrorContext()
+    $$ = nil
+    agg, ok := algebra.GetAggregate(fname, false, ($6 != nil), ($7 != nil))
+    if !ok {
+        yylex.Error(fmt.Sprintf("Invalid aggregate function %s%s.", fname, ectx))
+    } else if len($3) < agg.MinArgs() || len($3) > agg.MaxArgs() {
+        if agg.MinArgs() == agg.MaxArgs() {
+            yylex.Error(fmt.Sprintf("Number of arguments to function %s%s must be %d.", fname, ectx, agg.MaxArgs()))
+        } else {
+            yylex.Error(fmt.Sprintf("Number of arguments to function %s%s must be between %d and %d.", fname, ectx, agg.MinArgs(), agg.MaxArgs()))
+        }
+    } else {
+        $$ = agg.Constructor()($3...)
         if a, ok := $$.(algebra.Aggregate); ok {
-            a.SetAggregateModifiers($3, $6, $7)
+            a.SetAggregateModifiers(uint32(0), $6, $7)
+            if !setAggregateOptions(yylex, a, len($3), $4, fname, ectx) {
+                $$ = nil
+            }
+        }
+    }
+}
+|
+function_name LPAREN agg_quantifier exprs opt_agg_options RPAREN opt_filter opt_window_function
+{
+    fname := $1.Identifier()
+    ectx := $1.ErrorContext()
+    $$ = nil
+    agg, ok := algebra.GetAggregate(fname, $3 == algebra.AGGREGATE_DISTINCT, ($7 != nil), ($8 != nil))
+    if ok && algebra.AggregateHasProperty(fname, algebra.AGGREGATE_WITHIN_GROUP) {
+        yylex.Error(fmt.Sprintf("WITHIN GROUP clause is required for function %s%s.", fname, ectx))
+    } else if !ok {
+        yylex.Error(fmt.Sprintf("Invalid aggregate function %s%s.", fname, ectx))
+    } else if len($4) < agg.MinArgs() || len($4) > agg.MaxArgs() {
+        if agg.MinArgs() == agg.MaxArgs() {
+            yylex.Error(fmt.Sprintf("Number of arguments to function %s%s must be %d.", fname, ectx, agg.MaxArgs()))
+        } else {
+            yylex.Error(fmt.Sprintf("Number of arguments to function %s%s must be between %d and %d.", fname, ectx, agg.MinArgs(), agg.MaxArgs()))
         }
     } else {
-        yylex.Error(fmt.Sprintf("Invalid aggregate function %s%s.", fname, $1.ErrorContext()))
+        $$ = agg.Constructor()($4...)
+        if a, ok := $$.(algebra.Aggregate); ok {
+            a.SetAggregateModifiers($3, $7, $8)
+            if !setAggregateOptions(yylex, a, len($4), $5, fname, ectx) {
+                $$ = nil
+            }
+        }
     }
 }
 |
@@ -4374,6 +4644,79 @@ DISTINCT
 }
 ;
 
+agg_options:
+order_by opt_agg_overflow
+{
+    $$ = $2
+    if $$ == nil {
+        $$ = &aggregateOptions{}
+    }
+    $$.order = $1
+}
+|
+agg_overflow
+;
+
+opt_agg_options:
+/* empty */
+{ $$ = nil }
+|
+agg_options
+;
+
+agg_overflow:
+ON IDENT IDENT
+{
+    if strings.ToLower($2) != "overflow" || strings.ToLower($3) != "error" {
+        yylex.Error("syntax error - expected ON OVERFLOW ERROR or ON OVERFLOW TRUNCATE")
+    }
+    $$ = &aggregateOptions{overflow: true}
+}
+|
+ON IDENT TRUNCATE opt_agg_filler opt_agg_count
+{
+    if strings.ToLower($2) != "overflow" {
+        yylex.Error("syntax error - expected ON OVERFLOW ERROR or ON OVERFLOW TRUNCATE")
+    }
+    $$ = &aggregateOptions{overflow: true, flags: algebra.AGGREGATE_OVERFLOW_TRUNCATE | $5, filler: $4}
+}
+;
+
+opt_agg_overflow:
+/* empty */
+{ $$ = nil }
+|
+agg_overflow
+;
+
+opt_agg_filler:
+/* empty */
+{ $$ = algebra.STRING_AGG_FILLER }
+|
+STR
+;
+
+opt_agg_count:
+/* empty */
+{ $$ = uint32(0) }
+|
+WITH IDENT
+{
+    if strings.ToLower($2) != "count" {
+        yylex.Error("syntax error - expected WITH COUNT or WITHOUT COUNT")
+    }
+    $$ = uint32(0)
+}
+|
+IDENT IDENT
+{
+    if strings.ToLower($1) != "without" || strings.ToLower($2) != "count" {
+        yylex.Error("syntax error - expected WITH COUNT or WITHOUT COUNT")
+    }
+    $$ = algebra.AGGREGATE_OVERFLOW_NOCOUNT
+}
+;
+
 opt_filter:
 /* empty */
 { $$ = nil }
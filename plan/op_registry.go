@@ -167,6 +167,11 @@ var _OPERATORS = map[string]Operator{
 	"DropFunction":    &DropFunction{},
 	"ExecuteFunction": &ExecuteFunction{},
 
+	// Tasks
+	"CreateTask": &CreateTask{},
+	"DropTask":   &DropTask{},
+	"AlterTask":  &AlterTask{},
+
 	// Index Advisor
 	"AdviseIndex": &Advise{},
 	"IndexAdvice": &IndexAdvice{},
@@ -19,7 +19,8 @@ import (
 )
 
 type PrimaryScan struct {
-	legacy
+	readonly
+	optEstimate
 	index            datastore.PrimaryIndex
 	indexer          datastore.Indexer
 	keyspace         datastore.Keyspace
@@ -29,8 +30,9 @@ type PrimaryScan struct {
 }
 
 func NewPrimaryScan(index datastore.PrimaryIndex, keyspace datastore.Keyspace,
-	term *algebra.KeyspaceTerm, limit expression.Expression, hasDeltaKeyspace bool) *PrimaryScan {
-	return &PrimaryScan{
+	term *algebra.KeyspaceTerm, limit expression.Expression, cost, cardinality float64,
+	size int64, frCost float64, hasDeltaKeyspace bool) *PrimaryScan {
+	rv := &PrimaryScan{
 		index:            index,
 		indexer:          index.Indexer(),
 		keyspace:         keyspace,
@@ -38,6 +40,8 @@ func NewPrimaryScan(index datastore.PrimaryIndex, keyspace datastore.Keyspace,
 		limit:            limit,
 		hasDeltaKeyspace: hasDeltaKeyspace,
 	}
+	setOptEstimate(&rv.optEstimate, cost, cardinality, size, frCost)
+	return rv
 }
 
 func (this *PrimaryScan) Accept(visitor Visitor) (interface{}, error) {
@@ -94,6 +98,10 @@ func (this *PrimaryScan) MarshalBase(f func(map[string]interface{})) map[string]
 		r["has_delta_keyspace"] = this.hasDeltaKeyspace
 	}
 
+	if optEstimate := marshalOptEstimate(&this.optEstimate); optEstimate != nil {
+		r["optimizer_estimates"] = optEstimate
+	}
+
 	if f != nil {
 		f(r)
 	}
@@ -102,16 +110,17 @@ func (this *PrimaryScan) MarshalBase(f func(map[string]interface{})) map[string]
 
 func (this *PrimaryScan) UnmarshalJSON(body []byte) error {
 	var _unmarshalled struct {
-		_                string              `json:"#operator"`
-		Index            string              `json:"index"`
-		Namespace        string              `json:"namespace"`
-		Bucket           string              `json:"bucket"`
-		Scope            string              `json:"scope"`
-		Keyspace         string              `json:"keyspace"`
-		As               string              `json:"as"`
-		Using            datastore.IndexType `json:"using"`
-		Limit            string              `json:"limit"`
-		HasDeltaKeyspace bool                `json:"has_delta_keyspace"`
+		_                string                 `json:"#operator"`
+		Index            string                 `json:"index"`
+		Namespace        string                 `json:"namespace"`
+		Bucket           string                 `json:"bucket"`
+		Scope            string                 `json:"scope"`
+		Keyspace         string                 `json:"keyspace"`
+		As               string                 `json:"as"`
+		Using            datastore.IndexType    `json:"using"`
+		Limit            string                 `json:"limit"`
+		HasDeltaKeyspace bool                   `json:"has_delta_keyspace"`
+		OptEstimate      map[string]interface{} `json:"optimizer_estimates"`
 	}
 
 	err := json.Unmarshal(body, &_unmarshalled)
@@ -127,6 +136,8 @@ func (this *PrimaryScan) UnmarshalJSON(body []byte) error {
 		}
 	}
 
+	unmarshalOptEstimate(&this.optEstimate, _unmarshalled.OptEstimate)
+
 	this.term = algebra.NewKeyspaceTermFromPath(algebra.NewPathShortOrLong(_unmarshalled.Namespace, _unmarshalled.Bucket,
 		_unmarshalled.Scope, _unmarshalled.Keyspace), _unmarshalled.As, nil, nil)
 	this.keyspace, err = datastore.GetKeyspace(this.term.Path().Parts()...)
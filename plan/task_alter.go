@@ -0,0 +1,77 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package plan
+
+import (
+	"encoding/json"
+
+	"github.com/couchbase/query/algebra"
+)
+
+// Pause or resume a task
+type AlterTask struct {
+	ddl
+	name  string
+	pause bool
+}
+
+func NewAlterTask(node *algebra.AlterTask) *AlterTask {
+	return &AlterTask{
+		name:  node.Name(),
+		pause: node.Pause(),
+	}
+}
+
+func (this *AlterTask) Name() string {
+	return this.name
+}
+
+func (this *AlterTask) Pause() bool {
+	return this.pause
+}
+
+func (this *AlterTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitAlterTask(this)
+}
+
+func (this *AlterTask) New() Operator {
+	return &AlterTask{}
+}
+
+func (this *AlterTask) MarshalJSON() ([]byte, error) {
+	return json.Marshal(this.MarshalBase(nil))
+}
+
+func (this *AlterTask) MarshalBase(f func(map[string]interface{})) map[string]interface{} {
+	r := map[string]interface{}{"#operator": "AlterTask"}
+	r["name"] = this.name
+	r["pause"] = this.pause
+
+	if f != nil {
+		f(r)
+	}
+	return r
+}
+
+func (this *AlterTask) UnmarshalJSON(bytes []byte) error {
+	var _unmarshalled struct {
+		_     string `json:"#operator"`
+		Name  string `json:"name"`
+		Pause bool   `json:"pause"`
+	}
+
+	err := json.Unmarshal(bytes, &_unmarshalled)
+	if err != nil {
+		return err
+	}
+
+	this.name = _unmarshalled.Name
+	this.pause = _unmarshalled.Pause
+	return nil
+}
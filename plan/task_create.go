@@ -0,0 +1,97 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package plan
+
+import (
+	"encoding/json"
+
+	"github.com/couchbase/query/algebra"
+)
+
+// Create task
+type CreateTask struct {
+	ddl
+	name         string
+	schedule     string
+	text         string
+	failIfExists bool
+}
+
+func NewCreateTask(node *algebra.CreateTask) *CreateTask {
+	return &CreateTask{
+		name:         node.Name(),
+		schedule:     node.Schedule(),
+		text:         node.Text(),
+		failIfExists: node.FailIfExists(),
+	}
+}
+
+func (this *CreateTask) Name() string {
+	return this.name
+}
+
+func (this *CreateTask) Schedule() string {
+	return this.schedule
+}
+
+func (this *CreateTask) Text() string {
+	return this.text
+}
+
+func (this *CreateTask) FailIfExists() bool {
+	return this.failIfExists
+}
+
+func (this *CreateTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitCreateTask(this)
+}
+
+func (this *CreateTask) New() Operator {
+	return &CreateTask{}
+}
+
+func (this *CreateTask) MarshalJSON() ([]byte, error) {
+	return json.Marshal(this.MarshalBase(nil))
+}
+
+func (this *CreateTask) MarshalBase(f func(map[string]interface{})) map[string]interface{} {
+	r := map[string]interface{}{"#operator": "CreateTask"}
+	r["name"] = this.name
+	r["schedule"] = this.schedule
+	r["statement"] = this.text
+	if !this.failIfExists {
+		r["failIfExists"] = this.failIfExists
+	}
+
+	if f != nil {
+		f(r)
+	}
+	return r
+}
+
+func (this *CreateTask) UnmarshalJSON(bytes []byte) error {
+	var _unmarshalled struct {
+		_            string `json:"#operator"`
+		Name         string `json:"name"`
+		Schedule     string `json:"schedule"`
+		Statement    string `json:"statement"`
+		FailIfExists *bool  `json:"failIfExists"`
+	}
+
+	err := json.Unmarshal(bytes, &_unmarshalled)
+	if err != nil {
+		return err
+	}
+
+	this.name = _unmarshalled.Name
+	this.schedule = _unmarshalled.Schedule
+	this.text = _unmarshalled.Statement
+	this.failIfExists = _unmarshalled.FailIfExists == nil || *_unmarshalled.FailIfExists
+	return nil
+}
@@ -0,0 +1,79 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package plan
+
+import (
+	"encoding/json"
+
+	"github.com/couchbase/query/algebra"
+)
+
+// Drop task
+type DropTask struct {
+	ddl
+	name            string
+	failIfNotExists bool
+}
+
+func NewDropTask(node *algebra.DropTask) *DropTask {
+	return &DropTask{
+		name:            node.Name(),
+		failIfNotExists: node.FailIfNotExists(),
+	}
+}
+
+func (this *DropTask) Name() string {
+	return this.name
+}
+
+func (this *DropTask) FailIfNotExists() bool {
+	return this.failIfNotExists
+}
+
+func (this *DropTask) Accept(visitor Visitor) (interface{}, error) {
+	return visitor.VisitDropTask(this)
+}
+
+func (this *DropTask) New() Operator {
+	return &DropTask{}
+}
+
+func (this *DropTask) MarshalJSON() ([]byte, error) {
+	return json.Marshal(this.MarshalBase(nil))
+}
+
+func (this *DropTask) MarshalBase(f func(map[string]interface{})) map[string]interface{} {
+	r := map[string]interface{}{"#operator": "DropTask"}
+	r["name"] = this.name
+	if !this.failIfNotExists {
+		r["failIfNotExists"] = this.failIfNotExists
+	}
+
+	if f != nil {
+		f(r)
+	}
+	return r
+}
+
+func (this *DropTask) UnmarshalJSON(bytes []byte) error {
+	var _unmarshalled struct {
+		_               string `json:"#operator"`
+		Name            string `json:"name"`
+		FailIfNotExists *bool  `json:"failIfNotExists"`
+	}
+
+	err := json.Unmarshal(bytes, &_unmarshalled)
+	if err != nil {
+		return err
+	}
+
+	this.name = _unmarshalled.Name
+	this.failIfNotExists = _unmarshalled.FailIfNotExists == nil || *_unmarshalled.FailIfNotExists
+	return nil
+}
@@ -146,6 +146,11 @@ type Visitor interface {
 	VisitDropFunction(op *DropFunction) (interface{}, error)
 	VisitExecuteFunction(op *ExecuteFunction) (interface{}, error)
 
+	// Task statements
+	VisitCreateTask(op *CreateTask) (interface{}, error)
+	VisitDropTask(op *DropTask) (interface{}, error)
+	VisitAlterTask(op *AlterTask) (interface{}, error)
+
 	// Index Advisor
 	VisitIndexAdvice(op *IndexAdvice) (interface{}, error)
 	VisitAdvise(op *Advise) (interface{}, error)
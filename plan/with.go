@@ -11,22 +11,26 @@ package plan
 import (
 	"encoding/json"
 
+	"github.com/couchbase/query/algebra"
 	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/expression/parser"
 	"github.com/couchbase/query/expression/unmarshal"
 )
 
 type With struct {
 	readonly
 	optEstimate
-	bindings expression.Bindings
-	child    Operator
+	bindings  expression.Bindings
+	recursive algebra.RecursiveWiths
+	child     Operator
 }
 
-func NewWith(bindings expression.Bindings, child Operator, cost, cardinality float64,
-	size int64, frCost float64) *With {
+func NewWith(bindings expression.Bindings, recursive algebra.RecursiveWiths, child Operator,
+	cost, cardinality float64, size int64, frCost float64) *With {
 	rv := &With{
-		bindings: bindings,
-		child:    child,
+		bindings:  bindings,
+		recursive: recursive,
+		child:     child,
 	}
 	setOptEstimate(&rv.optEstimate, cost, cardinality, size, frCost)
 	return rv
@@ -44,6 +48,10 @@ func (this *With) Bindings() expression.Bindings {
 	return this.bindings
 }
 
+func (this *With) Recursive() algebra.RecursiveWiths {
+	return this.recursive
+}
+
 func (this *With) Readonly() bool {
 	return this.child.Readonly()
 }
@@ -59,6 +67,9 @@ func (this *With) MarshalJSON() ([]byte, error) {
 func (this *With) MarshalBase(f func(map[string]interface{})) map[string]interface{} {
 	r := map[string]interface{}{"#operator": "With"}
 	r["bindings"] = this.bindings
+	if recursive := this.marshalRecursive(); len(recursive) > 0 {
+		r["recursive"] = recursive
+	}
 	if optEstimate := marshalOptEstimate(&this.optEstimate); optEstimate != nil {
 		r["optimizer_estimates"] = optEstimate
 	}
@@ -72,8 +83,13 @@ func (this *With) MarshalBase(f func(map[string]interface{})) map[string]interfa
 
 func (this *With) UnmarshalJSON(body []byte) error {
 	var _unmarshalled struct {
-		_           string                 `json:"#operator"`
-		Bindings    json.RawMessage        `json:"bindings"`
+		_         string          `json:"#operator"`
+		Bindings  json.RawMessage `json:"bindings"`
+		Recursive []struct {
+			Variable string   `json:"variable"`
+			Options  string   `json:"options"`
+			Cycle    []string `json:"cycle"`
+		} `json:"recursive"`
 		Child       json.RawMessage        `json:"~child"`
 		OptEstimate map[string]interface{} `json:"optimizer_estimates"`
 	}
@@ -89,6 +105,33 @@ func (this *With) UnmarshalJSON(body []byte) error {
 
 	this.bindings, err = unmarshal.UnmarshalBindings(_unmarshalled.Bindings)
 
+	if len(_unmarshalled.Recursive) > 0 {
+		this.recursive = make(algebra.RecursiveWiths, 0, len(_unmarshalled.Recursive))
+		for _, r := range _unmarshalled.Recursive {
+			var options expression.Expression
+			var cycle expression.Expressions
+
+			if r.Options != "" {
+				options, err = parser.Parse(r.Options)
+				if err != nil {
+					return err
+				}
+			}
+			for _, c := range r.Cycle {
+				expr, err := parser.Parse(c)
+				if err != nil {
+					return err
+				}
+				cycle = append(cycle, expr)
+			}
+			this.recursive = append(this.recursive, algebra.NewRecursiveWith(r.Variable, options, cycle))
+		}
+		err = this.bindRecursive()
+		if err != nil {
+			return err
+		}
+	}
+
 	err = json.Unmarshal(_unmarshalled.Child, &child_type)
 	if err != nil {
 		return err
@@ -102,3 +145,48 @@ func (this *With) UnmarshalJSON(body []byte) error {
 
 	return nil
 }
+
+func (this *With) marshalRecursive() []map[string]interface{} {
+	var rv []map[string]interface{}
+	for _, rw := range this.recursive {
+		if !rw.IsRecursive() {
+			continue
+		}
+		r := map[string]interface{}{"variable": rw.Variable()}
+		if rw.Options() != nil {
+			r["options"] = rw.Options().String()
+		}
+		if rw.Cycle() != nil {
+			cycle := make([]string, len(rw.Cycle()))
+			for i, c := range rw.Cycle() {
+				cycle[i] = c.String()
+			}
+			r["cycle"] = cycle
+		}
+		rv = append(rv, r)
+	}
+	return rv
+}
+
+// unmarshalled bindings are not formalized, and the recursive terms
+// need to find the references to themselves
+func (this *With) bindRecursive() error {
+	f := expression.NewFormalizer("", nil)
+	f.SetPermanentWiths(this.bindings)
+	err := f.PushBindings(this.bindings, false)
+	if err != nil {
+		return err
+	}
+	for _, rw := range this.recursive {
+		for _, b := range this.bindings {
+			if b.Variable() == rw.Variable() {
+				err = rw.Bind(b.Expression())
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
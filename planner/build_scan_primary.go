@@ -69,7 +69,15 @@ func (this *builder) buildPrimaryScan(keyspace datastore.Keyspace, node *algebra
 		this.resetOffset()
 	}
 
-	return plan.NewPrimaryScan(primary, keyspace, node, limit, hasDeltaKeyspace), nil
+	cost := OPT_COST_NOT_AVAIL
+	cardinality := OPT_CARD_NOT_AVAIL
+	size := OPT_SIZE_NOT_AVAIL
+	frCost := OPT_COST_NOT_AVAIL
+	if this.useCBO && this.keyspaceUseCBO(node.Alias()) {
+		cost, cardinality, size, frCost = primaryIndexScanCost(primary, this.context.RequestId(), this.context)
+	}
+	return plan.NewPrimaryScan(primary, keyspace, node, limit, cost, cardinality, size, frCost,
+		hasDeltaKeyspace), nil
 }
 
 func (this *builder) buildCoveringPrimaryScan(keyspace datastore.Keyspace, node *algebra.KeyspaceTerm,
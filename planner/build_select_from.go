@@ -132,8 +132,14 @@ func (this *builder) visitFrom(node *algebra.Subselect, group *algebra.Group) er
 		if op != nil {
 			this.addChildren(op)
 		} else {
+			from := node.From()
+			if this.useCBO {
+				from = this.reorderJoins(from)
+				this.from = from
+			}
+
 			// Use FROM clause in index selection
-			_, err = node.From().Accept(this)
+			_, err = from.Accept(this)
 			if err != nil {
 				return err
 			}
@@ -735,7 +741,8 @@ func (this *builder) fastCount(node *algebra.Subselect) (bool, error) {
 	cardinality := OPT_CARD_NOT_AVAIL
 	size := OPT_SIZE_NOT_AVAIL
 	frCost := OPT_COST_NOT_AVAIL
-	if this.useCBO && this.keyspaceUseCBO(from.Alias()) {
+	if this.useCBO && optDocCount(baseKeyspace.Keyspace()) >= 0 {
+		// this.baseKeyspaces is not yet populated
 		cost, cardinality, size, frCost = getCountScanCost()
 	}
 	this.addChildren(plan.NewCountScan(keyspace, from, cost, cardinality, size, frCost))
@@ -327,7 +327,7 @@ func (this *builder) VisitSubselect(node *algebra.Subselect) (interface{}, error
 		if this.useCBO {
 			cost, cardinality, size, frCost = getWithCost(rv, node.With())
 		}
-		rv = plan.NewWith(node.With(), rv, cost, cardinality, size, frCost)
+		rv = plan.NewWith(node.With(), node.Recursive(), rv, cost, cardinality, size, frCost)
 		this.children = make([]plan.Operator, 0, 1)
 		this.addChildren(rv)
 	}
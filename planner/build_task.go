@@ -0,0 +1,26 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package planner
+
+import (
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/plan"
+)
+
+func (this *builder) VisitCreateTask(stmt *algebra.CreateTask) (interface{}, error) {
+	return plan.NewCreateTask(stmt), nil
+}
+
+func (this *builder) VisitDropTask(stmt *algebra.DropTask) (interface{}, error) {
+	return plan.NewDropTask(stmt), nil
+}
+
+func (this *builder) VisitAlterTask(stmt *algebra.AlterTask) (interface{}, error) {
+	return plan.NewAlterTask(stmt), nil
+}
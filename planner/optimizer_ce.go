@@ -0,0 +1,253 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+//
+// +build !enterprise
+
+package planner
+
+import (
+	"math"
+
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/plan"
+)
+
+/*
+The community edition optimizer. Query blocks are planned by the builder,
+using the cost model in optutil_ce.go; the optimizer only enables it.
+*/
+type optimizer struct {
+	builder Builder
+}
+
+func NewOptimizer() Optimizer {
+	return &optimizer{}
+}
+
+func (this *optimizer) Initialize(builder Builder) {
+	this.builder = builder
+}
+
+func (this *optimizer) OptimizeQueryBlock(node algebra.Node) (plan.Operator, error) {
+	return nil, nil
+}
+
+/*
+Reorder a chain of inner ANSI joins of keyspaces, greedily: start with the
+keyspace with the fewest qualifying documents, and add at each step the
+keyspace joined to those already chosen that gives the fewest rows. The ON
+clauses are redistributed so that each conjunct is evaluated by the first
+join where all the keyspaces it references are available.
+
+The FROM clause is returned unchanged if it is not such a chain, if any of
+its keyspaces has no statistics, or if the order does not change.
+*/
+func (this *builder) reorderJoins(from algebra.FromTerm) algebra.FromTerm {
+	terms, onclauses := joinChain(from)
+	if len(terms) < 3 {
+		// with two terms, the hash join already builds on the smaller side
+		return from
+	}
+
+	cards := make(map[string]float64, len(terms))
+	for _, term := range terms {
+		baseKeyspace, ok := this.baseKeyspaces[term.Alias()]
+		if !ok || !this.keyspaceUseCBO(term.Alias()) {
+			return from
+		}
+		card := float64(baseKeyspace.DocCount())
+		for _, fl := range baseKeyspace.Filters() {
+			if fl.Selec() > 0.0 {
+				card *= fl.Selec()
+			}
+		}
+		cards[term.Alias()] = math.Max(1.0, card)
+	}
+
+	first := 0
+	for i, term := range terms {
+		if cards[term.Alias()] < cards[terms[first].Alias()] {
+			first = i
+		}
+	}
+
+	order := []*algebra.KeyspaceTerm{terms[first]}
+	chosen := map[string]bool{terms[first].Alias(): true}
+	card := cards[terms[first].Alias()]
+	for len(order) < len(terms) {
+		var next *algebra.KeyspaceTerm
+		nextCard := math.MaxFloat64
+		for _, term := range terms {
+			if chosen[term.Alias()] {
+				continue
+			}
+			sel, connected := this.joinSelec(term.Alias(), chosen)
+			if !connected {
+				continue
+			}
+			if c := card * cards[term.Alias()] * sel; c < nextCard {
+				next, nextCard = term, c
+			}
+		}
+		if next == nil {
+			// no cartesian products
+			return from
+		}
+		order = append(order, next)
+		chosen[next.Alias()] = true
+		card = math.Max(1.0, nextCard)
+	}
+
+	same := true
+	for i, term := range order {
+		if term != terms[i] {
+			same = false
+			break
+		}
+	}
+	if same {
+		return from
+	}
+
+	// assign each ON clause conjunct to the first join that can evaluate it
+	ons := make([]expression.Expressions, len(order))
+	available := make(map[string]string, len(order))
+	position := make(map[string]int, len(order))
+	for i, term := range order {
+		available[term.Alias()] = term.Alias()
+		position[term.Alias()] = i
+	}
+	for _, onclause := range onclauses {
+		for _, conjunct := range andTerms(onclause) {
+			refs, err := expression.CountKeySpaces(conjunct, available)
+			if err != nil {
+				return from
+			}
+			pos := 1
+			for alias, _ := range refs {
+				if position[alias] > pos {
+					pos = position[alias]
+				}
+			}
+			ons[pos] = append(ons[pos], conjunct)
+		}
+	}
+
+	var left algebra.FromTerm
+	for i, term := range order {
+		right := algebra.NewKeyspaceTermFromPath(term.Path(), term.As(), nil, term.Indexes())
+		property := term.Property() &^ (algebra.TERM_ANSI_JOIN | algebra.TERM_PRIMARY_JOIN)
+		right.SetProperty(property)
+		if i == 0 {
+			left = right
+			continue
+		}
+		if len(ons[i]) == 0 {
+			return from
+		}
+		right.SetAnsiJoin()
+		var on expression.Expression
+		if len(ons[i]) == 1 {
+			on = ons[i][0]
+		} else {
+			on = expression.NewAnd(ons[i]...)
+		}
+		join := algebra.NewAnsiJoin(left, false, right, on)
+		join.SetPushable(true)
+		left = join
+	}
+
+	if baseKeyspace, ok := this.baseKeyspaces[terms[0].Alias()]; ok {
+		baseKeyspace.UnsetPrimaryTerm()
+	}
+	if baseKeyspace, ok := this.baseKeyspaces[order[0].Alias()]; ok {
+		baseKeyspace.SetPrimaryTerm()
+	}
+	return left
+}
+
+// the keyspace terms of a left-deep chain of pushable inner ANSI joins, with
+// their ON clauses; keyspaces referenced by name are expression terms wrapping
+// a keyspace term
+func joinChain(from algebra.FromTerm) ([]*algebra.KeyspaceTerm, expression.Expressions) {
+	var terms []*algebra.KeyspaceTerm
+	var onclauses expression.Expressions
+	for {
+		switch node := from.(type) {
+		case *algebra.AnsiJoin:
+			if node.Outer() || !node.Pushable() || node.IsCommaJoin() || node.Onclause() == nil {
+				return nil, nil
+			}
+			right := algebra.GetKeyspaceTerm(node.Right())
+			if !reorderableTerm(right) {
+				return nil, nil
+			}
+			terms = append(terms, right)
+			onclauses = append(onclauses, node.Onclause())
+			from = node.Left()
+		case algebra.SimpleFromTerm:
+			left := algebra.GetKeyspaceTerm(node)
+			if !reorderableTerm(left) {
+				return nil, nil
+			}
+			terms = append(terms, left)
+			for i, j := 0, len(terms)-1; i < j; i, j = i+1, j-1 {
+				terms[i], terms[j] = terms[j], terms[i]
+			}
+			return terms, onclauses
+		default:
+			return nil, nil
+		}
+	}
+}
+
+func reorderableTerm(term *algebra.KeyspaceTerm) bool {
+	return term != nil && term.Path() != nil && term.FromExpression() == nil && term.Keys() == nil &&
+		term.JoinHint() == algebra.JOIN_HINT_NONE
+}
+
+// the combined selectivity of the join filters between alias and the chosen
+// keyspaces, and whether there are any
+func (this *builder) joinSelec(alias string, chosen map[string]bool) (float64, bool) {
+	baseKeyspace, ok := this.baseKeyspaces[alias]
+	if !ok {
+		return 1.0, false
+	}
+
+	sel := 1.0
+	connected := false
+	for _, fl := range baseKeyspace.JoinFilters() {
+		joined := true
+		for ks, _ := range fl.Keyspaces() {
+			if ks != alias && !chosen[ks] {
+				joined = false
+				break
+			}
+		}
+		if !joined {
+			continue
+		}
+		connected = true
+		if fl.Selec() > 0.0 {
+			sel *= fl.Selec()
+		}
+	}
+	return sel, connected
+}
+
+func andTerms(expr expression.Expression) expression.Expressions {
+	if and, ok := expr.(*expression.And); ok {
+		var terms expression.Expressions
+		for _, op := range and.Operands() {
+			terms = append(terms, andTerms(op)...)
+		}
+		return terms
+	}
+	return expression.Expressions{expr}
+}
@@ -0,0 +1,363 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+//
+// +build !enterprise
+
+package planner
+
+import (
+	"math"
+
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/expression"
+	base "github.com/couchbase/query/plannerbase"
+	"github.com/couchbase/query/statistics"
+	"github.com/couchbase/query/value"
+)
+
+// Selectivity estimation for the community edition cost model.
+//
+// Predicates comparing a key of one keyspace with constants use the histogram
+// collected by UPDATE STATISTICS on that key, if there is one. Equality join
+// predicates use the number of distinct values on either side. Everything else
+// falls back to fixed defaults, and conjuncts are assumed to be independent.
+
+const (
+	_SELEC_MIN       = 1.0e-6
+	_DEF_SELEC_EQ    = 0.05
+	_DEF_SELEC_RANGE = 0.33
+	_DEF_SELEC_IN    = 0.2
+	_DEF_SELEC_LIKE  = 0.1
+	_DEF_SELEC_NULL  = 0.05 // IS NULL, IS MISSING
+	_DEF_SELEC_ANY   = 0.1
+	_DEF_SELEC       = 0.5
+)
+
+// exprSelec returns the selectivity of a predicate, and whether a default
+// was used anywhere in estimating it.
+func exprSelec(keyspaces map[string]string, pred expression.Expression) (float64, bool) {
+	if v := pred.Value(); v != nil {
+		if v.Truth() {
+			return 1.0, false
+		}
+		return _SELEC_MIN, false
+	}
+
+	var sel float64
+	def := false
+
+	switch pred := pred.(type) {
+	case *expression.And:
+		sel = 1.0
+		for _, op := range pred.Operands() {
+			s, d := exprSelec(keyspaces, op)
+			sel *= s
+			def = def || d
+		}
+	case *expression.Or:
+		for _, op := range pred.Operands() {
+			s, d := exprSelec(keyspaces, op)
+			sel = sel + s - sel*s
+			def = def || d
+		}
+	case *expression.Not:
+		sel, def = exprSelec(keyspaces, pred.Operand())
+		sel = 1.0 - sel
+	case *expression.Eq:
+		sel, def = eqSelec(keyspaces, pred.First(), pred.Second())
+	case *expression.LT:
+		sel, def = compSelec(keyspaces, pred.First(), pred.Second(), false)
+	case *expression.LE:
+		sel, def = compSelec(keyspaces, pred.First(), pred.Second(), true)
+	case *expression.Between:
+		sel, def = betweenSelec(keyspaces, pred.First(), pred.Second(), pred.Third())
+	case *expression.In:
+		sel, def = inSelec(keyspaces, pred.First(), pred.Second())
+	case *expression.Like:
+		sel, def = likeSelec(keyspaces, pred)
+	case *expression.IsNull:
+		sel, def = typeSelec(keyspaces, pred.Operand(), _DEF_SELEC_NULL, value.NULL)
+	case *expression.IsMissing:
+		sel, def = typeSelec(keyspaces, pred.Operand(), _DEF_SELEC_NULL, value.MISSING)
+	case *expression.IsNotValued:
+		sel, def = typeSelec(keyspaces, pred.Operand(), 2*_DEF_SELEC_NULL, value.NULL, value.MISSING)
+	case *expression.IsNotNull:
+		sel, def = typeSelec(keyspaces, pred.Operand(), 2*_DEF_SELEC_NULL, value.NULL, value.MISSING)
+		sel = 1.0 - sel
+	case *expression.IsNotMissing:
+		sel, def = typeSelec(keyspaces, pred.Operand(), _DEF_SELEC_NULL, value.MISSING)
+		sel = 1.0 - sel
+	case *expression.IsValued:
+		sel, def = typeSelec(keyspaces, pred.Operand(), 2*_DEF_SELEC_NULL, value.NULL, value.MISSING)
+		sel = 1.0 - sel
+	case *expression.Any, *expression.AnyEvery, *expression.Every:
+		sel, def = _DEF_SELEC_ANY, true
+	default:
+		sel, def = _DEF_SELEC, true
+	}
+
+	return clampSelec(sel), def
+}
+
+func clampSelec(sel float64) float64 {
+	return math.Max(_SELEC_MIN, math.Min(1.0, sel))
+}
+
+// the histogram of an expression that references exactly one keyspace
+func keyHistogram(keyspaces map[string]string, expr expression.Expression) *datastore.Histogram {
+	if len(keyspaces) == 0 {
+		return nil
+	}
+	refs, err := expression.CountKeySpaces(expr, keyspaces)
+	if err != nil || len(refs) != 1 {
+		return nil
+	}
+	for alias, keyspace := range refs {
+		return statistics.GetHistogram(keyspace, alias, expr)
+	}
+	return nil
+}
+
+// the number of distinct values of an expression, if it can be estimated
+func keyDistinct(keyspaces map[string]string, expr expression.Expression) float64 {
+	if h := keyHistogram(keyspaces, expr); h != nil {
+		return statistics.Distinct(h)
+	}
+	return -1.0
+}
+
+func eqSelec(keyspaces map[string]string, first, second expression.Expression) (float64, bool) {
+	if v := second.Value(); v != nil {
+		return eqValueSelec(keyspaces, first, v)
+	}
+	if v := first.Value(); v != nil {
+		return eqValueSelec(keyspaces, second, v)
+	}
+
+	// join predicate, or comparison with a parameter
+	ndv := math.Max(keyDistinct(keyspaces, first), keyDistinct(keyspaces, second))
+	if ndv <= 0.0 && isJoinPred(keyspaces, first, second) {
+		ndv = math.Max(joinDocCount(keyspaces, first), joinDocCount(keyspaces, second))
+	}
+	if ndv > 0.0 {
+		return 1.0 / ndv, false
+	}
+	return _DEF_SELEC_EQ, true
+}
+
+func eqValueSelec(keyspaces map[string]string, key expression.Expression, val value.Value) (float64, bool) {
+	h := keyHistogram(keyspaces, key)
+	if h == nil {
+		return _DEF_SELEC_EQ, true
+	}
+	sel := statistics.EqSelec(h, val)
+	if sel <= 0.0 {
+		// not sampled: at most as frequent as the rarest value
+		sel = 0.5 / statistics.Distinct(h)
+	}
+	return sel, false
+}
+
+func isJoinPred(keyspaces map[string]string, first, second expression.Expression) bool {
+	refs1, err1 := expression.CountKeySpaces(first, keyspaces)
+	refs2, err2 := expression.CountKeySpaces(second, keyspaces)
+	if err1 != nil || err2 != nil || len(refs1) != 1 || len(refs2) != 1 {
+		return false
+	}
+	for alias, _ := range refs1 {
+		_, ok := refs2[alias]
+		return !ok
+	}
+	return false
+}
+
+// without a histogram, assume a join key is unique on the larger side
+func joinDocCount(keyspaces map[string]string, expr expression.Expression) float64 {
+	refs, err := expression.CountKeySpaces(expr, keyspaces)
+	if err != nil {
+		return -1.0
+	}
+	for _, keyspace := range refs {
+		return float64(optDocCount(keyspace))
+	}
+	return -1.0
+}
+
+// first < second, or first <= second if inclusive
+func compSelec(keyspaces map[string]string, first, second expression.Expression, inclusive bool) (
+	float64, bool) {
+
+	if v := second.Value(); v != nil {
+		if h := keyHistogram(keyspaces, first); h != nil {
+			low, _ := statistics.TypeBounds(v.Type())
+			return statistics.RangeSelec(h, low, v, true, inclusive), false
+		}
+	} else if v := first.Value(); v != nil {
+		if h := keyHistogram(keyspaces, second); h != nil {
+			_, high := statistics.TypeBounds(v.Type())
+			return statistics.RangeSelec(h, v, high, inclusive, false), false
+		}
+	}
+	return _DEF_SELEC_RANGE, true
+}
+
+func betweenSelec(keyspaces map[string]string, key, low, high expression.Expression) (float64, bool) {
+	lv := low.Value()
+	hv := high.Value()
+	if lv != nil && hv != nil {
+		if h := keyHistogram(keyspaces, key); h != nil {
+			return statistics.RangeSelec(h, lv, hv, true, true), false
+		}
+	}
+	return _DEF_SELEC_RANGE * _DEF_SELEC_RANGE, true
+}
+
+func inSelec(keyspaces map[string]string, key, list expression.Expression) (float64, bool) {
+	var vals value.Values
+	if v := list.Value(); v != nil && v.Type() == value.ARRAY {
+		for _, a := range v.Actual().([]interface{}) {
+			vals = append(vals, value.NewValue(a))
+		}
+	} else if acons, ok := list.(*expression.ArrayConstruct); ok {
+		for _, op := range acons.Operands() {
+			v := op.Value()
+			if v == nil {
+				return _DEF_SELEC_IN, true
+			}
+			vals = append(vals, v)
+		}
+	} else {
+		return _DEF_SELEC_IN, true
+	}
+
+	sel := 0.0
+	def := false
+	for _, v := range vals {
+		s, d := eqValueSelec(keyspaces, key, v)
+		sel += s
+		def = def || d
+	}
+	return sel, def
+}
+
+func likeSelec(keyspaces map[string]string, pred *expression.Like) (float64, bool) {
+	re := pred.Regexp()
+	if re == nil {
+		return _DEF_SELEC_LIKE, true
+	}
+
+	prefix, complete := re.LiteralPrefix()
+	if complete {
+		return eqValueSelec(keyspaces, pred.First(), value.NewValue(prefix))
+	}
+	h := keyHistogram(keyspaces, pred.First())
+	if prefix == "" || h == nil {
+		return _DEF_SELEC_LIKE, true
+	}
+
+	bytes := []byte(prefix)
+	last := len(bytes) - 1
+	if bytes[last] == math.MaxUint8 {
+		return statistics.RangeSelec(h, value.NewValue(prefix), value.EMPTY_ARRAY_VALUE, true, false), false
+	}
+	bytes[last]++
+	return statistics.RangeSelec(h, value.NewValue(prefix), value.NewValue(string(bytes)), true, false), false
+}
+
+func typeSelec(keyspaces map[string]string, key expression.Expression, defSel float64,
+	types ...value.Type) (float64, bool) {
+
+	h := keyHistogram(keyspaces, key)
+	if h == nil {
+		return defSel, true
+	}
+	sel := 0.0
+	for _, t := range types {
+		sel += statistics.TypeSelec(h, t)
+	}
+	return sel, false
+}
+
+// the selectivity of a conjunction, using the selectivities of the filters of
+// the keyspaces for the conjuncts that are filters, and leaving out those
+// already applied by an index
+func conjunctSelec(expr expression.Expression, baseKeyspaces map[string]*base.BaseKeyspace,
+	keyspaceNames map[string]string, alias string) float64 {
+
+	var terms expression.Expressions
+	if and, ok := expr.(*expression.And); ok {
+		terms = and.Operands()
+	} else {
+		terms = expression.Expressions{expr}
+	}
+
+	sel := 1.0
+	for _, term := range terms {
+		fl := findFilter(term, baseKeyspaces, alias)
+		if fl == nil {
+			s, _ := exprSelec(keyspaceNames, term)
+			sel *= s
+		} else if !fl.HasIndexFlag() {
+			if fl.Selec() > 0.0 {
+				sel *= fl.Selec()
+			} else {
+				s, _ := exprSelec(fl.Keyspaces(), term)
+				sel *= s
+			}
+		}
+	}
+	return clampSelec(sel)
+}
+
+func findFilter(term expression.Expression, baseKeyspaces map[string]*base.BaseKeyspace,
+	alias string) *base.Filter {
+
+	find := func(baseKeyspace *base.BaseKeyspace) *base.Filter {
+		for _, fl := range baseKeyspace.Filters() {
+			if term.EquivalentTo(fl.FltrExpr()) ||
+				(fl.OrigExpr() != nil && term.EquivalentTo(fl.OrigExpr())) {
+				return fl
+			}
+		}
+		return nil
+	}
+
+	if alias != "" {
+		if baseKeyspace, ok := baseKeyspaces[alias]; ok {
+			return find(baseKeyspace)
+		}
+		return nil
+	}
+	for _, baseKeyspace := range baseKeyspaces {
+		if fl := find(baseKeyspace); fl != nil {
+			return fl
+		}
+	}
+	return nil
+}
+
+// a range filter comparing a key with a constant: the key, and whether the
+// constant is the lower bound
+func rangeFilterKey(fl *base.Filter) (expression.Expression, bool) {
+	var first, second expression.Expression
+	switch pred := fl.FltrExpr().(type) {
+	case *expression.LT:
+		first, second = pred.First(), pred.Second()
+	case *expression.LE:
+		first, second = pred.First(), pred.Second()
+	default:
+		return nil, false
+	}
+
+	if second.Value() != nil && first.Value() == nil {
+		return first, false
+	} else if first.Value() != nil && second.Value() == nil {
+		return second, true
+	}
+	return nil, false
+}
@@ -11,12 +11,44 @@
 package planner
 
 import (
+	"math"
+
 	"github.com/couchbase/query/algebra"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/expression"
 	"github.com/couchbase/query/plan"
 	base "github.com/couchbase/query/plannerbase"
+	"github.com/couchbase/query/statistics"
+	"github.com/couchbase/query/value"
+)
+
+// The community edition cost model.
+//
+// Costs are in arbitrary units, roughly the time taken to process one index
+// entry. Cardinalities come from the document counts and histograms collected
+// by UPDATE STATISTICS; keyspaces without statistics are not costed, and the
+// planner falls back to rules for them.
+
+const (
+	_COST_MIN           = 0.001
+	_COST_SCAN_START    = 20.0 // starting an index scan
+	_COST_INDEX_ENTRY   = 1.0  // per index entry returned by a secondary index
+	_COST_PRIMARY_ENTRY = 0.5  // per primary index entry
+	_COST_FETCH         = 10.0 // per document fetched
+	_COST_FETCH_KB      = 2.0  // per KB of documents fetched
+	_COST_EXPR          = 0.1  // per expression evaluated on a row
+	_COST_ROW           = 0.05 // per row passed on by an operator
+	_COST_HASH_BUILD    = 1.0  // per row added to a hash table
+	_COST_HASH_PROBE    = 0.5  // per hash table probe
+	_COST_SORT          = 0.2  // per sort comparison
+	_COST_GROUP         = 1.0  // per row aggregated
+	_COST_MUTATE        = 20.0 // per document written
+	_DEF_DOC_SIZE       = 512  // bytes, when the average is not known
+	_INDEX_KEY_SIZE     = 24   // bytes per index key
+	_DOC_KEY_SIZE       = 32   // bytes per document key
+	_DEF_ARRAY_LEN      = 5.0  // elements per unnested array
+	_DEF_GROUP_RATIO    = 0.1  // groups per row, when not known
 )
 
 func checkCostModel(featureControls uint64) {
@@ -24,251 +56,790 @@ func checkCostModel(featureControls uint64) {
 }
 
 func optDocCount(keyspace string) int64 {
-	return -1
+	docCount, _ := statistics.GetKeyspaceInfo(keyspace)
+	return docCount
 }
 
 func optFilterSelectivity(filter *base.Filter, advisorValidate bool, context *PrepareContext) {
-	return
+	sel, def := exprSelec(filter.Keyspaces(), filter.FltrExpr())
+	filter.SetSelec(sel)
+	filter.SetArraySelec(sel)
+	if def {
+		filter.SetDefSelec()
+	}
+	filter.SetSelecDone()
 }
+
 func optExprSelec(keyspaces map[string]string, pred expression.Expression, advisorValidate bool,
 	context *PrepareContext) (float64, float64) {
-	return OPT_SELEC_NOT_AVAIL, OPT_SELEC_NOT_AVAIL
+	sel, _ := exprSelec(keyspaces, pred)
+	return sel, sel
 }
 
 func optDefInSelec(keyspace, key string, advisorValidate bool) float64 {
-	return OPT_SELEC_NOT_AVAIL
+	return _DEF_SELEC_IN
 }
 
 func optDefLikeSelec(keyspace, key string, advisorValidate bool) float64 {
-	return OPT_SELEC_NOT_AVAIL
+	return _DEF_SELEC_LIKE
 }
 
+// mark the filters evaluated by an index scan: those implied by the index
+// condition, and those on the index keys that the spans restrict
 func optMarkIndexFilters(keys expression.Expressions, spans plan.Spans2,
 	condition expression.Expression, unnestAlias string, baseKeyspace *base.BaseKeyspace) {
-	// no-op
+
+	restricted := make([]bool, len(keys))
+	for _, span := range spans {
+		for i, rg := range span.Ranges {
+			if i < len(restricted) && !wholeRange(rg) {
+				restricted[i] = true
+			}
+		}
+	}
+
+	for _, fl := range baseKeyspace.Filters() {
+		if fl.IsJoin() && !fl.IsOnclause() {
+			continue
+		}
+		if condition != nil && base.SubsetOf(condition, fl.FltrExpr()) {
+			fl.SetIndexFlag()
+			continue
+		}
+		_, _, _, skeys := SargableFor(fl.FltrExpr(), keys, true, true)
+		for i, sargable := range skeys {
+			if sargable && restricted[i] {
+				fl.SetIndexFlag()
+				break
+			}
+		}
+	}
+}
+
+func wholeRange(rg *plan.Range2) bool {
+	return (rg.Low == nil && rg.High == nil) ||
+		rg.HasFlag(plan.RANGE_WHOLE_SPAN) || rg.HasFlag(plan.RANGE_FULL_SPAN)
 }
 
 func optMinCost() float64 {
-	return OPT_COST_NOT_AVAIL
+	return _COST_MIN
 }
 
+// combine the selectivities of a lower and an upper bound on the same key, so
+// that BETWEEN and its equivalents are not estimated as independent ranges
 func optCheckRangeExprs(baseKeyspaces map[string]*base.BaseKeyspace, advisorValidate bool,
 	context *PrepareContext) {
-	// no-op
+
+	for _, baseKeyspace := range baseKeyspaces {
+		lows := make(map[string][]*base.Filter, 4)
+		highs := make(map[string][]*base.Filter, 4)
+		for _, fl := range baseKeyspace.Filters() {
+			if fl.IsJoin() || fl.HasDefSelec() || fl.HasAdjustedSelec() || fl.Selec() <= 0.0 {
+				continue
+			}
+			key, low := rangeFilterKey(fl)
+			if key == nil {
+				continue
+			}
+			s := key.String()
+			if low {
+				lows[s] = append(lows[s], fl)
+			} else {
+				highs[s] = append(highs[s], fl)
+			}
+		}
+
+		for s, lfl := range lows {
+			hfl := highs[s]
+			if len(lfl) != 1 || len(hfl) != 1 {
+				continue
+			}
+			// P(low < x < high) = P(x > low) + P(x < high) - 1
+			sel := clampSelec(lfl[0].Selec() + hfl[0].Selec() - 1.0)
+			lfl[0].SetSelec(sel)
+			lfl[0].SetArraySelec(sel)
+			hfl[0].SetSelec(1.0)
+			hfl[0].SetArraySelec(1.0)
+			lfl[0].SetAdjustedSelec()
+			hfl[0].SetAdjustedSelec()
+		}
+	}
 }
 
 func primaryIndexScanCost(primary datastore.PrimaryIndex, requestId string, context *PrepareContext) (
 	float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	docCount := optDocCount(datastore.IndexQualifiedKeyspacePath(primary))
+	if docCount < 0 {
+		return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	}
+	card := math.Max(1.0, float64(docCount))
+	cost := _COST_SCAN_START + card*_COST_PRIMARY_ENTRY
+	return cost, card, _DOC_KEY_SIZE, _COST_SCAN_START + _COST_PRIMARY_ENTRY
 }
 
 func indexScanCost(index datastore.Index, sargKeys expression.Expressions, requestId string,
 	spans SargSpans, alias string, advisorValidate bool, context *PrepareContext) (
 	float64, float64, float64, int64, float64, error) {
-	return OPT_COST_NOT_AVAIL, OPT_SELEC_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL, errors.NewPlanInternalError("indexScanCost: unexpected in community edition")
+
+	keyspace := datastore.IndexQualifiedKeyspacePath(index)
+	docCount := optDocCount(keyspace)
+	if docCount < 0 {
+		return OPT_COST_NOT_AVAIL, OPT_SELEC_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL,
+			OPT_COST_NOT_AVAIL, nil
+	}
+
+	sel, err := sargSpansSelec(spans)
+	if err != nil {
+		return OPT_COST_NOT_AVAIL, OPT_SELEC_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL,
+			OPT_COST_NOT_AVAIL, err
+	}
+
+	// entries not in a partial index are not scanned at all
+	if cond := index.Condition(); cond != nil {
+		formalizer := expression.NewSelfFormalizer(alias, nil)
+		formalizer.SetIndexScope()
+		cond, err = formalizer.Map(cond.Copy())
+		formalizer.ClearIndexScope()
+		if err == nil {
+			csel, _ := exprSelec(map[string]string{alias: keyspace}, cond)
+			sel *= csel
+		}
+	}
+	sel = clampSelec(sel)
+
+	card := math.Max(1.0, sel*float64(docCount))
+	size := int64(len(sargKeys)*_INDEX_KEY_SIZE + _DOC_KEY_SIZE)
+	cost := _COST_SCAN_START + card*_COST_INDEX_ENTRY
+	return cost, sel, card, size, _COST_SCAN_START + _COST_INDEX_ENTRY, nil
+}
+
+func sargSpansSelec(spans SargSpans) (float64, error) {
+	switch spans := spans.(type) {
+	case *TermSpans:
+		return spans2Selec(spans.spans), nil
+	case *IntersectSpans:
+		sel := 1.0
+		for _, s := range spans.spans {
+			ssel, err := sargSpansSelec(s)
+			if err != nil {
+				return ssel, err
+			}
+			sel *= ssel
+		}
+		return sel, nil
+	case *UnionSpans:
+		sel := 0.0
+		for _, s := range spans.spans {
+			ssel, err := sargSpansSelec(s)
+			if err != nil {
+				return ssel, err
+			}
+			sel = sel + ssel - sel*ssel
+		}
+		return sel, nil
+	}
+	return OPT_SELEC_NOT_AVAIL, errors.NewPlanInternalError("indexScanCost: unexpected span type")
+}
+
+// spans are disjoint ranges of entries, and the ranges of a span restrict
+// successive index keys
+func spans2Selec(spans plan.Spans2) float64 {
+	sel := 0.0
+	for _, span := range spans {
+		ssel := 1.0
+		for _, rg := range span.Ranges {
+			ssel *= rangeSelec(rg)
+		}
+		sel += ssel
+	}
+	return math.Min(1.0, sel)
+}
+
+func rangeSelec(rg *plan.Range2) float64 {
+	if wholeRange(rg) {
+		return 1.0
+	}
+
+	// Selec1 is that of the predicate giving the lower bound, Selec2 that of
+	// the upper bound; for equality and IN, there is only Selec1
+	s1, s2 := rg.Selec1, rg.Selec2
+	switch {
+	case s1 > 0.0 && s2 > 0.0:
+		return clampSelec(s1 + s2 - 1.0)
+	case s1 > 0.0:
+		return s1
+	case s2 > 0.0:
+		return s2
+	case rg.HasFlag(plan.RANGE_VALUED_SPAN):
+		return 1.0 - 2*_DEF_SELEC_NULL
+	case rg.HasFlag(plan.RANGE_NULL_SPAN) || rg.HasFlag(plan.RANGE_MISSING_SPAN):
+		return _DEF_SELEC_NULL
+	case rg.HasFlag(plan.RANGE_EMPTY_SPAN):
+		return _SELEC_MIN
+	case rg.EqualRange() || rg.HasFlag(plan.RANGE_FROM_IN_EXPR):
+		return _DEF_SELEC_EQ
+	}
+	return _DEF_SELEC_RANGE
 }
 
 func getIndexProjectionCost(index datastore.Index, indexProjection *plan.IndexProjection,
 	cardinality float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	keys := 1
+	if indexProjection != nil {
+		keys += len(indexProjection.EntryKeys)
+	}
+	return cardinality * _COST_ROW, cardinality, int64(keys * _INDEX_KEY_SIZE), _COST_ROW
 }
 
 func getIndexGroupAggsCost(index datastore.Index, indexGroupAggs *plan.IndexGroupAggregates,
 	indexProjection *plan.IndexProjection, keyspaces map[string]string,
 	cardinality float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	exprs := make(expression.Expressions, 0, len(indexGroupAggs.Group))
+	for _, key := range indexGroupAggs.Group {
+		exprs = append(exprs, key.Expr)
+	}
+	groups := groupCount(exprs, keyspaces, cardinality)
+	size := int64((len(indexGroupAggs.Group) + len(indexGroupAggs.Aggregates)) * _INDEX_KEY_SIZE)
+	return cardinality * _COST_GROUP, groups, size, cardinality * _COST_GROUP
+}
+
+// the number of groups of rows with the same values of exprs
+func groupCount(exprs expression.Expressions, keyspaces map[string]string, cardinality float64) float64 {
+	if len(exprs) == 0 {
+		return 1.0
+	}
+	groups := 1.0
+	for _, expr := range exprs {
+		ndv := keyDistinct(keyspaces, expr)
+		if ndv <= 0.0 {
+			ndv = math.Max(1.0, cardinality*_DEF_GROUP_RATIO)
+		}
+		groups *= ndv
+		if groups >= cardinality {
+			break
+		}
+	}
+	return math.Max(1.0, math.Min(groups, cardinality))
 }
 
 func getKeyScanCost(keys expression.Expression) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	card := 1.0
+	if v := keys.Value(); v != nil && v.Type() == value.ARRAY {
+		card = math.Max(1.0, float64(len(v.Actual().([]interface{}))))
+	}
+	return card * _COST_ROW, card, _DOC_KEY_SIZE, _COST_ROW
 }
 
 func getFetchCost(keyspace datastore.Keyspace, cardinality float64) (float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	_, size := statistics.GetKeyspaceInfo(keyspace.QualifiedName())
+	if size <= 0 {
+		size = _DEF_DOC_SIZE
+	}
+	perDoc := _COST_FETCH + float64(size)/1024.0*_COST_FETCH_KB
+	return cardinality * perDoc, size, perDoc
 }
 
 func getDistinctScanCost(index datastore.Index, cardinality float64) (float64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL
+	return cardinality * _COST_HASH_BUILD, cardinality
 }
 
+// Expression terms, VALUES and queries without a FROM clause are not costed:
+// only keyspaces with statistics are, and plans that do not reference any
+// such keyspace do not change.
+
 func getExpressionScanCost(expr expression.Expression) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return notAvail()
 }
 
 func getValueScanCost(pairs algebra.Pairs) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return notAvail()
 }
 
 func getDummyScanCost() (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return notAvail()
 }
 
 func getCountScanCost() (float64, float64, int64, float64) {
+	return _COST_SCAN_START, 1.0, _DOC_KEY_SIZE, _COST_SCAN_START
+}
+
+func operatorCosts(op plan.Operator) (cost, cardinality float64, size int64, frCost float64, ok bool) {
+	if op == nil {
+		return
+	}
+	cost, cardinality, size, frCost = op.Cost(), op.Cardinality(), op.Size(), op.FrCost()
+	ok = cost > 0.0 && cardinality > 0.0 && size > 0 && frCost > 0.0
+	return
+}
+
+func notAvail() (float64, float64, int64, float64) {
 	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
 }
 
+// the right-hand side is costed for one probe, with the join predicates used
+// by its index scan included in its cardinality
 func getNLJoinCost(left, right plan.Operator, filters base.Filters, outer bool, op string) (
 	float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
-}
 
+	lcost, lcard, lsize, lfrCost, lok := operatorCosts(left)
+	rcost, rcard, rsize, rfrCost, rok := operatorCosts(right)
+	if !lok || !rok {
+		return notAvail()
+	}
+
+	cost := lcost + lcard*(rcost+rcard*_COST_ROW)
+	frCost := lfrCost + rfrCost
+	card := lcard * rcard
+	size := lsize + rsize
+	if op == "nest" {
+		card = lcard
+		size = lsize + int64(math.Ceil(rcard))*rsize
+	}
+	if outer {
+		card = math.Max(card, lcard)
+	}
+	return cost, card, size, frCost
+}
+
+// build the smaller side, unless forced
 func getHashJoinCost(left, right plan.Operator, buildExprs, probeExprs expression.Expressions,
 	buildRight, force bool, filters base.Filters, outer bool, op string) (
 	float64, float64, int64, float64, bool) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL, false
-}
 
+	lcost, lcard, lsize, lfrCost, lok := operatorCosts(left)
+	rcost, rcard, rsize, rfrCost, rok := operatorCosts(right)
+	if !lok || !rok {
+		return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL, false
+	}
+
+	if !force {
+		buildRight = rcard*float64(rsize) <= lcard*float64(lsize)
+	}
+
+	// the equality join predicates are evaluated by the hash table
+	sel := 1.0
+	for _, fl := range filters {
+		if fl.HasHJFlag() && fl.Selec() > 0.0 {
+			sel *= fl.Selec()
+		}
+	}
+
+	var cost, frCost float64
+	nexprs := float64(len(buildExprs))
+	if buildRight {
+		cost = lcost + rcost + rcard*(_COST_HASH_BUILD+nexprs*_COST_EXPR) +
+			lcard*(_COST_HASH_PROBE+nexprs*_COST_EXPR)
+		frCost = rcost + rcard*_COST_HASH_BUILD + lfrCost + _COST_HASH_PROBE
+	} else {
+		cost = lcost + rcost + lcard*(_COST_HASH_BUILD+nexprs*_COST_EXPR) +
+			rcard*(_COST_HASH_PROBE+nexprs*_COST_EXPR)
+		frCost = lcost + lcard*_COST_HASH_BUILD + rfrCost + _COST_HASH_PROBE
+	}
+
+	card := math.Max(1.0, lcard*rcard*sel)
+	size := lsize + rsize
+	if op == "nest" {
+		card = lcard
+		size = lsize + int64(math.Ceil(rcard*sel))*rsize
+	}
+	if outer {
+		card = math.Max(card, lcard)
+	}
+	return cost, card, size, frCost, buildRight
+}
+
+func fetchDocCosts(keyspace string) (float64, int64) {
+	_, size := statistics.GetKeyspaceInfo(keyspace)
+	if size <= 0 {
+		size = _DEF_DOC_SIZE
+	}
+	return _COST_FETCH + float64(size)/1024.0*_COST_FETCH_KB, size
+}
+
+// ON KEYS joins fetch the documents of the keys in each left-hand row
 func getLookupJoinCost(left plan.Operator, outer bool, right *algebra.KeyspaceTerm,
 	rightKeyspace string) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	lcost, lcard, lsize, lfrCost, ok := operatorCosts(left)
+	if !ok {
+		return notAvail()
+	}
+	perDoc, rsize := fetchDocCosts(rightKeyspace)
+	return lcost + lcard*perDoc, lcard, lsize + rsize, lfrCost + perDoc
 }
 
 func getIndexJoinCost(left plan.Operator, outer bool, right *algebra.KeyspaceTerm,
 	rightKeyspace string, covered bool, index datastore.Index, requestId string,
 	advisorValidate bool, context *PrepareContext) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	lcost, lcard, lsize, lfrCost, ok := operatorCosts(left)
+	if !ok {
+		return notAvail()
+	}
+	perRow := _COST_SCAN_START + _COST_INDEX_ENTRY
+	rsize := int64(_DOC_KEY_SIZE)
+	if !covered {
+		perDoc, size := fetchDocCosts(rightKeyspace)
+		perRow += perDoc
+		rsize = size
+	}
+	return lcost + lcard*perRow, lcard, lsize + rsize, lfrCost + perRow
 }
 
 func getLookupNestCost(left plan.Operator, outer bool, right *algebra.KeyspaceTerm,
 	rightKeyspace string) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return getLookupJoinCost(left, outer, right, rightKeyspace)
 }
 
 func getIndexNestCost(left plan.Operator, outer bool, right *algebra.KeyspaceTerm,
 	rightKeyspace string, index datastore.Index, requestId string, advisorValidate bool,
 	context *PrepareContext) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return getIndexJoinCost(left, outer, right, rightKeyspace, false, index, requestId,
+		advisorValidate, context)
 }
 
 func getUnnestCost(node *algebra.Unnest, lastOp plan.Operator,
 	baseKeyspaces map[string]*base.BaseKeyspace, keyspaceNames map[string]string,
 	advisorValidate bool) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	cost, card, size, frCost, ok := operatorCosts(lastOp)
+	if !ok {
+		return notAvail()
+	}
+	ucard := card * _DEF_ARRAY_LEN
+	if node.Outer() {
+		ucard = math.Max(ucard, card)
+	}
+	return cost + ucard*_COST_ROW, ucard, size, frCost + _COST_ROW
 }
 
 func getSimpleFromTermCost(left, right plan.Operator, filters base.Filters) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	lcost, lcard, lsize, lfrCost, lok := operatorCosts(left)
+	rcost, rcard, rsize, rfrCost, rok := operatorCosts(right)
+	if !lok || !rok {
+		return notAvail()
+	}
+	return lcost + lcard*rcost, lcard * rcard, lsize + rsize, lfrCost + rfrCost
 }
 
+// rows are read until one passes the filter
 func getSimpleFilterCost(alias string, cost, cardinality, selec float64, size int64, frCost float64) (
 	float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	selec = clampSelec(selec)
+	cost += cardinality * _COST_EXPR
+	frCost += math.Min(cardinality, 1.0/selec) * _COST_EXPR
+	return cost, math.Max(1.0, cardinality*selec), size, frCost
 }
 
 func getFilterCost(lastOp plan.Operator, expr expression.Expression,
 	baseKeyspaces map[string]*base.BaseKeyspace, keyspaceNames map[string]string,
 	alias string, advisorValidate bool, context *PrepareContext) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	cost, card, size, frCost, ok := operatorCosts(lastOp)
+	if !ok {
+		return notAvail()
+	}
+	return getFilterCostWithInput(expr, baseKeyspaces, keyspaceNames, alias, cost, card, size, frCost,
+		advisorValidate, context)
 }
 
 func getFilterCostWithInput(expr expression.Expression, baseKeyspaces map[string]*base.BaseKeyspace,
 	keyspaceNames map[string]string, alias string, cost, cardinality float64, size int64, frCost float64,
 	advisorValidate bool, context *PrepareContext) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	selec := conjunctSelec(expr, baseKeyspaces, keyspaceNames, alias)
+	return getSimpleFilterCost(alias, cost, cardinality, selec, size, frCost)
 }
 
 func getLetCost(lastOp plan.Operator) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	cost, card, size, frCost, ok := operatorCosts(lastOp)
+	if !ok {
+		return notAvail()
+	}
+	return cost + card*_COST_EXPR, card, size, frCost + _COST_EXPR
 }
 
 func getWithCost(lastOp plan.Operator, with expression.Bindings) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	cost, card, size, frCost, ok := operatorCosts(lastOp)
+	if !ok {
+		return notAvail()
+	}
+	n := float64(len(with))
+	return cost + n*_COST_EXPR, card, size, frCost + n*_COST_EXPR
 }
 
 func getOffsetCost(lastOp plan.Operator, noffset int64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
-}
-
+	cost, card, size, frCost, ok := operatorCosts(lastOp)
+	if !ok {
+		return notAvail()
+	}
+	if noffset > 0 {
+		frCost += math.Min(1.0, float64(noffset)/card) * (cost - frCost)
+		card = math.Max(1.0, card-float64(noffset))
+	}
+	return cost, card, size, frCost
+}
+
+// with a limit, the input is only partly consumed
 func getLimitCost(lastOp plan.Operator, nlimit, noffset int64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	cost, card, size, frCost, ok := operatorCosts(lastOp)
+	if !ok {
+		return notAvail()
+	}
+	if nlimit >= 0 && float64(nlimit) < card {
+		cost = frCost + (cost-frCost)*float64(nlimit)/card
+		card = math.Max(1.0, float64(nlimit))
+	}
+	return cost, card, size, frCost
 }
 
 func getUnnestPredSelec(pred expression.Expression, variable string, mapping expression.Expression,
 	keyspaces map[string]string, advisorValidate bool, context *PrepareContext) float64 {
-	return OPT_SELEC_NOT_AVAIL
+	sel, _ := exprSelec(keyspaces, pred)
+	return sel
 }
 
+// Keep the cheapest index scan, and intersect it with others only as long as
+// this is expected to reduce the total cost.
 func optChooseIntersectScan(keyspace datastore.Keyspace, sargables map[datastore.Index]*indexEntry,
 	nTerms int, alias string, advisorValidate bool, context *PrepareContext) map[datastore.Index]*indexEntry {
-	return sargables
+
+	if len(sargables) <= 1 {
+		return sargables
+	}
+
+	entries := make([]*indexEntry, 0, len(sargables))
+	hasOrder := false
+	for _, e := range sargables {
+		if e.cost <= 0.0 || e.cardinality <= 0.0 || e.selectivity <= 0.0 {
+			return sargables
+		}
+		entries = append(entries, e)
+		if e.IsPushDownProperty(_PUSHDOWN_ORDER) {
+			hasOrder = true
+		}
+	}
+
+	totalCost := func(e *indexEntry, card float64) float64 {
+		cost := e.cost
+		if hasOrder && nTerms > 0 && !e.IsPushDownProperty(_PUSHDOWN_ORDER) {
+			scost, _, _, _ := getSortCost(e.size, nTerms, card, 0, 0)
+			cost += scost
+		}
+		return cost
+	}
+
+	fetchCost := func(card float64) float64 {
+		cost, _, _ := getFetchCost(keyspace, card)
+		return cost
+	}
+
+	// the cheapest single index scan, fetch included
+	var best *indexEntry
+	bestCost := math.MaxFloat64
+	for _, e := range entries {
+		c := totalCost(e, e.cardinality) + fetchCost(e.cardinality)
+		if c < bestCost || (c == bestCost && e.cardinality < best.cardinality) {
+			best, bestCost = e, c
+		}
+	}
+
+	chosen := map[datastore.Index]*indexEntry{best.index: best}
+	if best.IsPushDownProperty(_PUSHDOWN_ORDER) {
+		return chosen
+	}
+
+	// intersecting adds the cost of a scan and reduces the documents fetched
+	scanCost := best.cost
+	sel := best.selectivity
+	docs := best.cardinality / best.selectivity
+	for {
+		var next *indexEntry
+		nextCost := scanCost + fetchCost(docs*sel)
+		for _, e := range entries {
+			if _, ok := chosen[e.index]; ok {
+				continue
+			}
+			c := scanCost + e.cost + fetchCost(math.Max(1.0, docs*sel*e.selectivity))
+			if c < nextCost {
+				next, nextCost = e, c
+			}
+		}
+		if next == nil {
+			break
+		}
+		chosen[next.index] = next
+		scanCost += next.cost
+		sel *= next.selectivity
+	}
+	return chosen
 }
 
 func getSortCost(totalSize int64, nterms int, cardinality float64, limit, offset int64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	n := math.Max(1.0, cardinality)
+	kept := n
+	if limit > 0 {
+		if offset > 0 {
+			limit += offset
+		}
+		kept = math.Max(1.0, math.Min(n, float64(limit)))
+	}
+	cost := n * math.Max(1.0, math.Log2(kept)) * float64(nterms) * _COST_SORT
+	card := n
+	if limit > 0 {
+		card = math.Max(1.0, math.Min(n, float64(limit)))
+	}
+	if totalSize <= 0 {
+		totalSize = _DEF_DOC_SIZE
+	}
+	return cost, card, totalSize, cost
 }
 
 func getInitialProjectCost(projection *algebra.Projection, cost, cardinality float64,
 	size int64, frCost float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	n := float64(len(projection.Terms()))
+	return cost + cardinality*n*_COST_EXPR, cardinality, size, frCost + n*_COST_EXPR
 }
 
+// the initial groups are per parallel stream, merged by the intermediate and
+// final groups
 func getGroupCosts(group *algebra.Group, aggregates algebra.Aggregates, cost, cardinality float64,
 	size int64, keyspaces map[string]string, maxParallelism int) (
 	float64, float64, float64, float64, float64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL
+
+	if maxParallelism <= 0 {
+		maxParallelism = plan.GetMaxParallelism()
+	}
+	groups := groupCount(group.By(), keyspaces, cardinality)
+	naggs := float64(len(aggregates))
+
+	costInitial := cost + cardinality*(_COST_GROUP+naggs*_COST_EXPR)
+	cardInitial := math.Min(cardinality, groups*float64(maxParallelism))
+	costIntermediate := costInitial + cardInitial*(_COST_GROUP+naggs*_COST_EXPR)
+	costFinal := costIntermediate + groups*_COST_ROW
+	return costInitial, cardInitial, costIntermediate, groups, costFinal, groups
 }
 
 func getDistinctCost(terms algebra.ResultTerms, cost, cardinality float64, size int64, frCost float64,
 	keyspaces map[string]string) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+
+	exprs := make(expression.Expressions, 0, len(terms))
+	for _, term := range terms {
+		if term.Star() {
+			// whole documents are rarely duplicates
+			return cost + cardinality*_COST_HASH_BUILD, cardinality, size, frCost + _COST_HASH_BUILD
+		}
+		exprs = append(exprs, term.Expression())
+	}
+	return cost + cardinality*_COST_HASH_BUILD, groupCount(exprs, keyspaces, cardinality), size,
+		frCost + _COST_HASH_BUILD
 }
 
 func getUnionDistinctCost(cost, cardinality float64, first, second plan.Operator, compatible bool) (float64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL
+	return cost + cardinality*_COST_HASH_BUILD, cardinality
 }
 
 func getUnionAllCost(first, second plan.Operator, compatible bool) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	fcost, fcard, fsize, ffrCost, fok := operatorCosts(first)
+	scost, scard, ssize, _, sok := operatorCosts(second)
+	if !fok || !sok {
+		return notAvail()
+	}
+	size := fsize
+	if ssize > size {
+		size = ssize
+	}
+	return fcost + scost, fcard + scard, size, ffrCost
 }
 
 func getIntersectAllCost(first, second plan.Operator, compatible bool) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	fcost, fcard, fsize, _, fok := operatorCosts(first)
+	scost, scard, _, _, sok := operatorCosts(second)
+	if !fok || !sok {
+		return notAvail()
+	}
+	cost := fcost + scost + scard*_COST_HASH_BUILD + fcard*_COST_HASH_PROBE
+	return cost, math.Min(fcard, scard), fsize, fcost + scost + scard*_COST_HASH_BUILD
 }
 
 func getExceptAllCost(first, second plan.Operator, compatible bool) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	fcost, fcard, fsize, _, fok := operatorCosts(first)
+	scost, scard, _, _, sok := operatorCosts(second)
+	if !fok || !sok {
+		return notAvail()
+	}
+	cost := fcost + scost + scard*_COST_HASH_BUILD + fcard*_COST_HASH_PROBE
+	return cost, fcard, fsize, fcost + scost + scard*_COST_HASH_BUILD
+}
+
+func limitCardinality(limit expression.Expression, cardinality float64) float64 {
+	if limit != nil {
+		if v := limit.Value(); v != nil && v.Type() == value.NUMBER {
+			if n := value.AsNumberValue(v).Float64(); n >= 0.0 && n < cardinality {
+				return math.Max(1.0, n)
+			}
+		}
+	}
+	return cardinality
+}
+
+func mutateCost(limit expression.Expression, cost, cardinality float64, size int64, frCost float64) (
+	float64, float64, int64, float64) {
+	card := limitCardinality(limit, cardinality)
+	return cost + card*_COST_MUTATE, card, size, frCost + _COST_MUTATE
 }
 
 func getInsertCost(key, value, options, limit expression.Expression, cost, cardinality float64,
 	size int64, frCost float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return mutateCost(limit, cost, cardinality, size, frCost)
 }
 
 func getUpsertCost(key, value, options expression.Expression, cost, cardinality float64,
 	size int64, frCost float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return mutateCost(nil, cost, cardinality, size, frCost)
 }
 
 func getDeleteCost(limit expression.Expression, cost, cardinality float64,
 	size int64, frCost float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return mutateCost(limit, cost, cardinality, size, frCost)
 }
 
 func getCloneCost(cost, cardinality float64, size int64, frCost float64) (
 	float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	perRow := _COST_ROW * math.Max(1.0, float64(size)/1024.0)
+	return cost + cardinality*perRow, cardinality, size, frCost + perRow
 }
 
 func getUpdateSetCost(set *algebra.Set, cost, cardinality float64,
 	size int64, frCost float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	n := float64(len(set.Terms()))
+	return cost + cardinality*n*_COST_EXPR, cardinality, size, frCost + n*_COST_EXPR
 }
 
 func getUpdateUnsetCost(unset *algebra.Unset, cost, cardinality float64,
 	size int64, frCost float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	n := float64(len(unset.Terms()))
+	return cost + cardinality*n*_COST_EXPR, cardinality, size, frCost + n*_COST_EXPR
 }
 
 func getUpdateSendCost(limit expression.Expression, cost, cardinality float64,
 	size int64, frCost float64) (float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	return mutateCost(limit, cost, cardinality, size, frCost)
 }
 
 func getWindowAggCost(aggs algebra.Aggregates, cost, cardinality float64, size int64, frCost float64) (
 	float64, float64, int64, float64) {
-	return OPT_COST_NOT_AVAIL, OPT_CARD_NOT_AVAIL, OPT_SIZE_NOT_AVAIL, OPT_COST_NOT_AVAIL
+	n := float64(len(aggs))
+	return cost + cardinality*n*_COST_GROUP, cardinality, size, frCost + n*_COST_GROUP
 }
 
 func getKeyspaceSize(keyspace string) int64 {
-	return OPT_SIZE_NOT_AVAIL
+	docCount, avgDocSize := statistics.GetKeyspaceInfo(keyspace)
+	if docCount < 0 || avgDocSize < 0 {
+		return OPT_SIZE_NOT_AVAIL
+	}
+	return docCount * avgDocSize
 }
@@ -477,3 +477,8 @@ func getWindowAggCost(aggs algebra.Aggregates, cost, cardinality float64, size i
 func getKeyspaceSize(keyspace string) int64 {
 	return optutil.GetKeyspaceSize(keyspace)
 }
+
+func (this *builder) reorderJoins(from algebra.FromTerm) algebra.FromTerm {
+	// join enumeration is done by the optimizer
+	return from
+}
@@ -0,0 +1,111 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package planner
+
+import (
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/plan"
+	base "github.com/couchbase/query/plannerbase"
+	"github.com/couchbase/query/util"
+)
+
+// maximum number of geohash cells, and so spans, to cover a bounding box with
+const _GEO_MAX_CELLS = 16
+
+/*
+A geospatial predicate on the geometry of a GEOHASH_ENCODE() index
+key is sarged as a prefix span for each geohash cell that covers its
+bounding box. The cells cover more than the predicate, so the spans
+are never exact.
+
+The geohash of a geometry is that of the center of its bounding box,
+which does not wrap around the antimeridian: a geometry on both sides
+of it has its geohash near longitude 0. Boxes that cross the
+antimeridian therefore cannot be sarged.
+*/
+func (this *sarg) visitGeo(pred expression.GeoBoxFunction) (interface{}, error) {
+	if len(this.context.NamedArgs()) > 0 || len(this.context.PositionalArgs()) > 0 {
+		replaced, err := base.ReplaceParameters(pred, this.context.NamedArgs(), this.context.PositionalArgs())
+		if err != nil {
+			return nil, err
+		}
+		if repFunc, ok := replaced.(expression.GeoBoxFunction); ok {
+			pred = repFunc
+		}
+	}
+
+	if base.SubsetOf(pred, this.key) {
+		if expression.Equivalent(pred, this.key) {
+			return _EXACT_SELF_SPANS, nil
+		}
+		return _SELF_SPANS, nil
+	}
+
+	precision, ok := geohashKey(pred, this.key)
+	if !ok {
+		if pred.DependsOn(this.key) {
+			return _VALUED_SPANS, nil
+		} else {
+			return nil, nil
+		}
+	}
+
+	// the geometry is valid, and so is its geohash, when the predicate is true
+	box, ok := pred.BoundingBox()
+	if !ok || box[0] > box[2] {
+		return _VALUED_SPANS, nil
+	}
+	cells := util.GeohashCover(box[0], box[1], box[2], box[3], precision, _GEO_MAX_CELLS)
+	if len(cells) == 0 {
+		return _VALUED_SPANS, nil
+	}
+
+	selec := this.getSelec(pred)
+
+	// the cells are sorted; adjacent ones make a single span
+	spans := make(plan.Spans2, 0, len(cells))
+	low, high := "", ""
+	n := 0
+	for i, cell := range cells {
+		if cell != high {
+			low = cell
+			n = 0
+		}
+		bytes := []byte(cell)
+		bytes[len(bytes)-1]++
+		high = string(bytes)
+		n++
+
+		if i+1 < len(cells) && cells[i+1] == high {
+			continue
+		}
+		// share the selectivity among the spans by their number of cells
+		selec1 := selec
+		if selec > 0.0 {
+			selec1 = selec * float64(n) / float64(len(cells))
+		}
+		range2 := plan.NewRange2(expression.NewConstant(low), expression.NewConstant(high),
+			datastore.LOW, selec1, OPT_SELEC_NOT_AVAIL, 0)
+		spans = append(spans, plan.NewSpan2(nil, plan.Ranges2{range2}, false))
+	}
+	return NewTermSpans(spans...), nil
+}
+
+/*
+The precision of key, if it is GEOHASH_ENCODE() of the geometry
+of pred with a constant precision.
+*/
+func geohashKey(pred expression.GeoBoxFunction, key expression.Expression) (int, bool) {
+	geohash, ok := key.(*expression.GeohashEncode)
+	if !ok || !pred.Geometry().EquivalentTo(geohash.Operands()[0]) {
+		return 0, false
+	}
+	return geohash.Precision()
+}
@@ -258,6 +258,8 @@ func (this *sargable) VisitFunction(pred expression.Function) (interface{}, erro
 	switch pred := pred.(type) {
 	case *expression.RegexpLike:
 		return this.visitLike(pred)
+	case expression.GeoBoxFunction:
+		return this.visitGeo(pred)
 	}
 
 	return this.visitDefault(pred)
@@ -458,6 +458,19 @@ func (this *scanIdxCol) VisitExecuteFunction(op *plan.ExecuteFunction) (interfac
 	return nil, nil
 }
 
+// Task statements
+func (this *scanIdxCol) VisitCreateTask(op *plan.CreateTask) (interface{}, error) {
+	return nil, nil
+}
+
+func (this *scanIdxCol) VisitDropTask(op *plan.DropTask) (interface{}, error) {
+	return nil, nil
+}
+
+func (this *scanIdxCol) VisitAlterTask(op *plan.AlterTask) (interface{}, error) {
+	return nil, nil
+}
+
 // IndexFtsSearch
 func (this *scanIdxCol) VisitIndexFtsSearch(op *plan.IndexFtsSearch) (interface{}, error) {
 	this.addIndexInfo(extractInfo(op.Index(), this.alias, this.keyspace, false, this.validatePhase))
@@ -115,6 +115,10 @@ func (this *BaseKeyspace) SetPrimaryTerm() {
 	this.ksFlags |= KS_PRIMARY_TERM
 }
 
+func (this *BaseKeyspace) UnsetPrimaryTerm() {
+	this.ksFlags &^= KS_PRIMARY_TERM
+}
+
 func CopyBaseKeyspaces(src map[string]*BaseKeyspace) map[string]*BaseKeyspace {
 	return copyBaseKeyspaces(src, false)
 }
@@ -0,0 +1,292 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package prepareds
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	atomic "github.com/couchbase/go-couchbase/platform"
+	json "github.com/couchbase/go_json"
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/logging"
+	"github.com/couchbase/query/parser/n1ql"
+	"github.com/couchbase/query/plan"
+)
+
+// Optional on disk store for the prepared statements cache, so that
+// statements survive a restart of a node that has no peer to prime from.
+//
+// The store is a single file with one statement per line, in MRU order,
+// each line being the CRC32 of the record followed by the record in JSON.
+// Statements are reprepared when loaded, so that the plans reflect the
+// metadata at the time of the restart.
+// The file is rewritten in the background when the cache has changed, and
+// only as many statements as fit in the size limit are kept.
+
+const (
+	_STORE_FILE     = "prepareds.json"
+	_STORE_INTERVAL = 10 * time.Second
+	_DEF_STORE_SIZE = 64 * 1024 * 1024
+)
+
+type preparedRecord struct {
+	Name            string `json:"name"`
+	QueryContext    string `json:"queryContext,omitempty"`
+	Namespace       string `json:"namespace"`
+	Text            string `json:"text"`
+	Type            string `json:"type,omitempty"`
+	IndexApiVersion int    `json:"indexApiVersion"`
+	FeatureControls uint64 `json:"featureControls"`
+	UseFts          bool   `json:"useFts,omitempty"`
+	UseCBO          bool   `json:"useCBO,omitempty"`
+	EncodedPlan     string `json:"encoded_plan"`
+}
+
+type preparedStore struct {
+	path  string
+	limit int64
+	dirty int32
+}
+
+var persisted *preparedStore
+
+// load the prepared statements saved by a previous incarnation, and start
+// saving the cache to dir. Must be called after PreparedsReprepareInit.
+func PreparedsPersistInit(dir string, limit int64) errors.Error {
+	if dir == "" {
+		return nil
+	}
+	if limit <= 0 {
+		limit = _DEF_STORE_SIZE
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return errors.NewPreparedStoreError("create", dir, err)
+	}
+	this := &preparedStore{path: filepath.Join(dir, _STORE_FILE), limit: limit}
+	this.load()
+	persisted = this
+	go this.flusher()
+	return nil
+}
+
+// flag that the cache needs to be saved
+func preparedsChanged() {
+	if persisted != nil {
+		atomic.StoreInt32(&persisted.dirty, 1)
+	}
+}
+
+func (this *preparedStore) flusher() {
+	ticker := time.NewTicker(_STORE_INTERVAL)
+	defer ticker.Stop()
+	for range ticker.C {
+		if atomic.CompareAndSwapInt32(&this.dirty, 1, 0) {
+			if err := this.save(); err != nil {
+				logging.Errorf("Prepared statements store: %v", err)
+
+				// try again next time round
+				atomic.StoreInt32(&this.dirty, 1)
+			}
+		}
+	}
+}
+
+func (this *preparedStore) load() {
+	f, err := os.Open(this.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Errorf("Prepared statements store: cannot open %v: %v", this.path, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	loaded := 0
+	corrupted := 0
+	failed := 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			rec, ok := readRecord(line)
+			if !ok {
+				corrupted++
+			} else if prepared, err1 := restorePrepared(rec); err1 != nil {
+				failed++
+				logging.Infof("Prepared statements store: cannot restore <ud>%v</ud>: %v",
+					encodeName(rec.Name, rec.QueryContext), err1)
+			} else {
+				prepareds.add(prepared, false, false, nil)
+				loaded++
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				logging.Errorf("Prepared statements store: error reading %v: %v", this.path, err)
+			}
+			break
+		}
+	}
+	if corrupted > 0 {
+		logging.Errorf("Prepared statements store: skipped %v corrupted entries in %v", corrupted, this.path)
+	}
+	logging.Infof("Prepared statements store: restored %v statements, %v failed", loaded, failed)
+
+	// the entries added have marked the cache as changed, and the store will be
+	// rewritten with just the good entries
+}
+
+func (this *preparedStore) save() error {
+	type entry struct {
+		prepared *plan.Prepared
+		lastUse  time.Time
+	}
+
+	entries := make([]entry, 0, CountPrepareds())
+	PreparedsForeach(func(name string, ce *CacheEntry) bool {
+		if ce.Prepared.EncodedPlan() != "" && !prepareds.IsPredefinedPrepareName(ce.Prepared.Name()) {
+			entries = append(entries, entry{ce.Prepared, ce.LastUse})
+		}
+		return true
+	}, nil)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].lastUse.After(entries[j].lastUse)
+	})
+
+	tmp := this.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	size := int64(0)
+	skipped := 0
+	for _, e := range entries {
+		line, err := writeRecord(e.prepared)
+		if err != nil {
+			logging.Infof("Prepared statements store: cannot save <ud>%v</ud>: %v",
+				encodeName(e.prepared.Name(), e.prepared.QueryContext()), err)
+			continue
+		}
+		if size+int64(len(line)) > this.limit {
+			skipped++
+			continue
+		}
+		size += int64(len(line))
+		writer.Write(line)
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmp, this.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if skipped > 0 {
+		logging.Infof("Prepared statements store: %v least recently used statements exceed the size limit of %v bytes and were not saved",
+			skipped, this.limit)
+	}
+	return nil
+}
+
+func writeRecord(prepared *plan.Prepared) ([]byte, error) {
+	rec := &preparedRecord{
+		Name:            prepared.Name(),
+		QueryContext:    prepared.QueryContext(),
+		Namespace:       prepared.Namespace(),
+		Text:            prepared.Text(),
+		Type:            prepared.Type(),
+		IndexApiVersion: prepared.IndexApiVersion(),
+		FeatureControls: prepared.FeatureControls(),
+		UseFts:          prepared.UseFts(),
+		UseCBO:          prepared.UseCBO(),
+		EncodedPlan:     prepared.EncodedPlan(),
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, 0, len(data)+10)
+	line = append(line, fmt.Sprintf("%08x ", crc32.ChecksumIEEE(data))...)
+	line = append(line, data...)
+	return append(line, '\n'), nil
+}
+
+func readRecord(line []byte) (*preparedRecord, bool) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) < 10 || line[8] != ' ' {
+		return nil, false
+	}
+	crc, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil || uint32(crc) != crc32.ChecksumIEEE(line[9:]) {
+		return nil, false
+	}
+	rec := &preparedRecord{}
+	if json.Unmarshal(line[9:], rec) != nil || rec.Name == "" || rec.Text == "" {
+		return nil, false
+	}
+	return rec, true
+}
+
+func restorePrepared(rec *preparedRecord) (*plan.Prepared, errors.Error) {
+
+	// reprepare expects a PREPARE statement
+	stmt, er := n1ql.ParseStatement2(rec.Text, rec.Namespace, rec.QueryContext)
+	if er != nil {
+		return nil, errors.NewUnrecognizedPreparedError(er)
+	}
+	if _, ok := stmt.(*algebra.Prepare); !ok {
+		return nil, errors.NewUnrecognizedPreparedError(fmt.Errorf("not a PREPARE statement"))
+	}
+
+	prepared := plan.NewPrepared(nil, nil, nil)
+	prepared.SetName(rec.Name)
+	prepared.SetText(rec.Text)
+	prepared.SetType(rec.Type)
+	prepared.SetIndexApiVersion(rec.IndexApiVersion)
+	prepared.SetFeatureControls(rec.FeatureControls)
+	prepared.SetNamespace(rec.Namespace)
+	prepared.SetQueryContext(rec.QueryContext)
+	prepared.SetUseFts(rec.UseFts)
+	prepared.SetUseCBO(rec.UseCBO)
+
+	pl, err := reprepare(prepared, nil, nil)
+	if err == nil {
+		return pl, nil
+	}
+
+	// the metadata may not be available yet: fall back to the saved plan,
+	// which will be verified, and reprepared if need be, when first used
+	planBytes, err1 := decodePlan(rec.EncodedPlan)
+	if err1 != nil {
+		return nil, err
+	}
+	pl, err1 = unmarshalPrepared(planBytes, nil, false)
+	if err1 != nil || pl.Name() != rec.Name || pl.QueryContext() != rec.QueryContext {
+		return nil, err
+	}
+	pl.SetEncodedPlan(rec.EncodedPlan)
+	return pl, nil
+}
@@ -0,0 +1,76 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package prepareds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/couchbase/query/plan"
+)
+
+func TestPreparedRecord(t *testing.T) {
+	prepared := plan.NewPrepared(nil, nil, nil)
+	prepared.SetName("p1")
+	prepared.SetText("PREPARE p1 FROM SELECT 1")
+	prepared.SetNamespace("default")
+	prepared.SetQueryContext("default:b1.s1")
+	prepared.SetFeatureControls(12)
+	prepared.SetEncodedPlan(EmptyPlan)
+
+	line, err := writeRecord(prepared)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rec, ok := readRecord(line)
+	if !ok {
+		t.Fatalf("Expected %s to be read back", line)
+	}
+	if rec.Name != "p1" || rec.QueryContext != "default:b1.s1" || rec.FeatureControls != 12 || rec.EncodedPlan != EmptyPlan {
+		t.Fatalf("Unexpected record %v", rec)
+	}
+
+	// a damaged or truncated line is rejected
+	damaged := append([]byte{}, line...)
+	damaged[len(damaged)/2] ^= 1
+	for _, l := range [][]byte{damaged, line[:len(line)/2], []byte("garbage\n"), []byte("\n")} {
+		if _, ok := readRecord(l); ok {
+			t.Errorf("Expected %s to be rejected", l)
+		}
+	}
+}
+
+func TestPreparedStoreCorruption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prepareds_")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	PreparedsInit(16)
+
+	path := filepath.Join(dir, _STORE_FILE)
+	ioutil.WriteFile(path, []byte("00000000 {\"name\":\"p1\"}\nnot a record"), 0600)
+	if err := PreparedsPersistInit(dir, 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() { persisted = nil }()
+	if CountPrepareds() != 0 {
+		t.Fatalf("Expected corrupted entries to be skipped")
+	}
+
+	// the store is rewritten without the bad entries
+	if err := persisted.save(); err != nil {
+		t.Fatalf("Unexpected error saving: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(path); len(data) != 0 {
+		t.Fatalf("Expected an empty store, found %s", data)
+	}
+}
@@ -286,6 +286,7 @@ func (this *preparedCache) add(prepared *plan.Prepared, populated bool, track bo
 		ce.Uses = 1
 		ce.LastUse = when
 	}
+	preparedsChanged()
 	prepareds.cache.Add(ce, encodeName(prepared.Name(), prepared.QueryContext()), func(entry interface{}) util.Operation {
 		var op util.Operation = util.AMEND
 		var cont bool = true
@@ -449,6 +450,7 @@ func AddPrepared(prepared *plan.Prepared) errors.Error {
 
 func DeletePrepared(name string) errors.Error {
 	if prepareds.cache.Delete(name, nil) {
+		preparedsChanged()
 		return nil
 	}
 	return errors.NewNoSuchPreparedError(name)
@@ -607,19 +609,9 @@ func DecodePrepared(prepared_name string, prepared_stmt string, reprep bool) (*p
 func DecodePreparedWithContext(prepared_name string, queryContext string, prepared_stmt string, track bool, phaseTime *time.Duration, reprep bool) (*plan.Prepared, errors.Error) {
 	added := true
 
-	decoded, err := base64.StdEncoding.DecodeString(prepared_stmt)
+	prepared_bytes, err := decodePlan(prepared_stmt)
 	if err != nil {
-		return nil, errors.NewPreparedDecodingError(err)
-	}
-	var buf bytes.Buffer
-	buf.Write(decoded)
-	reader, err := gzip.NewReader(&buf)
-	if err != nil {
-		return nil, errors.NewPreparedDecodingError(err)
-	}
-	prepared_bytes, err := ioutil.ReadAll(reader)
-	if err != nil {
-		return nil, errors.NewPreparedDecodingError(err)
+		return nil, err
 	}
 	prepared, err := unmarshalPrepared(prepared_bytes, phaseTime, reprep)
 	if err != nil {
@@ -686,6 +678,25 @@ func DecodePreparedWithContext(prepared_name string, queryContext string, prepar
 	}
 }
 
+// undo BuildEncodedPlan
+func decodePlan(encoded_plan string) ([]byte, errors.Error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded_plan)
+	if err != nil {
+		return nil, errors.NewPreparedDecodingError(err)
+	}
+	var buf bytes.Buffer
+	buf.Write(decoded)
+	reader, err := gzip.NewReader(&buf)
+	if err != nil {
+		return nil, errors.NewPreparedDecodingError(err)
+	}
+	prepared_bytes, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.NewPreparedDecodingError(err)
+	}
+	return prepared_bytes, nil
+}
+
 func unmarshalPrepared(bytes []byte, phaseTime *time.Duration, reprep bool) (*plan.Prepared, errors.Error) {
 	prepared := plan.NewPrepared(nil, nil, nil)
 	err := prepared.UnmarshalJSON(bytes)
@@ -63,3 +63,15 @@ func (this *Rewrite) VisitDropFunction(stmt *algebra.DropFunction) (interface{},
 func (this *Rewrite) VisitExecuteFunction(stmt *algebra.ExecuteFunction) (interface{}, error) {
 	return stmt, stmt.MapExpressions(this)
 }
+
+func (this *Rewrite) VisitCreateTask(stmt *algebra.CreateTask) (interface{}, error) {
+	return stmt.Statement().Accept(this)
+}
+
+func (this *Rewrite) VisitDropTask(stmt *algebra.DropTask) (interface{}, error) {
+	return stmt, stmt.MapExpressions(this)
+}
+
+func (this *Rewrite) VisitAlterTask(stmt *algebra.AlterTask) (interface{}, error) {
+	return stmt, stmt.MapExpressions(this)
+}
@@ -0,0 +1,242 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/query/errors"
+)
+
+// Schedules of recurring tasks.
+//
+// A schedule is either a fixed interval, specified as "@every <duration>", or
+// a cron specification of minute, hour, day of month, month and day of week,
+// using the server's local time. The usual "@hourly", "@daily", "@weekly",
+// "@monthly" and "@yearly" shorthands are also accepted.
+
+type Schedule interface {
+
+	// the first activation strictly after t, or the zero time if there is none
+	Next(t time.Time) time.Time
+	String() string
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func ParseSchedule(spec string) (Schedule, errors.Error) {
+	s := strings.TrimSpace(spec)
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "@every ") {
+		period, err := time.ParseDuration(strings.TrimSpace(s[len("@every "):]))
+		if err != nil {
+			return nil, errors.NewTaskScheduleError(spec, err)
+		}
+		if period < time.Second {
+			return nil, errors.NewTaskScheduleError(spec, fmt.Errorf("the interval must be at least one second"))
+		}
+		return &interval{spec: s, period: period}, nil
+	}
+	if d, ok := descriptors[lower]; ok {
+		s = d
+	}
+	rv, err := parseCron(s)
+	if err != nil {
+		return nil, errors.NewTaskScheduleError(spec, err)
+	}
+	rv.spec = strings.TrimSpace(spec)
+	return rv, nil
+}
+
+type interval struct {
+	spec   string
+	period time.Duration
+}
+
+func (this *interval) Next(t time.Time) time.Time {
+	return t.Add(this.period)
+}
+
+func (this *interval) String() string {
+	return this.spec
+}
+
+type cronField struct {
+	min   uint
+	max   uint
+	names map[string]uint
+}
+
+var (
+	_MINUTES  = cronField{0, 59, nil}
+	_HOURS    = cronField{0, 23, nil}
+	_DAYS     = cronField{1, 31, nil}
+	_MONTHS   = cronField{1, 12, map[string]uint{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}}
+	_WEEKDAYS = cronField{0, 7, map[string]uint{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}}
+)
+
+// the values of each field are bit sets
+type cron struct {
+	spec       string
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekdays   uint64
+	anyDay     bool
+	anyWeekday bool
+}
+
+func parseCron(spec string) (*cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields (minute, hour, day of month, month, day of week), found %v", len(fields))
+	}
+
+	var err error
+	rv := &cron{spec: spec}
+	if rv.minutes, err = _MINUTES.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if rv.hours, err = _HOURS.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if rv.days, err = _DAYS.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if rv.months, err = _MONTHS.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if rv.weekdays, err = _WEEKDAYS.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	// 7 is also sunday
+	if rv.weekdays&(1<<7) != 0 {
+		rv.weekdays |= 1
+	}
+	rv.anyDay = fields[2] == "*" || fields[2] == "?"
+	rv.anyWeekday = fields[4] == "*" || fields[4] == "?"
+	return rv, nil
+}
+
+// a comma separated list of *, n or n-m, each optionally followed by /step
+func (this *cronField) parse(field string) (uint64, error) {
+	var rv uint64
+
+	for _, item := range strings.Split(field, ",") {
+		var err error
+
+		step := uint(1)
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			step, err = this.number(item[i+1:], false)
+			if err != nil || step == 0 {
+				return 0, fmt.Errorf("invalid step in %v", item)
+			}
+			item = item[:i]
+		}
+
+		low, high := this.min, this.max
+		switch {
+		case item == "*" || item == "?":
+		case strings.IndexByte(item, '-') > 0:
+			i := strings.IndexByte(item, '-')
+			if low, err = this.number(item[:i], true); err != nil {
+				return 0, err
+			}
+			if high, err = this.number(item[i+1:], true); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %v", item)
+			}
+		default:
+			if low, err = this.number(item, true); err != nil {
+				return 0, err
+			}
+
+			// n/step means from n to the end of the range
+			if step == 1 {
+				high = low
+			}
+		}
+		for v := low; v <= high; v += step {
+			rv |= 1 << v
+		}
+	}
+	return rv, nil
+}
+
+func (this *cronField) number(s string, checkRange bool) (uint, error) {
+	if v, ok := this.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %v", s)
+	}
+	if checkRange && (uint(v) < this.min || uint(v) > this.max) {
+		return 0, fmt.Errorf("value %v out of range %v-%v", s, this.min, this.max)
+	}
+	return uint(v), nil
+}
+
+func (this *cron) dayMatches(t time.Time) bool {
+	day := this.days&(1<<uint(t.Day())) != 0
+	weekday := this.weekdays&(1<<uint(t.Weekday())) != 0
+
+	// if both are restricted, either will do
+	switch {
+	case this.anyDay && this.anyWeekday:
+		return true
+	case this.anyDay:
+		return weekday
+	case this.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+func (this *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// no match within five years means never (eg 30th of February)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case this.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !this.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case this.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case this.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (this *cron) String() string {
+	return this.spec
+}
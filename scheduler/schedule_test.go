@@ -0,0 +1,110 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/query/errors"
+)
+
+func TestCronSchedule(t *testing.T) {
+	start := time.Date(2021, time.March, 31, 22, 47, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2021, time.March, 31, 23, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2021, time.April, 1, 9, 0, 0, 0, time.UTC)},
+		{"30 2 1 * *", time.Date(2021, time.April, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, time.April, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * fri", time.Date(2021, time.April, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", start.Add(90 * time.Second)},
+	}
+	for _, c := range cases {
+		s, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", c.spec, err)
+		}
+		if next := s.Next(start); !next.Equal(c.next) {
+			t.Errorf("Expected %v to activate at %v, got %v", c.spec, c.next, next)
+		}
+	}
+
+	if s, err := ParseSchedule("0 0 30 feb *"); err != nil || !s.Next(start).IsZero() {
+		t.Errorf("Expected a schedule that never activates")
+	}
+	for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every 1ms", "@often"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected %v to be rejected", spec)
+		}
+	}
+}
+
+func TestRecurringTask(t *testing.T) {
+	runs := make(chan bool, 10)
+	exec := func(context Context, parms interface{}) (interface{}, []errors.Error) {
+		runs <- true
+		return nil, []errors.Error{errors.NewTaskNotFoundError("test")}
+	}
+	schedule, _ := ParseSchedule("@every 1s")
+	if err := ScheduleRecurringTask("recurring", "test", "", schedule, exec, nil, nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id, _ := TaskId("recurring", "test", "")
+	defer DeleteTask(id)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the task to run again")
+		}
+	}
+
+	if err := PauseTask(id); err != nil {
+		t.Fatalf("Unexpected error pausing: %v", err)
+	}
+
+	// wait for any run in progress to complete
+	time.Sleep(100 * time.Millisecond)
+	var state State
+	var history int
+	TaskDo(id, func(entry *TaskEntry) {
+		state = entry.State
+		history = len(entry.History)
+		info := map[string]interface{}{}
+		entry.DescribeSchedule(info)
+		if info["schedule"] != "@every 1s" || info["lastError"] == nil {
+			t.Errorf("Unexpected description %v", info)
+		}
+	})
+	if state != PAUSED || history < 2 {
+		t.Fatalf("Expected a paused task with 2 runs, got %v with %v", state, history)
+	}
+	for len(runs) > 0 {
+		<-runs
+	}
+	select {
+	case <-runs:
+		t.Fatalf("Expected a paused task not to run")
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	if err := ResumeTask(id); err != nil {
+		t.Fatalf("Unexpected error resuming: %v", err)
+	}
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a resumed task to run")
+	}
+}
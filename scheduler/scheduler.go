@@ -9,6 +9,7 @@
 package scheduler
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/couchbase/query/errors"
@@ -17,6 +18,9 @@ import (
 
 const _LIMIT = 16384
 
+// runs kept in the history of a recurring task
+const _HISTORY = 10
+
 type State string
 
 const (
@@ -25,6 +29,7 @@ const (
 	RUNNING   State = "running"
 	COMPLETED State = "completed"
 	CANCELLED State = "cancelled"
+	PAUSED    State = "paused"
 )
 
 type TaskFunc func(Context, interface{}) (interface{}, []errors.Error)
@@ -43,10 +48,28 @@ type TaskEntry struct {
 	State     State
 	Results   interface{}
 	Errors    []errors.Error
+	Users     []string // who created the task
+
+	// recurring tasks only
+	Schedule      Schedule
+	NextTime      time.Time
+	Runs          int
+	History       []*TaskRun
+	LastError     []errors.Error
+	LastErrorTime time.Time
 
 	timer      *time.Timer
 	parameters interface{}
 	context    Context
+	pausing    bool
+	generation int
+}
+
+// a past execution of a recurring task
+type TaskRun struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Errors    []errors.Error
 }
 
 type schedulerCache struct {
@@ -56,6 +79,19 @@ type schedulerCache struct {
 
 var scheduler = &schedulerCache{}
 
+// called whenever a recurring task is added, run, paused, resumed or deleted
+var recurringChanged func()
+
+func SetRecurringChanged(f func()) {
+	recurringChanged = f
+}
+
+func recurringTasksChanged() {
+	if recurringChanged != nil {
+		recurringChanged()
+	}
+}
+
 // init scheduler cache
 func init() {
 	scheduler.scheduled = util.NewGenCache(-1)
@@ -108,11 +144,19 @@ func TaskDo(key string, f func(*TaskEntry)) {
 }
 
 // scheduler primitives
+func TaskId(name, class, subClass string) (string, errors.Error) {
+	id, err := util.UUIDV5(class+subClass, name)
+	if err != nil {
+		return "", errors.NewSchedulerError("uuid", err)
+	}
+	return id, nil
+}
+
 func ScheduleTask(name, class, subClass string, delay time.Duration, exec, stop TaskFunc, parms interface{}, context Context) errors.Error {
 
-	id, err := util.UUIDV5(class+subClass, name)
+	id, err := TaskId(name, class, subClass)
 	if err != nil {
-		return errors.NewSchedulerError("uuid", err)
+		return err
 	}
 
 	task := &TaskEntry{
@@ -125,6 +169,7 @@ func ScheduleTask(name, class, subClass string, delay time.Duration, exec, stop
 		Stop:       stop,
 		State:      SCHEDULED,
 		Id:         id,
+		Users:      taskUsers(context),
 		parameters: parms,
 		context:    context,
 	}
@@ -197,9 +242,11 @@ func DeleteTask(id string) errors.Error {
 
 	_ = scheduler.scheduled.Get(id, func(ce interface{}) {
 		task = ce.(*TaskEntry)
-		if task.State == SCHEDULED {
+		if task.State == SCHEDULED || task.State == PAUSED {
 			task.State = DELETING
-			task.timer.Stop()
+			if task.timer != nil {
+				task.timer.Stop()
+			}
 		} else {
 			bailOut = true
 		}
@@ -219,6 +266,9 @@ func DeleteTask(id string) errors.Error {
 			res, errs = task.Stop(task.context, task.parameters)
 		}
 		scheduler.scheduled.Delete(id, nil)
+		if task.Schedule != nil {
+			recurringTasksChanged()
+		}
 
 		task.Exec = nil
 		task.Stop = nil
@@ -251,3 +301,255 @@ func DeleteTask(id string) errors.Error {
 
 	return errors.NewTaskNotFoundError(id)
 }
+
+// recurring tasks stay in the scheduled cache, and are rearmed after each execution
+func ScheduleRecurringTask(name, class, subClass string, schedule Schedule, exec, stop TaskFunc, parms interface{}, context Context) errors.Error {
+
+	id, err := TaskId(name, class, subClass)
+	if err != nil {
+		return err
+	}
+
+	if schedule.Next(time.Now()).IsZero() {
+		return errors.NewTaskScheduleError(schedule.String(), fmt.Errorf("the schedule never activates"))
+	}
+
+	task := &TaskEntry{
+		Name:       name,
+		Class:      class,
+		SubClass:   subClass,
+		Schedule:   schedule,
+		PostTime:   time.Now(),
+		Exec:       exec,
+		Stop:       stop,
+		State:      SCHEDULED,
+		Id:         id,
+		Users:      taskUsers(context),
+		parameters: parms,
+		context:    context,
+	}
+
+	// lose any old completed run, so to preserve key uniqueness
+	scheduler.completed.Delete(id, nil)
+
+	// add it to the cache, and arm it while we still hold the lock
+	added := true
+	scheduler.scheduled.Add(task, id, func(ce interface{}) util.Operation {
+		added = false
+		return util.IGNORE
+	})
+	if !added {
+		return errors.NewDuplicateTaskError(name)
+	}
+	scheduler.scheduled.Use(id, func(ce interface{}) {
+		if task.State == SCHEDULED {
+			task.arm()
+		}
+	})
+	recurringTasksChanged()
+	return nil
+}
+
+// put back the execution history of a recurring task saved before a restart
+func RestoreTaskHistory(id string, postTime time.Time, runs int, history []*TaskRun,
+	lastError []errors.Error, lastErrorTime time.Time) errors.Error {
+
+	if scheduler.scheduled.Use(id, func(ce interface{}) {
+		task := ce.(*TaskEntry)
+		task.PostTime = postTime
+		task.Runs = runs
+		task.History = history
+		task.LastError = lastError
+		task.LastErrorTime = lastErrorTime
+	}) == nil {
+		return errors.NewTaskNotFoundError(id)
+	}
+	recurringTasksChanged()
+	return nil
+}
+
+// whether the task is paused, or will be once done running
+func (this *TaskEntry) Paused() bool {
+	return this.State == PAUSED || this.pausing
+}
+
+func (this *TaskEntry) Parameters() interface{} {
+	return this.parameters
+}
+
+// the users whose credentials the task runs with
+func taskUsers(context Context) []string {
+	if context == nil {
+		return nil
+	}
+	return context.AuthenticatedUsers()
+}
+
+// whether the users include one of those who created the task
+func (this *TaskEntry) CreatedBy(users []string) bool {
+	for _, user := range users {
+		for _, creator := range this.Users {
+			if user == creator {
+				return true
+			}
+		}
+	}
+
+	// without authentication, tasks belong to everybody
+	return len(users) == 0 && len(this.Users) == 0
+}
+
+// must be called with the entry locked
+func (this *TaskEntry) arm() {
+	this.generation++
+	generation := this.generation
+	this.NextTime = this.Schedule.Next(time.Now())
+	if this.NextTime.IsZero() {
+		this.State = COMPLETED
+		return
+	}
+	this.timer = time.AfterFunc(this.NextTime.Sub(time.Now()), func() {
+		this.run(generation)
+	})
+}
+
+func (this *TaskEntry) run(generation int) {
+
+	// a timer stopped by a pause or a delete may already have fired
+	bailOut := true
+	scheduler.scheduled.Use(this.Id, func(ce interface{}) {
+		if this.State != SCHEDULED || this.generation != generation {
+			return
+		}
+		bailOut = false
+		this.State = RUNNING
+		this.StartTime = time.Now()
+		this.EndTime = time.Time{}
+	})
+	if bailOut {
+		return
+	}
+
+	res, errs := this.Exec(this.context, this.parameters)
+
+	scheduler.scheduled.Use(this.Id, func(ce interface{}) {
+		this.EndTime = time.Now()
+		this.Results = res
+		this.Errors = errs
+		this.Runs++
+		if len(this.History) >= _HISTORY {
+			copy(this.History, this.History[1:])
+			this.History = this.History[:_HISTORY-1]
+		}
+		this.History = append(this.History, &TaskRun{StartTime: this.StartTime, EndTime: this.EndTime, Errors: errs})
+		if len(errs) > 0 {
+			this.LastError = errs
+			this.LastErrorTime = this.EndTime
+		}
+		if this.pausing {
+			this.pausing = false
+			this.State = PAUSED
+			this.NextTime = time.Time{}
+		} else {
+			this.State = SCHEDULED
+			this.arm()
+		}
+	})
+	recurringTasksChanged()
+}
+
+// stop a recurring task from running until it is resumed
+func PauseTask(id string) errors.Error {
+	var err errors.Error
+
+	if scheduler.scheduled.Use(id, func(ce interface{}) {
+		task := ce.(*TaskEntry)
+		if task.Schedule == nil {
+			err = errors.NewTaskStateError(task.Name, "not recurring", "paused")
+			return
+		}
+		switch task.State {
+		case SCHEDULED:
+			if task.timer != nil {
+				task.timer.Stop()
+			}
+			task.State = PAUSED
+			task.NextTime = time.Time{}
+
+		// we'll pause once done
+		case RUNNING:
+			task.pausing = true
+		}
+	}) == nil {
+		return errors.NewTaskNotFoundError(id)
+	}
+	if err == nil {
+		recurringTasksChanged()
+	}
+	return err
+}
+
+func ResumeTask(id string) errors.Error {
+	var err errors.Error
+
+	if scheduler.scheduled.Use(id, func(ce interface{}) {
+		task := ce.(*TaskEntry)
+		if task.Schedule == nil {
+			err = errors.NewTaskStateError(task.Name, "not recurring", "resumed")
+			return
+		}
+		switch task.State {
+		case PAUSED:
+			task.State = SCHEDULED
+			task.arm()
+		case RUNNING:
+			task.pausing = false
+		}
+	}) == nil {
+		return errors.NewTaskNotFoundError(id)
+	}
+	if err == nil {
+		recurringTasksChanged()
+	}
+	return err
+}
+
+// Add schedule and execution history of recurring tasks to their description
+func (this *TaskEntry) DescribeSchedule(itemMap map[string]interface{}) {
+	if this.Schedule == nil {
+		return
+	}
+	itemMap["schedule"] = this.Schedule.String()
+	itemMap["runs"] = this.Runs
+	if !this.NextTime.IsZero() {
+		itemMap["nextRunTime"] = this.NextTime.String()
+	}
+	if len(this.History) > 0 {
+		history := make([]interface{}, 0, len(this.History))
+		for _, run := range this.History {
+			h := map[string]interface{}{
+				"startTime": run.StartTime.String(),
+				"stopTime":  run.EndTime.String(),
+			}
+			if len(run.Errors) > 0 {
+				h["errors"] = errorObjects(run.Errors)
+			}
+			history = append(history, h)
+		}
+		itemMap["history"] = history
+	}
+	if len(this.LastError) > 0 {
+		itemMap["lastError"] = errorObjects(this.LastError)
+		itemMap["lastErrorTime"] = this.LastErrorTime.String()
+	}
+}
+
+func errorObjects(errs []errors.Error) []interface{} {
+	rv := make([]interface{}, 0, len(errs))
+	for _, err := range errs {
+		if err != nil {
+			rv = append(rv, err.Object())
+		}
+	}
+	return rv
+}
@@ -50,6 +50,55 @@ func (this *SemChecker) visitAggregateFunction(agg algebra.Aggregate) (err error
 			"semantics.visit_aggregate_function.filter")
 	}
 
+	// percentile aggregates need a constant fraction between 0 and 1
+	if algebra.AggregateHasProperty(agg.Name(), algebra.AGGREGATE_FRACTION) {
+		op := agg.Operands()[1]
+		ok := op != nil && op.Static() != nil
+		if ok {
+			val := op.Value()
+			ok = (val == nil || (val.Type() == value.NUMBER && val.(value.NumberValue).Float64() >= 0.0 &&
+				val.(value.NumberValue).Float64() <= 1.0))
+		}
+
+		if !ok {
+			return errors.NewWindowSemanticError(aggName, "", "fraction must be a constant between 0 and 1.",
+				"semantics.visit_aggregate_function.fraction")
+		}
+	}
+
+	// string aggregates need a constant separator and maximum length
+	if algebra.AggregateHasProperty(agg.Name(), algebra.AGGREGATE_OVERFLOW) {
+		ops := agg.Operands()
+		if ops[1] == nil || ops[1].Static() == nil {
+			return errors.NewWindowSemanticError(aggName, "", "separator must be a constant.",
+				"semantics.visit_aggregate_function.separator")
+		}
+
+		if len(ops) > 2 {
+			op := ops[2]
+			ok := op != nil && op.Static() != nil
+			if ok {
+				val := op.Value()
+				ok = (val == nil || (val.Type() == value.NUMBER && val.(value.NumberValue).Float64() > 0.0 &&
+					value.IsInt(val.(value.NumberValue).Float64())))
+			}
+
+			if !ok {
+				return errors.NewWindowSemanticError(aggName, "", "maximum length must be a positive integer constant.",
+					"semantics.visit_aggregate_function.length")
+			}
+		}
+	}
+
+	// with DISTINCT, the values can only be ordered by themselves
+	if stringAgg, ok := agg.(*algebra.StringAgg); ok && agg.Distinct() && stringAgg.Order() != nil {
+		terms := stringAgg.Order().Terms()
+		if len(terms) > 1 || !terms[0].Expression().EquivalentTo(agg.Operands()[0]) {
+			return errors.NewWindowSemanticError(aggName, "ORDER BY clause ", "must only refer to the argument with DISTINCT.",
+				"semantics.visit_aggregate_function.oby")
+		}
+	}
+
 	wTerm := agg.WindowTerm()
 	if wTerm == nil {
 		if algebra.AggregateHasProperty(aggName, algebra.AGGREGATE_ALLOWS_REGULAR) {
@@ -51,9 +51,6 @@ func (this *SemChecker) VisitInferKeyspace(stmt *algebra.InferKeyspace) (interfa
 }
 
 func (this *SemChecker) VisitUpdateStatistics(stmt *algebra.UpdateStatistics) (interface{}, error) {
-	if !this.hasSemFlag(_SEM_ENTERPRISE) {
-		return nil, errors.NewEnterpriseFeature("Update Statistics", "semantics.visit_update_statistics")
-	}
 	if (stmt.IndexAll() || len(stmt.Indexes()) > 0) &&
 		(stmt.Using() != datastore.GSI && stmt.Using() != datastore.DEFAULT) {
 		return nil, errors.NewUpdateStatInvalidIndexTypeError()
@@ -0,0 +1,33 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package semantics
+
+import (
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/errors"
+)
+
+func (this *SemChecker) VisitCreateTask(stmt *algebra.CreateTask) (interface{}, error) {
+
+	// tasks run outside of any transaction, and can't manage other tasks
+	switch stmt.Statement().Type() {
+	case "START_TRANSACTION", "COMMIT", "ROLLBACK", "ROLLBACK_SAVEPOINT", "SET_TRANSACTION_ISOLATION", "SAVEPOINT",
+		"CREATE_TASK", "DROP_TASK", "ALTER_TASK":
+		return nil, errors.NewTaskStatementError(stmt.Statement().Type())
+	}
+	return stmt.Statement().Accept(this)
+}
+
+func (this *SemChecker) VisitDropTask(stmt *algebra.DropTask) (interface{}, error) {
+	return nil, nil
+}
+
+func (this *SemChecker) VisitAlterTask(stmt *algebra.AlterTask) (interface{}, error) {
+	return nil, nil
+}
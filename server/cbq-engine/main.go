@@ -29,6 +29,7 @@ import (
 	datastore_package "github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/datastore/resolver"
 	"github.com/couchbase/query/datastore/system"
+	"github.com/couchbase/query/execution"
 	"github.com/couchbase/query/functions"
 	"github.com/couchbase/query/functions/constructor"
 	"github.com/couchbase/query/logging"
@@ -37,6 +38,7 @@ import (
 	"github.com/couchbase/query/scheduler"
 	server_package "github.com/couchbase/query/server"
 	"github.com/couchbase/query/server/http"
+	"github.com/couchbase/query/statistics"
 	"github.com/couchbase/query/util"
 )
 
@@ -50,10 +52,14 @@ const (
 	_DEF_COMPLETED_THRESHOLD    = 1000
 	_DEF_COMPLETED_LIMIT        = 4000
 	_DEF_PREPARED_LIMIT         = 16384
+	_DEF_PREPARED_STORE_LIMIT   = 64
 	_DEF_FUNCTIONS_LIMIT        = 16384
 	_DEF_DICTIONARY_CACHE_LIMIT = 16384
 	_DEF_TASKS_LIMIT            = 16384
 	_DEF_MEMORY_QUOTA           = 0
+	_DEF_MAX_RECURSION          = 1000
+	_DEF_AUDIT_MAX_SIZE         = 100
+	_DEF_AUDIT_MAX_FILES        = 5
 )
 
 var DATASTORE = flag.String("datastore", "", "Datastore address (http://URL or dir:PATH or mock:)")
@@ -92,6 +98,15 @@ var ENTERPRISE = flag.Bool("enterprise", true, "Enterprise mode")
 var MAX_INDEX_API = flag.Int("max-index-api", datastore_package.INDEX_API_MAX, "Max Index API")
 var N1QL_FEAT_CTRL = flag.Uint64("n1ql-feat-ctrl", util.DEF_N1QL_FEAT_CTRL, "N1QL Feature Controls")
 var MEMORY_QUOTA = flag.Uint64("memory-quota", _DEF_MEMORY_QUOTA, "Maximum amount of document memory allowed per request, in MB")
+var SPILL_THRESHOLD = flag.Uint64("spill-threshold", 0, "Amount of memory an operator can use before spilling to disk, in MB")
+var SPILL_DIR = flag.String("spill-dir", "", "Directory for spill files, defaults to the system temporary directory")
+var MAX_RECURSION = flag.Int("max-recursion", _DEF_MAX_RECURSION, "Maximum number of iterations of a recursive WITH term, 0 for no limit")
+var STATISTICS_DIR = flag.String("statistics-dir", "", "Directory for optimizer statistics of keyspaces that cannot store their own")
+
+// Auditing without an audit daemon
+var AUDIT = flag.String("audit", "", "Local audit sink (file:PATH or syslog[:TAG]), empty to use the cluster audit service")
+var AUDIT_MAX_SIZE = flag.Int64("audit-max-size", _DEF_AUDIT_MAX_SIZE, "maximum size of the audit file before it is rotated, in MB")
+var AUDIT_MAX_FILES = flag.Int("audit-max-files", _DEF_AUDIT_MAX_FILES, "number of rotated audit files to keep")
 
 //cpu and memory profiling flags
 var CPU_PROFILE = flag.String("cpuprofile", "", "write cpu profile to file")
@@ -102,10 +117,13 @@ var COMPLETED_THRESHOLD = flag.Int("completed-threshold", _DEF_COMPLETED_THRESHO
 var COMPLETED_LIMIT = flag.Int("completed-limit", _DEF_COMPLETED_LIMIT, "maximum number of completed requests")
 
 var PREPARED_LIMIT = flag.Int("prepared-limit", _DEF_PREPARED_LIMIT, "maximum number of prepared statements")
+var PREPARED_STORE = flag.String("prepared-store", "", "Directory for saving prepared statements across restarts, empty to disable")
+var PREPARED_STORE_LIMIT = flag.Int64("prepared-store-limit", _DEF_PREPARED_STORE_LIMIT, "maximum size of the prepared statements store, in MB")
 var AUTO_PREPARE = flag.Bool("auto-prepare", false, "Silently prepare ad hoc statements if possible")
 
 var FUNCTIONS_LIMIT = flag.Int("functions-limit", _DEF_FUNCTIONS_LIMIT, "maximum number of cached functions")
 var TASKS_LIMIT = flag.Int("tasks-limit", _DEF_TASKS_LIMIT, "maximum number of cached tasks")
+var TASKS_STORE = flag.String("tasks-store", "", "Directory for saving tasks across restarts, empty to disable")
 
 // GOGC
 var _GOGC_PERCENT_DEFAULT = 200
@@ -321,9 +339,25 @@ func main() {
 		util.SetUseCBO(util.CE_USE_CBO)
 	}
 	server.SetMemoryQuota(*MEMORY_QUOTA)
+	server.SetSpillThreshold(*SPILL_THRESHOLD)
+	server.SetSpillDir(*SPILL_DIR)
+	server.SetMaxRecursion(*MAX_RECURSION)
+	statistics.SetDirectory(*STATISTICS_DIR)
 	server.SetGCPercent(*_GOGC_PERCENT)
+	if err := prepareds.PreparedsPersistInit(*PREPARED_STORE, *PREPARED_STORE_LIMIT*1024*1024); err != nil {
+		logging.Errorf("%v", err.Error())
+	}
+	if err := execution.TasksPersistInit(*TASKS_STORE, server.NewTaskContext); err != nil {
+		logging.Errorf("%v", err.Error())
+	}
 
-	audit.StartAuditService(*DATASTORE, *SERVICERS+*PLUS_SERVICERS)
+	if *AUDIT != "" {
+		if err := audit.StartLocalAuditService(*AUDIT, *AUDIT_MAX_SIZE*1024*1024, *AUDIT_MAX_FILES, *SERVICERS+*PLUS_SERVICERS); err != nil {
+			logging.Errorf("%v", err.Error())
+		}
+	} else {
+		audit.StartAuditService(*DATASTORE, *SERVICERS+*PLUS_SERVICERS)
+	}
 
 	ll := logging.LogLevel().String() // extract first
 	logging.Infoa(func() string {
@@ -54,6 +54,9 @@ const (
 	CLEANUPCLIENTATTEMPTS = "cleanupclientattempts"
 	CLEANUPLOSTATTEMPTS   = "cleanuplostattempts"
 	GCPERCENT             = "gc-percent"
+	SPILLTHRESHOLD        = "spill-threshold"
+	SPILLDIR              = "spill-dir"
+	MAXRECURSION          = "max-recursion"
 )
 
 type Checker func(interface{}) (bool, errors.Error)
@@ -86,6 +89,7 @@ var CHECKERS = map[string]Checker{
 	CLEANUPCLIENTATTEMPTS: checkBool,
 	CLEANUPLOSTATTEMPTS:   checkBool,
 	GCPERCENT:             checkNumber,
+	SPILLDIR:              checkString,
 }
 
 var CHECKERS_MIN = map[string]int{
@@ -98,6 +102,8 @@ var CHECKERS_MIN = map[string]int{
 	FUNCLIMIT:       2,
 	TASKLIMIT:       2,
 	MEMORYQUOTA:     0,
+	SPILLTHRESHOLD:  0,
+	MAXRECURSION:    0,
 	NUMATRS:         2,
 }
 
@@ -59,6 +59,8 @@ type RequestLogEntry struct {
 	ErrorCount               int
 	Errors                   []errors.Error
 	Mutations                uint64
+	SpillCount               uint64
+	SpillSize                uint64
 	PreparedName             string
 	PreparedText             string
 	Time                     time.Time
@@ -537,6 +539,8 @@ func LogRequest(request_time, service_time, transactionElapsedTime time.Duration
 		UseFts:          request.UseFts(),
 		UseCBO:          request.UseCBO(),
 		Mutations:       request.MutationCount(),
+		SpillCount:      request.SpillCount(),
+		SpillSize:       request.SpillSize(),
 		QueryContext:    request.QueryContext(),
 		TxId:            request.TxId(),
 	}
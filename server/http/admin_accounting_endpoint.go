@@ -53,6 +53,7 @@ const (
 	prometheusLow         = "/_prometheusMetrics"
 	prometheusHigh        = "/_prometheusMetricsHigh"
 	transactionsPrefix    = adminPrefix + "/transactions"
+	changesPrefix         = adminPrefix + "/changes"
 	functionsBackupPrefix = "/api/v1"
 )
 
@@ -135,7 +136,7 @@ func (this *HttpEndpoint) registerAccountingHandlers() {
 		this.wrapAPI(w, req, doPrometheusLow)
 	}
 	prometheusHighHandler := func(w http.ResponseWriter, req *http.Request) {
-		this.wrapAPI(w, req, doEmpty)
+		this.wrapAPI(w, req, doPrometheusHigh)
 	}
 	transactionsIndexHandler := func(w http.ResponseWriter, req *http.Request) {
 		this.wrapAPI(w, req, doTransactionsIndex)
@@ -152,6 +153,9 @@ func (this *HttpEndpoint) registerAccountingHandlers() {
 	functionsBucketBackupHandler := func(w http.ResponseWriter, req *http.Request) {
 		this.wrapAPI(w, req, doFunctionsBucketBackup)
 	}
+	changesHandler := func(w http.ResponseWriter, req *http.Request) {
+		this.wrapAPI(w, req, doChanges)
+	}
 	routeMap := map[string]struct {
 		handler handlerFunc
 		methods []string
@@ -184,6 +188,7 @@ func (this *HttpEndpoint) registerAccountingHandlers() {
 		indexesPrefix + "/transactions":            {handler: transactionsIndexHandler, methods: []string{"GET"}},
 		functionsBackupPrefix + "/backup":          {handler: functionsGlobalBackupHandler, methods: []string{"GET", "POST"}},
 		functionsBackupPrefix + "/{bucket}/backup": {handler: functionsBucketBackupHandler, methods: []string{"GET", "POST"}},
+		changesPrefix:                              {handler: changesHandler, methods: []string{"GET"}},
 	}
 
 	for route, h := range routeMap {
@@ -273,28 +278,18 @@ func doPrometheusLow(endpoint *HttpEndpoint, w http.ResponseWriter, req *http.Re
 	}
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	acctStore := endpoint.server.AccountingStore()
-	reg := acctStore.MetricRegistry()
-	for name, metric := range reg.Counters() {
-		w.Write([]byte("# TYPE n1ql_" + name + " counter\n"))
-		w.Write([]byte("n1ql_" + name + " "))
-		w.Write([]byte(fmt.Sprintf("%v\n", metric.Count())))
-	}
-	for name, metric := range reg.Gauges() {
-		w.Write([]byte("# TYPE n1ql_" + name + " gauge\n"))
-		w.Write([]byte("n1ql_" + name + " "))
-		w.Write([]byte(fmt.Sprintf("%v\n", metric.Value())))
-	}
+	pw := &prometheusWriter{}
+	writePrometheusRegistry(pw, endpoint.server.AccountingStore().MetricRegistry())
 	for name, metric := range localData {
-		w.Write([]byte("# TYPE n1ql_" + name + " " + metric + "\n"))
-		w.Write([]byte("n1ql_" + name + " "))
-		w.Write([]byte(fmt.Sprintf("%v\n", localValue(endpoint.server, name))))
+		pw.family(name, metric, "")
+		pw.sample(name, fmt.Sprintf("%v", localValue(endpoint.server, name)))
 	}
+	w.Write(pw.Bytes())
 
 	return textPlain(""), nil
 }
 
-func doEmpty(endpoint *HttpEndpoint, w http.ResponseWriter, req *http.Request, af *audit.ApiAuditFields) (interface{}, errors.Error) {
+func doPrometheusHigh(endpoint *HttpEndpoint, w http.ResponseWriter, req *http.Request, af *audit.ApiAuditFields) (interface{}, errors.Error) {
 	af.EventTypeId = audit.API_DO_NOT_AUDIT
 	err, _ := endpoint.verifyCredentialsFromRequest("", auth.PRIV_QUERY_STATS, req, nil)
 	if err != nil {
@@ -302,6 +297,9 @@ func doEmpty(endpoint *HttpEndpoint, w http.ResponseWriter, req *http.Request, a
 	}
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	pw := &prometheusWriter{}
+	writePrometheusHigh(pw, endpoint.server.Datastore())
+	w.Write(pw.Bytes())
 	return textPlain(""), nil
 }
 
@@ -758,6 +756,7 @@ func doTask(endpoint *HttpEndpoint, w http.ResponseWriter, req *http.Request, af
 			if !entry.EndTime.IsZero() {
 				itemMap["stopTime"] = entry.EndTime.String()
 			}
+			entry.DescribeSchedule(itemMap)
 			res = itemMap
 		})
 		return res, nil
@@ -805,6 +804,7 @@ func doTasks(endpoint *HttpEndpoint, w http.ResponseWriter, req *http.Request, a
 			if !d.EndTime.IsZero() {
 				data[i]["stopTime"] = d.EndTime.String()
 			}
+			d.DescribeSchedule(data[i])
 			i++
 			return true
 		}
@@ -1613,6 +1613,10 @@ func completedRequestWorkHorse(requestId string, profiling bool) interface{} {
 		if request.Mutations != 0 {
 			reqMap["mutations"] = request.Mutations
 		}
+		if request.SpillCount != 0 {
+			reqMap["spills"] = request.SpillCount
+			reqMap["spillSize"] = request.SpillSize
+		}
 		if request.PhaseCounts != nil {
 			reqMap["phaseCounts"] = request.PhaseCounts
 		}
@@ -1722,6 +1726,10 @@ func doCompletedRequests(endpoint *HttpEndpoint, w http.ResponseWriter, req *htt
 		if request.Mutations != 0 {
 			requests[i]["mutations"] = request.Mutations
 		}
+		if request.SpillCount != 0 {
+			requests[i]["spills"] = request.SpillCount
+			requests[i]["spillSize"] = request.SpillSize
+		}
 		if request.PhaseCounts != nil {
 			requests[i]["phaseCounts"] = request.PhaseCounts
 		}
@@ -0,0 +1,154 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	json "github.com/couchbase/go_json"
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/audit"
+	"github.com/couchbase/query/auth"
+	"github.com/couchbase/query/changefeed"
+	"github.com/couchbase/query/clustering"
+	"github.com/couchbase/query/errors"
+)
+
+// /admin/changes streams the mutations performed by queries. Clients that accept
+// text/event-stream get server-sent events whose ids are the sequence numbers of
+// the changes, so that browsers resume where they stopped; other clients get one
+// JSON object per line, and resume with ?since=SEQ. Idle streams get a comment, or
+// an empty line, every 30 seconds.
+//
+// Changes may be limited to some keyspaces with ?keyspace=NAME, which requires
+// the SELECT privilege on them. Following all changes requires cluster admin
+// privileges.
+//
+// The stream ends when the client does not keep up; it may then resume from the
+// last change it received. A reset event, or {"reset":true} line, tells that it
+// resumed too late and changes were missed: it should refresh whatever it derives
+// from the changes.
+
+const _CHANGES_KEEPALIVE = 30 * time.Second
+
+func doChanges(endpoint *HttpEndpoint, w http.ResponseWriter, req *http.Request, af *audit.ApiAuditFields) (interface{}, errors.Error) {
+	af.EventTypeId = audit.API_ADMIN_CHANGES
+	if req.Method != "GET" {
+		return nil, errors.NewServiceErrorHttpMethod(req.Method)
+	}
+
+	query := req.URL.Query()
+	keyspaces := make([]string, 0, len(query["keyspace"]))
+	for _, name := range query["keyspace"] {
+		parts := algebra.ParsePath(name)
+		if len(parts) != 2 && len(parts) != 4 {
+			return nil, errors.NewServiceErrorUnrecognizedValue("keyspace", name)
+		}
+		if parts[0] == "" {
+			parts[0] = "default"
+		}
+		path := algebra.NewPathFromElements(parts)
+		err, _ := endpoint.verifyCredentialsFromRequest(path.SimpleString(), auth.PRIV_QUERY_SELECT, req, af)
+		if err != nil {
+			return nil, err
+		}
+		keyspaces = append(keyspaces, path.FullName())
+	}
+	if len(keyspaces) == 0 {
+		err := endpoint.hasAdminAuth(req, clustering.PRIV_SYS_ADMIN)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sse := strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+	since := query.Get("since")
+	if sse && since == "" {
+		since = req.Header.Get("Last-Event-ID")
+	}
+	var seq uint64
+	if since != "" {
+		var er error
+		seq, er = strconv.ParseUint(since, 10, 64)
+		if er != nil {
+			return nil, errors.NewServiceErrorBadValue(er, "since")
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.NewServiceErrorNotImplemented("streaming", "HTTP connection")
+	}
+
+	sub, complete := changefeed.Subscribe(seq, keyspaces...)
+	defer sub.Close()
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	write := func(event string, id uint64, data []byte) error {
+		var er error
+		if sse {
+			if id > 0 {
+				_, er = fmt.Fprintf(w, "id: %d\n", id)
+			}
+			if er == nil && event != "" {
+				_, er = fmt.Fprintf(w, "event: %s\n", event)
+			}
+			if er == nil {
+				_, er = fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+		} else {
+			_, er = fmt.Fprintf(w, "%s\n", data)
+		}
+		flusher.Flush()
+		return er
+	}
+	if !complete && write("reset", 0, []byte(`{"reset":true}`)) != nil {
+		return textPlain(""), nil
+	}
+
+	keepalive := time.NewTicker(_CHANGES_KEEPALIVE)
+	defer keepalive.Stop()
+	for {
+		var er error
+		select {
+		case change, ok := <-sub.Changes():
+			if !ok {
+				return textPlain(""), nil
+			}
+			data, err := json.Marshal(change)
+			if err != nil {
+				continue
+			}
+			er = write("", change.Seq, data)
+		case <-keepalive.C:
+			if sse {
+				_, er = fmt.Fprint(w, ": keepalive\n\n")
+			} else {
+				_, er = fmt.Fprint(w, "\n")
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			return textPlain(""), nil
+		}
+		if er != nil {
+			return textPlain(""), nil
+		}
+	}
+}
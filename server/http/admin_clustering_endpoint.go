@@ -430,10 +430,23 @@ func settingsWorkHorse(settings map[string]interface{}, srvr *server.Server) err
 		delete(settings, "distribute")
 	}
 
+	// the audit settings belong to the local auditor, not the server
+	auditSettings, ok := settings["audit"]
+	if ok {
+		delete(settings, "audit")
+	}
+
 	if errP := server.ProcessSettings(settings, srvr); errP != nil {
 		return errP
 	}
 
+	if auditSettings != nil {
+		if errA := audit.SetAuditSettings(auditSettings); errA != nil {
+			return errA
+		}
+		settings["audit"] = auditSettings
+	}
+
 	if distribute != nil {
 		body, _ := json.Marshal(settings)
 		go distributed.RemoteAccess().DoRemoteOps([]string{}, "settings", "POST", "", string(body),
@@ -475,6 +488,9 @@ func fillSettings(settings map[string]interface{}, srvr *server.Server) map[stri
 	settings[server.MUTEXPROFILE] = srvr.MutexProfile()
 	settings[server.FUNCLIMIT] = functions.FunctionsLimit()
 	settings[server.MEMORYQUOTA] = srvr.MemoryQuota()
+	settings[server.SPILLTHRESHOLD] = srvr.SpillThreshold()
+	settings[server.SPILLDIR] = srvr.SpillDir()
+	settings[server.MAXRECURSION] = srvr.MaxRecursion()
 	settings[server.USECBO] = srvr.UseCBO()
 	settings[server.ATRCOLLECTION] = srvr.AtrCollection()
 	settings[server.NUMATRS] = srvr.NumAtrs()
@@ -484,6 +500,9 @@ func fillSettings(settings map[string]interface{}, srvr *server.Server) map[stri
 	settings[server.CLEANUPCLIENTATTEMPTS] = tranSettings.CleanupClientAttempts()
 	settings[server.CLEANUPLOSTATTEMPTS] = tranSettings.CleanupLostAttempts()
 	settings[server.GCPERCENT] = srvr.GCPercent()
+	if auditSettings := audit.AuditSettings(); auditSettings != nil {
+		settings["audit"] = auditSettings
+	}
 	return settings
 }
 
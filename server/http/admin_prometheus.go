@@ -0,0 +1,358 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package http
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	atomic "github.com/couchbase/go-couchbase/platform"
+	"github.com/couchbase/query/accounting"
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/prepareds"
+)
+
+// Prometheus text exposition format.
+//
+// The low cardinality endpoint exports the metric registry: counters and
+// gauges as such, meters as rates, timers and histograms as summaries with
+// quantiles, and the latency buckets as histograms labelled by statement type
+// or phase. The high cardinality endpoint exports per keyspace and per
+// prepared statement statistics.
+
+const _PROMETHEUS_PREFIX = "n1ql_"
+
+var prometheusQuantiles = []float64{0.5, 0.8, 0.95, 0.99}
+
+type prometheusWriter struct {
+	bytes.Buffer
+}
+
+func (this *prometheusWriter) family(name, metricType, help string) {
+	if help != "" {
+		this.WriteString("# HELP " + _PROMETHEUS_PREFIX + name + " " + prometheusEscape(help, false) + "\n")
+	}
+	this.WriteString("# TYPE " + _PROMETHEUS_PREFIX + name + " " + metricType + "\n")
+}
+
+// labels alternate names and values
+func (this *prometheusWriter) sample(name string, value string, labels ...string) {
+	this.WriteString(_PROMETHEUS_PREFIX + name)
+	if len(labels) > 0 {
+		this.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				this.WriteByte(',')
+			}
+			this.WriteString(labels[i] + "=\"" + prometheusEscape(labels[i+1], true) + "\"")
+		}
+		this.WriteByte('}')
+	}
+	this.WriteString(" " + value + "\n")
+}
+
+func prometheusEscape(s string, quote bool) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\n", "\\n", -1)
+	if quote {
+		s = strings.Replace(s, "\"", "\\\"", -1)
+	}
+	return s
+}
+
+func prometheusFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func prometheusInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
+
+func prometheusSeconds(ns float64) string {
+	return prometheusFloat(ns / float64(time.Second))
+}
+
+func writePrometheusRegistry(pw *prometheusWriter, reg accounting.MetricRegistry) {
+	counters := reg.Counters()
+	counterNames := make([]string, 0, len(counters))
+	for n := range counters {
+		counterNames = append(counterNames, n)
+	}
+	sort.Strings(counterNames)
+	for _, name := range counterNames {
+		pw.family(name, "counter", accounting.MetricHelp(name))
+		pw.sample(name, prometheusInt(counters[name].Count()))
+	}
+
+	gauges := reg.Gauges()
+	gaugeNames := make([]string, 0, len(gauges))
+	for n := range gauges {
+		gaugeNames = append(gaugeNames, n)
+	}
+	sort.Strings(gaugeNames)
+	for _, name := range gaugeNames {
+		pw.family(name, "gauge", accounting.MetricHelp(name))
+		pw.sample(name, prometheusInt(gauges[name].Value()))
+	}
+
+	meters := reg.Meters()
+	meterNames := make([]string, 0, len(meters))
+	for n := range meters {
+		meterNames = append(meterNames, n)
+	}
+	sort.Strings(meterNames)
+	for _, name := range meterNames {
+		meter := meters[name]
+		pw.family(name, "gauge", accounting.MetricHelp(name))
+		pw.sample(name, prometheusFloat(meter.Rate1()), "window", "1m")
+		pw.sample(name, prometheusFloat(meter.Rate5()), "window", "5m")
+		pw.sample(name, prometheusFloat(meter.Rate15()), "window", "15m")
+		pw.sample(name, prometheusFloat(meter.RateMean()), "window", "mean")
+		pw.family(name+"_count", "counter", "")
+		pw.sample(name+"_count", prometheusInt(meter.Count()))
+	}
+
+	// labelled timers share a family, and a family must be written in one go
+	timers := reg.Timers()
+	families := make(map[string][]string, len(timers))
+	for name := range timers {
+		family, _, _ := accounting.MetricLabel(name)
+		families[family] = append(families[family], name)
+	}
+	familyNames := make([]string, 0, len(families))
+	for n := range families {
+		familyNames = append(familyNames, n)
+	}
+	sort.Strings(familyNames)
+	for _, family := range familyNames {
+		names := families[family]
+		sort.Strings(names)
+		pw.family(family, "summary", accounting.MetricHelp(family))
+		for _, name := range names {
+			timer := timers[name]
+			_, labelName, label := accounting.MetricLabel(name)
+			percentiles := timer.Percentiles(prometheusQuantiles)
+			for i, q := range prometheusQuantiles {
+				labels := []string{"quantile", prometheusFloat(q)}
+				if labelName != "" {
+					labels = append([]string{labelName, label}, labels...)
+				}
+				pw.sample(family, prometheusSeconds(percentiles[i]), labels...)
+			}
+			var labels []string
+			if labelName != "" {
+				labels = []string{labelName, label}
+			}
+			pw.sample(family+"_count", prometheusInt(timer.Count()), labels...)
+		}
+	}
+
+	histograms := reg.Histograms()
+	histogramNames := make([]string, 0, len(histograms))
+	for n := range histograms {
+		histogramNames = append(histogramNames, n)
+	}
+	sort.Strings(histogramNames)
+	for _, name := range histogramNames {
+		histogram := histograms[name]
+		pw.family(name, "summary", accounting.MetricHelp(name))
+		percentiles := histogram.Percentiles(prometheusQuantiles)
+		for i, q := range prometheusQuantiles {
+			pw.sample(name, prometheusFloat(percentiles[i]), "quantile", prometheusFloat(q))
+		}
+		pw.sample(name+"_count", prometheusInt(histogram.Count()))
+	}
+
+	lastName := ""
+	accounting.LatenciesForeach(func(name, labelName, label string, h *accounting.LatencyHistogram) {
+		if name != lastName {
+			pw.family(name, "histogram", accounting.MetricHelp(name))
+			lastName = name
+		}
+		bounds := h.Bounds()
+		buckets := h.Buckets()
+		for i, count := range buckets {
+			le := "+Inf"
+			if i < len(bounds) {
+				le = prometheusFloat(bounds[i])
+			}
+			pw.sample(name+"_bucket", strconv.FormatUint(count, 10), labelName, label, "le", le)
+		}
+		pw.sample(name+"_sum", prometheusFloat(h.Sum().Seconds()), labelName, label)
+		pw.sample(name+"_count", strconv.FormatUint(buckets[len(buckets)-1], 10), labelName, label)
+	})
+}
+
+type keyspaceStats struct {
+	path  string
+	count int64
+	size  int64
+}
+
+// document count and size of every keyspace, including collections
+func collectKeyspaceStats(store datastore.Datastore) []keyspaceStats {
+	var rv []keyspaceStats
+
+	if store == nil {
+		return nil
+	}
+	which := []datastore.KeyspaceStats{datastore.KEYSPACE_COUNT, datastore.KEYSPACE_SIZE}
+	add := func(keyspace datastore.Keyspace, elems ...string) {
+		res, err := keyspace.Stats(nil, which)
+		if err == nil && len(res) == len(which) {
+			rv = append(rv, keyspaceStats{path: algebra.NewPathFromElements(elems).SimpleString(),
+				count: res[0], size: res[1]})
+		}
+	}
+
+	namespaceIds, err := store.NamespaceIds()
+	if err != nil {
+		return nil
+	}
+	for _, namespaceId := range namespaceIds {
+		namespace, err := store.NamespaceById(namespaceId)
+		if err != nil {
+			continue
+		}
+		objects, err := namespace.Objects(true)
+		if err != nil {
+			continue
+		}
+		for _, object := range objects {
+			if object.IsKeyspace {
+				keyspace, err := namespace.KeyspaceByName(object.Id)
+				if err == nil {
+					add(keyspace, namespace.Name(), keyspace.Name())
+				}
+			}
+			if !object.IsBucket {
+				continue
+			}
+			bucket, err := namespace.BucketByName(object.Id)
+			if err != nil {
+				continue
+			}
+			scopeIds, _ := bucket.ScopeIds()
+			for _, scopeId := range scopeIds {
+				scope, _ := bucket.ScopeById(scopeId)
+				if scope == nil {
+					continue
+				}
+				keyspaceIds, _ := scope.KeyspaceIds()
+				for _, keyspaceId := range keyspaceIds {
+
+					// system collections are not of interest
+					if keyspaceId[0] == '_' && keyspaceId != "_default" {
+						continue
+					}
+					keyspace, _ := scope.KeyspaceById(keyspaceId)
+					if keyspace != nil {
+						add(keyspace, namespace.Name(), bucket.Name(), scope.Name(), keyspace.Name())
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].path < rv[j].path })
+	return rv
+}
+
+type preparedStats struct {
+	name           string
+	queryContext   string
+	uses           int64
+	requestTime    uint64
+	serviceTime    uint64
+	maxRequestTime uint64
+	maxServiceTime uint64
+}
+
+func collectPreparedStats() []preparedStats {
+	var rv []preparedStats
+
+	prepareds.PreparedsForeach(func(_ string, entry *prepareds.CacheEntry) bool {
+		rv = append(rv, preparedStats{
+			name:           entry.Prepared.Name(),
+			queryContext:   entry.Prepared.QueryContext(),
+			uses:           int64(atomic.LoadInt32(&entry.Uses)),
+			requestTime:    atomic.LoadUint64(&entry.RequestTime),
+			serviceTime:    atomic.LoadUint64(&entry.ServiceTime),
+			maxRequestTime: atomic.LoadUint64(&entry.MaxRequestTime),
+			maxServiceTime: atomic.LoadUint64(&entry.MaxServiceTime),
+		})
+		return true
+	}, nil)
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].queryContext != rv[j].queryContext {
+			return rv[i].queryContext < rv[j].queryContext
+		}
+		return rv[i].name < rv[j].name
+	})
+	return rv
+}
+
+func writePrometheusHigh(pw *prometheusWriter, store datastore.Datastore) {
+	keyspaces := collectKeyspaceStats(store)
+	if len(keyspaces) > 0 {
+		pw.family("keyspace_documents", "gauge", "Number of documents in the keyspace")
+		for _, ks := range keyspaces {
+			pw.sample("keyspace_documents", prometheusInt(ks.count), "keyspace", ks.path)
+		}
+		pw.family("keyspace_size_bytes", "gauge", "Size of the documents in the keyspace, in bytes")
+		for _, ks := range keyspaces {
+			pw.sample("keyspace_size_bytes", prometheusInt(ks.size), "keyspace", ks.path)
+		}
+	}
+
+	stats := collectPreparedStats()
+	if len(stats) == 0 {
+		return
+	}
+	pw.family("prepared_uses", "counter", "Number of executions of the prepared statement")
+	for _, p := range stats {
+		pw.sample("prepared_uses", prometheusInt(p.uses), "name", p.name, "query_context", p.queryContext)
+	}
+	pw.family("prepared_request_time_seconds", "counter",
+		"Total end to end time of the executions of the prepared statement, in seconds")
+	for _, p := range stats {
+		pw.sample("prepared_request_time_seconds", prometheusSeconds(float64(p.requestTime)),
+			"name", p.name, "query_context", p.queryContext)
+	}
+	pw.family("prepared_service_time_seconds", "counter",
+		"Total execution time of the executions of the prepared statement, in seconds")
+	for _, p := range stats {
+		pw.sample("prepared_service_time_seconds", prometheusSeconds(float64(p.serviceTime)),
+			"name", p.name, "query_context", p.queryContext)
+	}
+	pw.family("prepared_max_request_time_seconds", "gauge",
+		"Longest end to end time of an execution of the prepared statement, in seconds")
+	for _, p := range stats {
+		pw.sample("prepared_max_request_time_seconds", prometheusSeconds(float64(p.maxRequestTime)),
+			"name", p.name, "query_context", p.queryContext)
+	}
+	pw.family("prepared_max_service_time_seconds", "gauge",
+		"Longest execution time of an execution of the prepared statement, in seconds")
+	for _, p := range stats {
+		pw.sample("prepared_max_service_time_seconds", prometheusSeconds(float64(p.maxServiceTime)),
+			"name", p.name, "query_context", p.queryContext)
+	}
+}
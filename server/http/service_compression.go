@@ -0,0 +1,199 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/couchbase/query/util"
+)
+
+// Response compression.
+//
+// The compression request parameter takes precedence; when it is not
+// specified, the encoding is negotiated through the Accept-Encoding header.
+// The compressor sits between the buffered writer and the response writer,
+// and is flushed every time the buffered writer is, so that results still
+// stream out as they are produced.
+
+type compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(w io.Writer)
+}
+
+var gzipPool, zlibPool, zstdPool util.FastPool
+
+func init() {
+	util.NewFastPool(&gzipPool, func() interface{} {
+		return gzip.NewWriter(ioutil.Discard)
+	})
+
+	// the HTTP deflate coding is a zlib stream, not raw deflate (RFC 7230 4.2.2)
+	util.NewFastPool(&zlibPool, func() interface{} {
+		return zlib.NewWriter(ioutil.Discard)
+	})
+	util.NewFastPool(&zstdPool, func() interface{} {
+
+		// streams are flushed often, so there's no point in more than one encoding goroutine
+		e, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return e
+	})
+}
+
+func getCompressor(c Compression, w io.Writer) compressor {
+	var rv compressor
+	switch c {
+	case GZIP:
+		rv = gzipPool.Get().(*gzip.Writer)
+	case DEFLATE:
+		rv = zlibPool.Get().(*zlib.Writer)
+	case ZSTD:
+		rv = zstdPool.Get().(*zstd.Encoder)
+	default:
+		return nil
+	}
+	rv.Reset(w)
+	return rv
+}
+
+func putCompressor(c Compression, w compressor) {
+	switch c {
+	case GZIP:
+		gzipPool.Put(w)
+	case DEFLATE:
+		zlibPool.Put(w)
+	case ZSTD:
+		zstdPool.Put(w)
+	}
+}
+
+// the Content-Encoding token for each supported compression
+func (c Compression) contentEncoding() string {
+	switch c {
+	case GZIP:
+		return "gzip"
+	case DEFLATE:
+		return "deflate"
+	case ZSTD:
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// choose the compression for the response
+func negotiateCompression(rv *httpRequest, req *http.Request) Compression {
+	if rv.compressionSet {
+		return rv.compression
+	}
+	return acceptEncoding(req.Header.Get("Accept-Encoding"))
+}
+
+// pick the encoding with the highest quality factor, preferring zstd over gzip over deflate
+func acceptEncoding(header string) Compression {
+	best := NONE
+	bestQ := 0.0
+	for _, entry := range strings.Split(header, ",") {
+		coding, q := parseCoding(entry)
+		var c Compression
+		switch coding {
+		case "zstd":
+			c = ZSTD
+		case "gzip", "x-gzip":
+			c = GZIP
+		case "deflate":
+			c = DEFLATE
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && q > 0 && c.preferred(best)) {
+			best = c
+			bestQ = q
+		}
+	}
+	return best
+}
+
+func (c Compression) preferred(other Compression) bool {
+	rank := func(c Compression) int {
+		switch c {
+		case ZSTD:
+			return 3
+		case GZIP:
+			return 2
+		case DEFLATE:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return rank(c) > rank(other)
+}
+
+func parseCoding(entry string) (string, float64) {
+	parts := strings.Split(entry, ";")
+	coding := strings.ToLower(strings.TrimSpace(parts[0]))
+	q := 1.0
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "q=") {
+			f, err := strconv.ParseFloat(p[2:], 64)
+			if err != nil {
+				return coding, 0.0
+			}
+			q = f
+		}
+	}
+	return coding, q
+}
+
+// set up the buffered writer to compress the response
+func (this *bufferedWriter) setCompression(c Compression) {
+	encoding := c.contentEncoding()
+	if encoding == "" {
+		return
+	}
+	h := this.req.resp.Header()
+	h.Set("Content-Encoding", encoding)
+	h.Add("Vary", "Accept-Encoding")
+	this.compression = c
+	this.compressor = getCompressor(c, this.req.resp)
+}
+
+// write out and empty the buffer, compressing if required
+func (this *bufferedWriter) writeBuffer(w io.Writer) {
+	if this.compressor != nil {
+		io.Copy(this.compressor, this.buffer)
+
+		// make what we have compressed so far available to the client
+		this.compressor.Flush()
+	} else {
+		io.Copy(w, this.buffer)
+	}
+	this.buffer.Reset()
+}
+
+// terminate the compressed stream and return the compressor to its pool
+func (this *bufferedWriter) closeCompressor() {
+	if this.compressor != nil {
+		this.compressor.Close()
+		putCompressor(this.compression, this.compressor)
+		this.compressor = nil
+	}
+}
@@ -0,0 +1,116 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		expect Compression
+	}{
+		{"", NONE},
+		{"identity", NONE},
+		{"gzip", GZIP},
+		{"gzip, deflate, br", GZIP},
+		{"deflate", DEFLATE},
+		{"gzip, zstd", ZSTD},
+		{"zstd;q=0.5, gzip", GZIP},
+		{"gzip;q=0, deflate;q=0.1", DEFLATE},
+		{"GZIP;q=0.8, zstd;q=0.8", ZSTD},
+		{"gzip;q=bogus", NONE},
+	}
+
+	for _, test := range tests {
+		c := acceptEncoding(test.header)
+		if c != test.expect {
+			t.Errorf("Accept-Encoding %q: expected %v, got %v", test.header, test.expect, c)
+		}
+	}
+}
+
+func TestCompressors(t *testing.T) {
+	input := bytes.Repeat([]byte("{\"name\": \"value\", \"count\": 12345}\n"), 1000)
+	decompress := map[Compression]func(io.Reader) (io.Reader, error){
+		GZIP: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		DEFLATE: func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		},
+		ZSTD: func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		},
+	}
+
+	for c, d := range decompress {
+
+		// twice, to exercise the pools
+		for i := 0; i < 2; i++ {
+			var out bytes.Buffer
+			w := getCompressor(c, &out)
+
+			// flushed halves must decode to the same stream
+			w.Write(input[:len(input)/2])
+			w.Flush()
+			w.Write(input[len(input)/2:])
+			w.Close()
+			putCompressor(c, w)
+
+			if out.Len() >= len(input) {
+				t.Errorf("%v: output not compressed (%v bytes)", c, out.Len())
+			}
+			r, err := d(&out)
+			if err != nil {
+				t.Fatalf("%v: %v", c, err)
+			}
+			result, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%v: %v", c, err)
+			}
+			if !bytes.Equal(result, input) {
+				t.Errorf("%v: round trip mismatch", c)
+			}
+		}
+	}
+}
+
+func TestDeflateResponse(t *testing.T) {
+	res, err := doUrlEncodedPost(url.Values{"statement": {"SELECT 1 AS a"}, "compression": {"deflate"}})
+	if err != nil {
+		t.Fatalf("Unexpected error in HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Encoding") != "deflate" {
+		t.Errorf("Expected content encoding deflate, actual: %v", res.Header.Get("Content-Encoding"))
+	}
+	r, err := zlib.NewReader(res.Body)
+	if err != nil {
+		t.Fatalf("Response is not a zlib stream: %v", err)
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Unexpected error decompressing response: %v", err)
+	}
+	if !strings.Contains(string(body), "\"results\": [\n    {\n        \"a\": 1\n    }\n    ]") {
+		t.Errorf("Unexpected response: %s", body)
+	}
+}
@@ -451,6 +451,11 @@ func (this *HttpEndpoint) doStats(request *httpRequest, srvr *server.Server) {
 		int(request.PhaseOperator(execution.INDEX_SCAN)),
 		int(request.PhaseOperator(execution.PRIMARY_SCAN)),
 		string(request.ScanConsistency()))
+	for p := execution.Phases(0); p < execution.PHASES; p++ {
+		if phaseTime := request.PhaseTime(p); phaseTime > 0 {
+			accounting.RecordPhaseTime(p.String(), phaseTime)
+		}
+	}
 
 	request.CompleteRequest(request_time, service_time, transaction_time, request.resultCount,
 		request.resultSize, request.errorCount, request.req, srvr)
@@ -0,0 +1,586 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/plan"
+	"github.com/couchbase/query/server"
+	"github.com/couchbase/query/value"
+)
+
+// Non JSON result formats.
+//
+// CSV, TSV and NDJSON responses carry nothing but the result rows in the
+// body: the request status, errors, warnings and metrics are delivered as
+// HTTP trailers, so that the body can be fed as is to the consuming tool.
+// XML responses wrap the rows in a <response> document, which also
+// carries the status, errors, warnings and metrics.
+//
+// Column names for CSV and TSV are derived from the projection of the
+// statement being executed. Star terms can only be resolved at run time,
+// so the first row supplies the remaining columns, in alphabetical order.
+
+const (
+	_CSV_CONTENT    = "text/csv; charset=utf-8"
+	_TSV_CONTENT    = "text/tab-separated-values; charset=utf-8"
+	_NDJSON_CONTENT = "application/x-ndjson"
+	_XML_CONTENT    = "application/xml; charset=utf-8"
+)
+
+const (
+	_TRAILER_STATUS   = "N1ql-Status"
+	_TRAILER_ERRORS   = "N1ql-Errors"
+	_TRAILER_WARNINGS = "N1ql-Warnings"
+	_TRAILER_METRICS  = "N1ql-Metrics"
+)
+
+var _FORMAT_TRAILERS = []string{_TRAILER_STATUS, _TRAILER_ERRORS, _TRAILER_WARNINGS, _TRAILER_METRICS}
+
+var _FORMAT_MEDIA_TYPES = []string{"text/csv", "text/tab-separated-values", "application/x-ndjson",
+	"application/xml", "text/xml"}
+
+func formatMediaType(mediaType string) bool {
+	for _, t := range _FORMAT_MEDIA_TYPES {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Format) contentType() string {
+	switch f {
+	case CSV:
+		return _CSV_CONTENT
+	case TSV:
+		return _TSV_CONTENT
+	case NDJSON:
+		return _NDJSON_CONTENT
+	case XML:
+		return _XML_CONTENT
+	default:
+		return version
+	}
+}
+
+// formats whose metadata is sent in the HTTP trailers
+func (f Format) useTrailers() bool {
+	return f == CSV || f == TSV || f == NDJSON
+}
+
+func (this *httpRequest) writeFormatPrefix(srvr *server.Server, prepared *plan.Prepared) bool {
+	h := this.resp.Header()
+	h.Set("Content-Type", this.format.contentType())
+	if this.format.useTrailers() {
+		for _, t := range _FORMAT_TRAILERS {
+			h.Add("Trailer", t)
+		}
+		this.trailers = make(map[string]string, len(_FORMAT_TRAILERS))
+	}
+
+	if prepared != nil {
+		this.columns, this.rawRows = projectionColumns(prepared.Operator)
+	}
+
+	switch this.format {
+	case XML:
+		return this.writeString(xml.Header) &&
+			this.writeString("<response>\n") &&
+			this.writeXMLElement("requestID", this.Id().String()) &&
+			(!this.ClientID().IsValid() || this.writeXMLElement("clientContextID", this.ClientID().String())) &&
+			this.writeString("<results>")
+	case CSV, TSV:
+
+		// star terms need the first row to resolve the column names
+		if this.columns != nil && !hasStarColumn(this.columns) {
+			return this.writeHeaderRow()
+		}
+	}
+	return true
+}
+
+func (this *httpRequest) writeFormatResult(item value.AnnotatedValue) bool {
+	switch this.format {
+	case NDJSON:
+		if this.resultCount > 0 && !this.writer.write("\n") {
+			return false
+		}
+		return this.writeRowJSON(item)
+	case XML:
+		return this.writer.write("\n<row>") &&
+			this.writeXMLFields(item) &&
+			this.writer.write("</row>")
+	default:
+		if this.resultCount == 0 && (this.columns == nil || hasStarColumn(this.columns)) {
+			this.resolveColumns(item)
+			if !this.writeHeaderRow() {
+				return false
+			}
+		}
+		return this.writeDelimitedRow(item)
+	}
+}
+
+func (this *httpRequest) writeFormatSuffix(srvr *server.Server, state server.State) bool {
+	errs, warnings := this.formatErrors()
+	if state == server.COMPLETED {
+		if this.errorCount == 0 {
+			state = server.SUCCESS
+		} else {
+			state = server.ERRORS
+		}
+	}
+	metrics := this.formatMetrics(srvr.Metrics())
+
+	switch this.format {
+	case XML:
+		if !(this.writeString("\n</results>\n") && this.writeXMLErrors("errors", "error", errs) &&
+			this.writeXMLErrors("warnings", "warning", warnings) &&
+			this.writeXMLElement("status", state.StateName())) {
+			return false
+		}
+		if metrics != nil {
+			if !this.writeString("<metrics>\n") {
+				return false
+			}
+			for _, m := range metrics {
+				if !this.writeXMLElement(m.name, m.value.ToString()) {
+					return false
+				}
+			}
+			if !this.writeString("</metrics>\n") {
+				return false
+			}
+		}
+		return this.writeString("</response>\n")
+	default:
+		if this.resultCount > 0 && this.format == NDJSON && !this.writeString("\n") {
+			return false
+		}
+		this.trailers[_TRAILER_STATUS] = state.StateName()
+		if len(errs) > 0 {
+			this.trailers[_TRAILER_ERRORS] = marshalErrors(errs)
+		}
+		if len(warnings) > 0 {
+			this.trailers[_TRAILER_WARNINGS] = marshalErrors(warnings)
+		}
+		if metrics != nil {
+			buf := bytes.NewBuffer(make([]byte, 0, 256))
+			buf.WriteString("{")
+			for i, m := range metrics {
+				if i > 0 {
+					buf.WriteString(",")
+				}
+				buf.WriteString(strconv.Quote(m.name))
+				buf.WriteString(":")
+				m.value.WriteJSON(buf, "", "", true)
+			}
+			buf.WriteString("}")
+			this.trailers[_TRAILER_METRICS] = buf.String()
+		}
+		return true
+	}
+}
+
+// the errors and warnings to be reported, along with the same side effects as writeErrors()
+func (this *httpRequest) formatErrors() ([]errors.Error, []errors.Error) {
+	errs := this.Errors()
+	if len(errs) > 0 && this.State() != server.FATAL {
+		this.setHttpCode(mapErrorToHttpResponse(errs[0], http.StatusOK))
+	}
+	this.errorCount = len(errs)
+
+	var warnings []errors.Error
+	alreadySeen := make(map[string]bool)
+	for _, w := range this.Warnings() {
+		if w.OnceOnly() && alreadySeen[w.Error()] {
+			continue
+		}
+		warnings = append(warnings, w)
+		alreadySeen[w.Error()] = true
+	}
+	this.warningCount = len(warnings)
+	return errs, warnings
+}
+
+func errorMap(err errors.Error) map[string]interface{} {
+	m := map[string]interface{}{
+		"code": err.Code(),
+		"msg":  err.Error(),
+	}
+	if err.Retry() {
+		m["retry"] = true
+	}
+	if err.Cause() != nil {
+		m["cause"] = err.Cause()
+	}
+	return m
+}
+
+func marshalErrors(errs []errors.Error) string {
+	ms := make([]map[string]interface{}, len(errs))
+	for i, err := range errs {
+		ms[i] = errorMap(err)
+	}
+	bytes, err := json.Marshal(ms)
+	if err != nil {
+		return ""
+	}
+	return string(bytes)
+}
+
+type formatMetric struct {
+	name  string
+	value value.Value
+}
+
+// the same metrics writeMetrics() produces, in the same order
+func (this *httpRequest) formatMetrics(metrics bool) []formatMetric {
+	m := this.Metrics()
+	if m == value.FALSE || (m == value.NONE && !metrics) {
+		return nil
+	}
+
+	rv := []formatMetric{
+		{"elapsedTime", value.NewValue(this.elapsedTime.String())},
+		{"executionTime", value.NewValue(this.executionTime.String())},
+		{"resultCount", value.NewValue(this.resultCount)},
+		{"resultSize", value.NewValue(this.resultSize)},
+		{"serviceLoad", value.NewValue(server.ActiveRequestsLoad())},
+	}
+	if this.UsedMemory() > 0 {
+		rv = append(rv, formatMetric{"usedMemory", value.NewValue(this.UsedMemory())})
+	}
+	if this.MutationCount() > 0 {
+		rv = append(rv, formatMetric{"mutationCount", value.NewValue(this.MutationCount())})
+	}
+	if this.transactionElapsedTime > 0 {
+		rv = append(rv, formatMetric{"transactionElapsedTime", value.NewValue(this.transactionElapsedTime.String())})
+	}
+	if transactionRemainingTime := this.TransactionRemainingTime(); transactionRemainingTime != "" {
+		rv = append(rv, formatMetric{"transactionRemainingTime", value.NewValue(transactionRemainingTime)})
+	}
+	if this.SortCount() > 0 {
+		rv = append(rv, formatMetric{"sortCount", value.NewValue(this.SortCount())})
+	}
+	if this.errorCount > 0 {
+		rv = append(rv, formatMetric{"errorCount", value.NewValue(this.errorCount)})
+	}
+	if this.warningCount > 0 {
+		rv = append(rv, formatMetric{"warningCount", value.NewValue(this.warningCount)})
+	}
+	return rv
+}
+
+// set the trailers once the body has been written
+func (this *httpRequest) writeTrailers() {
+	if this.trailers == nil {
+		return
+	}
+	h := this.resp.Header()
+	for k, v := range this.trailers {
+		h.Set(k, v)
+	}
+}
+
+// projection columns
+
+// Column names of the statement's projection, and whether rows are raw values.
+// A star term is returned as "*" and is resolved against the first row.
+func projectionColumns(op plan.Operator) ([]string, bool) {
+	var projection interface {
+		Terms() plan.ProjectTerms
+	}
+
+	switch op := op.(type) {
+	case *plan.InitialProject:
+		projection = op
+	case *plan.IndexCountProject:
+		projection = op
+	case *plan.Sequence:
+		for _, child := range op.Children() {
+			if columns, raw := projectionColumns(child); columns != nil {
+				return columns, raw
+			}
+		}
+		return nil, false
+	case *plan.Parallel:
+		return projectionColumns(op.Child())
+	case *plan.Authorize:
+		return projectionColumns(op.Child())
+	case *plan.With:
+		return projectionColumns(op.Child())
+
+	// set operations take the names of the first branch
+	case *plan.UnionAll:
+		if len(op.Children()) > 0 {
+			return projectionColumns(op.Children()[0])
+		}
+		return nil, false
+	case *plan.IntersectAll:
+		return projectionColumns(op.First())
+	case *plan.ExceptAll:
+		return projectionColumns(op.First())
+	default:
+		return nil, false
+	}
+
+	terms := projection.Terms()
+	columns := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if term.Result().Star() {
+			columns = append(columns, "*")
+		} else {
+			columns = append(columns, term.Result().Alias())
+		}
+	}
+	raw := false
+	if p, ok := op.(*plan.InitialProject); ok {
+		raw = p.Projection().Raw()
+	}
+	return columns, raw
+}
+
+func hasStarColumn(columns []string) bool {
+	for _, c := range columns {
+		if c == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// replace star terms with the fields of the first row
+func (this *httpRequest) resolveColumns(item value.Value) {
+	if this.rawRows {
+		return
+	}
+	if item.Type() != value.OBJECT {
+		if len(this.columns) == 0 {
+			this.columns = []string{"$1"}
+		}
+		this.rawRows = true
+		return
+	}
+
+	explicit := make(map[string]bool, len(this.columns))
+	columns := make([]string, 0, len(this.columns))
+	for _, c := range this.columns {
+		if c != "*" {
+			explicit[c] = true
+			columns = append(columns, c)
+		}
+	}
+
+	fields := item.Fields()
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if !explicit[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	this.columns = append(columns, names...)
+}
+
+// CSV and TSV
+
+func (this *httpRequest) writeHeaderRow() bool {
+	buf := this.writer.buffer
+	for i, c := range this.columns {
+		if i > 0 {
+			buf.WriteByte(this.format.delimiter())
+		}
+		this.format.writeField(buf, c)
+	}
+	buf.WriteString("\r\n")
+	return true
+}
+
+func (this *httpRequest) writeDelimitedRow(item value.Value) bool {
+	buf := this.writer.buffer
+	if this.rawRows {
+		this.format.writeField(buf, fieldText(item))
+	} else {
+		for i, c := range this.columns {
+			if i > 0 {
+				buf.WriteByte(this.format.delimiter())
+			}
+			f, _ := item.Field(c)
+			this.format.writeField(buf, fieldText(f))
+		}
+	}
+	_, err := buf.WriteString("\r\n")
+	return err == nil
+}
+
+func (f Format) delimiter() byte {
+	if f == TSV {
+		return '\t'
+	}
+	return ','
+}
+
+// CSV fields are quoted per RFC 4180, TSV fields escape the special characters instead
+func (f Format) writeField(buf *bytes.Buffer, field string) {
+	if f == TSV {
+		buf.WriteString(_TSV_ESCAPER.Replace(field))
+	} else if strings.ContainsAny(field, ",\"\r\n") || (field != "" && (field[0] == ' ' || field[len(field)-1] == ' ')) {
+		buf.WriteByte('"')
+		buf.WriteString(strings.Replace(field, "\"", "\"\"", -1))
+		buf.WriteByte('"')
+	} else {
+		buf.WriteString(field)
+	}
+}
+
+var _TSV_ESCAPER = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// scalars are rendered as text, objects and arrays as JSON
+func fieldText(val value.Value) string {
+	if val == nil {
+		return ""
+	}
+	switch val.Type() {
+	case value.MISSING, value.NULL:
+		return ""
+	default:
+		return val.ToString()
+	}
+}
+
+// NDJSON
+
+func (this *httpRequest) writeRowJSON(item value.AnnotatedValue) bool {
+	beforeResult := this.writer.mark()
+	err := item.WriteJSON(this.writer.buf(), "", "", item.Self())
+	if err != nil {
+		this.writer.truncate(beforeResult)
+		this.Error(errors.NewServiceErrorInvalidJSON(err))
+		this.SetState(server.FATAL)
+		return false
+	}
+	return true
+}
+
+// XML
+
+func (this *httpRequest) writeXMLElement(name, text string) bool {
+	buf := this.writer.buffer
+	buf.WriteString("<" + name + ">")
+	xml.EscapeText(buf, []byte(text))
+	_, err := buf.WriteString("</" + name + ">\n")
+	return err == nil
+}
+
+func (this *httpRequest) writeXMLErrors(list, element string, errs []errors.Error) bool {
+	if len(errs) == 0 {
+		return true
+	}
+	buf := this.writer.buffer
+	buf.WriteString("<" + list + ">\n")
+	for _, err := range errs {
+		buf.WriteString("<" + element + " code=\"" + strconv.Itoa(int(err.Code())) + "\">")
+		xml.EscapeText(buf, []byte(err.Error()))
+		buf.WriteString("</" + element + ">\n")
+	}
+	_, err := buf.WriteString("</" + list + ">\n")
+	return err == nil
+}
+
+func (this *httpRequest) writeXMLFields(item value.Value) bool {
+	buf := this.writer.buffer
+	if this.rawRows || item.Type() != value.OBJECT {
+		name := "$1"
+		if len(this.columns) == 1 {
+			name = this.columns[0]
+		}
+		writeXMLValue(buf, "field", name, item)
+		return true
+	}
+
+	// explicit columns in projection order, then any star fields
+	written := make(map[string]bool, len(this.columns))
+	for _, c := range this.columns {
+		if c == "*" {
+			continue
+		}
+		if f, ok := item.Field(c); ok {
+			writeXMLValue(buf, "field", c, f)
+		}
+		written[c] = true
+	}
+	if this.columns == nil || hasStarColumn(this.columns) {
+		fields := item.Fields()
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			if !written[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f, _ := item.Field(name)
+			writeXMLValue(buf, "field", name, f)
+		}
+	}
+	return true
+}
+
+// objects nest <field> elements, arrays nest <item> elements
+func writeXMLValue(buf *bytes.Buffer, element, name string, val value.Value) {
+	typ := val.Type()
+	buf.WriteString("<" + element)
+	if name != "" {
+		buf.WriteString(" name=\"")
+		xml.EscapeText(buf, []byte(name))
+		buf.WriteString("\"")
+	}
+	buf.WriteString(" type=\"" + typ.String() + "\"")
+
+	switch typ {
+	case value.MISSING, value.NULL:
+		buf.WriteString("/>")
+		return
+	case value.OBJECT:
+		buf.WriteString(">")
+		fields := val.Fields()
+		names := make([]string, 0, len(fields))
+		for n := range fields {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			f, _ := val.Field(n)
+			writeXMLValue(buf, "field", n, f)
+		}
+	case value.ARRAY:
+		buf.WriteString(">")
+		for i := 0; ; i++ {
+			e, ok := val.Index(i)
+			if !ok {
+				break
+			}
+			writeXMLValue(buf, "item", "", e)
+		}
+	default:
+		buf.WriteString(">")
+		xml.EscapeText(buf, []byte(val.ToString()))
+	}
+	buf.WriteString("</" + element + ">")
+}
@@ -0,0 +1,135 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/couchbase/query/value"
+)
+
+func TestFormatFields(t *testing.T) {
+	tests := []struct {
+		format Format
+		field  string
+		expect string
+	}{
+		{CSV, "plain", "plain"},
+		{CSV, "a,b", "\"a,b\""},
+		{CSV, "say \"hi\"", "\"say \"\"hi\"\"\""},
+		{CSV, "two\nlines", "\"two\nlines\""},
+		{CSV, " padded", "\" padded\""},
+		{TSV, "a,b", "a,b"},
+		{TSV, "a\tb", "a\\tb"},
+		{TSV, "two\nlines", "two\\nlines"},
+		{TSV, "back\\slash", "back\\\\slash"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		test.format.writeField(&buf, test.field)
+		if buf.String() != test.expect {
+			t.Errorf("%v field %q: expected %q, got %q", test.format, test.field, test.expect, buf.String())
+		}
+	}
+}
+
+func TestFormatFieldText(t *testing.T) {
+	tests := []struct {
+		val    value.Value
+		expect string
+	}{
+		{nil, ""},
+		{value.MISSING_VALUE, ""},
+		{value.NULL_VALUE, ""},
+		{value.NewValue("text"), "text"},
+		{value.NewValue(12), "12"},
+		{value.NewValue(true), "true"},
+		{value.NewValue([]interface{}{1, "a"}), "[1,\"a\"]"},
+		{value.NewValue(map[string]interface{}{"a": 1}), "{\"a\":1}"},
+	}
+
+	for _, test := range tests {
+		text := fieldText(test.val)
+		if text != test.expect {
+			t.Errorf("value %v: expected %q, got %q", test.val, test.expect, text)
+		}
+	}
+}
+
+func TestNewFormat(t *testing.T) {
+	for _, f := range []Format{JSON, XML, CSV, TSV, NDJSON} {
+		if newFormat(f.String()) != f {
+			t.Errorf("format %v does not round trip", f)
+		}
+	}
+	if newFormat("jsonl") != NDJSON {
+		t.Errorf("jsonl should be accepted as NDJSON")
+	}
+	if newFormat("yaml") != UNDEFINED_FORMAT {
+		t.Errorf("yaml should not be a recognized format")
+	}
+}
+
+func doFormatRequest(t *testing.T, statement string) (string, *http.Response) {
+	res, err := doUrlEncodedPost(url.Values{"statement": {statement}, "format": {"csv"}, "metrics": {"true"}})
+	if err != nil {
+		t.Fatalf("Unexpected error in HTTP request: %v", err)
+	}
+	defer res.Body.Close()
+
+	// trailers are only available once the body has been read
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error reading response: %v", err)
+	}
+	if res.Header.Get("Content-Type") != _CSV_CONTENT {
+		t.Errorf("Expected content type %v, actual: %v", _CSV_CONTENT, res.Header.Get("Content-Type"))
+	}
+	return string(body), res
+}
+
+func TestFormatResponse(t *testing.T) {
+	body, res := doFormatRequest(t, "SELECT 1 AS a, \"x,y\" AS b UNION ALL SELECT 2 AS a, \"z\" AS b")
+	if body != "a,b\r\n1,\"x,y\"\r\n2,z\r\n" && body != "a,b\r\n2,z\r\n1,\"x,y\"\r\n" {
+		t.Errorf("Unexpected CSV body: %q", body)
+	}
+	if res.Trailer.Get(_TRAILER_STATUS) != "success" {
+		t.Errorf("Expected status success, actual: %v", res.Trailer.Get(_TRAILER_STATUS))
+	}
+	if !strings.Contains(res.Trailer.Get(_TRAILER_METRICS), "\"resultCount\":2") {
+		t.Errorf("Expected a result count of 2, actual metrics: %v", res.Trailer.Get(_TRAILER_METRICS))
+	}
+	if res.Trailer.Get(_TRAILER_ERRORS) != "" {
+		t.Errorf("Unexpected errors: %v", res.Trailer.Get(_TRAILER_ERRORS))
+	}
+
+	// requests that fail before execution report through the same trailers
+	body, res = doFormatRequest(t, "SELEC 1")
+	if body != "" {
+		t.Errorf("Unexpected CSV body: %q", body)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %v, actual: %v", http.StatusBadRequest, res.StatusCode)
+	}
+	if res.Trailer.Get(_TRAILER_STATUS) != "fatal" {
+		t.Errorf("Expected status fatal, actual: %v", res.Trailer.Get(_TRAILER_STATUS))
+	}
+	if !strings.Contains(res.Trailer.Get(_TRAILER_ERRORS), "\"code\":3000") {
+		t.Errorf("Expected a parse error, actual: %v", res.Trailer.Get(_TRAILER_ERRORS))
+	}
+	if !strings.Contains(res.Trailer.Get(_TRAILER_METRICS), "\"errorCount\":1") {
+		t.Errorf("Expected an error count of 1, actual metrics: %v", res.Trailer.Get(_TRAILER_METRICS))
+	}
+}
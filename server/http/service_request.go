@@ -61,6 +61,14 @@ type httpRequest struct {
 	consCnt  int
 	jsonArgs jsonArgs // ESCAPE analysis workaround
 	urlArgs  urlArgs  // ESCAPE analysis workaround
+
+	format   Format
+	columns  []string
+	rawRows  bool
+	trailers map[string]string
+
+	compression    Compression
+	compressionSet bool
 }
 
 var zeroScanVectorSource = &ZeroScanVectorSource{}
@@ -182,6 +190,7 @@ func newHttpRequest(rv *httpRequest, resp http.ResponseWriter, req *http.Request
 	}
 
 	NewBufferedWriter(&rv.writer, rv, bp)
+	rv.writer.setCompression(negotiateCompression(rv, req))
 
 	// Prevent operator to send results until the prefix is done
 	rv.Add(1)
@@ -346,8 +355,8 @@ func handleFormat(rv *httpRequest, httpArgs httpRequestArgs, parm string, val in
 		format := newFormat(format_field)
 		if format == UNDEFINED_FORMAT {
 			err = errors.NewServiceErrorUnrecognizedValue(FORMAT, format_field)
-		} else if format != JSON {
-			err = errors.NewServiceErrorNotImplemented(FORMAT, format_field)
+		} else {
+			rv.format = format
 		}
 	}
 	return err
@@ -367,8 +376,11 @@ func handleCompression(rv *httpRequest, httpArgs httpRequestArgs, parm string, v
 		compression := newCompression(compression_field)
 		if compression == UNDEFINED_COMPRESSION {
 			err = errors.NewServiceErrorUnrecognizedValue(COMPRESSION, compression_field)
-		} else if compression != NONE {
+		} else if compression != NONE && compression.contentEncoding() == "" {
 			err = errors.NewServiceErrorNotImplemented(COMPRESSION, compression_field)
+		} else {
+			rv.compression = compression
+			rv.compressionSet = true
 		}
 	}
 	return err
@@ -1013,6 +1025,10 @@ func contentNegotiation(resp http.ResponseWriter, req *http.Request) errors.Erro
 		return nil
 	}
 	desiredContent := accept[0]
+	// result formats other than JSON are selected through the format parameter
+	if formatMediaType(desiredContent) {
+		return nil
+	}
 	// media type must be application/json at least
 	if !strings.HasPrefix(desiredContent, acceptType) {
 		return errors.NewServiceErrorMediaType(desiredContent)
@@ -1766,6 +1782,7 @@ const (
 	XML
 	CSV
 	TSV
+	NDJSON
 	UNDEFINED_FORMAT
 )
 
@@ -1779,6 +1796,8 @@ func newFormat(s string) Format {
 		return CSV
 	case "TSV":
 		return TSV
+	case "NDJSON", "JSONL":
+		return NDJSON
 	default:
 		return UNDEFINED_FORMAT
 	}
@@ -1795,6 +1814,8 @@ func (f Format) String() string {
 		s = "CSV"
 	case TSV:
 		s = "TSV"
+	case NDJSON:
+		s = "NDJSON"
 	default:
 		s = "UNDEFINED_FORMAT"
 	}
@@ -1809,6 +1830,9 @@ const (
 	RLE
 	LZMA
 	LZO
+	GZIP
+	DEFLATE
+	ZSTD
 	UNDEFINED_COMPRESSION
 )
 
@@ -1824,6 +1848,12 @@ func newCompression(s string) Compression {
 		return LZMA
 	case "LZO":
 		return LZO
+	case "GZIP":
+		return GZIP
+	case "DEFLATE":
+		return DEFLATE
+	case "ZSTD":
+		return ZSTD
 	default:
 		return UNDEFINED_COMPRESSION
 	}
@@ -1842,6 +1872,12 @@ func (c Compression) String() string {
 		s = "LZMA"
 	case LZO:
 		s = "LZO"
+	case GZIP:
+		s = "GZIP"
+	case DEFLATE:
+		s = "DEFLATE"
+	case ZSTD:
+		s = "ZSTD"
 	default:
 		s = "UNDEFINED_COMPRESSION"
 	}
@@ -66,6 +66,7 @@ func init() {
 	server.RequestsInit(1000, 4000)
 	prepareds.PreparedsInit(1024)
 	test_server = newTestServer()
+	server.SetActives(NewActiveRequests(test_server.query_server))
 	prepareds.PreparedsReprepareInit(test_server.query_server.Datastore(), test_server.query_server.Systemstore())
 }
 
@@ -105,6 +105,15 @@ func (this *httpRequest) setHttpCode(httpRespCode int) {
 }
 
 func (this *httpRequest) Failed(srvr *server.Server) {
+	if this.format != JSON {
+		this.writeFormatPrefix(srvr, nil)
+		this.markTimeOfCompletion(time.Now())
+		this.writeFormatSuffix(srvr, this.State())
+		this.writer.noMoreData()
+		this.Stop(server.FATAL)
+		return
+	}
+
 	prefix, indent := this.prettyStrings(srvr.Pretty(), false)
 	this.writeString("{\n")
 	this.writeRequestID(prefix)
@@ -136,7 +145,11 @@ func (this *httpRequest) Execute(srvr *server.Server, context *execution.Context
 	this.prefix, this.indent = this.prettyStrings(srvr.Pretty(), false)
 
 	this.setHttpCode(http.StatusOK)
-	this.writePrefix(srvr, signature, this.prefix, this.indent)
+	if this.format == JSON {
+		this.writePrefix(srvr, signature, this.prefix, this.indent)
+	} else {
+		this.writeFormatPrefix(srvr, context.Prepared())
+	}
 
 	// release writer
 	this.Done()
@@ -169,7 +182,11 @@ func (this *httpRequest) Execute(srvr *server.Server, context *execution.Context
 	this.markTimeOfCompletion(now)
 
 	state := this.State()
-	this.writeSuffix(srvr, state, this.prefix, this.indent)
+	if this.format == JSON {
+		this.writeSuffix(srvr, state, this.prefix, this.indent)
+	} else {
+		this.writeFormatSuffix(srvr, state)
+	}
 	this.writer.noMoreData()
 }
 
@@ -250,6 +267,10 @@ func (this *httpRequest) Result(item value.AnnotatedValue) bool {
 	this.writer.timeFlush()
 	beforeWrites := this.writer.mark()
 
+	if this.format != JSON {
+		return this.formatResult(item, beforeWrites)
+	}
+
 	if this.resultCount == 0 {
 		success = this.writer.write("\n")
 	} else {
@@ -282,6 +303,23 @@ func (this *httpRequest) Result(item value.AnnotatedValue) bool {
 	return success
 }
 
+func (this *httpRequest) formatResult(item value.AnnotatedValue, beforeWrites int) bool {
+	success := this.writeFormatResult(item)
+	if success {
+		this.resultSize += (this.writer.mark() - beforeWrites)
+		this.resultCount++
+		this.writer.sizeFlush()
+	} else {
+		if this.State() != server.FATAL {
+			this.SetState(server.CLOSED)
+		}
+
+		// remove partial writes so that we have a well formed document
+		this.writer.truncate(beforeWrites)
+	}
+	return success
+}
+
 func (this *httpRequest) writeValue(item value.Value, prefix, indent string, fast bool) bool {
 	if item == nil {
 		return this.writeString("null")
@@ -403,16 +441,7 @@ func (this *httpRequest) writeError(err errors.Error, count int, prefix, indent
 		return false
 	}
 
-	m := map[string]interface{}{
-		"code": err.Code(),
-		"msg":  err.Error(),
-	}
-	if err.Retry() {
-		m["retry"] = true
-	}
-	if err.Cause() != nil {
-		m["cause"] = err.Cause()
-	}
+	m := errorMap(err)
 
 	var er error
 	var bytes []byte
@@ -759,6 +788,8 @@ type bufferedWriter struct {
 	closed      bool
 	header      bool // headers required
 	lastFlush   util.Time
+	compression Compression
+	compressor  compressor // compresses the response, if required
 }
 
 const _PRINTF_THRESHOLD = 128
@@ -791,8 +822,7 @@ func (this *bufferedWriter) writeBytes(s []byte) bool {
 		}
 
 		// write out and empty the buffer
-		io.Copy(w, this.buffer)
-		this.buffer.Reset()
+		this.writeBuffer(w)
 
 		// do the flushing
 		this.lastFlush = util.Now()
@@ -820,8 +850,7 @@ func (this *bufferedWriter) printf(f string, args ...interface{}) bool {
 		}
 
 		// write out and empty the buffer
-		io.Copy(w, this.buffer)
-		this.buffer.Reset()
+		this.writeBuffer(w)
 
 		// do the flushing
 		this.lastFlush = util.Now()
@@ -859,8 +888,7 @@ func (this *bufferedWriter) timeFlush() {
 		}
 
 		// write out and empty the buffer
-		io.Copy(w, this.buffer)
-		this.buffer.Reset()
+		this.writeBuffer(w)
 
 		// do the flushing
 		this.lastFlush = util.Now()
@@ -885,8 +913,7 @@ func (this *bufferedWriter) sizeFlush() {
 		}
 
 		// write out and empty the buffer
-		io.Copy(w, this.buffer)
-		this.buffer.Reset()
+		this.writeBuffer(w)
 
 		// do the flushing
 		this.lastFlush = util.Now()
@@ -918,14 +945,20 @@ func (this *bufferedWriter) noMoreData() {
 
 	if this.header {
 		// calculate and set the Content-Length header:
-		content_len := strconv.Itoa(len(this.buffer.Bytes()))
-		w.Header().Set("Content-Length", content_len)
+		// trailers can only be sent with a chunked transfer encoding,
+		// and the compressed length is not known until the stream is closed
+		if this.req.trailers == nil && this.compressor == nil {
+			content_len := strconv.Itoa(len(this.buffer.Bytes()))
+			w.Header().Set("Content-Length", content_len)
+		}
 		// write response header and data buffered so far:
 		w.WriteHeader(this.req.httpCode())
 		this.header = false
 	}
 
-	io.Copy(w, this.buffer)
+	this.writeBuffer(w)
+	this.closeCompressor()
+	this.req.writeTrailers()
 	// no more data in the response => return buffer to pool:
 	this.buffer_pool.PutBuffer(this.buffer)
 	r.Body.Close()
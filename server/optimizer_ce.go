@@ -15,5 +15,5 @@ import (
 )
 
 func getNewOptimizer() planner.Optimizer {
-	return nil
+	return planner.NewOptimizer()
 }
@@ -152,6 +152,8 @@ type Request interface {
 	Failed(server *Server)
 	Expire(state State, timeout time.Duration)
 	SortCount() uint64
+	SpillCount() uint64
+	SpillSize() uint64
 	State() State
 	Halted() bool
 	Credentials() *auth.Credentials
@@ -254,6 +256,8 @@ type BaseRequest struct {
 	usedMemory    atomic.AlignedUint64
 	mutationCount atomic.AlignedUint64
 	sortCount     atomic.AlignedUint64
+	spillCount    atomic.AlignedUint64
+	spillSize     atomic.AlignedUint64
 	phaseStats    [execution.PHASES]phaseStat
 
 	sync.RWMutex
@@ -693,6 +697,19 @@ func (this *BaseRequest) SortCount() uint64 {
 	return atomic.LoadUint64(&this.sortCount)
 }
 
+func (this *BaseRequest) AddSpill(size uint64) {
+	atomic.AddUint64(&this.spillCount, 1)
+	atomic.AddUint64(&this.spillSize, size)
+}
+
+func (this *BaseRequest) SpillCount() uint64 {
+	return atomic.LoadUint64(&this.spillCount)
+}
+
+func (this *BaseRequest) SpillSize() uint64 {
+	return atomic.LoadUint64(&this.spillSize)
+}
+
 func (this *BaseRequest) AddPhaseCount(p execution.Phases, c uint64) {
 	atomic.AddUint64(&this.phaseStats[p].count, c)
 }
@@ -747,6 +764,10 @@ func (this *BaseRequest) AddPhaseTime(phase execution.Phases, duration time.Dura
 	atomic.AddUint64(&(this.phaseStats[phase].duration), uint64(duration))
 }
 
+func (this *BaseRequest) PhaseTime(phase execution.Phases) time.Duration {
+	return time.Duration(atomic.LoadUint64(&this.phaseStats[phase].duration))
+}
+
 func (this *BaseRequest) FmtPhaseTimes() map[string]interface{} {
 	var p map[string]interface{} = nil
 
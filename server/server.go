@@ -25,6 +25,7 @@ import (
 	atomic "github.com/couchbase/go-couchbase/platform"
 	"github.com/couchbase/query/accounting"
 	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/auth"
 	"github.com/couchbase/query/clustering"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
@@ -524,6 +525,30 @@ func (this *Server) SetMemoryQuota(memoryQuota uint64) {
 	this.memoryQuota = memoryQuota
 }
 
+func (this *Server) SpillThreshold() uint64 {
+	return execution.GetSpillThreshold()
+}
+
+func (this *Server) SetSpillThreshold(threshold uint64) {
+	execution.SetSpillThreshold(threshold)
+}
+
+func (this *Server) MaxRecursion() int {
+	return execution.GetMaxRecursion()
+}
+
+func (this *Server) SetMaxRecursion(max int) {
+	execution.SetMaxRecursion(max)
+}
+
+func (this *Server) SpillDir() string {
+	return execution.GetSpillDir()
+}
+
+func (this *Server) SetSpillDir(dir string) {
+	execution.SetSpillDir(dir)
+}
+
 func (this *Server) AtrCollection() string {
 	return this.atrCollection
 }
@@ -616,6 +641,21 @@ func (this *Server) setupRequestContext(request Request) bool {
 	return true
 }
 
+// a context with the server defaults, for work done outside of any request,
+// such as running the tasks restored at startup
+func (this *Server) NewTaskContext(namespace, queryContext string, credentials *auth.Credentials) *execution.Context {
+	if namespace == "" {
+		namespace = this.namespace
+	}
+	requestId, _ := util.UUIDV3()
+	context := execution.NewContext(requestId, this.datastore, this.systemstore, namespace,
+		this.readonly, this.MaxParallelism(), this.ScanCap(), this.PipelineCap(), this.PipelineBatch(),
+		nil, nil, credentials, datastore.UNBOUNDED, nil, nil, nil, util.GetMaxIndexAPI(), util.GetN1qlFeatureControl(),
+		queryContext, false, util.GetUseCBO(), getNewOptimizer(), 0, this.Timeout())
+	context.SetWhitelist(this.whitelist)
+	return context
+}
+
 func (this *Server) handleRequest(request Request, queue *runQueue) bool {
 	if !queue.enqueue(request) {
 		return false
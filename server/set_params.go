@@ -165,6 +165,22 @@ var _SETTERS = map[string]Setter{
 		s.SetMemoryQuota(uint64(value))
 		return nil
 	},
+	SPILLTHRESHOLD: func(s *Server, o interface{}) errors.Error {
+		value := getNumber(o)
+		s.SetSpillThreshold(uint64(value))
+		return nil
+	},
+	MAXRECURSION: func(s *Server, o interface{}) errors.Error {
+		value := getNumber(o)
+		s.SetMaxRecursion(int(value))
+		return nil
+	},
+	SPILLDIR: func(s *Server, o interface{}) errors.Error {
+		if value, ok := o.(string); ok {
+			s.SetSpillDir(value)
+		}
+		return nil
+	},
 	USECBO: func(s *Server, o interface{}) errors.Error {
 		value, _ := o.(bool)
 		s.SetUseCBO(value)
@@ -223,7 +223,7 @@ func ExecN1QLStmt(line string, dBn1ql n1ql.N1qlDB, w io.Writer) (int, string) {
 	if rows != nil {
 		// We have output. That is what we want.
 
-		_, werr := io.Copy(w, rows)
+		werr := command.WriteResponse(w, rows)
 
 		// For any captured write error
 		if werr != nil {
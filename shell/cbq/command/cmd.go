@@ -31,6 +31,7 @@ const (
 	UNALIAS_CMD             = "UNALIAS"
 	SOURCE_CMD              = "SOURCE"
 	REDIRECT_CMD            = "REDIRECT"
+	EXPORT_CMD              = "EXPORT"
 	REFRESH_CLUSTER_MAP_CMD = "REFRESH_CLUSTER_MAP"
 )
 
@@ -72,6 +73,12 @@ var (
 	BATCH = "off"
 	//Output File open in append mode
 	FILE_APPEND_MODE = false
+	//Format to display query results in : json, jsonl, table or csv
+	OUTPUT_FORMAT = JSON_FORMAT
+	//Page query results that do not fit on the terminal
+	PAGER = true
+	//Maximum width of a table column, 0 for no limit
+	MAX_COL_WIDTH = 40
 )
 
 /* Value to store sorted list of keys for shell commands */
@@ -127,6 +134,7 @@ var COMMAND_LIST = map[string]ShellCommand{
 	/* Scripting Management */
 	"\\source":   &Source{},
 	"\\redirect": &Redirect{},
+	"\\export":   &Export{},
 
 	"\\refresh_cluster_map": &Refresh_cluster_map{},
 }
@@ -69,6 +69,14 @@ func init() {
 		PrintError(s_err)
 	}
 
+	for vble, val := range _OUTPUT_PARAMS {
+		err_code, err_str = PushValue_Helper(false, PreDefSV, vble, val)
+		if err_code != 0 {
+			s_err := HandleError(err_code, err_str)
+			PrintError(s_err)
+		}
+	}
+
 }
 
 func SetWriter(Wt io.Writer) {
@@ -350,6 +358,8 @@ func PushOrSet(args []string, pushvalue bool) (int, string) {
 	// Check what kind of parameter needs to be set or pushed
 	// depending on the pushvalue boolean value.
 
+	args[0] = outputParam(args[0])
+
 	if strings.HasPrefix(args[0], "-$") {
 
 		// For Named Parameters
@@ -487,6 +497,11 @@ func PushOrSet(args []string, pushvalue bool) (int, string) {
 			if errQ != nil {
 				return errors.INVALID_INPUT_ARGUMENTS, ""
 			}
+		} else if _, ok := _OUTPUT_PARAMS[vble]; ok {
+			err_code, err_str := setOutputParam(vble, args_str)
+			if err_code != 0 {
+				return err_code, err_str
+			}
 		}
 
 		err_code, err_str := PushValue_Helper(pushvalue, PreDefSV, vble, args_str)
@@ -573,6 +588,9 @@ func printDesc(cmdname string) (int, string) {
 	case REDIRECT_CMD:
 		return PrintStr(W, DREDIRECT)
 
+	case EXPORT_CMD:
+		return PrintStr(W, DEXPORT)
+
 	case REFRESH_CLUSTER_MAP_CMD:
 		return PrintStr(W, DREFRESH_CLUSTERMAP)
 
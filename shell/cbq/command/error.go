@@ -103,6 +103,10 @@ func HandleError(err int, msg string) errors.Error {
 		return errors.NewShellErrorNoSuchAlias(msg)
 	case errors.BATCH_MODE:
 		return errors.NewShellErrorBatchMode("")
+	case errors.OUTPUT_FORMAT:
+		return errors.NewShellErrorOutputFormat(msg)
+	case errors.NO_RESULTS:
+		return errors.NewShellErrorNoResults(msg)
 
 	//Generic Errors
 	case errors.OPERATION_TIMEOUT:
@@ -0,0 +1,104 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package command
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/couchbase/query/errors"
+)
+
+/* Export Command */
+type Export struct {
+	ShellCommand
+}
+
+func (this *Export) Name() string {
+	return "EXPORT"
+}
+
+func (this *Export) CommandCompletion() bool {
+	return false
+}
+
+func (this *Export) MinArgs() int {
+	return ONE_ARG
+}
+
+func (this *Export) MaxArgs() int {
+	return TWO_ARGS
+}
+
+func (this *Export) ExecCommand(args []string) (int, string) {
+	/* Command to write the result rows of the last query to a
+	   file, as csv or jsonl. The format defaults to csv for a
+	   .csv file, and to jsonl otherwise. A + before the file
+	   name appends to the file.
+	*/
+	if len(args) > this.MaxArgs() {
+		return errors.TOO_MANY_ARGS, ""
+
+	} else if len(args) < this.MinArgs() {
+		return errors.TOO_FEW_ARGS, ""
+	}
+
+	if lastResults == nil {
+		return errors.NO_RESULTS, ""
+	}
+
+	fileName := args[0]
+	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if strings.HasPrefix(fileName, "+") {
+		fileName = strings.TrimPrefix(fileName, "+")
+		flag = os.O_RDWR | os.O_CREATE | os.O_APPEND
+	}
+
+	format := JSONL_FORMAT
+	if len(args) > 1 {
+		format = strings.ToLower(args[1])
+		if format != CSV_FORMAT && format != JSONL_FORMAT {
+			return errors.OUTPUT_FORMAT, args[1]
+		}
+	} else if strings.HasSuffix(strings.ToLower(fileName), ".csv") {
+		format = CSV_FORMAT
+	}
+
+	file, err := os.OpenFile(fileName, flag, 0600)
+	if err != nil {
+		return errors.FILE_OPEN, err.Error()
+	}
+
+	err = writeRows(file, lastResults, format)
+	if err != nil {
+		file.Close()
+		return errors.WRITE_FILE, err.Error()
+	}
+	err = file.Close()
+	if err != nil {
+		return errors.FILE_CLOSE, err.Error()
+	}
+	return 0, ""
+}
+
+func (this *Export) PrintHelp(desc bool) (int, string) {
+	_, werr := io.WriteString(W, HEXPORT)
+	if desc {
+		err_code, err_str := printDesc(this.Name())
+		if err_code != 0 {
+			return err_code, err_str
+		}
+	}
+	_, werr = io.WriteString(W, "\n")
+	if werr != nil {
+		return errors.WRITER_OUTPUT, werr.Error()
+	}
+	return 0, ""
+}
@@ -106,6 +106,7 @@ const (
 	HUNSET              = "\\UNSET parameter\n"
 	HPOP                = "\\POP [ parameter ]\n"
 	HREDIRECT           = "\\REDIRECT OFF | filename \n"
+	HEXPORT             = "\\EXPORT filename [ CSV | JSONL ]\n"
 	HSOURCE             = "\\SOURCE filename\n"
 	HREFRESH_CLUSTERMAP = "\\REFRESH_CLUSTER_MAP\n"
 
@@ -150,7 +151,9 @@ const (
 
 	DSET = "Set the value of the given parameter to the input value. parameter is a prefixed name " +
 		"(-creds, -$rate, $user, histfile).\nIf no arguments are given, list all the existing parameters.\n" +
-		"\tExample : \n\t        \\SET -$r 9.5 ;\n\t        \\SET $Val -$r ;\n"
+		"Query results are displayed as set by output_format (json, jsonl, table or csv), pager (on or off)\n" +
+		"and max_col_width (the widest table column, 0 for no limit).\n" +
+		"\tExample : \n\t        \\SET -$r 9.5 ;\n\t        \\SET $Val -$r ;\n\t        \\SET output_format table ;\n"
 
 	DSOURCE = "Load input file into shell.\n\tExample : \n\t \\SOURCE temp1.txt ;\n"
 
@@ -167,6 +170,10 @@ const (
 		"To return to STDOUT, execute \\REDIRECT OFF .\n" +
 		"\tExample : \n\t\t \\REDIRECT temp1.txt ;\n\t\t select * from `beer-sample`;\n\t\t \\REDIRECT OFF;"
 
+	DEXPORT = "Write the result rows of the last query to file, as CSV or JSONL (one document per line). " +
+		"The format defaults\nto CSV for a .csv file and JSONL otherwise. Prefix filename with + to append to it.\n" +
+		"\tExample : \n\t\t select * from `beer-sample` limit 10;\n\t\t \\EXPORT beers.csv ;\n\t\t \\EXPORT +beers.json JSONL ;\n"
+
 	DDEFAULT            = "Fix : Does not exist.\n"
 	DREFRESH_CLUSTERMAP = "Refresh the list of query APIs to reflect input service url as cluster. " +
 		"\tExample : \n\t\t \\REFRESH_CLUSTER_MAP;"
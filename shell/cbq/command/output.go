@@ -0,0 +1,408 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package command
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/couchbase/query/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	JSON_FORMAT  = "json"
+	JSONL_FORMAT = "jsonl"
+	TABLE_FORMAT = "table"
+	CSV_FORMAT   = "csv"
+)
+
+/*
+Output settings are predefined session parameters, with their
+default values. They are handled by the shell and never sent to
+the query service, so they are also accepted with a leading -
+like query parameters.
+*/
+var _OUTPUT_PARAMS = map[string]string{
+	"output_format": JSON_FORMAT,
+	"pager":         "on",
+	"max_col_width": "40",
+}
+
+/* Rows of the last query result, kept for \EXPORT. */
+var lastResults []json.RawMessage
+
+/* Map a -name output setting to its predefined parameter name. */
+func outputParam(name string) string {
+	if strings.HasPrefix(name, "-") && !strings.HasPrefix(name, "-$") {
+		vble := strings.ToLower(name[1:])
+		if _, ok := _OUTPUT_PARAMS[vble]; ok {
+			return vble
+		}
+	}
+	return name
+}
+
+/*
+Validate the input value for an output setting before it is
+pushed on the parameter stack, and apply it.
+*/
+func setOutputParam(vble, args_str string) (int, string) {
+	v, err_code, err_str := Resolve(args_str)
+	if err_code != 0 {
+		return err_code, err_str
+	}
+	return applyOutputParam(vble, handleStrings(ValToStr(v)))
+}
+
+/*
+After a \POP or \UNSET apply the value now on top of the stack for
+an output setting, restoring the default if the stack is empty.
+*/
+func resetOutputParam(vble string) (int, string) {
+	nval, ok := _OUTPUT_PARAMS[vble]
+	if !ok {
+		return 0, ""
+	}
+
+	st_val, ok := PreDefSV[vble]
+	if ok {
+		newval, err_code, err_str := st_val.Top()
+		if err_code != 0 {
+			return err_code, err_str
+		}
+		nval = handleStrings(ValToStr(newval))
+	} else {
+		err_code, err_str := PushValue_Helper(false, PreDefSV, vble, nval)
+		if err_code != 0 {
+			return err_code, err_str
+		}
+	}
+	return applyOutputParam(vble, nval)
+}
+
+func applyOutputParam(vble, nval string) (int, string) {
+	switch vble {
+	case "output_format":
+		format := strings.ToLower(nval)
+		switch format {
+		case JSON_FORMAT, JSONL_FORMAT, TABLE_FORMAT, CSV_FORMAT:
+			OUTPUT_FORMAT = format
+		default:
+			return errors.OUTPUT_FORMAT, nval
+		}
+	case "pager":
+		if nval != "on" && nval != "off" {
+			return errors.INVALID_INPUT_ARGUMENTS, ""
+		}
+		PAGER = nval == "on"
+	case "max_col_width":
+		width, err := strconv.Atoi(nval)
+		if err != nil || width < 0 {
+			return errors.INVALID_INPUT_ARGUMENTS, ""
+		}
+		MAX_COL_WIDTH = width
+	}
+	return 0, ""
+}
+
+type queryResponse struct {
+	Results  []json.RawMessage `json:"results"`
+	Errors   json.RawMessage   `json:"errors"`
+	Warnings json.RawMessage   `json:"warnings"`
+}
+
+/*
+Write a query response to w in the current output format, through
+the pager if the output is too long for the terminal, and keep its
+result rows for \EXPORT. The json format writes the response as it
+is received.
+*/
+func WriteResponse(w io.Writer, r io.Reader) error {
+	var body bytes.Buffer
+
+	paged := paging(w)
+	if OUTPUT_FORMAT == JSON_FORMAT && !paged {
+		_, err := io.Copy(w, io.TeeReader(r, &body))
+		keepResults(body.Bytes())
+		return err
+	}
+
+	_, err := body.ReadFrom(r)
+	if err != nil {
+		return err
+	}
+	out := body.Bytes()
+
+	resp := keepResults(out)
+	if OUTPUT_FORMAT != JSON_FORMAT && resp != nil {
+		var buf bytes.Buffer
+		err = writeRows(&buf, resp.Results, OUTPUT_FORMAT)
+		if err != nil {
+			return err
+		}
+		writeMessages(&buf, "errors", resp.Errors)
+		writeMessages(&buf, "warnings", resp.Warnings)
+		out = buf.Bytes()
+	}
+
+	if paged {
+		return page(w, out)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+func keepResults(body []byte) *queryResponse {
+	resp := &queryResponse{}
+	if json.Unmarshal(body, resp) != nil {
+		lastResults = nil
+		return nil
+	}
+	lastResults = resp.Results
+	return resp
+}
+
+/*
+Write result rows as jsonl (one compact document per line), csv or
+table.
+*/
+func writeRows(w io.Writer, rows []json.RawMessage, format string) error {
+	switch format {
+	case JSONL_FORMAT:
+		for _, row := range rows {
+			var buf bytes.Buffer
+			err := json.Compact(&buf, row)
+			if err != nil {
+				return err
+			}
+			buf.WriteByte('\n')
+			_, err = w.Write(buf.Bytes())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case CSV_FORMAT:
+		cols, objs := columns(rows)
+		cw := csv.NewWriter(w)
+		if len(cols) > 0 {
+			cw.Write(cols)
+		}
+		for _, obj := range objs {
+			record := make([]string, len(cols))
+			for i, col := range cols {
+				record[i] = cellString(obj[col])
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+
+	default:
+		return writeTable(w, rows)
+	}
+}
+
+/*
+The table has a column for each field of the rows, with values
+truncated to MAX_COL_WIDTH characters, and ends with a count of
+the rows.
+*/
+func writeTable(w io.Writer, rows []json.RawMessage) error {
+	cols, objs := columns(rows)
+
+	header := make([]string, len(cols))
+	widths := make([]int, len(cols))
+	for i, col := range cols {
+		header[i] = truncate(col)
+		widths[i] = utf8.RuneCountInString(header[i])
+	}
+
+	cells := make([][]string, len(objs))
+	for r, obj := range objs {
+		cells[r] = make([]string, len(cols))
+		for i, col := range cols {
+			cells[r][i] = truncate(cellString(obj[col]))
+			if n := utf8.RuneCountInString(cells[r][i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if len(cols) > 0 {
+		writeLine(&buf, header, widths)
+		for i, width := range widths {
+			if i > 0 {
+				buf.WriteByte('+')
+			}
+			buf.WriteString(strings.Repeat("-", width+2))
+		}
+		buf.WriteByte('\n')
+		for _, line := range cells {
+			writeLine(&buf, line, widths)
+		}
+	}
+
+	if len(rows) == 1 {
+		buf.WriteString("(1 row)\n")
+	} else {
+		fmt.Fprintf(&buf, "(%d rows)\n", len(rows))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeLine(buf *bytes.Buffer, line []string, widths []int) {
+	var l bytes.Buffer
+	for i, cell := range line {
+		if i > 0 {
+			l.WriteString(" |")
+		}
+		l.WriteByte(' ')
+		l.WriteString(cell)
+		l.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+	}
+	buf.WriteString(strings.TrimRight(l.String(), " "))
+	buf.WriteByte('\n')
+}
+
+/*
+The columns are the fields of the rows in the order they are first
+seen. Rows that are not objects, such as those of SELECT RAW, are
+given the field $1.
+*/
+func columns(rows []json.RawMessage) ([]string, []map[string]json.RawMessage) {
+	var cols []string
+	seen := make(map[string]bool)
+	objs := make([]map[string]json.RawMessage, len(rows))
+
+	for r, row := range rows {
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(row, &obj) != nil || obj == nil {
+			obj = map[string]json.RawMessage{"$1": row}
+		}
+		objs[r] = obj
+
+		keys := make([]string, 0, len(obj))
+		for k, _ := range obj {
+			if !seen[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			seen[k] = true
+			cols = append(cols, k)
+		}
+	}
+	return cols, objs
+}
+
+/*
+Strings are shown without quotes and other values as compact JSON.
+A missing field is empty.
+*/
+func cellString(val json.RawMessage) string {
+	if len(val) == 0 {
+		return ""
+	}
+
+	var s string
+	if val[0] == '"' && json.Unmarshal(val, &s) == nil {
+		return s
+	}
+
+	var buf bytes.Buffer
+	if json.Compact(&buf, val) != nil {
+		return string(val)
+	}
+	return buf.String()
+}
+
+var _CELL_ESCAPER = strings.NewReplacer("\n", "\\n", "\r", "\\r", "\t", "\\t")
+
+func truncate(cell string) string {
+	cell = _CELL_ESCAPER.Replace(cell)
+	if MAX_COL_WIDTH > 0 && utf8.RuneCountInString(cell) > MAX_COL_WIDTH {
+		runes := []rune(cell)
+		if MAX_COL_WIDTH > 3 {
+			return string(runes[:MAX_COL_WIDTH-3]) + "..."
+		}
+		return string(runes[:MAX_COL_WIDTH])
+	}
+	return cell
+}
+
+func writeMessages(w io.Writer, name string, msgs json.RawMessage) {
+	if len(msgs) == 0 || string(msgs) == "null" {
+		return
+	}
+
+	var buf bytes.Buffer
+	if json.Indent(&buf, msgs, "", "    ") != nil {
+		buf.Reset()
+		buf.Write(msgs)
+	}
+	fmt.Fprintf(w, "%s: %s\n", name, buf.String())
+}
+
+/* Only output to the terminal of an interactive session is paged. */
+func paging(w io.Writer) bool {
+	return PAGER && w == os.Stdout &&
+		terminal.IsTerminal(int(os.Stdin.Fd())) &&
+		terminal.IsTerminal(int(os.Stdout.Fd()))
+}
+
+/*
+Output that does not fit on the terminal is passed to the pager
+named by $PAGER, or less (more on windows). If the pager cannot be
+run the output is written directly.
+*/
+func page(w io.Writer, out []byte) error {
+	_, height, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil || bytes.Count(out, []byte("\n")) < height-1 {
+		_, err = w.Write(out)
+		return err
+	}
+
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		if runtime.GOOS == "windows" {
+			pager = []string{"more"}
+		} else {
+			pager = []string{"less", "-FRSX"}
+		}
+	}
+
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = bytes.NewReader(out)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if cmd.Start() != nil {
+		_, err = w.Write(out)
+		return err
+	}
+
+	// The pager exits with an error if it is quit early; that is not ours
+	cmd.Wait()
+	return nil
+}
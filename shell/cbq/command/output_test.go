@@ -0,0 +1,187 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package command
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const _RESPONSE = `{
+    "requestID": "1b8e8f9c",
+    "signature": {"*": "*"},
+    "results": [
+    {"name": "alice", "age": 30, "tags": ["a", "b"]},
+    {"name": "bob, jr.", "city": "line1\nline2", "age": null},
+    "raw"
+    ],
+    "status": "success",
+    "metrics": {"resultCount": 3}
+}`
+
+func writeResponse(format string, t *testing.T) string {
+	prev := OUTPUT_FORMAT
+	defer func() { OUTPUT_FORMAT = prev }()
+	OUTPUT_FORMAT = format
+
+	var b bytes.Buffer
+	err := WriteResponse(&b, strings.NewReader(_RESPONSE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestOutputFormats(t *testing.T) {
+	if out := writeResponse(JSON_FORMAT, t); out != _RESPONSE {
+		t.Errorf("Expected the response as received, got %s", out)
+	}
+
+	expected := `{"name":"alice","age":30,"tags":["a","b"]}
+{"name":"bob, jr.","city":"line1\nline2","age":null}
+"raw"
+`
+	if out := writeResponse(JSONL_FORMAT, t); out != expected {
+		t.Errorf("Expected jsonl %s, got %s", expected, out)
+	}
+
+	expected = `age,name,tags,city,$1
+30,alice,"[""a"",""b""]",,
+null,"bob, jr.",,"line1
+line2",
+,,,,raw
+`
+	if out := writeResponse(CSV_FORMAT, t); out != expected {
+		t.Errorf("Expected csv %s, got %s", expected, out)
+	}
+
+	expected = ` age  | name     | tags      | city         | $1
+------+----------+-----------+--------------+-----
+ 30   | alice    | ["a","b"] |              |
+ null | bob, jr. |           | line1\nline2 |
+      |          |           |              | raw
+(3 rows)
+`
+	if out := writeResponse(TABLE_FORMAT, t); out != expected {
+		t.Errorf("Expected table %s, got %s", expected, out)
+	}
+}
+
+func TestOutputTruncate(t *testing.T) {
+	prev := MAX_COL_WIDTH
+	defer func() { MAX_COL_WIDTH = prev }()
+
+	MAX_COL_WIDTH = 8
+	if s := truncate("abcdefghij"); s != "abcde..." {
+		t.Errorf("Expected abcde..., got %s", s)
+	}
+	if s := truncate("abcdefgh"); s != "abcdefgh" {
+		t.Errorf("Expected abcdefgh, got %s", s)
+	}
+
+	MAX_COL_WIDTH = 0
+	if s := truncate("abcdefghij"); s != "abcdefghij" {
+		t.Errorf("Expected abcdefghij, got %s", s)
+	}
+}
+
+func TestOutputParams(t *testing.T) {
+	var b bytes.Buffer
+	SetWriter(&b)
+
+	pushval(strings.Split("-output_format table", " "), true, t)
+	if OUTPUT_FORMAT != TABLE_FORMAT {
+		t.Errorf("Expected output format table, got %s", OUTPUT_FORMAT)
+	}
+	if _, ok := QueryParam["output_format"]; ok {
+		t.Errorf("Output format should not be a query parameter")
+	}
+
+	pushval(strings.Split("output_format csv", " "), false, t)
+	if OUTPUT_FORMAT != CSV_FORMAT {
+		t.Errorf("Expected output format csv, got %s", OUTPUT_FORMAT)
+	}
+
+	errCode, _ := PushOrSet(strings.Split("output_format xml", " "), true)
+	if errCode == 0 || OUTPUT_FORMAT != CSV_FORMAT {
+		t.Errorf("Expected error for output format xml")
+	}
+
+	errCode, errStr := COMMAND_LIST["\\pop"].ExecCommand([]string{"output_format"})
+	if errCode != 0 {
+		t.Error(HandleError(errCode, errStr))
+	} else if OUTPUT_FORMAT != TABLE_FORMAT {
+		t.Errorf("Expected output format table, got %s", OUTPUT_FORMAT)
+	}
+
+	pushval(strings.Split("max_col_width 10", " "), true, t)
+	pushval(strings.Split("pager off", " "), true, t)
+	if MAX_COL_WIDTH != 10 || PAGER {
+		t.Errorf("Expected max_col_width 10 and pager off, got %v %v", MAX_COL_WIDTH, PAGER)
+	}
+
+	for _, vble := range []string{"-output_format", "max_col_width", "pager"} {
+		errCode, errStr = COMMAND_LIST["\\unset"].ExecCommand([]string{vble})
+		if errCode != 0 {
+			t.Error(HandleError(errCode, errStr))
+		}
+	}
+	if OUTPUT_FORMAT != JSON_FORMAT || MAX_COL_WIDTH != 40 || !PAGER {
+		t.Errorf("Expected defaults, got %v %v %v", OUTPUT_FORMAT, MAX_COL_WIDTH, PAGER)
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cbq_export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	export := COMMAND_LIST["\\export"]
+	writeResponse(JSON_FORMAT, t)
+
+	csvFile := filepath.Join(dir, "rows.csv")
+	errCode, errStr := export.ExecCommand([]string{csvFile})
+	if errCode != 0 {
+		t.Fatal(HandleError(errCode, errStr))
+	}
+	b, _ := ioutil.ReadFile(csvFile)
+	if !strings.HasPrefix(string(b), "age,name,tags,city,$1\n") {
+		t.Errorf("Unexpected csv export %s", b)
+	}
+
+	jsonFile := filepath.Join(dir, "rows.json")
+	for _, arg := range []string{jsonFile, "+" + jsonFile} {
+		errCode, errStr = export.ExecCommand([]string{arg, "JSONL"})
+		if errCode != 0 {
+			t.Fatal(HandleError(errCode, errStr))
+		}
+	}
+	b, _ = ioutil.ReadFile(jsonFile)
+	if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != 6 ||
+		lines[0] != `{"name":"alice","age":30,"tags":["a","b"]}` {
+		t.Errorf("Unexpected jsonl export %s", b)
+	}
+
+	errCode, _ = export.ExecCommand([]string{jsonFile, "xml"})
+	if errCode == 0 {
+		t.Errorf("Expected error for export format xml")
+	}
+
+	lastResults = nil
+	errCode, _ = export.ExecCommand([]string{jsonFile})
+	if errCode == 0 {
+		t.Errorf("Expected error for export without results")
+	}
+}
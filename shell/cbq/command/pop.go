@@ -67,6 +67,8 @@ func (this *Pop) ExecCommand(args []string) (int, string) {
 		//Popparam_Helper(PreDefSV, false)
 
 	} else {
+		args[0] = outputParam(args[0])
+
 		//Check what kind of parameter needs to be popped
 
 		if strings.HasPrefix(args[0], "-$") {
@@ -212,6 +214,11 @@ func (this *Pop) ExecCommand(args []string) (int, string) {
 				// Dont need to worry about error handling here as we make sure we push correct values
 				// into the stack.
 				QUIET, _ = strconv.ParseBool(nval)
+			} else {
+				err_code, err_str := resetOutputParam(vble)
+				if err_code != 0 {
+					return err_code, err_str
+				}
 			}
 
 		}
@@ -49,6 +49,8 @@ func (this *Unset) ExecCommand(args []string) (int, string) {
 		return errors.TOO_FEW_ARGS, ""
 
 	} else {
+		args[0] = outputParam(args[0])
+
 		//Check what kind of parameter needs to be Unset.
 		// For query parameters
 		if strings.HasPrefix(args[0], "-$") {
@@ -122,6 +124,11 @@ func (this *Unset) ExecCommand(args []string) (int, string) {
 				QUIET = false
 			}
 
+			err_code, err_str = resetOutputParam(vble)
+			if err_code != 0 {
+				return err_code, err_str
+			}
+
 			//Print the path to histfile
 			err_code, err_str = printPath(HISTFILE)
 			if err_code != 0 {
@@ -0,0 +1,426 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/couchbase/query/parser/n1ql"
+	"github.com/couchbase/query/shell/cbq/command"
+)
+
+const (
+	// How long metadata fetched from the query service is used for completion
+	_COMPLETION_TTL = 5 * time.Minute
+
+	// Number of documents INFER samples for the field names of a keyspace
+	_INFER_SAMPLE_SIZE = 100
+
+	// Depth of nested field names taken from INFER
+	_FIELD_DEPTH = 3
+)
+
+// What the word being completed is expected to be
+const (
+	_EXPRESSION = iota
+	_KEYSPACE
+	_INDEX
+)
+
+/*
+Tab completion for the word before the cursor. The statement so far,
+including the earlier lines of a multi-line statement, decides what
+the word is completed with:
+shell commands, aliases and parameters for shell commands;
+named parameters for words starting with $;
+keyspaces after FROM, JOIN, INTO and the like;
+index names after INDEX; and
+otherwise N1QL keywords and the fields of the keyspaces in the statement.
+*/
+func completeWord(earlier []string, line string, pos int) (string, []string, string) {
+	runes := []rune(line)
+	if pos > len(runes) {
+		pos = len(runes)
+	}
+	start := pos
+	for start > 0 && isWordRune(runes[start-1]) {
+		start--
+	}
+	head, word, tail := string(runes[:start]), string(runes[start:pos]), string(runes[pos:])
+
+	lines := append(earlier[:len(earlier):len(earlier)], head)
+	stmt := strings.TrimSpace(strings.Join(lines, " "))
+	return head, completions(stmt, word), tail
+}
+
+func completions(stmt, word string) []string {
+	var candidates []string
+
+	if strings.HasPrefix(stmt, "\\") || (stmt == "" && strings.HasPrefix(word, "\\")) {
+		candidates = shellCandidates(stmt, word)
+	} else if strings.HasPrefix(word, "$") {
+		candidates = parameters("$", command.NamedParam)
+	} else {
+		tokens := tokenize(stmt)
+		switch wordContext(tokens) {
+		case _KEYSPACE:
+			candidates = completion.keyspacePaths()
+		case _INDEX:
+			dot := strings.LastIndexByte(word, '.')
+			for _, name := range completion.indexNames() {
+				candidates = append(candidates, word[:dot+1]+name)
+			}
+		default:
+			if word == "" {
+				return nil
+			}
+			candidates = fieldCandidates(word, completion.fieldNames(keyspacesIn(tokens)))
+			for _, keyword := range n1ql.Keywords() {
+				candidates = append(candidates, inCaseOf(word, keyword))
+			}
+		}
+	}
+	return matching(candidates, word)
+}
+
+/*
+The first word of a shell command is a command or an alias, and its
+arguments may be named parameters or user defined session parameters.
+*/
+func shellCandidates(stmt, word string) []string {
+	var candidates []string
+
+	switch {
+	case strings.HasPrefix(word, "\\\\"):
+		for name, _ := range command.AliasCommand {
+			candidates = append(candidates, "\\\\"+name)
+		}
+	case stmt == "":
+		for name, _ := range command.COMMAND_LIST {
+			candidates = append(candidates, inCaseOf(word, name))
+		}
+	case strings.HasPrefix(word, "-$"):
+		candidates = parameters("-$", command.NamedParam)
+	case strings.HasPrefix(word, "$"):
+		candidates = parameters("$", command.UserDefSV)
+	}
+	return candidates
+}
+
+func parameters(prefix string, params map[string]*command.Stack) []string {
+	candidates := make([]string, 0, len(params))
+	for name, _ := range params {
+		candidates = append(candidates, prefix+name)
+	}
+	return candidates
+}
+
+/*
+Field names are completed one level at a time. A word whose first
+part is not a field is taken to start with a keyspace alias.
+*/
+func fieldCandidates(word string, fields []string) []string {
+	dot := strings.IndexByte(word, '.')
+	if dot < 0 {
+		return namesAtDepth(fields, 0, "")
+	}
+
+	depth := strings.Count(word, ".")
+	root := strings.ToLower(stripQuotes(word[:dot]))
+	for _, field := range fields {
+		if strings.ToLower(stripQuotes(field)) == root {
+			return namesAtDepth(fields, depth, "")
+		}
+	}
+	return namesAtDepth(fields, depth-1, word[:dot+1])
+}
+
+func namesAtDepth(fields []string, depth int, prefix string) []string {
+	var names []string
+	for _, field := range fields {
+		if strings.Count(stripQuotes(field), ".") == depth {
+			names = append(names, prefix+field)
+		}
+	}
+	return names
+}
+
+/* Candidates that start with the word, ignoring case and backticks. */
+func matching(candidates []string, word string) []string {
+	prefix := strings.ToLower(stripQuotes(word))
+	seen := make(map[string]bool, len(candidates))
+	var rv []string
+	for _, candidate := range candidates {
+		if !seen[candidate] && strings.HasPrefix(strings.ToLower(stripQuotes(candidate)), prefix) {
+			seen[candidate] = true
+			rv = append(rv, candidate)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+/* Keywords and commands are completed in lower case if the word is. */
+func inCaseOf(word, name string) string {
+	if strings.IndexFunc(word, unicode.IsLower) >= 0 {
+		return strings.ToLower(name)
+	}
+	return strings.ToUpper(name)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_$`.:\\-", r)
+}
+
+func tokenize(stmt string) []string {
+	var tokens []string
+	runes := []rune(stmt)
+	for i := 0; i < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[i]):
+			i++
+		case isWordRune(runes[i]):
+			j := i
+			for j < len(runes) && isWordRune(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			tokens = append(tokens, string(runes[i]))
+			i++
+		}
+	}
+	return tokens
+}
+
+/* The context of the word after tokens, from the tokens before it. */
+func wordContext(tokens []string) int {
+	n := len(tokens)
+	if n == 0 {
+		return _EXPRESSION
+	}
+	if isKeyspaceToken(tokens, n-1) {
+		return _KEYSPACE
+	}
+
+	switch strings.ToUpper(tokens[n-1]) {
+	case "INDEX":
+		return _INDEX
+	case "(":
+		// USE INDEX (
+		if n > 1 && strings.ToUpper(tokens[n-2]) == "INDEX" {
+			return _INDEX
+		}
+	}
+	return _EXPRESSION
+}
+
+/* Whether tokens[i] is followed by a keyspace. */
+func isKeyspaceToken(tokens []string, i int) bool {
+	switch strings.ToUpper(tokens[i]) {
+	case "FROM", "JOIN", "NEST", "INTO", "UPDATE", "KEYSPACE", "INFER":
+		return true
+	case "ON":
+		// CREATE INDEX ... ON, BUILD INDEX ON and the like
+		switch strings.ToUpper(tokens[0]) {
+		case "CREATE", "BUILD", "DROP", "ALTER":
+			return true
+		}
+	}
+	return false
+}
+
+func keyspacesIn(tokens []string) []string {
+	var keyspaces []string
+	for i := 1; i < len(tokens); i++ {
+		if isKeyspaceToken(tokens, i-1) {
+			keyspaces = append(keyspaces, tokens[i])
+		}
+	}
+	return keyspaces
+}
+
+func stripQuotes(name string) string {
+	return strings.Replace(name, "`", "", -1)
+}
+
+/* Names that are not plain identifiers are quoted with backticks. */
+func quoteName(name string) string {
+	plain := name != "" && !unicode.IsDigit(rune(name[0]))
+	for _, r := range name {
+		if r != '_' && (r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r))) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return name
+	}
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+/*
+Metadata fetched from the query service for completion: the paths of
+the keyspaces, the names of the indexes, and the field names INFER
+finds in each keyspace. It is only used while connected, and fetched
+again after _COMPLETION_TTL or when the shell connects elsewhere.
+*/
+type completionCache struct {
+	server    string
+	fetched   time.Time
+	keyspaces []string
+	indexes   []string
+	fields    map[string]*inferredFields
+}
+
+type inferredFields struct {
+	fetched time.Time
+	fields  []string
+}
+
+var completion = &completionCache{fields: make(map[string]*inferredFields)}
+
+func (this *completionCache) refresh() bool {
+	if noQueryService {
+		return false
+	}
+
+	if this.server != serverFlag {
+		*this = completionCache{server: serverFlag, fields: make(map[string]*inferredFields)}
+	}
+	if command.DbN1ql == nil || time.Since(this.fetched) < _COMPLETION_TTL {
+		return true
+	}
+
+	this.fetched = time.Now()
+	this.keyspaces = this.keyspaces[:0]
+	for _, row := range completionQuery("SELECT k.`bucket`, k.`scope`, k.name FROM system:keyspaces AS k") {
+		obj, _ := row.(map[string]interface{})
+		name, _ := obj["name"].(string)
+		bucket, _ := obj["bucket"].(string)
+		scope, _ := obj["scope"].(string)
+		if name == "" {
+			continue
+		} else if bucket != "" && scope != "" {
+			this.keyspaces = append(this.keyspaces, quoteName(bucket)+"."+quoteName(scope)+"."+quoteName(name))
+		} else {
+			this.keyspaces = append(this.keyspaces, quoteName(name))
+		}
+	}
+
+	this.indexes = this.indexes[:0]
+	for _, row := range completionQuery("SELECT DISTINCT RAW name FROM system:indexes") {
+		if name, ok := row.(string); ok {
+			this.indexes = append(this.indexes, quoteName(name))
+		}
+	}
+	return true
+}
+
+func (this *completionCache) keyspacePaths() []string {
+	if !this.refresh() {
+		return nil
+	}
+	return this.keyspaces
+}
+
+func (this *completionCache) indexNames() []string {
+	if !this.refresh() {
+		return nil
+	}
+	return this.indexes
+}
+
+/* The field names of the known keyspaces among those given. */
+func (this *completionCache) fieldNames(keyspaces []string) []string {
+	if len(keyspaces) == 0 || !this.refresh() {
+		return nil
+	}
+
+	var fields []string
+	for _, keyspace := range keyspaces {
+		keyspace = stripQuotes(strings.TrimPrefix(keyspace, "default:"))
+		for _, path := range this.keyspaces {
+			if stripQuotes(path) != keyspace {
+				continue
+			}
+			inferred, ok := this.fields[path]
+			if command.DbN1ql != nil && (!ok || time.Since(inferred.fetched) >= _COMPLETION_TTL) {
+				inferred = &inferredFields{fetched: time.Now(), fields: inferFields(path)}
+				this.fields[path] = inferred
+			}
+			if inferred != nil {
+				fields = append(fields, inferred.fields...)
+			}
+			break
+		}
+	}
+	return fields
+}
+
+/*
+INFER returns a schema for each flavor of document in the keyspace,
+whose properties are the fields, with nested properties for objects.
+*/
+func inferFields(path string) []string {
+	stmt := "INFER " + path + " WITH {\"sample_size\": " + strconv.Itoa(_INFER_SAMPLE_SIZE) + "}"
+	names := make(map[string]bool)
+	for _, row := range completionQuery(stmt) {
+		flavors, _ := row.([]interface{})
+		for _, flavor := range flavors {
+			obj, _ := flavor.(map[string]interface{})
+			addFields(names, "", obj["properties"], 0)
+		}
+	}
+
+	fields := make([]string, 0, len(names))
+	for name, _ := range names {
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+func addFields(names map[string]bool, prefix string, properties interface{}, depth int) {
+	props, _ := properties.(map[string]interface{})
+	for name, prop := range props {
+		field := prefix + quoteName(name)
+		names[field] = true
+		if depth+1 < _FIELD_DEPTH {
+			obj, _ := prop.(map[string]interface{})
+			addFields(names, field+".", obj["properties"], depth+1)
+		}
+	}
+}
+
+/* The results of a statement, or nil if it fails. */
+func completionQuery(stmt string) []interface{} {
+	rows, err := command.DbN1ql.QueryRaw(stmt)
+	if rows == nil {
+		return nil
+	}
+	body, rerr := ioutil.ReadAll(rows)
+	if err != nil || rerr != nil {
+		return nil
+	}
+
+	var resp struct {
+		Results []interface{} `json:"results"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return nil
+	}
+	return resp.Results
+}
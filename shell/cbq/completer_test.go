@@ -0,0 +1,88 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/couchbase/query/shell/cbq/command"
+)
+
+func complete(t *testing.T, earlier []string, line string, expected ...string) {
+	head, completions, tail := completeWord(earlier, line, len([]rune(line)))
+	if tail != "" || !strings.HasPrefix(line, head) {
+		t.Errorf("Unexpected head %q and tail %q for %q", head, tail, line)
+	}
+	if len(completions) != len(expected) || (len(expected) > 0 && !reflect.DeepEqual(completions, expected)) {
+		t.Errorf("Expected completions %v for %q, got %v", expected, line, completions)
+	}
+}
+
+func TestCompleteShell(t *testing.T) {
+	complete(t, nil, "\\SE", "\\SET")
+	complete(t, nil, "\\ec", "\\echo")
+	complete(t, nil, "\\ex", "\\exit", "\\export")
+
+	command.AliasCommand["serverversion"] = "select version()"
+	defer delete(command.AliasCommand, "serverversion")
+	complete(t, nil, "\\\\serv", "\\\\serverversion")
+
+	command.NamedParam["limit"] = command.Stack_Helper()
+	defer delete(command.NamedParam, "limit")
+	complete(t, nil, "\\UNSET -$li", "-$limit")
+	complete(t, nil, "SELECT * FROM b LIMIT $l", "$limit")
+}
+
+func TestCompleteKeywords(t *testing.T) {
+	complete(t, nil, "SELE", "SELECT")
+	complete(t, nil, "sele", "select")
+	complete(t, []string{"select *"}, "from b wher", "where")
+	complete(t, nil, "SELECT ")
+}
+
+func TestCompleteMetadata(t *testing.T) {
+	prevServer, prevNoQuery, prevCompletion := serverFlag, noQueryService, completion
+	defer func() {
+		serverFlag, noQueryService, completion = prevServer, prevNoQuery, prevCompletion
+	}()
+
+	serverFlag = "http://localhost:8093"
+	noQueryService = false
+	completion = &completionCache{
+		server:    serverFlag,
+		fetched:   time.Now(),
+		keyspaces: []string{"`travel-sample`", "`travel-sample`.inventory.airline", "customers"},
+		indexes:   []string{"def_type", "def_name"},
+		fields: map[string]*inferredFields{
+			"`travel-sample`.inventory.airline": &inferredFields{
+				fetched: time.Now(),
+				fields:  []string{"name", "country", "address", "address.city", "`call-sign`"},
+			},
+		},
+	}
+
+	complete(t, nil, "SELECT * FROM tr", "`travel-sample`", "`travel-sample`.inventory.airline")
+	complete(t, nil, "SELECT * FROM `travel-sample`.inv", "`travel-sample`.inventory.airline")
+	complete(t, nil, "SELECT * FROM cust", "customers")
+	complete(t, nil, "CREATE INDEX ix ON cu", "customers")
+	complete(t, nil, "DROP INDEX def_", "def_name", "def_type")
+	complete(t, nil, "SELECT * FROM customers USE INDEX (def_n", "def_name")
+
+	airline := "SELECT * FROM `travel-sample`.inventory.airline AS a WHERE "
+	complete(t, nil, airline+"cou", "country")
+	complete(t, nil, airline+"address.ci", "address.city")
+	complete(t, nil, airline+"a.ca", "a.`call-sign`")
+	complete(t, nil, airline+"NA", "NAMESPACE", "name")
+
+	noQueryService = true
+	complete(t, nil, "SELECT * FROM cust")
+}
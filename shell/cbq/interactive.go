@@ -193,6 +193,10 @@ func HandleInteractiveMode(prompt string) {
 	inputLine := []string{}
 	fullPrompt := prompt + QRY_PROMPT1
 
+	liner.SetWordCompleter(func(line string, pos int) (string, []string, string) {
+		return completeWord(inputLine, line, pos)
+	})
+
 	handleScriptFlag(&liner)
 	handleIPModeFlag(&liner)
 
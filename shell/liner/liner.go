@@ -90,3 +90,15 @@ func (s *State) SetMultiLineMode(mlmode bool) {
 		s.vi.SetMultiLineMode(mlmode)
 	}
 }
+
+// WordCompleter takes the line being edited and the cursor position, and
+// returns the text before the word being completed, the completions of
+// the word, and the text after it.
+type WordCompleter func(line string, pos int) (head string, completions []string, tail string)
+
+// Tab completion is not supported in vi mode.
+func (s *State) SetWordCompleter(f WordCompleter) {
+	if !s.viMode {
+		s.orig.SetWordCompleter(pliner.WordCompleter(f))
+	}
+}
@@ -0,0 +1,245 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package statistics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+// Histograms are built over all the sampled values of a key, MISSING and NULL
+// included, in collation order. Bin sizes are fractions of the number of sampled
+// values, which for array keys are the array elements rather than documents.
+//
+// A value that fills a bin by itself goes to an overflow bin. The remaining values
+// are spread over equi-depth distribution bins, each holding the values above the
+// maximum of the previous one; the first distribution bin is empty and only
+// records the smallest value. The distinct fraction of a bin is the number of
+// distinct values in it, over the number of sampled values.
+
+const (
+	DEF_RESOLUTION = 1.0  // percentage of the sampled values per bin
+	MIN_RESOLUTION = 0.02 // 5000 bins
+	MAX_RESOLUTION = 5.0  // 20 bins
+)
+
+type arrayCounts struct {
+	docs    int64
+	missing int64
+	empty   int64
+}
+
+func newHistogram(keyspace string, key expression.Expression, docCount int64, resolution float64,
+	vals value.Values, arrays *arrayCounts) *datastore.Histogram {
+
+	sort.Slice(vals, func(i, j int) bool { return vals[i].Collate(vals[j]) < 0 })
+
+	n := float64(len(vals))
+	binSize := math.Max(1.0, math.Floor(n*resolution/100.0))
+
+	var avgArrayLen, missingArr, emptyArr float64
+	population := float64(docCount)
+	if arrays != nil && arrays.docs > 0 {
+		docs := float64(arrays.docs)
+		if arrays.docs > arrays.missing {
+			avgArrayLen = n / (docs - float64(arrays.missing))
+		}
+		missingArr = float64(arrays.missing) / docs
+		emptyArr = float64(arrays.empty) / docs
+		population *= avgArrayLen * (1.0 - missingArr)
+	}
+
+	distrib := make(datastore.DistBins, 0, int(100.0/resolution)+2)
+	ovrflow := make(datastore.OverflowBins, 0, 16)
+	var ndv, singles, binCount, binDistinct float64
+	var binMax value.Value
+
+	for i := 0; i < len(vals); {
+		j := i + 1
+		for j < len(vals) && vals[j].Collate(vals[i]) == 0 {
+			j++
+		}
+		count := float64(j - i)
+		ndv++
+		if count == 1 {
+			singles++
+		}
+
+		if count >= binSize {
+			ovrflow = append(ovrflow, datastore.NewOverflowBin(count/n, vals[i]))
+		} else {
+			if len(distrib) == 0 {
+				distrib = append(distrib, datastore.NewDistBin(0.0, 0.0, vals[i]))
+			}
+			binCount += count
+			binDistinct++
+			binMax = vals[i]
+			if binCount >= binSize {
+				distrib = append(distrib, datastore.NewDistBin(binCount/n, binDistinct/n, binMax))
+				binCount = 0
+				binDistinct = 0
+			}
+		}
+		i = j
+	}
+	if binCount > 0 {
+		distrib = append(distrib, datastore.NewDistBin(binCount/n, binDistinct/n, binMax))
+	}
+
+	// scale the number of distinct values up to the whole keyspace, with the
+	// guaranteed error estimator: values seen once stand for sqrt(N/n) values
+	if n > 0 && n < population {
+		ndv += (math.Sqrt(population/n) - 1.0) * singles
+		ndv = math.Min(ndv, population)
+	}
+	fdistincts := 0.0
+	if population > 0 {
+		fdistincts = ndv / population
+	}
+
+	rv := &datastore.Histogram{}
+	rv.SetHistogram(datastore.HISTOGRAM_VERSION, keyspace, key, docCount, int64(n), resolution,
+		fdistincts, avgArrayLen, missingArr, emptyArr, distrib, ovrflow)
+	return rv
+}
+
+// Distinct returns the estimated number of distinct values of the key.
+func Distinct(h *datastore.Histogram) float64 {
+	population := float64(h.DocCount())
+	if ai := h.ArrayInfo(); ai != nil {
+		population *= ai.AvgArrayLen() * (1.0 - ai.MissingArray())
+	}
+	return math.Max(1.0, h.Fdistincts()*population)
+}
+
+// EqSelec returns the fraction of values equal to val.
+func EqSelec(h *datastore.Histogram, val value.Value) float64 {
+	for _, bin := range h.Ovrflow() {
+		if bin.Val().Collate(val) == 0 {
+			return bin.Size()
+		}
+	}
+
+	distrib := h.Distrib()
+	for i := 1; i < len(distrib); i++ {
+		if distrib[i].Max().Collate(val) < 0 {
+			continue
+		}
+		if val.Collate(distrib[i-1].Max()) < 0 {
+			break
+		}
+		return valueSize(h, distrib[i])
+	}
+	return 0.0
+}
+
+// RangeSelec returns the fraction of values between low and high; a nil bound
+// is open.
+func RangeSelec(h *datastore.Histogram, low, high value.Value, lowIncl, highIncl bool) float64 {
+	sel := 1.0
+	if high != nil {
+		sel = below(h, high, highIncl)
+	}
+	if low != nil {
+		sel -= below(h, low, !lowIncl)
+	}
+	return math.Max(sel, 0.0)
+}
+
+// TypeSelec returns the fraction of values of the given type.
+func TypeSelec(h *datastore.Histogram, typ value.Type) float64 {
+	low, high := TypeBounds(typ)
+	return RangeSelec(h, low, high, true, false)
+}
+
+// TypeBounds returns the smallest value of a type, and that of the next type,
+// which is nil for objects.
+func TypeBounds(typ value.Type) (value.Value, value.Value) {
+	switch typ {
+	case value.MISSING:
+		return value.MISSING_VALUE, value.NULL_VALUE
+	case value.NULL:
+		return value.NULL_VALUE, value.FALSE_VALUE
+	case value.BOOLEAN:
+		return value.FALSE_VALUE, value.NewValue(math.Inf(-1))
+	case value.NUMBER:
+		return value.NewValue(math.Inf(-1)), value.EMPTY_STRING_VALUE
+	case value.STRING:
+		return value.EMPTY_STRING_VALUE, value.EMPTY_ARRAY_VALUE
+	case value.ARRAY:
+		return value.EMPTY_ARRAY_VALUE, value.EMPTY_OBJECT_VALUE
+	default:
+		return value.EMPTY_OBJECT_VALUE, nil
+	}
+}
+
+// fraction of values below val, or up to it if inclusive
+func below(h *datastore.Histogram, val value.Value, inclusive bool) float64 {
+	var sel float64
+
+	for _, bin := range h.Ovrflow() {
+		c := bin.Val().Collate(val)
+		if c < 0 || (c == 0 && inclusive) {
+			sel += bin.Size()
+		}
+	}
+
+	distrib := h.Distrib()
+	for i := 1; i < len(distrib); i++ {
+		bin := distrib[i]
+		c := bin.Max().Collate(val)
+		if c < 0 {
+			sel += bin.Size()
+			continue
+		} else if c == 0 {
+			sel += bin.Size()
+			if !inclusive {
+				sel -= valueSize(h, bin)
+			}
+			break
+		}
+
+		// val is below the maximum of the bin
+		lo := distrib[i-1].Max()
+		c = lo.Collate(val)
+		if c < 0 {
+			sel += bin.Size() * interpolate(lo, bin.Max(), val)
+		} else if c == 0 && i == 1 && inclusive {
+			sel += valueSize(h, bin)
+		}
+		break
+	}
+
+	return math.Min(sel, 1.0)
+}
+
+// the share of a single value of the bin
+func valueSize(h *datastore.Histogram, bin *datastore.DistBin) float64 {
+	if bin.Distinct() <= 0.0 || h.SampleSize() <= 0 {
+		return bin.Size()
+	}
+	return bin.Size() / (bin.Distinct() * float64(h.SampleSize()))
+}
+
+// position of val between lo and hi; only numbers are interpolated
+func interpolate(lo, hi, val value.Value) float64 {
+	if lo.Type() == value.NUMBER && hi.Type() == value.NUMBER && val.Type() == value.NUMBER {
+		l := value.AsNumberValue(lo).Float64()
+		h := value.AsNumberValue(hi).Float64()
+		v := value.AsNumberValue(val).Float64()
+		if h > l {
+			return (v - l) / (h - l)
+		}
+	}
+	return 0.5
+}
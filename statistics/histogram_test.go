@@ -0,0 +1,109 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package statistics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.02
+}
+
+func TestHistogram(t *testing.T) {
+	// 1000 numbers, 0..99 ten times each, with 100 MISSING and 100 strings
+	vals := make(value.Values, 0, 1200)
+	for i := 0; i < 1000; i++ {
+		vals = append(vals, value.NewValue(i%100))
+	}
+	for i := 0; i < 100; i++ {
+		vals = append(vals, value.MISSING_VALUE, value.NewValue("s"))
+	}
+
+	key := expression.NewField(expression.NewIdentifier("ks"), expression.NewFieldName("k", false))
+	h := newHistogram("default:ks", key, 1200, DEF_RESOLUTION, vals, nil)
+
+	if d := Distinct(h); d < 90 || d > 110 {
+		t.Errorf("expected about 102 distinct values, got %v", d)
+	}
+
+	n := float64(len(vals))
+	if s := EqSelec(h, value.NewValue("s")); !near(s, 100/n) {
+		t.Errorf("expected selectivity %v for \"s\", got %v", 100/n, s)
+	}
+	if s := EqSelec(h, value.NewValue(42)); !near(s, 10/n) {
+		t.Errorf("expected selectivity %v for 42, got %v", 10/n, s)
+	}
+	if s := EqSelec(h, value.NewValue(1000)); s != 0.0 {
+		t.Errorf("expected selectivity 0 for 1000, got %v", s)
+	}
+
+	if s := RangeSelec(h, value.NewValue(10), value.NewValue(60), true, false); !near(s, 500/n) {
+		t.Errorf("expected selectivity %v for [10, 60), got %v", 500/n, s)
+	}
+	if s := RangeSelec(h, nil, value.NewValue(50), false, false); !near(s, 600/n) {
+		t.Errorf("expected selectivity %v below 50, got %v", 600/n, s)
+	}
+
+	if s := TypeSelec(h, value.MISSING); !near(s, 100/n) {
+		t.Errorf("expected MISSING selectivity %v, got %v", 100/n, s)
+	}
+	if s := TypeSelec(h, value.NUMBER); !near(s, 1000/n) {
+		t.Errorf("expected NUMBER selectivity %v, got %v", 1000/n, s)
+	}
+	if s := TypeSelec(h, value.OBJECT); s != 0.0 {
+		t.Errorf("expected OBJECT selectivity 0, got %v", s)
+	}
+}
+
+func TestEncodeStatistics(t *testing.T) {
+	vals := make(value.Values, 0, 100)
+	for i := 0; i < 100; i++ {
+		vals = append(vals, value.NewValue(i))
+	}
+
+	key := expression.NewField(expression.NewIdentifier("ks"), expression.NewFieldName("k", false))
+	stats := &keyspaceStatistics{
+		keyspace:   "default:ks",
+		name:       "ks",
+		docCount:   100,
+		avgDocSize: 64,
+	}
+	stats.histograms = map[string]*datastore.Histogram{
+		histogramKey(key, "ks", "ks"): newHistogram(stats.keyspace, key, 100, DEF_RESOLUTION, vals, nil),
+	}
+
+	bytes, err := encodeStatistics(stats)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	decoded, err := decodeStatistics(stats.keyspace, bytes)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if decoded.docCount != 100 || decoded.avgDocSize != 64 {
+		t.Errorf("expected 100 documents of 64 bytes, got %v of %v", decoded.docCount, decoded.avgDocSize)
+	}
+
+	// the histogram is found under another alias
+	alias := expression.NewField(expression.NewIdentifier("a"), expression.NewFieldName("k", false))
+	h := decoded.histograms[histogramKey(alias, "a", decoded.name)]
+	if h == nil {
+		t.Fatalf("histogram of %v not found", alias)
+	}
+	if s := RangeSelec(h, value.NewValue(25), value.NewValue(75), true, false); !near(s, 0.5) {
+		t.Errorf("expected selectivity 0.5 for [25, 75), got %v", s)
+	}
+}
@@ -0,0 +1,328 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+/*
+Package statistics collects and keeps the optimizer statistics of
+keyspaces: the document count, the average document size and one
+histogram per expression that UPDATE STATISTICS was run on.
+
+Statistics are persisted by the keyspace itself if it implements
+Storage, otherwise in the statistics directory, if one is set, and
+otherwise they only live in memory. Either way, they are cached here
+after first use.
+*/
+package statistics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/couchbase/query/algebra"
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/parser/n1ql"
+	"github.com/couchbase/query/value"
+)
+
+// Storage is implemented by keyspaces that can persist their own statistics.
+// LoadStatistics returns nil if none have been saved.
+type Storage interface {
+	LoadStatistics() ([]byte, errors.Error)
+	SaveStatistics(data []byte) errors.Error
+	DropStatistics() errors.Error
+}
+
+type keyspaceStatistics struct {
+	keyspace   string
+	name       string
+	docCount   int64
+	avgDocSize int64
+	histograms map[string]*datastore.Histogram
+}
+
+var cache struct {
+	sync.RWMutex
+	entries map[string]*keyspaceStatistics // nil entries record keyspaces without statistics
+}
+
+var directory string
+
+func init() {
+	cache.entries = make(map[string]*keyspaceStatistics, 64)
+}
+
+// SetDirectory sets where statistics are persisted for keyspaces that do not
+// implement Storage.
+func SetDirectory(dir string) {
+	directory = dir
+}
+
+// GetKeyspaceInfo returns the document count and average document size of a
+// keyspace, or -1 for both if it has no statistics.
+func GetKeyspaceInfo(keyspace string) (int64, int64) {
+	stats := getStatistics(keyspace)
+	if stats == nil {
+		return -1, -1
+	}
+	return stats.docCount, stats.avgDocSize
+}
+
+// GetHistogram returns the histogram of an expression of the keyspace, in which
+// the keyspace is referenced as alias, or nil if there is none.
+func GetHistogram(keyspace, alias string, expr expression.Expression) *datastore.Histogram {
+	stats := getStatistics(keyspace)
+	if stats == nil {
+		return nil
+	}
+	return stats.histograms[histogramKey(expr, alias, stats.name)]
+}
+
+// histograms are keyed by the expression string, with the keyspace referenced
+// by its name, as UPDATE STATISTICS formalizes its terms
+func histogramKey(expr expression.Expression, alias, name string) string {
+	if alias != name {
+		rv, err := expression.ReplaceExpr(expr.Copy(), expression.NewIdentifier(alias),
+			expression.NewIdentifier(name))
+		if err == nil {
+			expr = rv
+		}
+	}
+	return expression.NewStringer().Visit(expr)
+}
+
+func getStatistics(keyspace string) *keyspaceStatistics {
+	cache.RLock()
+	stats, ok := cache.entries[keyspace]
+	cache.RUnlock()
+	if ok {
+		return stats
+	}
+
+	stats, _ = loadStatistics(keyspace)
+	cache.Lock()
+	cache.entries[keyspace] = stats
+	cache.Unlock()
+	return stats
+}
+
+func setStatistics(keyspace string, stats *keyspaceStatistics) {
+	cache.Lock()
+	cache.entries[keyspace] = stats
+	cache.Unlock()
+}
+
+func storageFor(keyspace string) Storage {
+	ks, err := datastore.GetKeyspace(algebra.ParsePath(keyspace)...)
+	if err != nil {
+		return nil
+	}
+	storage, _ := ks.(Storage)
+	return storage
+}
+
+func filename(keyspace string) string {
+	return filepath.Join(directory, url.QueryEscape(keyspace)+".json")
+}
+
+func loadStatistics(keyspace string) (*keyspaceStatistics, errors.Error) {
+	var bytes []byte
+	var err errors.Error
+
+	if storage := storageFor(keyspace); storage != nil {
+		bytes, err = storage.LoadStatistics()
+	} else if directory != "" {
+		var er error
+		bytes, er = ioutil.ReadFile(filename(keyspace))
+		if er != nil && !os.IsNotExist(er) {
+			err = errors.NewDictInternalError("reading statistics of "+keyspace, er)
+		}
+	}
+	if err != nil || bytes == nil {
+		return nil, err
+	}
+	return decodeStatistics(keyspace, bytes)
+}
+
+func saveStatistics(keyspace string, stats *keyspaceStatistics) errors.Error {
+	bytes, err := encodeStatistics(stats)
+	if err != nil {
+		return err
+	}
+
+	if storage := storageFor(keyspace); storage != nil {
+		err = storage.SaveStatistics(bytes)
+	} else if directory != "" {
+		tmp := filename(keyspace) + ".tmp"
+		er := ioutil.WriteFile(tmp, bytes, 0666)
+		if er == nil {
+			er = os.Rename(tmp, filename(keyspace))
+		}
+		if er != nil {
+			err = errors.NewDictInternalError("saving statistics of "+keyspace, er)
+		}
+	}
+	if err == nil {
+		setStatistics(keyspace, stats)
+	}
+	return err
+}
+
+func dropStatistics(keyspace string) errors.Error {
+	var err errors.Error
+
+	if storage := storageFor(keyspace); storage != nil {
+		err = storage.DropStatistics()
+	} else if directory != "" {
+		if er := os.Remove(filename(keyspace)); er != nil && !os.IsNotExist(er) {
+			err = errors.NewDictInternalError("dropping statistics of "+keyspace, er)
+		}
+	}
+	if err == nil {
+		setStatistics(keyspace, nil)
+	}
+	return err
+}
+
+// Persisted form. MISSING bin values are left out.
+
+type statisticsFile struct {
+	Keyspace   string          `json:"keyspace"`
+	Name       string          `json:"name"`
+	DocCount   int64           `json:"docCount"`
+	AvgDocSize int64           `json:"avgDocSize"`
+	Histograms []histogramFile `json:"histograms"`
+}
+
+type histogramFile struct {
+	Key         string            `json:"key"`
+	DocCount    int64             `json:"docCount"`
+	SampleSize  int64             `json:"sampleSize"`
+	Resolution  float64           `json:"resolution"`
+	Fdistincts  float64           `json:"fdistincts"`
+	AvgArrayLen float64           `json:"avgArrayLen,omitempty"`
+	MissingArr  float64           `json:"missingArray,omitempty"`
+	EmptyArr    float64           `json:"emptyArray,omitempty"`
+	Distrib     []distBinFile     `json:"distributionBins"`
+	Ovrflow     []overflowBinFile `json:"overflowBins"`
+}
+
+type distBinFile struct {
+	Size     float64     `json:"size"`
+	Distinct float64     `json:"distinct"`
+	Max      interface{} `json:"max,omitempty"`
+	Missing  bool        `json:"missing,omitempty"`
+}
+
+type overflowBinFile struct {
+	Size    float64     `json:"size"`
+	Val     interface{} `json:"val,omitempty"`
+	Missing bool        `json:"missing,omitempty"`
+}
+
+func encodeStatistics(stats *keyspaceStatistics) ([]byte, errors.Error) {
+	f := statisticsFile{
+		Keyspace:   stats.keyspace,
+		Name:       stats.name,
+		DocCount:   stats.docCount,
+		AvgDocSize: stats.avgDocSize,
+		Histograms: make([]histogramFile, 0, len(stats.histograms)),
+	}
+
+	for key, h := range stats.histograms {
+		hf := histogramFile{
+			Key:        key,
+			DocCount:   h.DocCount(),
+			SampleSize: h.SampleSize(),
+			Resolution: h.Resolution(),
+			Fdistincts: h.Fdistincts(),
+			Distrib:    make([]distBinFile, len(h.Distrib())),
+			Ovrflow:    make([]overflowBinFile, len(h.Ovrflow())),
+		}
+		if ai := h.ArrayInfo(); ai != nil {
+			hf.AvgArrayLen = ai.AvgArrayLen()
+			hf.MissingArr = ai.MissingArray()
+			hf.EmptyArr = ai.EmptyArray()
+		}
+		for i, bin := range h.Distrib() {
+			hf.Distrib[i] = distBinFile{Size: bin.Size(), Distinct: bin.Distinct()}
+			if bin.Max().Type() == value.MISSING {
+				hf.Distrib[i].Missing = true
+			} else {
+				hf.Distrib[i].Max = bin.Max().Actual()
+			}
+		}
+		for i, bin := range h.Ovrflow() {
+			hf.Ovrflow[i] = overflowBinFile{Size: bin.Size()}
+			if bin.Val().Type() == value.MISSING {
+				hf.Ovrflow[i].Missing = true
+			} else {
+				hf.Ovrflow[i].Val = bin.Val().Actual()
+			}
+		}
+		f.Histograms = append(f.Histograms, hf)
+	}
+
+	bytes, er := json.Marshal(f)
+	if er != nil {
+		return nil, errors.NewDictionaryEncodingError("encode", stats.keyspace, er)
+	}
+	return bytes, nil
+}
+
+func decodeStatistics(keyspace string, bytes []byte) (*keyspaceStatistics, errors.Error) {
+	var f statisticsFile
+	if er := json.Unmarshal(bytes, &f); er != nil {
+		return nil, errors.NewDictionaryEncodingError("decode", keyspace, er)
+	}
+	if f.Keyspace != keyspace {
+		return nil, errors.NewDictKeyspaceMismatchError(keyspace, f.Keyspace)
+	}
+
+	stats := &keyspaceStatistics{
+		keyspace:   f.Keyspace,
+		name:       f.Name,
+		docCount:   f.DocCount,
+		avgDocSize: f.AvgDocSize,
+		histograms: make(map[string]*datastore.Histogram, len(f.Histograms)),
+	}
+
+	for _, hf := range f.Histograms {
+		key, er := n1ql.ParseExpression(hf.Key)
+		if er != nil {
+			return nil, errors.NewDictionaryEncodingError("decode", keyspace, er)
+		}
+
+		distrib := make(datastore.DistBins, len(hf.Distrib))
+		for i, bin := range hf.Distrib {
+			max := value.MISSING_VALUE
+			if !bin.Missing {
+				max = value.NewValue(bin.Max)
+			}
+			distrib[i] = datastore.NewDistBin(bin.Size, bin.Distinct, max)
+		}
+		ovrflow := make(datastore.OverflowBins, len(hf.Ovrflow))
+		for i, bin := range hf.Ovrflow {
+			val := value.MISSING_VALUE
+			if !bin.Missing {
+				val = value.NewValue(bin.Val)
+			}
+			ovrflow[i] = datastore.NewOverflowBin(bin.Size, val)
+		}
+
+		h := &datastore.Histogram{}
+		h.SetHistogram(datastore.HISTOGRAM_VERSION, keyspace, key, hf.DocCount, hf.SampleSize,
+			hf.Resolution, hf.Fdistincts, hf.AvgArrayLen, hf.MissingArr, hf.EmptyArr, distrib, ovrflow)
+		stats.histograms[hf.Key] = h
+	}
+	return stats, nil
+}
@@ -0,0 +1,352 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package statistics
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/errors"
+	"github.com/couchbase/query/expression"
+	"github.com/couchbase/query/value"
+)
+
+const (
+	_DEF_SAMPLE_SIZE = 100000
+	_FETCH_BATCH     = 512
+)
+
+// UPDATE STATISTICS and its DELETE form of the same keyspace are serialized
+var updateLock sync.Mutex
+
+// StatUpdater samples keyspaces to build histograms for UPDATE STATISTICS.
+type StatUpdater struct {
+}
+
+func NewStatUpdater() *StatUpdater {
+	return &StatUpdater{}
+}
+
+func (this *StatUpdater) Name() datastore.StatUpdaterType {
+	return datastore.UPDSTAT_DEFAULT
+}
+
+func (this *StatUpdater) UpdateStatistics(ks datastore.Keyspace, indexes []datastore.Index,
+	terms expression.Expressions, with value.Value, conn *datastore.ValueConnection,
+	exContext interface{}, internal bool) {
+	defer close(conn.ValueChannel())
+
+	sampleSize, resolution, err := getOptions(with)
+	if err != nil {
+		conn.Error(err)
+		return
+	}
+
+	keys, err := getKeys(ks.Name(), indexes, terms)
+	if err != nil {
+		conn.Error(err)
+		return
+	}
+
+	context, ok := exContext.(datastore.QueryContext)
+	if !ok {
+		context = datastore.NULL_QUERY_CONTEXT
+	}
+
+	docCount, err := ks.Count(context)
+	if err != nil {
+		conn.Error(err)
+		return
+	}
+	if sampleSize <= 0 || sampleSize > docCount {
+		sampleSize = docCount
+	}
+
+	scanContext, ok := exContext.(datastore.Context)
+	if !ok {
+		scanContext = datastore.NULL_CONTEXT
+	}
+
+	docKeys, err := sampleKeys(ks, sampleSize, scanContext)
+	if err != nil {
+		conn.Error(err)
+		return
+	}
+
+	vals := make([]value.Values, len(keys))
+	arrays := make([]*arrayCounts, len(keys))
+	for i, key := range keys {
+		vals[i] = make(value.Values, 0, len(docKeys))
+		if _, ok := key.(*expression.All); ok {
+			arrays[i] = &arrayCounts{}
+		}
+	}
+
+	var docs, docSize int64
+	evalContext := expression.NewIndexContext()
+	fetched := make(map[string]value.AnnotatedValue, _FETCH_BATCH)
+	for b := 0; b < len(docKeys); b += _FETCH_BATCH {
+		select {
+		case <-conn.StopChannel():
+			return
+		default:
+		}
+
+		e := b + _FETCH_BATCH
+		if e > len(docKeys) {
+			e = len(docKeys)
+		}
+		errs := ks.Fetch(docKeys[b:e], fetched, context, nil)
+		if len(errs) > 0 {
+			conn.Error(errs[0])
+			return
+		}
+
+		for _, doc := range fetched {
+			item := value.NewAnnotatedValue(make(map[string]interface{}, 1))
+			item.SetField(ks.Name(), doc)
+			docs++
+			docSize += int64(doc.Size())
+
+			for i, key := range keys {
+				val, er := key.Evaluate(item, evalContext)
+				if er != nil {
+					val = value.MISSING_VALUE
+				}
+				if arrays[i] == nil {
+					vals[i] = append(vals[i], val)
+				} else {
+					vals[i] = appendElements(vals[i], val, key.(*expression.All).Distinct(), arrays[i])
+				}
+			}
+		}
+		for k, _ := range fetched {
+			delete(fetched, k)
+		}
+	}
+
+	stats := &keyspaceStatistics{
+		keyspace:   ks.QualifiedName(),
+		name:       ks.Name(),
+		docCount:   docCount,
+		histograms: make(map[string]*datastore.Histogram, len(keys)),
+	}
+	if docs > 0 {
+		stats.avgDocSize = docSize / docs
+	}
+	for i, key := range keys {
+		stats.histograms[histogramKey(key, ks.Name(), ks.Name())] = newHistogram(stats.keyspace, key,
+			docCount, resolution, vals[i], arrays[i])
+	}
+
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	// keep the histograms of the keys that were not sampled this time
+	if old := getStatistics(stats.keyspace); old != nil {
+		for k, h := range old.histograms {
+			if _, ok := stats.histograms[k]; !ok {
+				stats.histograms[k] = h
+			}
+		}
+	}
+
+	if err = saveStatistics(stats.keyspace, stats); err != nil {
+		conn.Error(err)
+	}
+}
+
+func (this *StatUpdater) DeleteStatistics(ks datastore.Keyspace, terms expression.Expressions,
+	conn *datastore.ValueConnection, exContext interface{}) {
+	defer close(conn.ValueChannel())
+
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	keyspace := ks.QualifiedName()
+	var err errors.Error
+	if len(terms) == 0 {
+		err = dropStatistics(keyspace)
+	} else if old := getStatistics(keyspace); old != nil {
+		stats := *old
+		stats.histograms = make(map[string]*datastore.Histogram, len(old.histograms))
+		for k, h := range old.histograms {
+			stats.histograms[k] = h
+		}
+		var keys expression.Expressions
+		keys, err = getKeys(ks.Name(), nil, terms)
+		for _, key := range keys {
+			delete(stats.histograms, histogramKey(key, ks.Name(), ks.Name()))
+		}
+		if err == nil {
+			err = saveStatistics(keyspace, &stats)
+		}
+	}
+	if err != nil {
+		conn.Error(err)
+	}
+}
+
+func getOptions(with value.Value) (int64, float64, errors.Error) {
+	sampleSize := int64(_DEF_SAMPLE_SIZE)
+	resolution := DEF_RESOLUTION
+	if with == nil {
+		return sampleSize, resolution, nil
+	}
+	if with.Type() != value.OBJECT {
+		return 0, 0, errors.NewUpdateStatisticsError("WITH clause must be an object")
+	}
+
+	for name, val := range with.Fields() {
+		v := value.NewValue(val)
+		switch name {
+		case "sample_size":
+			n, ok := value.IsIntValue(v)
+			if !ok || n < 0 {
+				return 0, 0, errors.NewUpdateStatisticsError("sample_size must be a non-negative integer")
+			}
+			if n > 0 {
+				sampleSize = n
+			}
+		case "resolution":
+			if v.Type() != value.NUMBER {
+				return 0, 0, errors.NewUpdateStatisticsError("resolution must be a number")
+			}
+			resolution = value.AsNumberValue(v).Float64()
+			resolution = math.Max(MIN_RESOLUTION, math.Min(MAX_RESOLUTION, resolution))
+		default:
+			return 0, 0, errors.NewUpdateStatisticsError(fmt.Sprintf("Invalid option %s in WITH clause", name))
+		}
+	}
+	return sampleSize, resolution, nil
+}
+
+// the expressions to collect histograms on, with the keyspace referenced by its name
+func getKeys(name string, indexes []datastore.Index, terms expression.Expressions) (
+	expression.Expressions, errors.Error) {
+
+	keys := make(expression.Expressions, 0, len(terms)+2*len(indexes))
+	seen := make(map[string]bool, cap(keys))
+	add := func(key expression.Expression) {
+		s := key.String()
+		if !seen[s] {
+			seen[s] = true
+			keys = append(keys, key)
+		}
+	}
+
+	// terms are formalized relative to the document, like index keys
+	formalizer := expression.NewSelfFormalizer(name, nil)
+	for _, term := range terms {
+		formalizer.SetIndexScope()
+		fterm, err := formalizer.Map(term.Copy())
+		formalizer.ClearIndexScope()
+		if err != nil {
+			return nil, errors.NewUpdateStatisticsError(fmt.Sprintf("Term %s: %v", term, err))
+		}
+		add(fterm)
+	}
+
+	for _, index := range indexes {
+		for _, key := range index.RangeKey() {
+			formalizer.SetIndexScope()
+			fkey, err := formalizer.Map(key.Copy())
+			formalizer.ClearIndexScope()
+			if err != nil {
+				return nil, errors.NewUpdateStatisticsError(fmt.Sprintf("Index %s key %s: %v",
+					index.Name(), key, err))
+			}
+			add(fkey)
+		}
+	}
+	return keys, nil
+}
+
+// a uniform sample of the document keys, from a primary index
+func sampleKeys(ks datastore.Keyspace, sampleSize int64, context datastore.Context) (
+	[]string, errors.Error) {
+
+	indexers, err := ks.Indexers()
+	if err != nil {
+		return nil, err
+	}
+
+	var primary datastore.PrimaryIndex
+	for _, indexer := range indexers {
+		primaries, err := indexer.PrimaryIndexes()
+		if err != nil {
+			continue
+		}
+		for _, p := range primaries {
+			if state, _, _ := p.State(); state == datastore.ONLINE {
+				primary = p
+				break
+			}
+		}
+		if primary != nil {
+			break
+		}
+	}
+	if primary == nil {
+		return nil, errors.NewUpdateStatisticsError("No online primary index on keyspace " + ks.Name())
+	}
+
+	iconn := datastore.NewIndexConnection(context)
+	go primary.ScanEntries("update_statistics", math.MaxInt64, datastore.UNBOUNDED, nil, iconn)
+
+	keys := make([]string, 0, sampleSize)
+	var seen int64
+	for {
+		entry, _ := iconn.Sender().GetEntry()
+		if entry == nil {
+			break
+		}
+		if seen < sampleSize {
+			keys = append(keys, entry.PrimaryKey)
+		} else if r := rand.Int63n(seen + 1); r < sampleSize {
+			keys[r] = entry.PrimaryKey
+		}
+		seen++
+	}
+	return keys, nil
+}
+
+func appendElements(vals value.Values, val value.Value, distinct bool, arrays *arrayCounts) value.Values {
+	arrays.docs++
+	if val.Type() != value.ARRAY {
+		arrays.missing++
+		return vals
+	}
+
+	elems := val.Actual().([]interface{})
+	if len(elems) == 0 {
+		arrays.empty++
+		return vals
+	}
+
+	var seen map[string]bool
+	if distinct {
+		seen = make(map[string]bool, len(elems))
+	}
+	for _, e := range elems {
+		v := value.NewValue(e)
+		if distinct {
+			s := v.String()
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+		}
+		vals = append(vals, v)
+	}
+	return vals
+}
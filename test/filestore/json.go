@@ -145,6 +145,21 @@ func (this *MockServer) doStats(request *MockQuery) {
 }
 
 func Run(mockServer *MockServer, p bool, q string, namedArgs map[string]value.Value, positionalArgs []value.Value, namespace string) ([]interface{}, []errors.Error, errors.Error) {
+	results, warnings, err, _ := run(mockServer, p, q, namedArgs, positionalArgs, namespace)
+	return results, warnings, err
+}
+
+// Like Run, but also returns the errors raised while the statement executed
+func RunWithErrors(mockServer *MockServer, q string, namespace string) ([]interface{}, []errors.Error) {
+	results, _, err, query := run(mockServer, true, q, nil, nil, namespace)
+	errs := query.Errors()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return results, errs
+}
+
+func run(mockServer *MockServer, p bool, q string, namedArgs map[string]value.Value, positionalArgs []value.Value, namespace string) ([]interface{}, []errors.Error, errors.Error, *MockQuery) {
 	var metrics value.Tristate
 	scanConfiguration := &scanConfigImpl{}
 
@@ -173,12 +188,12 @@ func Run(mockServer *MockServer, p bool, q string, namedArgs map[string]value.Va
 	defer mockServer.doStats(query)
 
 	if !mockServer.server.ServiceRequest(query) {
-		return nil, nil, errors.NewError(nil, "Query timed out")
+		return nil, nil, errors.NewError(nil, "Query timed out"), query
 	}
 
 	// wait till all the results are ready
 	<-mr.done
-	return mr.results, mr.warnings, mr.err
+	return mr.results, mr.warnings, mr.err, query
 }
 
 func Start(site, pool, namespace string) *MockServer {
@@ -10,8 +10,11 @@ package test
 
 import (
 	"fmt"
+	"github.com/couchbase/query/changefeed"
 	"github.com/couchbase/query/datastore"
+	"github.com/couchbase/query/execution"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -197,6 +200,136 @@ func TestSimpleSelect(t *testing.T) {
 	}
 }
 
+// geometries and boxes that cross the antimeridian must not be lost by geohash index scans
+func TestGeohashIndexAntimeridian(t *testing.T) {
+	dir, er := ioutil.TempDir("", "geo")
+	if er != nil {
+		t.Fatalf("failed to create directory: %v", er)
+	}
+	defer os.RemoveAll(dir)
+
+	docs := map[string]string{
+		"across": `{"geom": {"type": "MultiPoint", "coordinates": [[179, 0], [-179, 0]]}}`,
+		"east":   `{"geom": {"type": "Point", "coordinates": [179.5, 5]}}`,
+		"origin": `{"geom": {"type": "Point", "coordinates": [0, 0]}}`,
+	}
+	if er = os.MkdirAll(filepath.Join(dir, _NAMESPACE, "places"), 0755); er != nil {
+		t.Fatalf("failed to create keyspace: %v", er)
+	}
+	for key, doc := range docs {
+		if er = ioutil.WriteFile(filepath.Join(dir, _NAMESPACE, "places", key+".json"), []byte(doc), 0644); er != nil {
+			t.Fatalf("failed to write document: %v", er)
+		}
+	}
+
+	qc := Start("dir:", dir, _NAMESPACE)
+	_, _, err := Run(qc, true, "CREATE INDEX ix_geo ON places(GEOHASH_ENCODE(geom, 4))", nil, nil, _NAMESPACE)
+	if err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+
+	cases := []struct {
+		stmt string
+		keys []string
+	}{
+		{"SELECT META().id FROM places WHERE ST_WITHIN_BOX(geom, [170, -10, -170, 10]) ORDER BY META().id",
+			[]string{"across", "east"}},
+		{"SELECT META().id FROM places WHERE ST_WITHIN_RADIUS(geom, ST_POINT(180, 0), 200000) ORDER BY META().id",
+			[]string{"across"}},
+		{"SELECT META().id FROM places WHERE ST_WITHIN_BOX(geom, [-1, -1, 1, 1]) ORDER BY META().id",
+			[]string{"origin"}},
+	}
+	for _, c := range cases {
+		r, _, err := Run(qc, true, c.stmt, nil, nil, _NAMESPACE)
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %v", c.stmt, err)
+		}
+		keys := make([]string, 0, len(r))
+		for _, row := range r {
+			keys = append(keys, fmt.Sprint(row.(map[string]interface{})["id"]))
+		}
+		if fmt.Sprint(keys) != fmt.Sprint(c.keys) {
+			t.Errorf("expected %v for %v, got %v", c.keys, c.stmt, keys)
+		}
+	}
+}
+
+// the caches of the system keyspaces are not documents
+func TestChangeFeedSystemKeyspaces(t *testing.T) {
+	qc := start()
+	sub, _ := changefeed.Subscribe(0)
+	defer sub.Close()
+
+	_, _, err := Run(qc, true, "select 1", nil, nil, _NAMESPACE)
+	if err == nil {
+		_, _, err = Run(qc, true, "delete from system:completed_requests", nil, nil, _NAMESPACE)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case change := <-sub.Changes():
+		t.Errorf("unexpected change to %v", change.Keyspace)
+	default:
+	}
+}
+
+// upserts report the documents they replace
+func TestChangeFeedUpsert(t *testing.T) {
+	dir, er := ioutil.TempDir("", "changes")
+	if er != nil {
+		t.Fatalf("failed to create directory: %v", er)
+	}
+	defer os.RemoveAll(dir)
+
+	if er = os.MkdirAll(filepath.Join(dir, _NAMESPACE, "items"), 0755); er != nil {
+		t.Fatalf("failed to create keyspace: %v", er)
+	}
+	if er = ioutil.WriteFile(filepath.Join(dir, _NAMESPACE, "items", "old.json"), []byte(`{"v": 1}`), 0644); er != nil {
+		t.Fatalf("failed to write document: %v", er)
+	}
+
+	qc := Start("dir:", dir, _NAMESPACE)
+	sub, _ := changefeed.Subscribe(0, _NAMESPACE+":items")
+	defer sub.Close()
+
+	_, _, err := Run(qc, true, `UPSERT INTO items VALUES ("old", {"v": 2}), ("new", {"v": 3})`, nil, nil, _NAMESPACE)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		change := <-sub.Changes()
+		var before string
+		if change.Before != nil {
+			before = change.Before.String()
+		}
+		if change.Type != changefeed.UPSERT || (change.Key == "old") != (before == `{"v":1}`) ||
+			(change.Key == "new") != (change.Before == nil) {
+			t.Errorf("unexpected change to %v, before %v", change.Key, before)
+		}
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	qc := start()
+	defer execution.SetMaxRecursion(execution.GetMaxRecursion())
+	execution.SetMaxRecursion(10)
+
+	// hitting the limit fails the statement without returning the documents produced so far
+	for _, stmt := range []string{
+		"WITH RECURSIVE r AS (SELECT 1 AS n UNION ALL SELECT r.n + 1 AS n FROM r) SELECT r.n FROM r",
+		"WITH RECURSIVE r AS (SELECT 1 AS n UNION ALL SELECT r.n + 1 AS n FROM r) SELECT 1 AS one",
+	} {
+		r, errs := RunWithErrors(qc, stmt, _NAMESPACE)
+		if len(errs) != 1 || errs[0].Code() != 5520 {
+			t.Errorf("%v: expected recursion limit error, got %v", stmt, errs)
+		}
+		if len(r) != 0 {
+			t.Errorf("%v: expected no results, got %v", stmt, r)
+		}
+	}
+}
+
 func TestAllCaseFiles(t *testing.T) {
 	qc := start()
 	matches, err := filepath.Glob("json/default/cases/case_*.json")
@@ -31,6 +31,9 @@ func TestAggregateFunctions(t *testing.T) {
 	runMatch("case_distinct.json", false, false, qc, t)
 	runMatch("case_group_by_having.json", false, false, qc, t)
 	runMatch("case_median_stddev_variance.json", false, false, qc, t)
+	runMatch("case_percentile_mode_regression.json", false, false, qc, t)
+	runMatch("case_approx.json", false, false, qc, t)
+	runMatch("case_string_agg.json", false, false, qc, t)
 
 	runStmt(qc, "delete from product where test_id IN [\"agg_func\"]")
 	runStmt(qc, "delete from orders where test_id IN [\"agg_func\",\"median_agg_func\",\"cntn_agg_func\"]")
@@ -12,6 +12,7 @@ import (
 	go_atomic "sync/atomic"
 	"time"
 
+	"github.com/couchbase/query/changefeed"
 	"github.com/couchbase/query/datastore"
 	"github.com/couchbase/query/errors"
 	"github.com/couchbase/query/util"
@@ -55,6 +56,9 @@ func DeleteTransContext(txId string, userDelete bool) errors.Error {
 			tranContextCache.cache.Delete(txId, nil)
 			txContext.SetTxStatus(TX_RELEASED)
 		}
+
+		// changes that were not published on commit never will be
+		changefeed.Rollback(txId, "")
 	}
 	return nil
 }
@@ -137,6 +141,7 @@ func (this *TranContextCache) doTransactionCleanup() {
 					context.SetTxContext(tranContext)
 					ds.RollbackTransaction(false, context, "")
 				}
+				changefeed.Rollback(tranContext.TxId(), "")
 				tranContext.SetTxStatus(TX_RELEASED)
 			}
 		}
@@ -0,0 +1,155 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package util
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Geohashes, see https://en.wikipedia.org/wiki/Geohash
+// A geohash of precision p interleaves 5*p bits, starting with
+// longitude, and encodes them in base 32; each prefix of a geohash
+// names a cell that contains the cells of all its extensions.
+
+const (
+	GEOHASH_MAX_PRECISION = 12
+	geohashBase32         = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// Given a longitude and latitude in degrees, compute the geohash of
+// the given precision of the cell that contains them
+func GeohashEncode(lon, lat float64, precision int) string {
+	lonBits, latBits := geohashBits(precision)
+	return geohashCell(geohashIndex(lon, -180.0, 360.0, lonBits),
+		geohashIndex(lat, -90.0, 180.0, latBits), precision)
+}
+
+// Given a geohash, return the bounds of its cell in degrees
+func GeohashDecode(hash string) (minLon, minLat, maxLon, maxLat float64, ok bool) {
+	if hash == "" || len(hash) > GEOHASH_MAX_PRECISION {
+		return
+	}
+
+	var lon, lat uint64
+	var lonBits, latBits uint
+	even := true
+	for _, c := range strings.ToLower(hash) {
+		n := strings.IndexRune(geohashBase32, c)
+		if n < 0 {
+			return
+		}
+		for b := 4; b >= 0; b-- {
+			bit := uint64(n>>uint(b)) & 1
+			if even {
+				lon = lon<<1 | bit
+				lonBits++
+			} else {
+				lat = lat<<1 | bit
+				latBits++
+			}
+			even = !even
+		}
+	}
+
+	width := 360.0 / float64(uint64(1)<<lonBits)
+	height := 180.0 / float64(uint64(1)<<latBits)
+	minLon = -180.0 + float64(lon)*width
+	minLat = -90.0 + float64(lat)*height
+	return minLon, minLat, minLon + width, minLat + height, true
+}
+
+// Given a bounding box in degrees, return the sorted geohashes of the
+// cells that cover it, at the highest precision up to the given one
+// that needs no more than maxCells cells. A box with minLon > maxLon
+// crosses the antimeridian. Return nil if even a precision of one
+// needs too many cells.
+func GeohashCover(minLon, minLat, maxLon, maxLat float64, precision, maxCells int) []string {
+	if precision > GEOHASH_MAX_PRECISION {
+		precision = GEOHASH_MAX_PRECISION
+	}
+
+	for p := precision; p > 0; p-- {
+		lonBits, latBits := geohashBits(p)
+		lat0 := geohashIndex(minLat, -90.0, 180.0, latBits)
+		lat1 := geohashIndex(maxLat, -90.0, 180.0, latBits)
+		lon0 := geohashIndex(minLon, -180.0, 360.0, lonBits)
+		lon1 := geohashIndex(maxLon, -180.0, 360.0, lonBits)
+
+		// split a box that crosses the antimeridian
+		lons := [][2]uint64{{lon0, lon1}}
+		if minLon > maxLon {
+			lons = [][2]uint64{{lon0, uint64(1)<<lonBits - 1}, {0, lon1}}
+		}
+
+		count := uint64(0)
+		for _, l := range lons {
+			count += (l[1] - l[0] + 1) * (lat1 - lat0 + 1)
+		}
+		if count > uint64(maxCells) {
+			continue
+		}
+
+		cells := make([]string, 0, count)
+		for _, l := range lons {
+			for i := l[0]; i <= l[1]; i++ {
+				for j := lat0; j <= lat1; j++ {
+					cells = append(cells, geohashCell(i, j, p))
+				}
+			}
+		}
+		sort.Strings(cells)
+		return cells
+	}
+	return nil
+}
+
+func geohashBits(precision int) (lonBits, latBits uint) {
+	if precision < 1 {
+		precision = 1
+	} else if precision > GEOHASH_MAX_PRECISION {
+		precision = GEOHASH_MAX_PRECISION
+	}
+	return uint(5*precision+1) / 2, uint(5*precision) / 2
+}
+
+// the index of the cell containing v, out of 2^bits cells covering [min, min+size]
+func geohashIndex(v, min, size float64, bits uint) uint64 {
+	cells := uint64(1) << bits
+	i := math.Floor((v - min) / size * float64(cells))
+	if i < 0 {
+		return 0
+	} else if i >= float64(cells) {
+		return cells - 1
+	}
+	return uint64(i)
+}
+
+func geohashCell(lon, lat uint64, precision int) string {
+	lonBits, latBits := geohashBits(precision)
+	buf := make([]byte, precision)
+	even := true
+	for i := range buf {
+		n := 0
+		for b := 0; b < 5; b++ {
+			n <<= 1
+			if even {
+				lonBits--
+				n |= int(lon>>lonBits) & 1
+			} else {
+				latBits--
+				n |= int(lat>>latBits) & 1
+			}
+			even = !even
+		}
+		buf[i] = geohashBase32[n]
+	}
+	return string(buf)
+}
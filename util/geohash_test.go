@@ -0,0 +1,65 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGeohash(t *testing.T) {
+	if h := GeohashEncode(-5.6, 42.6, 5); h != "ezs42" {
+		t.Errorf("Expected ezs42, got %s", h)
+	}
+	if h := GeohashEncode(10.40744, 57.64911, 11); h != "u4pruydqqvj" {
+		t.Errorf("Expected u4pruydqqvj, got %s", h)
+	}
+	if h := GeohashEncode(180.0, 90.0, 3); h != "zzz" {
+		t.Errorf("Expected zzz, got %s", h)
+	}
+
+	minLon, minLat, maxLon, maxLat, ok := GeohashDecode("EZS42")
+	if !ok || minLon > -5.6 || maxLon < -5.6 || minLat > 42.6 || maxLat < 42.6 ||
+		maxLon-minLon != 360.0/8192 || maxLat-minLat != 180.0/4096 {
+		t.Errorf("Unexpected cell %v %v %v %v %v", minLon, minLat, maxLon, maxLat, ok)
+	}
+	if _, _, _, _, ok = GeohashDecode("ezs4a"); ok {
+		t.Errorf("Expected invalid geohash")
+	}
+}
+
+func TestGeohashCover(t *testing.T) {
+	// a box inside cell "ezs42" is covered by it alone
+	cells := GeohashCover(-5.61, 42.59, -5.59, 42.61, 5, 16)
+	if !reflect.DeepEqual(cells, []string{"ezs42"}) {
+		t.Errorf("Unexpected cover %v", cells)
+	}
+
+	// longer cells are used when few enough cover the box
+	cells = GeohashCover(-5.601, 42.599, -5.599, 42.601, 8, 4)
+	if len(cells) == 0 || len(cells) > 4 {
+		t.Errorf("Unexpected cover %v", cells)
+	}
+	for _, c := range cells {
+		if len(c) != len(cells[0]) || len(c) <= 5 || len(c) >= 8 || c[:5] != "ezs42" {
+			t.Errorf("Unexpected cover %v", cells)
+			break
+		}
+	}
+
+	// across the antimeridian
+	cells = GeohashCover(170.0, -10.0, -170.0, 10.0, 1, 16)
+	if !reflect.DeepEqual(cells, []string{"2", "8", "r", "x"}) {
+		t.Errorf("Unexpected cover %v", cells)
+	}
+
+	if cells = GeohashCover(-180.0, -90.0, 180.0, 90.0, 4, 16); cells != nil {
+		t.Errorf("Expected no cover, got %v", cells)
+	}
+}
@@ -0,0 +1,201 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog estimates the number of distinct items in a stream in fixed
+// memory, with a standard error of about 1.04 / sqrt(2^precision).
+//
+// Sketches start sparse, holding only the registers that have been set, and
+// switch to a full array of registers once that gets smaller. Sketches of
+// the same precision can be merged, which gives the estimate of the union.
+
+const (
+	HLL_PRECISION = 14
+
+	_HLL_VERSION = 1
+	_HLL_SPARSE  = 0
+	_HLL_DENSE   = 1
+)
+
+type HyperLogLog struct {
+	precision uint8
+	sparse    map[uint32]uint8
+	dense     []uint8
+}
+
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < 4 || precision > 18 {
+		precision = HLL_PRECISION
+	}
+	return &HyperLogLog{precision: precision, sparse: make(map[uint32]uint8)}
+}
+
+func (this *HyperLogLog) registers() uint32 {
+	return 1 << this.precision
+}
+
+// add an item, given its 64 bit hash
+func (this *HyperLogLog) AddHash(hash uint64) {
+	index := uint32(hash >> (64 - this.precision))
+
+	// the position of the first set bit in the remaining bits
+	rank := uint8(bits.LeadingZeros64(hash<<this.precision|1<<(this.precision-1)) + 1)
+	this.set(index, rank)
+}
+
+func (this *HyperLogLog) Add(item []byte) {
+	this.AddHash(SeaHashSum64(item))
+}
+
+func (this *HyperLogLog) set(index uint32, rank uint8) {
+	if this.dense != nil {
+		if rank > this.dense[index] {
+			this.dense[index] = rank
+		}
+		return
+	}
+	if rank > this.sparse[index] {
+		this.sparse[index] = rank
+
+		// a map entry takes several times the size of a register
+		if uint32(len(this.sparse))*8 > this.registers() {
+			this.toDense()
+		}
+	}
+}
+
+func (this *HyperLogLog) toDense() {
+	this.dense = make([]uint8, this.registers())
+	for i, r := range this.sparse {
+		this.dense[i] = r
+	}
+	this.sparse = nil
+}
+
+// merge another sketch into this one
+func (this *HyperLogLog) Merge(other *HyperLogLog) error {
+	if other.precision != this.precision {
+		return fmt.Errorf("Cannot merge HyperLogLog sketches of precision %v and %v", this.precision, other.precision)
+	}
+	if other.dense != nil {
+		if this.dense == nil {
+			this.toDense()
+		}
+		for i, r := range other.dense {
+			if r > this.dense[i] {
+				this.dense[i] = r
+			}
+		}
+		return nil
+	}
+	for i, r := range other.sparse {
+		this.set(uint32(i), r)
+	}
+	return nil
+}
+
+// the estimated number of distinct items
+func (this *HyperLogLog) Count() uint64 {
+	m := float64(this.registers())
+	zeros := m
+	sum := m
+	if this.dense != nil {
+		zeros = 0
+		sum = 0
+		for _, r := range this.dense {
+			if r == 0 {
+				zeros++
+			}
+			sum += math.Ldexp(1, -int(r))
+		}
+	} else {
+		zeros -= float64(len(this.sparse))
+		for _, r := range this.sparse {
+			sum += math.Ldexp(1, -int(r)) - 1
+		}
+	}
+
+	var alpha float64
+	switch this.precision {
+	case 4:
+		alpha = 0.673
+	case 5:
+		alpha = 0.697
+	case 6:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	estimate := alpha * m * m / sum
+
+	// linear counting is more accurate for small cardinalities
+	if zeros > 0 {
+		linear := m * math.Log(m/zeros)
+		if linear <= 5*m/2 {
+			estimate = linear
+		}
+	}
+	return uint64(estimate + 0.5)
+}
+
+func (this *HyperLogLog) MarshalBinary() ([]byte, error) {
+	var rv []byte
+	if this.dense != nil {
+		rv = make([]byte, 3, 3+len(this.dense))
+		rv[2] = _HLL_DENSE
+		rv = append(rv, this.dense...)
+	} else {
+		rv = make([]byte, 3, 3+5*len(this.sparse))
+		rv[2] = _HLL_SPARSE
+		var entry [5]byte
+		for i, r := range this.sparse {
+			binary.BigEndian.PutUint32(entry[:4], i)
+			entry[4] = r
+			rv = append(rv, entry[:]...)
+		}
+	}
+	rv[0] = _HLL_VERSION
+	rv[1] = this.precision
+	return rv, nil
+}
+
+func (this *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 || data[0] != _HLL_VERSION || data[1] < 4 || data[1] > 18 {
+		return fmt.Errorf("Invalid HyperLogLog sketch")
+	}
+	this.precision = data[1]
+	kind := data[2]
+	data = data[3:]
+	switch {
+	case kind == _HLL_DENSE && uint32(len(data)) == this.registers():
+		this.dense = make([]uint8, len(data))
+		copy(this.dense, data)
+		this.sparse = nil
+	case kind == _HLL_SPARSE && len(data)%5 == 0:
+		this.dense = nil
+		this.sparse = make(map[uint32]uint8, len(data)/5)
+		for ; len(data) > 0; data = data[5:] {
+			i := binary.BigEndian.Uint32(data[:4])
+			if i >= this.registers() {
+				return fmt.Errorf("Invalid HyperLogLog sketch")
+			}
+			this.sparse[i] = data[4]
+		}
+	default:
+		return fmt.Errorf("Invalid HyperLogLog sketch")
+	}
+	return nil
+}
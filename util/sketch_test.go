@@ -0,0 +1,95 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package util
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 1000, 10000, 200000} {
+		h1 := NewHyperLogLog(HLL_PRECISION)
+		h2 := NewHyperLogLog(HLL_PRECISION)
+
+		// duplicates, and a common half
+		for i := 0; i < n; i++ {
+			item := []byte(strconv.Itoa(i))
+			if i < n/2 {
+				h1.Add(item)
+				h1.Add(item)
+			} else {
+				h2.Add(item)
+			}
+			if i%4 == 0 {
+				h2.Add(item)
+			}
+		}
+
+		data, _ := h2.MarshalBinary()
+		h3 := &HyperLogLog{}
+		if err := h3.UnmarshalBinary(data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := h1.Merge(h3); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		count := h1.Count()
+		if math.Abs(float64(count)-float64(n)) > 0.03*float64(n) {
+			t.Errorf("Expected about %v distinct items, got %v", n, count)
+		}
+	}
+
+	if err := NewHyperLogLog(HLL_PRECISION).UnmarshalBinary([]byte{_HLL_VERSION, HLL_PRECISION, _HLL_DENSE, 0}); err == nil {
+		t.Errorf("Expected truncated sketch to be rejected")
+	}
+}
+
+func TestTDigest(t *testing.T) {
+	const n = 100000
+	r := rand.New(rand.NewSource(1))
+	parts := []*TDigest{NewTDigest(TDIGEST_COMPRESSION), NewTDigest(TDIGEST_COMPRESSION), NewTDigest(TDIGEST_COMPRESSION)}
+	for _, i := range r.Perm(n) {
+		parts[i%len(parts)].Add(float64(i))
+	}
+
+	d := NewTDigest(TDIGEST_COMPRESSION)
+	for _, p := range parts {
+		data, _ := p.MarshalBinary()
+		p1 := &TDigest{}
+		if err := p1.UnmarshalBinary(data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		d.Merge(p1)
+	}
+	if d.Count() != n {
+		t.Fatalf("Expected count %v, got %v", n, d.Count())
+	}
+	for _, q := range []float64{0, 0.001, 0.01, 0.25, 0.5, 0.75, 0.99, 0.999, 1} {
+		v := d.Quantile(q)
+		if math.Abs(v-q*(n-1)) > 0.01*n {
+			t.Errorf("Expected quantile %v to be about %v, got %v", q, q*(n-1), v)
+		}
+	}
+
+	d = NewTDigest(TDIGEST_COMPRESSION)
+	if !math.IsNaN(d.Quantile(0.5)) {
+		t.Errorf("Expected NaN for an empty digest")
+	}
+	for _, x := range []float64{5, 1, 4, 2, 3} {
+		d.Add(x)
+	}
+	for q, v := range map[float64]float64{0: 1, 0.25: 2, 0.3: 2.2, 0.5: 3, 0.9: 4.6, 1: 5} {
+		if math.Abs(d.Quantile(q)-v) > 1e-9 {
+			t.Errorf("Expected quantile %v to be %v, got %v", q, v, d.Quantile(q))
+		}
+	}
+}
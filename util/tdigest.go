@@ -0,0 +1,209 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// TDigest estimates quantiles of a stream of numbers in bounded memory.
+//
+// This is a merging t-digest: values are buffered, and the buffer is sorted
+// and merged into a list of centroids whose size is bounded by the
+// compression, the centroids at the tails being kept smaller so that extreme
+// quantiles are more accurate. Digests can be merged, which gives an
+// estimate for the union of their inputs.
+
+const (
+	TDIGEST_COMPRESSION = 100
+
+	_TDIGEST_VERSION = 1
+)
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	count       float64
+	min         float64
+	max         float64
+}
+
+func NewTDigest(compression float64) *TDigest {
+	if compression < 10 {
+		compression = TDIGEST_COMPRESSION
+	}
+	return &TDigest{compression: compression, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+func (this *TDigest) Add(x float64) {
+	this.add(x, 1)
+}
+
+func (this *TDigest) add(x, w float64) {
+	if math.IsNaN(x) || w <= 0 {
+		return
+	}
+	if x < this.min {
+		this.min = x
+	}
+	if x > this.max {
+		this.max = x
+	}
+	this.count += w
+	this.buffer = append(this.buffer, centroid{x, w})
+	if len(this.buffer) >= int(5*this.compression) {
+		this.compress()
+	}
+}
+
+// merge another digest into this one
+func (this *TDigest) Merge(other *TDigest) {
+	for _, c := range other.centroids {
+		this.add(c.mean, c.weight)
+	}
+	for _, c := range other.buffer {
+		this.add(c.mean, c.weight)
+	}
+}
+
+func (this *TDigest) Count() float64 {
+	return this.count
+}
+
+// the arcsine scale function, and its inverse
+func (this *TDigest) k(q float64) float64 {
+	return this.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (this *TDigest) q(k float64) float64 {
+	return (math.Sin(k*2*math.Pi/this.compression) + 1) / 2
+}
+
+func (this *TDigest) compress() {
+	if len(this.buffer) == 0 {
+		return
+	}
+	all := append(this.centroids, this.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, int(this.compression))
+	cur := all[0]
+	done := 0.0
+	limit := this.count * this.q(this.k(0)+1)
+	for _, c := range all[1:] {
+		if done+cur.weight+c.weight <= limit {
+			cur.mean += (c.mean - cur.mean) * c.weight / (cur.weight + c.weight)
+			cur.weight += c.weight
+			continue
+		}
+		done += cur.weight
+		merged = append(merged, cur)
+		limit = this.count * this.q(this.k(done/this.count)+1)
+		cur = c
+	}
+	this.centroids = append(merged, cur)
+	this.buffer = this.buffer[:0]
+}
+
+// the estimated value at fraction q of the ordered inputs; NaN if empty.
+// As with PERCENTILE_CONT, this is the value at position q * (count - 1),
+// interpolating linearly between the centroids on either side, so that the
+// result is exact for small inputs.
+func (this *TDigest) Quantile(q float64) float64 {
+	this.compress()
+	switch {
+	case len(this.centroids) == 0:
+		return math.NaN()
+	case q <= 0:
+		return this.min
+	case q >= 1:
+		return this.max
+	}
+
+	// each centroid is taken to sit in the middle of its weight, and the
+	// smallest and largest inputs at the first and last positions
+	target := q*(this.count-1) + 0.5
+	prevPos := 0.5
+	prevVal := this.min
+	done := 0.0
+	for _, c := range this.centroids {
+		pos := done + c.weight/2
+		if target <= pos {
+			if pos <= prevPos {
+				return c.mean
+			}
+			return prevVal + (c.mean-prevVal)*(target-prevPos)/(pos-prevPos)
+		}
+		done += c.weight
+		prevPos = pos
+		prevVal = c.mean
+	}
+	pos := this.count - 0.5
+	if pos <= prevPos {
+		return this.max
+	}
+	return prevVal + (this.max-prevVal)*(target-prevPos)/(pos-prevPos)
+}
+
+func (this *TDigest) MarshalBinary() ([]byte, error) {
+	this.compress()
+	rv := make([]byte, 1, 1+8*3+16*len(this.centroids))
+	rv[0] = _TDIGEST_VERSION
+	var f [8]byte
+	for _, v := range []float64{this.compression, this.min, this.max} {
+		binary.BigEndian.PutUint64(f[:], math.Float64bits(v))
+		rv = append(rv, f[:]...)
+	}
+	for _, c := range this.centroids {
+		binary.BigEndian.PutUint64(f[:], math.Float64bits(c.mean))
+		rv = append(rv, f[:]...)
+		binary.BigEndian.PutUint64(f[:], math.Float64bits(c.weight))
+		rv = append(rv, f[:]...)
+	}
+	return rv, nil
+}
+
+func (this *TDigest) UnmarshalBinary(data []byte) error {
+	if len(data) < 1+8*3 || data[0] != _TDIGEST_VERSION || (len(data)-1-8*3)%16 != 0 {
+		return fmt.Errorf("Invalid t-digest")
+	}
+	next := func() float64 {
+		v := math.Float64frombits(binary.BigEndian.Uint64(data[:8]))
+		data = data[8:]
+		return v
+	}
+	data = data[1:]
+	this.compression = next()
+	this.min = next()
+	this.max = next()
+	this.centroids = make([]centroid, 0, len(data)/16)
+	this.buffer = nil
+	this.count = 0
+	for len(data) > 0 {
+		c := centroid{next(), next()}
+		if math.IsNaN(c.mean) || !(c.weight > 0) {
+			return fmt.Errorf("Invalid t-digest")
+		}
+		this.count += c.weight
+		this.centroids = append(this.centroids, c)
+	}
+	if this.compression < 10 {
+		return fmt.Errorf("Invalid t-digest")
+	}
+	return nil
+}
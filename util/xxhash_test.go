@@ -0,0 +1,31 @@
+//  Copyright 2021-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included in
+//  the file licenses/Couchbase-BSL.txt.  As of the Change Date specified in that
+//  file, in accordance with the Business Source License, use of this software will
+//  be governed by the Apache License, Version 2.0, included in the file
+//  licenses/APL.txt.
+
+package util
+
+import (
+	"testing"
+)
+
+func TestXXHash(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		hash  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"asdf", 0x415872f599cea71e},
+		{"Call me Ishmael. Some years ago--never mind how long precisely-", 0x02a2e85470d6fd96},
+	} {
+		s := XXHashSum64([]byte(c.input))
+
+		if s != c.hash {
+			t.Errorf("Expected 0x%x for %q, got 0x%x", c.hash, c.input, s)
+		}
+	}
+}